@@ -0,0 +1,31 @@
+// Command natsd runs a minimal NATS server for trying out the NATS event publisher locally:
+//
+//	go run ./cmd/natsd -addr :4222
+//
+// It is not a replacement for a real NATS server.
+package main
+
+import (
+	"flag"
+	"github.com/harsha-aqfer/todo/internal/natsd"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	addr := flag.String("addr", ":4222", "listen address")
+	flag.Parse()
+
+	s, err := natsd.Listen(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", s.Addr())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+
+	_ = s.Close()
+}
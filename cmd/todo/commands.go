@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/harsha-aqfer/todo/pkg/client"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+func login(a *app, args []string) error {
+	fs := a.flags("login")
+	email := fs.String("email", "", "email address, asked for if not given")
+
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+
+	cr, err := a.loadCredentials()
+	if err != nil {
+		return err
+	}
+	server := a.serverURL(cr)
+
+	if *email == "" {
+		if *email, err = a.prompt("Email: "); err != nil {
+			return err
+		}
+	}
+
+	password, err := a.readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	c := client.New(server)
+
+	err = c.SignIn(a.ctx, *email, password)
+
+	var mfa *client.MFARequiredError
+	if errors.As(err, &mfa) {
+		code, perr := a.prompt("Authentication code: ")
+		if perr != nil {
+			return perr
+		}
+		err = c.SignInMFA(a.ctx, mfa.Challenge.MFAToken, code)
+	}
+
+	// A rejected password is not a session to renew, which is what run says about ErrUnauthorized.
+	var e *client.Error
+	if errors.As(err, &e) {
+		return fmt.Errorf("could not sign in to %s: %s", server, e.Message)
+	} else if err != nil {
+		return err
+	}
+
+	if err = a.saveCredentials(&credentials{Server: server, Email: *email, Token: c.Token()}); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "Signed in to %s as %s.\n", server, *email)
+	return nil
+}
+
+func logout(a *app, args []string) error {
+	if _, err := a.parse(a.flags("logout"), args); err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	// The credentials go either way; a session the server no longer knows is over already.
+	if err = c.SignOut(a.ctx); err != nil && !errors.Is(err, client.ErrUnauthorized) {
+		a.warn("could not sign out: %v", err)
+	}
+	if err = a.removeCredentials(); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stderr, "Signed out.")
+	return nil
+}
+
+// todoFlags are the fields of a todo add and edit take.
+type todoFlags struct {
+	priority, category, due, recurrence string
+	project                             int64
+}
+
+func (a *app) todoFlags(name string) (*todoFlags, *flag.FlagSet) {
+	var (
+		tf = &todoFlags{}
+		fs = a.flags(name)
+	)
+	fs.StringVar(&tf.priority, "p", "", "priority: low, medium or high")
+	fs.StringVar(&tf.category, "c", "", "category, such as work or home")
+	fs.StringVar(&tf.due, "due", "", "due date: 2006-01-02, \"2006-01-02 15:04\" or RFC 3339")
+	fs.StringVar(&tf.recurrence, "r", "", "recurrence rule, such as FREQ=WEEKLY;BYDAY=MO")
+	fs.Int64Var(&tf.project, "project", 0, "project ID")
+	return tf, fs
+}
+
+// request returns a todo request with the fields given as flags.
+func (tf *todoFlags) request(task string) (*pkg.TodoRequest, error) {
+	req := &pkg.TodoRequest{
+		Task:     task,
+		Priority: strings.ToLower(tf.priority),
+		Category: tf.category,
+	}
+	if tf.project != 0 {
+		req.ProjectID = &tf.project
+	}
+	if tf.recurrence != "" {
+		req.Recurrence = &tf.recurrence
+	}
+	if tf.due != "" {
+		due, err := parseDue(tf.due)
+		if err != nil {
+			return nil, err
+		}
+		req.DueAt = due
+	}
+	return req, nil
+}
+
+func add(a *app, args []string) error {
+	tf, fs := a.todoFlags("add")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	task := strings.TrimSpace(strings.Join(args, " "))
+	if task == "" {
+		return usageErr("missing task, as in todo add \"fix flaky test\" -p high")
+	}
+
+	// Priorities are required; most todos are neither urgent nor important.
+	if tf.priority == "" {
+		tf.priority = "low"
+	}
+
+	req, err := tf.request(task)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	todo, err := c.CreateTodo(a.ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.printTodos([]pkg.TodoResponse{*todo})
+}
+
+func ls(a *app, args []string) error {
+	fs := a.flags("ls")
+	var (
+		all   = fs.Bool("all", false, "include todos that are done")
+		sort  = fs.String("sort", "", "sort order, such as due_asc or priority_desc,position")
+		query = fs.String("q", "", "search query, such as \"priority:high due:<today\"")
+	)
+
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	var todos []pkg.TodoResponse
+	if *query != "" {
+		// Searches include todos that are done unless the query says otherwise.
+		q := *query
+		if !*all && !strings.Contains(q, "is:") {
+			q += " is:open"
+		}
+		todos, err = c.SearchTodos(a.ctx, q, *sort).All()
+	} else {
+		todos, err = c.ListTodos(a.ctx, &client.ListOptions{All: *all, Sort: *sort})
+	}
+	if err != nil {
+		return err
+	}
+	return a.printTodos(todos)
+}
+
+func done(a *app, args []string) error {
+	args, err := a.parse(a.flags("done"), args)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	todos := make([]pkg.TodoResponse, 0, len(ids))
+	for _, id := range ids {
+		if err = c.CompleteTodo(a.ctx, id); err != nil {
+			return err
+		}
+
+		todo, err := c.GetTodo(a.ctx, id)
+		if err != nil {
+			return err
+		}
+		todos = append(todos, *todo)
+	}
+	return a.printTodos(todos)
+}
+
+func edit(a *app, args []string) error {
+	tf, fs := a.todoFlags("edit")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return usageErr("missing todo ID, as in todo edit 42 \"new task\" -p high")
+	}
+
+	ids, err := parseIDs(args[:1])
+	if err != nil {
+		return err
+	}
+
+	req, err := tf.request(strings.TrimSpace(strings.Join(args[1:], " ")))
+	if err != nil {
+		return err
+	}
+	if req.IsZero() {
+		return usageErr("nothing to change, give a new task or flags such as -p high")
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	// The edit applies to the todo as it is now, not as someone else may change it meanwhile.
+	todo, err := c.GetTodo(a.ctx, ids[0])
+	if err != nil {
+		return err
+	}
+
+	err = c.UpdateTodo(a.ctx, todo.Id, req, client.IfMatch(todo.Revision))
+	if errors.Is(err, client.ErrPreconditionFailed) {
+		return fmt.Errorf("todo %d changed while it was edited, try again", todo.Id)
+	} else if err != nil {
+		return err
+	}
+
+	if todo, err = c.GetTodo(a.ctx, todo.Id); err != nil {
+		return err
+	}
+	return a.printTodos([]pkg.TodoResponse{*todo})
+}
+
+func rm(a *app, args []string) error {
+	args, err := a.parse(a.flags("rm"), args)
+	if err != nil {
+		return err
+	}
+
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if err = c.DeleteTodo(a.ctx, id); err != nil {
+			_ = a.printIDs("Deleted", ids[:i])
+			return err
+		}
+	}
+	return a.printIDs("Deleted", ids)
+}
+
+// readPassword asks for a password without echoing it when stdin is a terminal.
+func (a *app) readPassword(label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return a.prompt(label)
+	}
+
+	// An interrupt leaves the read blocked until the process exits, so the echo is turned back on here.
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = term.Restore(fd, state)
+		fmt.Fprintln(a.stderr)
+	}()
+
+	fmt.Fprint(a.stderr, label)
+	return a.interruptible(func() (string, error) {
+		password, err := term.ReadPassword(fd)
+		return strings.TrimSpace(string(password)), err
+	})
+}
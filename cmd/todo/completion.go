@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The completion scripts complete commands, flags and, for done, edit and rm, the IDs of open todos,
+// which they get from todo ls.
+
+const bashCompletion = `# bash completion for todo. Load it with: source <(todo completion bash)
+_todo() {
+	local cur=${COMP_WORDS[COMP_CWORD]} cmd=${COMP_WORDS[1]}
+	local common="-server -o"
+
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "login logout add ls done edit rm completion help" -- "$cur"))
+		return
+	fi
+
+	case ${COMP_WORDS[COMP_CWORD-1]} in
+	-o) COMPREPLY=($(compgen -W "table json plain" -- "$cur")); return ;;
+	-p) COMPREPLY=($(compgen -W "low medium high" -- "$cur")); return ;;
+	esac
+
+	case $cmd in
+	login) COMPREPLY=($(compgen -W "$common -email" -- "$cur")) ;;
+	logout) COMPREPLY=($(compgen -W "$common" -- "$cur")) ;;
+	add) COMPREPLY=($(compgen -W "$common -p -c -due -r -project" -- "$cur")) ;;
+	ls) COMPREPLY=($(compgen -W "$common --all -sort -q" -- "$cur")) ;;
+	edit) COMPREPLY=($(compgen -W "$common -p -c -due -r -project $(todo ls -o plain 2>/dev/null | cut -f1)" -- "$cur")) ;;
+	done|rm) COMPREPLY=($(compgen -W "$common $(todo ls -o plain 2>/dev/null | cut -f1)" -- "$cur")) ;;
+	completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	esac
+}
+complete -F _todo todo
+`
+
+const zshCompletion = `#compdef todo
+# zsh completion for todo. Load it with: source <(todo completion zsh)
+_todo_ids() {
+	local -a ids
+	ids=(${(f)"$(todo ls -o plain 2>/dev/null | awk -F'\t' '{print $1":"$6}')"})
+	_describe 'todo' ids
+}
+
+_todo() {
+	local -a common
+	common=('-server[server URL]:url:' '-o[output format]:format:(table json plain)')
+
+	if (( CURRENT == 2 )); then
+		local -a commands
+		commands=(
+			'login:sign in and store the credentials'
+			'logout:sign out and forget the credentials'
+			'add:add a todo'
+			'ls:list todos'
+			'done:mark todos done'
+			'edit:change a todo'
+			'rm:move todos to the trash'
+			'completion:print a completion script'
+		)
+		_describe 'command' commands
+		return
+	fi
+
+	local -a fields
+	fields=('-p[priority]:priority:(low medium high)' '-c[category]:category:' '-due[due date]:date:'
+		'-r[recurrence rule]:rule:' '-project[project ID]:id:')
+
+	case $words[2] in
+	login) _arguments $common '-email[email address]:email:' ;;
+	logout) _arguments $common ;;
+	add) _arguments $common $fields '*:task:' ;;
+	ls) _arguments $common '--all[include todos that are done]' '-sort[sort order]:sort:' '-q[search query]:query:' ;;
+	edit) _arguments $common $fields '1:todo:_todo_ids' '*:task:' ;;
+	done|rm) _arguments $common '*:todo:_todo_ids' ;;
+	completion) _arguments '1:shell:(bash zsh fish)' ;;
+	esac
+}
+
+compdef _todo todo
+`
+
+const fishCompletion = `# fish completion for todo. Load it with: todo completion fish | source
+set -l commands login logout add ls done edit rm completion help
+
+complete -c todo -f
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a login -d 'sign in and store the credentials'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a logout -d 'sign out and forget the credentials'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a add -d 'add a todo'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a ls -d 'list todos'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a done -d 'mark todos done'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a edit -d 'change a todo'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a rm -d 'move todos to the trash'
+complete -c todo -n "not __fish_seen_subcommand_from $commands" -a completion -d 'print a completion script'
+
+complete -c todo -n "__fish_seen_subcommand_from $commands" -o server -r -d 'server URL'
+complete -c todo -n "__fish_seen_subcommand_from $commands" -o o -x -a 'table json plain' -d 'output format'
+complete -c todo -n "__fish_seen_subcommand_from login" -o email -x -d 'email address'
+complete -c todo -n "__fish_seen_subcommand_from add edit" -o p -x -a 'low medium high' -d 'priority'
+complete -c todo -n "__fish_seen_subcommand_from add edit" -o c -x -d 'category'
+complete -c todo -n "__fish_seen_subcommand_from add edit" -o due -x -d 'due date'
+complete -c todo -n "__fish_seen_subcommand_from add edit" -o r -x -d 'recurrence rule'
+complete -c todo -n "__fish_seen_subcommand_from add edit" -o project -x -d 'project ID'
+complete -c todo -n "__fish_seen_subcommand_from ls" -l all -d 'include todos that are done'
+complete -c todo -n "__fish_seen_subcommand_from ls" -o sort -x -d 'sort order'
+complete -c todo -n "__fish_seen_subcommand_from ls" -o q -x -d 'search query'
+complete -c todo -n "__fish_seen_subcommand_from done edit rm" -a "(todo ls -o plain 2>/dev/null | awk -F'\t' '{print \$1\"\t\"\$6}')"
+complete -c todo -n "__fish_seen_subcommand_from completion" -a 'bash zsh fish'
+`
+
+var completions = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func completion(a *app, args []string) error {
+	if len(args) != 1 {
+		return usageErr("expected a shell: todo completion bash|zsh|fish")
+	}
+
+	script, ok := completions[args[0]]
+	if !ok {
+		return usageErr("unknown shell %q, expected bash, zsh or fish", args[0])
+	}
+	_, err := fmt.Fprint(a.stdout, script)
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/harsha-aqfer/todo/pkg/client"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultServer = "http://localhost:3030"
+
+// credentials are what login stores: the server signed in to and the token of the session.
+type credentials struct {
+	Server string     `json:"server"`
+	Email  string     `json:"email,omitempty"`
+	Token  *pkg.Token `json:"token,omitempty"`
+}
+
+func (a *app) credentialsPath() string {
+	return filepath.Join(a.configDir, "todo", "credentials.json")
+}
+
+// loadCredentials returns the stored credentials, which are empty before the first login.
+func (a *app) loadCredentials() (*credentials, error) {
+	cr := &credentials{}
+
+	data, err := os.ReadFile(a.credentialsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return cr, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, cr); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// saveCredentials stores the credentials where only the user can read them. The file is replaced at
+// once, so that commands running at the same time don't read half of it.
+func (a *app) saveCredentials(cr *credentials) error {
+	path := a.credentialsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cr, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (a *app) removeCredentials() error {
+	err := os.Remove(a.credentialsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// serverURL returns the server given with -server or $TODO_SERVER, or else the one of the last login.
+func (a *app) serverURL(cr *credentials) string {
+	switch {
+	case a.server != "":
+		return strings.TrimRight(a.server, "/")
+	case cr.Server != "":
+		return cr.Server
+	}
+	return defaultServer
+}
+
+// client returns a client of the server with the stored token, if it is for that server. Tokens the
+// client refreshes are stored in turn.
+func (a *app) client() (*client.Client, error) {
+	cr, err := a.loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	server := a.serverURL(cr)
+	c := client.New(server)
+
+	if cr.Token != nil && cr.Server == server {
+		c.SetToken(cr.Token)
+		c.OnToken = func(t *pkg.Token) {
+			cr.Token = t
+			if err := a.saveCredentials(cr); err != nil {
+				a.warn("could not store the refreshed token: %v", err)
+			}
+		}
+	}
+	return c, nil
+}
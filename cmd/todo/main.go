@@ -0,0 +1,201 @@
+// Command todo manages the todos of a todo server from the terminal:
+//
+//	todo login -server https://todo.example.com
+//	todo add "fix flaky test" -p high -c work
+//	todo ls --all
+//	todo done 42
+//
+// Credentials are kept in the user's config directory. Run "todo help" for all commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg/client"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+const usage = `Usage: todo <command> [arguments]
+
+Commands:
+  login       sign in and store the credentials
+  logout      sign out and forget the credentials
+  add         add a todo: todo add "task" [-p priority] [-c category] [-due date]
+  ls          list open todos, or all with --all; -q searches
+  done        mark todos done: todo done ID...
+  edit        change a todo: todo edit ID ["task"] [-p priority] [-c category] [-due date]
+  rm          move todos to the trash: todo rm ID...
+  completion  print a completion script: todo completion bash|zsh|fish
+
+Flags of every command:
+  -server URL    server to use, or $TODO_SERVER (default: the server of the last login)
+  -o FORMAT      output format: table, json or plain (default: table)
+`
+
+// command runs a subcommand with the arguments after its name.
+type command func(a *app, args []string) error
+
+var commands = map[string]command{
+	"login":      login,
+	"logout":     logout,
+	"add":        add,
+	"ls":         ls,
+	"done":       done,
+	"edit":       edit,
+	"rm":         rm,
+	"completion": completion,
+}
+
+// app is what commands share: where the credentials are, the server and the output.
+type app struct {
+	ctx       context.Context
+	configDir string
+	server    string
+	output    string
+
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "todo:", err)
+		os.Exit(1)
+	}
+
+	a := &app{
+		ctx:       ctx,
+		configDir: dir,
+		stdin:     bufio.NewReader(os.Stdin),
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+	}
+	os.Exit(a.run(os.Args[1:]))
+}
+
+// run runs the command line and returns the exit status.
+func (a *app) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(a.stdout, usage)
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.stderr, "todo: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := cmd(a, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, context.Canceled):
+		// Interrupted, like a shell reports for SIGINT.
+		return 130
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(a.stderr, "todo:", err)
+		return 2
+	case errors.Is(err, client.ErrUnauthorized):
+		fmt.Fprintln(a.stderr, "todo: not signed in or the session expired, run todo login")
+		return 1
+	}
+
+	// Messages of the server say what went wrong well enough on their own.
+	var e *client.Error
+	if errors.As(err, &e) && err == error(e) {
+		fmt.Fprintln(a.stderr, "todo:", e.Message)
+	} else {
+		fmt.Fprintln(a.stderr, "todo:", err)
+	}
+	return 1
+}
+
+// errUsage marks errors in the command line.
+var errUsage = errors.New("usage")
+
+func usageErr(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, args...))
+}
+
+// flags returns the flag set of a command with the flags every command has.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&a.server, "server", os.Getenv("TODO_SERVER"), "server URL")
+	fs.StringVar(&a.output, "o", "table", "output format: table, json or plain")
+	return fs
+}
+
+// parse parses flags that may come before, between or after the positional arguments, as in
+// todo add "task" -p high, and returns the positional arguments. Arguments after "--" are positional.
+func (a *app) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if consumed := args[:len(args)-len(rest)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional, args = append(positional, rest[0]), rest[1:]
+	}
+
+	switch a.output {
+	case outputTable, outputJSON, outputPlain:
+	default:
+		return nil, usageErr("unknown output format %q, expected table, json or plain", a.output)
+	}
+	return positional, nil
+}
+
+// prompt asks for a line of input.
+func (a *app) prompt(label string) (string, error) {
+	fmt.Fprint(a.stderr, label)
+	return a.interruptible(func() (string, error) {
+		line, err := a.stdin.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	})
+}
+
+// interruptible returns what read returns, or the error of the context once the command is interrupted.
+func (a *app) interruptible(read func() (string, error)) (string, error) {
+	type result struct {
+		s   string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		s, err := read()
+		done <- result{s, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.s, r.err
+	case <-a.ctx.Done():
+		return "", a.ctx.Err()
+	}
+}
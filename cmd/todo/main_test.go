@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers the calls of the commands like the API does, for a user with the password
+// "secret".
+type fakeServer struct {
+	mu     sync.Mutex
+	todos  []*pkg.TodoResponse
+	tokens int
+}
+
+func (fs *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	reply := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	if r.URL.Path == "/v1/sign_in" {
+		var u pkg.User
+		_ = json.NewDecoder(r.Body).Decode(&u)
+		if u.Password != "secret" {
+			reply(http.StatusUnauthorized, pkg.NewMsgResp("invalid email or password"))
+			return
+		}
+		fs.tokens++
+		reply(http.StatusOK, &pkg.Token{ExpiresIn: 3600, JWTToken: fmt.Sprintf("jwt%d", fs.tokens), RefreshToken: "refresh"})
+		return
+	}
+
+	if r.Header.Get("Authorization") != fmt.Sprintf("Bearer jwt%d", fs.tokens) {
+		reply(http.StatusUnauthorized, pkg.NewMsgResp("Unauthorized"))
+		return
+	}
+
+	if r.URL.Path == "/v1/todos" {
+		if r.Method == http.MethodPost {
+			var req pkg.TodoRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			t := &pkg.TodoResponse{Id: int64(len(fs.todos) + 1), Task: req.Task, Priority: req.Priority, Category: req.Category, DueAt: req.DueAt, Revision: 1}
+			if t.Category == "" {
+				t.Category = "work"
+			}
+			fs.todos = append(fs.todos, t)
+			reply(http.StatusOK, t)
+			return
+		}
+
+		todos := []pkg.TodoResponse{}
+		for _, t := range fs.todos {
+			if t.DeletedAt == nil && (t.CompletedAt == nil || r.URL.Query().Get("all") == "true") {
+				todos = append(todos, *t)
+			}
+		}
+		reply(http.StatusOK, todos)
+		return
+	}
+
+	id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/todos/"), 10, 64)
+
+	var t *pkg.TodoResponse
+	for _, o := range fs.todos {
+		if o.Id == id && o.DeletedAt == nil {
+			t = o
+		}
+	}
+
+	switch {
+	case t == nil && r.Method == http.MethodGet:
+		reply(http.StatusOK, nil)
+	case t == nil:
+		reply(http.StatusNotFound, pkg.NewMsgResp(fmt.Sprintf("no such todo: %d", id)))
+	case r.Method == http.MethodGet:
+		reply(http.StatusOK, t)
+	case r.Method == http.MethodPut:
+		if m := r.Header.Get("If-Match"); m != "" && m != fmt.Sprintf(`"%d"`, t.Revision) {
+			reply(http.StatusPreconditionFailed, pkg.NewMsgResp("modified"))
+			return
+		}
+		var req pkg.TodoRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Task != "" {
+			t.Task = req.Task
+		}
+		if req.Priority != "" {
+			t.Priority = req.Priority
+		}
+		if req.Done {
+			now := time.Now()
+			t.CompletedAt = &now
+		}
+		t.Revision++
+		reply(http.StatusOK, nil)
+	case r.Method == http.MethodDelete:
+		now := time.Now()
+		t.DeletedAt = &now
+		reply(http.StatusOK, nil)
+	}
+}
+
+type testApp struct {
+	*app
+	out, errs *bytes.Buffer
+}
+
+// newTestApp returns an app with its config in a temporary directory, for the server at url.
+func newTestApp(t *testing.T, url string) *testApp {
+	ta := &testApp{out: &bytes.Buffer{}, errs: &bytes.Buffer{}}
+	ta.app = &app{ctx: context.Background(), configDir: t.TempDir(), stdout: ta.out, stderr: ta.errs}
+	t.Setenv("TODO_SERVER", url)
+	return ta
+}
+
+// run runs a command line with input, and returns its exit status and output.
+func (ta *testApp) run(input string, args ...string) (int, string) {
+	ta.out.Reset()
+	ta.errs.Reset()
+	ta.stdin = bufio.NewReader(strings.NewReader(input))
+	return ta.app.run(args), ta.out.String()
+}
+
+func Test_Commands(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		srv    = httptest.NewServer(&fakeServer{})
+		a      = newTestApp(t, srv.URL)
+	)
+	defer srv.Close()
+
+	code, _ := a.run("", "ls")
+	assert.Equal(1, code)
+	assert.Equal("todo: not signed in or the session expired, run todo login\n", a.errs.String())
+
+	code, _ = a.run("ann@example.com\nwrong\n", "login")
+	assert.Equal(1, code)
+	assert.Contains(a.errs.String(), "could not sign in to "+srv.URL+": invalid email or password")
+
+	code, _ = a.run("secret\n", "login", "-email", "ann@example.com")
+	assert.Equal(0, code)
+
+	info, err := os.Stat(a.credentialsPath())
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	cr, err := a.loadCredentials()
+	assert.NoError(err)
+	assert.Equal(srv.URL, cr.Server)
+	assert.Equal("jwt1", cr.Token.JWTToken)
+
+	code, out := a.run("", "add", "fix", "flaky test", "-p", "high", "-c", "home", "-due", "2026-11-02")
+	assert.Equal(0, code)
+	assert.Equal("ID  DONE  PRIORITY  CATEGORY  DUE         TASK\n1         high      home      2026-11-02  fix flaky test\n", out)
+
+	code, _ = a.run("", "add", "-o", "plain", "--", "-p is not a flag here")
+	assert.Equal(0, code)
+
+	code, out = a.run("", "done", "2", "-o", "plain")
+	assert.Equal(0, code)
+	assert.Equal("2\ttrue\tlow\twork\t-\t-p is not a flag here\n", out)
+
+	code, out = a.run("", "ls", "-o", "plain")
+	assert.Equal(0, code)
+	assert.Equal("1\tfalse\thigh\thome\t2026-11-02\tfix flaky test\n", out)
+
+	code, out = a.run("", "ls", "--all", "-o", "json")
+	assert.Equal(0, code)
+	var todos []pkg.TodoResponse
+	assert.NoError(json.Unmarshal([]byte(out), &todos))
+	assert.Len(todos, 2)
+
+	code, out = a.run("", "edit", "1", "fix the flaky test", "-p", "medium", "-o", "plain")
+	assert.Equal(0, code)
+	assert.Equal("1\tfalse\tmedium\thome\t2026-11-02\tfix the flaky test\n", out)
+
+	code, _ = a.run("", "edit", "1")
+	assert.Equal(2, code)
+
+	code, out = a.run("", "rm", "1", "2", "-o", "json")
+	assert.Equal(0, code)
+	assert.JSONEq(`{"deleted": [1, 2]}`, out)
+
+	code, _ = a.run("", "rm", "1")
+	assert.Equal(1, code)
+	assert.Equal("todo: no such todo: 1\n", a.errs.String())
+
+	code, out = a.run("", "ls")
+	assert.Equal(0, code)
+	assert.Equal("No todos.\n", out)
+
+	code, _ = a.run("", "logout")
+	assert.Equal(0, code)
+	_, err = os.Stat(a.credentialsPath())
+	assert.True(os.IsNotExist(err))
+}
+
+func Test_Parse(t *testing.T) {
+	assert := asserts.New(t)
+
+	a := &app{stderr: &bytes.Buffer{}}
+	fs := a.flags("ls")
+	all := fs.Bool("all", false, "")
+
+	args, err := a.parse(fs, []string{"a", "--all", "b", "-o", "json", "--", "-c"})
+	assert.NoError(err)
+	assert.Equal([]string{"a", "b", "-c"}, args)
+	assert.True(*all)
+	assert.Equal(outputJSON, a.output)
+
+	_, err = parseIDs([]string{"4", "x"})
+	assert.EqualError(err, `usage: invalid todo ID "x"`)
+
+	due, err := parseDue("2026-11-02")
+	assert.NoError(err)
+	assert.Equal("2026-11-02", formatDue(due, time.RFC3339))
+
+	_, err = parseDue("next week")
+	assert.Error(err)
+
+	code := (&app{stdout: &bytes.Buffer{}, stderr: &bytes.Buffer{}}).run([]string{"completion", "tcsh"})
+	assert.Equal(2, code)
+}
+
+func Test_InterruptedPrompt(t *testing.T) {
+	assert := asserts.New(t)
+
+	ta := newTestApp(t, "http://127.0.0.1:1")
+	ctx, cancel := context.WithCancel(context.Background())
+	ta.ctx = ctx
+
+	// The input never comes, so only the interrupt ends the prompt.
+	r, w := io.Pipe()
+	defer w.Close()
+	ta.stdin = bufio.NewReader(r)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	assert.Equal(130, ta.app.run([]string{"login"}))
+	assert.Equal("Email: ", ta.errs.String())
+}
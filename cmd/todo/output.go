@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats. Plain is a line of tab-separated fields per todo, without header, for scripts.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputPlain = "plain"
+)
+
+func (a *app) printJSON(v interface{}) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTodos prints todos in the output format.
+func (a *app) printTodos(todos []pkg.TodoResponse) error {
+	switch a.output {
+	case outputJSON:
+		if todos == nil {
+			todos = []pkg.TodoResponse{}
+		}
+		return a.printJSON(todos)
+
+	case outputPlain:
+		for _, t := range todos {
+			fmt.Fprintf(a.stdout, "%d\t%t\t%s\t%s\t%s\t%s\n",
+				t.Id, t.CompletedAt != nil, t.Priority, t.Category, formatDue(t.DueAt, time.RFC3339), oneLine(t.Task))
+		}
+		return nil
+	}
+
+	if len(todos) == 0 {
+		fmt.Fprintln(a.stdout, "No todos.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDONE\tPRIORITY\tCATEGORY\tDUE\tTASK")
+	for _, t := range todos {
+		check := ""
+		if t.CompletedAt != nil {
+			check = "x"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			t.Id, check, t.Priority, t.Category, formatDue(t.DueAt, "2006-01-02 15:04"), oneLine(t.Task))
+	}
+	return w.Flush()
+}
+
+// printIDs reports the todos a command changed without printing them, as rm does.
+func (a *app) printIDs(verb string, ids []int64) error {
+	if a.output == outputJSON {
+		return a.printJSON(map[string][]int64{strings.ToLower(verb): ids})
+	}
+
+	for _, id := range ids {
+		if a.output == outputPlain {
+			fmt.Fprintln(a.stdout, id)
+		} else {
+			fmt.Fprintf(a.stdout, "%s todo %d.\n", verb, id)
+		}
+	}
+	return nil
+}
+
+func (a *app) warn(format string, args ...interface{}) {
+	fmt.Fprintf(a.stderr, "todo: "+format+"\n", args...)
+}
+
+// formatDue returns a due time in the local zone, as a date if it is at midnight, which is how dates
+// without time are stored.
+func formatDue(due *time.Time, layout string) string {
+	if due == nil {
+		return "-"
+	}
+	if due.UTC().Hour() == 0 && due.UTC().Minute() == 0 && due.UTC().Second() == 0 {
+		return due.UTC().Format("2006-01-02")
+	}
+	return due.Local().Format(layout)
+}
+
+// parseDue reads a date, a date and time in the local zone, or an RFC 3339 time.
+func parseDue(s string) (*time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return &t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	return nil, usageErr("invalid due date %q, expected 2006-01-02, \"2006-01-02 15:04\" or RFC 3339", s)
+}
+
+func parseIDs(args []string) ([]int64, error) {
+	if len(args) == 0 {
+		return nil, usageErr("missing todo ID")
+	}
+
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, usageErr("invalid todo ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// oneLine keeps multi-line tasks from breaking tables and plain output.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
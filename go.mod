@@ -11,6 +11,9 @@ require (
 	github.com/labstack/echo/v4 v4.10.0
 	github.com/satori/go.uuid v1.2.0
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/crypto v0.2.0
+	golang.org/x/net v0.4.0
+	golang.org/x/term v0.10.0
 )
 
 require (
@@ -22,9 +25,7 @@ require (
 	github.com/stretchr/objx v0.5.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
-	golang.org/x/crypto v0.2.0 // indirect
-	golang.org/x/net v0.4.0 // indirect
-	golang.org/x/sys v0.3.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.5.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
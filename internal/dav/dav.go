@@ -0,0 +1,252 @@
+// Package dav reads WebDAV request bodies and writes multistatus responses (RFC 4918), with the names
+// that CalDAV (RFC 4791) and collection synchronization (RFC 6578) add.
+package dav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Namespaces.
+const (
+	NS             = "DAV:"
+	NSCalDAV       = "urn:ietf:params:xml:ns:caldav"
+	NSCalendarServ = "http://calendarserver.org/ns/"
+	NSAppleICal    = "http://apple.com/ns/ical/"
+)
+
+// maxBodySize bounds the request bodies Parse reads.
+const maxBodySize = 1 << 20
+
+// prefixes are the namespace prefixes of responses. Other namespaces are declared on their elements.
+var prefixes = map[string]string{NS: "d", NSCalDAV: "c", NSCalendarServ: "cs", NSAppleICal: "ical"}
+
+func Name(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+// Element is an XML element of a request body.
+type Element struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Children []*Element
+	Text     string
+}
+
+// Attr returns the value of the attribute without namespace, such as the name of a comp-filter.
+func (e *Element) Attr(local string) string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.Attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first child with the name, or nil.
+func (e *Element) Child(name xml.Name) *Element {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// All returns the children with the name.
+func (e *Element) All(name xml.Name) []*Element {
+	var r []*Element
+	if e == nil {
+		return r
+	}
+	for _, c := range e.Children {
+		if c.Name == name {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// Names returns the names of the children, such as the properties of a prop element.
+func (e *Element) Names() []xml.Name {
+	var r []xml.Name
+	if e == nil {
+		return r
+	}
+	for _, c := range e.Children {
+		r = append(r, c.Name)
+	}
+	return r
+}
+
+// Parse reads an XML body into a tree. An empty body gives a nil element.
+func Parse(r io.Reader) (*Element, error) {
+	var (
+		d     = xml.NewDecoder(io.LimitReader(r, maxBodySize))
+		stack []*Element
+		root  *Element
+	)
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			if len(stack) != 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return root, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &Element{Name: t.Name, Attrs: t.Copy().Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += strings.TrimSpace(string(t))
+			}
+		}
+	}
+}
+
+// Prop is a property value. Inner is the XML content of the property element.
+type Prop struct {
+	Name  xml.Name
+	Inner string
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// TextProp returns a property with a text value.
+func TextProp(name xml.Name, value string) Prop {
+	return Prop{Name: name, Inner: escape(value)}
+}
+
+// HrefProp returns a property holding a href, such as DAV:current-user-principal.
+func HrefProp(name xml.Name, href string) Prop {
+	return Prop{Name: name, Inner: "<d:href>" + escape(Href(href)) + "</d:href>"}
+}
+
+// URLProp returns a property holding a href that is a URL rather than a path, such as a mailto: URL.
+func URLProp(name xml.Name, u string) Prop {
+	return Prop{Name: name, Inner: "<d:href>" + escape(u) + "</d:href>"}
+}
+
+// Href escapes a path for a href element.
+func Href(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// element formats an element, declaring its namespace unless it has a common prefix.
+func element(name xml.Name, inner string) string {
+	if p, ok := prefixes[name.Space]; ok {
+		if inner == "" {
+			return fmt.Sprintf("<%s:%s/>", p, name.Local)
+		}
+		return fmt.Sprintf("<%s:%s>%s</%s:%s>", p, name.Local, inner, p, name.Local)
+	}
+
+	if inner == "" {
+		return fmt.Sprintf(`<x:%s xmlns:x="%s"/>`, name.Local, escape(name.Space))
+	}
+	return fmt.Sprintf(`<x:%s xmlns:x="%s">%s</x:%s>`, name.Local, escape(name.Space), inner, name.Local)
+}
+
+// Raw returns the XML of an element with the given content, for building property values.
+func Raw(name xml.Name, inner string) string {
+	return element(name, inner)
+}
+
+// Response is a response of a multistatus. Responses with a Status have no properties, as the members
+// removed in a sync report.
+type Response struct {
+	Href     string
+	Found    []Prop
+	NotFound []xml.Name
+	Status   int
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// Multistatus collects responses. SyncToken is set for sync-collection reports.
+type Multistatus struct {
+	Responses []Response
+	SyncToken string
+}
+
+func (ms *Multistatus) Add(r Response) {
+	ms.Responses = append(ms.Responses, r)
+}
+
+// Bytes renders the multistatus document.
+func (ms *Multistatus) Bytes() []byte {
+	var b bytes.Buffer
+
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/" xmlns:ical="http://apple.com/ns/ical/">`)
+
+	for _, r := range ms.Responses {
+		b.WriteString("<d:response><d:href>" + escape(Href(r.Href)) + "</d:href>")
+
+		if r.Status != 0 {
+			b.WriteString(statusLine(r.Status))
+		}
+
+		if len(r.Found) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, p := range r.Found {
+				b.WriteString(element(p.Name, p.Inner))
+			}
+			b.WriteString("</d:prop>" + statusLine(http.StatusOK) + "</d:propstat>")
+		}
+
+		if len(r.NotFound) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, n := range r.NotFound {
+				b.WriteString(element(n, ""))
+			}
+			b.WriteString("</d:prop>" + statusLine(http.StatusNotFound) + "</d:propstat>")
+		}
+
+		b.WriteString("</d:response>")
+	}
+
+	if ms.SyncToken != "" {
+		b.WriteString("<d:sync-token>" + escape(ms.SyncToken) + "</d:sync-token>")
+	}
+
+	b.WriteString("</d:multistatus>")
+	return b.Bytes()
+}
+
+// Error renders a DAV:error body with a precondition, such as DAV:valid-sync-token.
+func Error(precondition xml.Name) []byte {
+	return []byte(`<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<d:error xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` + element(precondition, "") + `</d:error>`)
+}
@@ -0,0 +1,66 @@
+package dav
+
+import (
+	"encoding/xml"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	assert := asserts.New(t)
+
+	body := `<?xml version="1.0"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+	e, err := Parse(strings.NewReader(body))
+	assert.NoError(err)
+	assert.Equal(Name(NSCalDAV, "calendar-query"), e.Name)
+	assert.Equal([]xml.Name{Name(NS, "getetag"), Name(NSCalDAV, "calendar-data")}, e.Child(Name(NS, "prop")).Names())
+
+	cal := e.Child(Name(NSCalDAV, "filter")).Child(Name(NSCalDAV, "comp-filter"))
+	assert.Equal("VCALENDAR", cal.Attr("name"))
+	assert.Equal("VTODO", cal.Child(Name(NSCalDAV, "comp-filter")).Attr("name"))
+	assert.Nil(e.Child(Name(NS, "missing")).Child(Name(NS, "prop")))
+	assert.Len(e.All(Name(NS, "prop")), 1)
+
+	e, err = Parse(strings.NewReader(`<d:sync-collection xmlns:d="DAV:"><d:sync-token> https://x/1 </d:sync-token></d:sync-collection>`))
+	assert.NoError(err)
+	assert.Equal("https://x/1", e.Child(Name(NS, "sync-token")).Text)
+
+	e, err = Parse(strings.NewReader(""))
+	assert.NoError(err)
+	assert.Nil(e)
+
+	_, err = Parse(strings.NewReader(`<d:propfind xmlns:d="DAV:">`))
+	assert.Error(err)
+}
+
+func Test_Multistatus(t *testing.T) {
+	assert := asserts.New(t)
+
+	ms := &Multistatus{SyncToken: "https://todo.example.com/dav/sync/1"}
+	ms.Add(Response{
+		Href:     "/dav/calendars/1-inbox/a b.ics",
+		Found:    []Prop{TextProp(Name(NS, "getetag"), `"3"`), {Name: Name(NS, "resourcetype")}, HrefProp(Name(NS, "current-user-principal"), "/dav/principal/")},
+		NotFound: []xml.Name{Name("urn:x", "color")},
+	})
+	ms.Add(Response{Href: "/dav/calendars/1-inbox/gone.ics", Status: http.StatusNotFound})
+
+	assert.Equal(`<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/" xmlns:ical="http://apple.com/ns/ical/">`+
+		`<d:response><d:href>/dav/calendars/1-inbox/a%20b.ics</d:href>`+
+		`<d:propstat><d:prop><d:getetag>&#34;3&#34;</d:getetag><d:resourcetype/><d:current-user-principal><d:href>/dav/principal/</d:href></d:current-user-principal></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>`+
+		`<d:propstat><d:prop><x:color xmlns:x="urn:x"/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat></d:response>`+
+		`<d:response><d:href>/dav/calendars/1-inbox/gone.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`+
+		`<d:sync-token>https://todo.example.com/dav/sync/1</d:sync-token></d:multistatus>`,
+		string(ms.Bytes()))
+
+	// The document has to be well-formed.
+	_, err := Parse(strings.NewReader(string(ms.Bytes())))
+	assert.NoError(err)
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/outbox"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type ActivityDB interface {
+	ListTodoHistory(orgID, userID, todoID int64, limit, offset int) ([]pkg.TodoActivity, error)
+	ListActivity(orgID, userID int64, limit, offset int) ([]pkg.TodoActivity, error)
+}
+
+type activityStore struct {
+	db *sql.DB
+}
+
+func NewActivityStore(db *sql.DB) ActivityDB {
+	return &activityStore{db: db}
+}
+
+// todoActivity identifies a mutation of a todo for the activity log.
+type todoActivity struct {
+	orgID  int64
+	userID int64
+	todoID int64
+	actor  *pkg.Actor
+	action string
+}
+
+// lockTodo reads the logged fields of a todo and locks its row for the rest of the transaction. It only
+// finds todos in the trash if trashed is set, and only the others otherwise.
+func lockTodo(tx *sql.Tx, orgID, userID, todoID int64, trashed bool) (map[string]interface{}, error) {
+	query := "SELECT task, done, category, priority, project_id, due_at, recurrence FROM todo WHERE org_id = ? AND user_id = ? AND id = ?"
+	if trashed {
+		query += " AND deleted_at IS NOT NULL FOR UPDATE"
+	} else {
+		query += " AND deleted_at IS NULL FOR UPDATE"
+	}
+	row := tx.QueryRow(query, orgID, userID, todoID)
+
+	var (
+		task, category, priority string
+		recurrence               string
+		done                     bool
+		pid                      sql.NullInt64
+		due                      sql.NullTime
+	)
+
+	err := row.Scan(&task, &done, &category, &priority, &pid, &due, &recurrence)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	} else if err != nil {
+		return nil, err
+	}
+
+	r := map[string]interface{}{
+		"task":       task,
+		"done":       done,
+		"category":   category,
+		"priority":   priority,
+		"project_id": nil,
+		"due_at":     nil,
+		"recurrence": nil,
+	}
+	if pid.Valid {
+		r["project_id"] = pid.Int64
+	}
+	if due.Valid {
+		r["due_at"] = due.Time.UTC().Format(time.RFC3339)
+	}
+	if recurrence != "" {
+		r["recurrence"] = recurrence
+	}
+	return r, nil
+}
+
+// diffTodo returns the fields that differ between two states of a todo. A nil state stands for a todo
+// that does not exist (yet, or any more), so that every field of the other state is reported.
+func diffTodo(before, after map[string]interface{}) map[string]pkg.FieldChange {
+	changes := make(map[string]pkg.FieldChange)
+
+	for _, state := range []map[string]interface{}{before, after} {
+		for field := range state {
+			if before[field] != after[field] {
+				changes[field] = pkg.FieldChange{From: before[field], To: after[field]}
+			}
+		}
+	}
+	return changes
+}
+
+func recordActivity(tx *sql.Tx, a *todoActivity, changes map[string]pkg.FieldChange) error {
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT todo_activity SET org_id = ?, user_id = ?, todo_id = ?, actor_id = ?, client_id = ?, action = ?, changes = ?",
+		a.orgID, a.userID, a.todoID, a.actor.UserID, a.actor.ClientID, a.action, string(raw),
+	)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"org_id":    a.orgID,
+		"user_id":   a.userID,
+		"todo_id":   a.todoID,
+		"actor_id":  a.actor.UserID,
+		"client_id": a.actor.ClientID,
+		"changes":   changes,
+	}
+	if err = writeEvent(tx, todoEventType(a.action, changes), outbox.AggregateTodo, a.todoID, payload); err != nil {
+		return err
+	}
+
+	if event := webhookEvent(a.action, changes); event != "" {
+		return enqueueTodoEvent(tx, a.orgID, a.userID, a.todoID, event)
+	}
+	return nil
+}
+
+// todoEventType returns the domain event of an activity. Updates that complete the todo are reported
+// as completions.
+func todoEventType(action string, changes map[string]pkg.FieldChange) string {
+	switch action {
+	case pkg.ActivityCreate:
+		return outbox.TodoCreated
+	case pkg.ActivityDelete:
+		return outbox.TodoDeleted
+	case pkg.ActivityRestore:
+		return outbox.TodoRestored
+	case pkg.ActivityPurge:
+		return outbox.TodoPurged
+	}
+
+	if c, ok := changes["done"]; ok && c.To == true {
+		return outbox.TodoCompleted
+	}
+	return outbox.TodoUpdated
+}
+
+const activityColumns = "a.id, a.todo_id, a.actor_id, u.email, a.client_id, a.action, a.changes, a.created_at"
+
+func (as *activityStore) listActivity(where string, args ...interface{}) ([]pkg.TodoActivity, error) {
+	rows, err := as.db.Query(
+		"SELECT "+activityColumns+" FROM todo_activity a LEFT JOIN user u ON u.id = a.actor_id WHERE "+where+
+			" ORDER BY a.id DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	activities := make([]pkg.TodoActivity, 0)
+
+	for rows.Next() {
+		var (
+			r     = pkg.TodoActivity{}
+			email sql.NullString
+			raw   string
+		)
+
+		if err = rows.Scan(&r.ID, &r.TodoID, &r.ActorID, &email, &r.ClientID, &r.Action, &raw, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.ActorEmail = email.String
+
+		if err = json.Unmarshal([]byte(raw), &r.Changes); err != nil {
+			return nil, fmt.Errorf("invalid changes in activity %d: %w", r.ID, err)
+		}
+		activities = append(activities, r)
+	}
+	return activities, rows.Err()
+}
+
+// ListTodoHistory returns the activity of one todo, newest first. It includes the deletion of the todo.
+func (as *activityStore) ListTodoHistory(orgID, userID, todoID int64, limit, offset int) ([]pkg.TodoActivity, error) {
+	return as.listActivity("a.org_id = ? AND a.user_id = ? AND a.todo_id = ?", orgID, userID, todoID, limit, offset)
+}
+
+// ListActivity returns the activity on every todo of the user in the organization, newest first.
+func (as *activityStore) ListActivity(orgID, userID int64, limit, offset int) ([]pkg.TodoActivity, error) {
+	return as.listActivity("a.org_id = ? AND a.user_id = ?", orgID, userID, limit, offset)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/harsha-aqfer/todo/internal/outbox"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_DiffTodo(t *testing.T) {
+	assert := asserts.New(t)
+
+	before := map[string]interface{}{"task": "a", "done": false, "priority": "low", "project_id": nil}
+	after := map[string]interface{}{"task": "a", "done": true, "priority": "high", "project_id": int64(3)}
+
+	assert.Equal(map[string]pkg.FieldChange{
+		"done":       {From: false, To: true},
+		"priority":   {From: "low", To: "high"},
+		"project_id": {From: nil, To: int64(3)},
+	}, diffTodo(before, after))
+
+	assert.Empty(diffTodo(before, before))
+
+	created := diffTodo(nil, after)
+	assert.Len(created, 4)
+	assert.Equal(pkg.FieldChange{From: nil, To: "a"}, created["task"])
+
+	deleted := diffTodo(before, nil)
+	assert.Len(deleted, 3)
+	assert.Equal(pkg.FieldChange{From: false, To: nil}, deleted["done"])
+}
+
+func Test_TodoEventType(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal(outbox.TodoCreated, todoEventType(pkg.ActivityCreate, nil))
+	assert.Equal(outbox.TodoCompleted, todoEventType(pkg.ActivityUpdate, map[string]pkg.FieldChange{"done": {From: false, To: true}}))
+	assert.Equal(outbox.TodoUpdated, todoEventType(pkg.ActivityUpdate, map[string]pkg.FieldChange{"done": {From: true, To: false}}))
+	assert.Equal(outbox.TodoUpdated, todoEventType(pkg.ActivityUpdate, map[string]pkg.FieldChange{"task": {From: "a", To: "b"}}))
+	assert.Equal(outbox.TodoDeleted, todoEventType(pkg.ActivityDelete, nil))
+	assert.Equal(outbox.TodoRestored, todoEventType(pkg.ActivityRestore, nil))
+	assert.Equal(outbox.TodoPurged, todoEventType(pkg.ActivityPurge, nil))
+}
+
+func Test_WebhookEvent(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal(pkg.EventTodoCreated, webhookEvent(pkg.ActivityCreate, nil))
+	assert.Equal(pkg.EventTodoCreated, webhookEvent(pkg.ActivityRestore, nil))
+	assert.Equal(pkg.EventTodoCompleted, webhookEvent(pkg.ActivityUpdate, map[string]pkg.FieldChange{"done": {From: false, To: true}}))
+	assert.Equal(pkg.EventTodoUpdated, webhookEvent(pkg.ActivityUpdate, map[string]pkg.FieldChange{"task": {From: "a", To: "b"}}))
+	assert.Equal(pkg.EventTodoDeleted, webhookEvent(pkg.ActivityDelete, nil))
+	assert.Equal("", webhookEvent(pkg.ActivityPurge, nil))
+}
+
+// Test_RecordActivityWebhooks checks that the deliveries of subscribed webhooks are queued in the
+// transaction of the change, with the todo as it is after the change.
+func Test_RecordActivityWebhooks(t *testing.T) {
+	assert := asserts.New(t)
+	conn, mock := newMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityUpdate, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.completed", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.completed", 1)
+	mock.ExpectQuery("SELECT " + todoColumns + " FROM todo WHERE id = ?").WithArgs(int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "task", "category", "priority", "project_id", "due_at", "position", "revision",
+			"created_at", "completed_at", "deleted_at", "client_uid", "recurrence"}).
+			AddRow(5, "a", "work", "low", nil, nil, "", 2, nil, nil, nil, nil, ""))
+
+	var payload []byte
+	mock.ExpectExec("INSERT INTO webhook_delivery (webhook_id, event, payload, status, next_attempt_at) SELECT id, ?, ?, ?, ? "+
+		"FROM webhook WHERE org_id = ? AND user_id = ? AND active AND (events = '' OR FIND_IN_SET(?, events))").
+		WithArgs("todo.completed", argFunc(func(v interface{}) bool {
+			payload, _ = v.([]byte)
+			return true
+		}), pkg.WebhookPending, sqlmock.AnyArg(), int64(1), int64(2), "todo.completed").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := conn.Begin()
+	assert.NoError(err)
+
+	a := &todoActivity{orgID: 1, userID: 2, todoID: 5, actor: &pkg.Actor{UserID: 2}, action: pkg.ActivityUpdate}
+	assert.NoError(recordActivity(tx, a, map[string]pkg.FieldChange{"done": {From: false, To: true}}))
+	assert.NoError(tx.Commit())
+
+	var e pkg.TodoEvent
+	if assert.NoError(json.Unmarshal(payload, &e)) {
+		assert.NotEmpty(e.ID)
+		assert.Equal("todo.completed", e.Type)
+		assert.Equal(int64(5), e.TodoID)
+		if assert.NotNil(e.Todo) {
+			assert.Equal("a", e.Todo.Task)
+		}
+	}
+}
+
+// argFunc matches any argument the function accepts.
+type argFunc func(interface{}) bool
+
+func (f argFunc) Match(v driver.Value) bool {
+	return f(v)
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/harsha-aqfer/todo/pkg"
+)
+
+type AdminAuditDB interface {
+	RecordAdminAction(a *pkg.AdminAction) error
+	ListAdminActions(limit, offset int) ([]pkg.AdminAction, error)
+}
+
+type adminAuditStore struct {
+	db *sql.DB
+}
+
+func NewAdminAuditStore(db *sql.DB) AdminAuditDB {
+	return &adminAuditStore{db: db}
+}
+
+func (as *adminAuditStore) RecordAdminAction(a *pkg.AdminAction) error {
+	_, err := as.db.Exec(
+		"INSERT admin_audit SET actor_id = ?, actor_email = ?, action = ?, target_user_id = ?, detail = ?, outcome = ?, ip = ?",
+		a.ActorID, a.ActorEmail, a.Action, a.TargetUserID, a.Detail, a.Outcome, a.IP,
+	)
+	return err
+}
+
+func (as *adminAuditStore) ListAdminActions(limit, offset int) ([]pkg.AdminAction, error) {
+	rows, err := as.db.Query(
+		"SELECT id, actor_id, actor_email, action, target_user_id, detail, outcome, ip, created_at FROM admin_audit ORDER BY id DESC LIMIT ? OFFSET ?",
+		limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	actions := make([]pkg.AdminAction, 0)
+
+	for rows.Next() {
+		var (
+			a      = pkg.AdminAction{}
+			target sql.NullInt64
+		)
+
+		if err = rows.Scan(&a.ID, &a.ActorID, &a.ActorEmail, &a.Action, &target, &a.Detail, &a.Outcome, &a.IP, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if target.Valid {
+			a.TargetUserID = &target.Int64
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Attempt tracks failed sign-in attempts for a single key, such as an account or a client IP.
+type Attempt struct {
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+}
+
+type AttemptDB interface {
+	GetAttempt(key string) (*Attempt, error)
+	RecordFailure(key string, now time.Time, window time.Duration) (*Attempt, error)
+	BlockUntil(key string, until time.Time) error
+	ResetAttempts(key string) error
+}
+
+type attemptStore struct {
+	db *sql.DB
+}
+
+func NewAttemptStore(db *sql.DB) AttemptDB {
+	return &attemptStore{db: db}
+}
+
+func (as *attemptStore) GetAttempt(key string) (*Attempt, error) {
+	row := as.db.QueryRow("SELECT failures, last_failure_at, blocked_until FROM login_attempt WHERE attempt_key = ?", key)
+
+	var (
+		r  = Attempt{}
+		bu sql.NullTime
+	)
+
+	err := row.Scan(&r.Failures, &r.LastFailure, &bu)
+	if err == sql.ErrNoRows {
+		return &r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if bu.Valid {
+		r.BlockedUntil = bu.Time
+	}
+	return &r, nil
+}
+
+// RecordFailure increments the failure counter. Counters whose last failure is older than window
+// start over at one.
+func (as *attemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*Attempt, error) {
+	now = now.UTC()
+
+	_, err := as.db.Exec(
+		"INSERT login_attempt SET attempt_key = ?, failures = 1, last_failure_at = ? "+
+			"ON DUPLICATE KEY UPDATE failures = IF(last_failure_at < ?, 1, failures + 1), last_failure_at = VALUES(last_failure_at)",
+		key, now, now.Add(-window),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return as.GetAttempt(key)
+}
+
+func (as *attemptStore) BlockUntil(key string, until time.Time) error {
+	_, err := as.db.Exec("UPDATE login_attempt SET blocked_until = ? WHERE attempt_key = ?", until.UTC(), key)
+	return err
+}
+
+func (as *attemptStore) ResetAttempts(key string) error {
+	_, err := as.db.Exec("DELETE FROM login_attempt WHERE attempt_key = ?", key)
+	return err
+}
+
+// memoryMaxAttempts bounds the number of keys an in-memory store keeps before stale ones are pruned.
+const memoryMaxAttempts = 100000
+
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*Attempt
+}
+
+// NewMemoryAttemptStore returns an AttemptDB that keeps counters in process memory. It is only
+// suitable for single instance deployments.
+func NewMemoryAttemptStore() AttemptDB {
+	return &memoryAttemptStore{attempts: make(map[string]*Attempt)}
+}
+
+func (ms *memoryAttemptStore) GetAttempt(key string) (*Attempt, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if a, ok := ms.attempts[key]; ok {
+		r := *a
+		return &r, nil
+	}
+	return &Attempt{}, nil
+}
+
+func (ms *memoryAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*Attempt, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if len(ms.attempts) >= memoryMaxAttempts {
+		ms.prune(now, window)
+	}
+
+	a, ok := ms.attempts[key]
+	if !ok {
+		a = &Attempt{}
+		ms.attempts[key] = a
+	}
+
+	if now.Sub(a.LastFailure) > window {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = now
+
+	r := *a
+	return &r, nil
+}
+
+func (ms *memoryAttemptStore) BlockUntil(key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if a, ok := ms.attempts[key]; ok {
+		a.BlockedUntil = until
+	}
+	return nil
+}
+
+func (ms *memoryAttemptStore) ResetAttempts(key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.attempts, key)
+	return nil
+}
+
+func (ms *memoryAttemptStore) prune(now time.Time, window time.Duration) {
+	for k, a := range ms.attempts {
+		if now.Sub(a.LastFailure) > window && now.After(a.BlockedUntil) {
+			delete(ms.attempts, k)
+		}
+	}
+}
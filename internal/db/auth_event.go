@@ -0,0 +1,27 @@
+package db
+
+import (
+	"database/sql"
+)
+
+const (
+	AuthEventLockout = "lockout"
+	AuthEventUnlock  = "unlock"
+)
+
+type AuthEventDB interface {
+	RecordEvent(event, subject, ip string) error
+}
+
+type authEventStore struct {
+	db *sql.DB
+}
+
+func NewAuthEventStore(db *sql.DB) AuthEventDB {
+	return &authEventStore{db: db}
+}
+
+func (as *authEventStore) RecordEvent(event, subject, ip string) error {
+	_, err := as.db.Exec("INSERT auth_event SET event = ?, subject = ?, ip = ?", event, subject, ip)
+	return err
+}
@@ -2,14 +2,33 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 type DB struct {
-	Sql  *sql.DB
-	Todo TodoDB
-	User UserDB
+	Sql         *sql.DB
+	Todo        TodoDB
+	User        UserDB
+	Session     SessionDB
+	Attempt     AttemptDB
+	AuthEvent   AuthEventDB
+	MFA         MFADB
+	Identity    IdentityDB
+	OAuth       OAuthDB
+	AdminAudit  AdminAuditDB
+	Org         OrgDB
+	Project     ProjectDB
+	Activity    ActivityDB
+	View        ViewDB
+	Sync        SyncDB
+	Feed        FeedDB
+	Token       PersonalTokenDB
+	ImportJob   ImportJobDB
+	Webhook     WebhookDB
+	Outbox      OutboxDB
+	Idempotency IdempotencyDB
 }
 
 func NewDB(username, password, host, dbname string) (*DB, error) {
@@ -17,10 +36,34 @@ func NewDB(username, password, host, dbname string) (*DB, error) {
 	db, err := sql.Open("mysql", connectString)
 	if err == nil {
 		return &DB{
-			Sql:  db,
-			Todo: NewTodoStore(db),
-			User: NewUserStore(db),
+			Sql:         db,
+			Todo:        NewTodoStore(db),
+			User:        NewUserStore(db),
+			Session:     NewSessionStore(db),
+			Attempt:     NewAttemptStore(db),
+			AuthEvent:   NewAuthEventStore(db),
+			MFA:         NewMFAStore(db),
+			Identity:    NewIdentityStore(db),
+			OAuth:       NewOAuthStore(db),
+			AdminAudit:  NewAdminAuditStore(db),
+			Org:         NewOrgStore(db),
+			Project:     NewProjectStore(db),
+			Activity:    NewActivityStore(db),
+			View:        NewViewStore(db),
+			Sync:        NewSyncStore(db),
+			Feed:        NewFeedStore(db),
+			Token:       NewPersonalTokenStore(db),
+			ImportJob:   NewImportJobStore(db),
+			Webhook:     NewWebhookStore(db),
+			Outbox:      NewOutboxStore(db),
+			Idempotency: NewIdempotencyStore(db),
 		}, nil
 	}
 	return nil, err
 }
+
+// isDuplicate reports whether err is a violation of a unique index.
+func isDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
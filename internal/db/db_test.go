@@ -0,0 +1,23 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+)
+
+// newMock returns a connection that expects the statements a test sets up, matched verbatim.
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		_ = conn.Close()
+	})
+	return conn, mock
+}
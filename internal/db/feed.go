@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// FeedOwner is whose todos a calendar feed shows.
+type FeedOwner struct {
+	OrgID  int64
+	UserID int64
+}
+
+type FeedDB interface {
+	GetFeed(orgID, userID int64) (*pkg.Feed, error)
+	SetFeed(orgID, userID int64, tokenHash string) error
+	DeleteFeed(orgID, userID int64) error
+	UseFeed(tokenHash string) (*FeedOwner, error)
+}
+
+type feedStore struct {
+	db *sql.DB
+}
+
+func NewFeedStore(db *sql.DB) FeedDB {
+	return &feedStore{db: db}
+}
+
+func (fs *feedStore) GetFeed(orgID, userID int64) (*pkg.Feed, error) {
+	var (
+		r    = pkg.Feed{}
+		used sql.NullTime
+	)
+
+	err := fs.db.QueryRow("SELECT created_at, last_used_at FROM calendar_feed WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&r.CreatedAt, &used)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "no calendar feed")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if used.Valid {
+		r.LastUsedAt = &used.Time
+	}
+	return &r, nil
+}
+
+// SetFeed creates the user's feed in the organization, or replaces its token, which stops the old URL.
+func (fs *feedStore) SetFeed(orgID, userID int64, tokenHash string) error {
+	_, err := fs.db.Exec(
+		"INSERT calendar_feed SET org_id = ?, user_id = ?, token_hash = ? "+
+			"ON DUPLICATE KEY UPDATE token_hash = VALUES(token_hash), created_at = CURRENT_TIMESTAMP, last_used_at = NULL",
+		orgID, userID, tokenHash,
+	)
+	return err
+}
+
+func (fs *feedStore) DeleteFeed(orgID, userID int64) error {
+	res, err := fs.db.Exec("DELETE FROM calendar_feed WHERE org_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "no calendar feed")
+	}
+	return nil
+}
+
+// UseFeed returns the owner of the feed with the token hash and records that it was polled.
+func (fs *feedStore) UseFeed(tokenHash string) (*FeedOwner, error) {
+	r := FeedOwner{}
+
+	err := fs.db.QueryRow("SELECT org_id, user_id FROM calendar_feed WHERE token_hash = ?", tokenHash).Scan(&r.OrgID, &r.UserID)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "no such calendar feed")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err = fs.db.Exec("UPDATE calendar_feed SET last_used_at = ? WHERE token_hash = ?", time.Now().UTC(), tokenHash); err != nil {
+		return nil, fmt.Errorf("could not record use of calendar feed: %w", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotentRequest is a request stored under an idempotency key. Status is zero while the first
+// request with the key is still being processed.
+type IdempotentRequest struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type IdempotencyDB interface {
+	ReserveKey(userID, orgID int64, key, fingerprint string, expiresAt time.Time) (*IdempotentRequest, error)
+	SaveResponse(userID, orgID int64, key string, status int, contentType string, body []byte) error
+	ReleaseKey(userID, orgID int64, key string) error
+	PurgeIdempotencyKeys(now time.Time) (int64, error)
+}
+
+type idempotencyStore struct {
+	db *sql.DB
+}
+
+func NewIdempotencyStore(db *sql.DB) IdempotencyDB {
+	return &idempotencyStore{db: db}
+}
+
+// ReserveKey claims the key of a user in an organization for a new request and returns nil. If the key
+// is already taken, it returns the request stored under it instead.
+func (is *idempotencyStore) ReserveKey(userID, orgID int64, key, fingerprint string, expiresAt time.Time) (*IdempotentRequest, error) {
+	now := time.Now().UTC()
+
+	_, err := is.db.Exec(
+		"DELETE FROM idempotency_key WHERE user_id = ? AND org_id = ? AND idempotency_key = ? AND expires_at <= ?",
+		userID, orgID, key, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = is.db.Exec(
+		"INSERT idempotency_key SET user_id = ?, org_id = ?, idempotency_key = ?, fingerprint = ?, expires_at = ?",
+		userID, orgID, key, fingerprint, expiresAt.UTC(),
+	)
+	if err == nil {
+		return nil, nil
+	} else if !isDuplicate(err) {
+		return nil, err
+	}
+
+	row := is.db.QueryRow(
+		"SELECT fingerprint, status, content_type, body FROM idempotency_key WHERE user_id = ? AND org_id = ? AND idempotency_key = ?",
+		userID, orgID, key,
+	)
+
+	r := IdempotentRequest{}
+	if err = row.Scan(&r.Fingerprint, &r.Status, &r.ContentType, &r.Body); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (is *idempotencyStore) SaveResponse(userID, orgID int64, key string, status int, contentType string, body []byte) error {
+	_, err := is.db.Exec(
+		"UPDATE idempotency_key SET status = ?, content_type = ?, body = ? WHERE user_id = ? AND org_id = ? AND idempotency_key = ?",
+		status, contentType, body, userID, orgID, key,
+	)
+	return err
+}
+
+// ReleaseKey frees a reserved key whose request failed, so that it can be retried.
+func (is *idempotencyStore) ReleaseKey(userID, orgID int64, key string) error {
+	_, err := is.db.Exec(
+		"DELETE FROM idempotency_key WHERE user_id = ? AND org_id = ? AND idempotency_key = ? AND status = 0",
+		userID, orgID, key,
+	)
+	return err
+}
+
+func (is *idempotencyStore) PurgeIdempotencyKeys(now time.Time) (int64, error) {
+	res, err := is.db.Exec("DELETE FROM idempotency_key WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// OIDCState is the server side half of an OIDC login that is in flight.
+type OIDCState struct {
+	State    string
+	Provider string
+	Nonce    string
+	Verifier string
+}
+
+type IdentityDB interface {
+	GetIdentityUserID(provider, subject string) (int64, error)
+	LinkIdentity(userID int64, provider, subject, email string) error
+	SaveOIDCState(st *OIDCState, expiresAt time.Time) error
+	ConsumeOIDCState(state string) (*OIDCState, error)
+}
+
+type identityStore struct {
+	db *sql.DB
+}
+
+func NewIdentityStore(db *sql.DB) IdentityDB {
+	return &identityStore{db: db}
+}
+
+// GetIdentityUserID returns the user linked to the external identity, or zero if there is none.
+func (is *identityStore) GetIdentityUserID(provider, subject string) (int64, error) {
+	row := is.db.QueryRow("SELECT user_id FROM user_identity WHERE provider = ? AND subject = ?", provider, subject)
+
+	var r int64
+	err := row.Scan(&r)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return r, nil
+}
+
+func (is *identityStore) LinkIdentity(userID int64, provider, subject, email string) error {
+	_, err := is.db.Exec(
+		"INSERT user_identity SET user_id = ?, provider = ?, subject = ?, email = ?",
+		userID, provider, subject, email,
+	)
+	return err
+}
+
+func (is *identityStore) SaveOIDCState(st *OIDCState, expiresAt time.Time) error {
+	_, err := is.db.Exec(
+		"INSERT oidc_state SET state = ?, provider = ?, nonce = ?, verifier = ?, expires_at = ?",
+		st.State, st.Provider, st.Nonce, st.Verifier, expiresAt.UTC(),
+	)
+	return err
+}
+
+// ConsumeOIDCState returns and deletes a pending login so that every state can only be used once.
+func (is *identityStore) ConsumeOIDCState(state string) (*OIDCState, error) {
+	tx, err := is.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	row := tx.QueryRow(
+		"SELECT state, provider, nonce, verifier FROM oidc_state WHERE state = ? AND expires_at > ? FOR UPDATE",
+		state, time.Now().UTC(),
+	)
+
+	r := OIDCState{}
+	err = row.Scan(&r.State, &r.Provider, &r.Nonce, &r.Verifier)
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "unknown or expired login state")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("DELETE FROM oidc_state WHERE state = ? OR expires_at <= ?", state, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return &r, tx.Commit()
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// ErrImportJobLost is returned to a worker whose claim on an import job ended, because another worker
+// claimed the job after the lease ran out.
+var ErrImportJobLost = errors.New("the import job was claimed by another worker")
+
+// ClaimedImportJob is an import job a worker has taken, with the user it imports for and the file.
+// Claim is the number of times the job has been claimed; the worker's updates only apply while no
+// other worker has claimed the job since.
+type ClaimedImportJob struct {
+	pkg.ImportJob
+	OrgID  int64
+	UserID int64
+	Data   []byte
+	Claim  int
+}
+
+type ImportJobDB interface {
+	CreateImportJob(orgID, userID int64, source, filename string, opts *pkg.ImportOptions, data []byte) (int64, error)
+	ListImportJobs(orgID, userID int64) ([]pkg.ImportJob, error)
+	GetImportJob(orgID, userID, jobID int64) (*pkg.ImportJob, error)
+	ClaimImportJob(now time.Time, lease time.Duration, maxClaims int) (*ClaimedImportJob, error)
+	UpdateImportProgress(jobID int64, claim, processed, total int) error
+	FinishImportJob(jobID int64, claim int, report *pkg.ImportReport, jobErr string) error
+	PurgeImportJobs(before time.Time) (int64, error)
+}
+
+type importJobStore struct {
+	db *sql.DB
+}
+
+func NewImportJobStore(db *sql.DB) ImportJobDB {
+	return &importJobStore{db: db}
+}
+
+const importJobColumns = "id, source, filename, options, status, processed, total, error, created_at, started_at, finished_at"
+
+func scanImportJob(row scanner, dest ...interface{}) (*pkg.ImportJob, error) {
+	var (
+		j                 = pkg.ImportJob{}
+		opts              string
+		started, finished sql.NullTime
+	)
+
+	err := row.Scan(append([]interface{}{
+		&j.ID, &j.Source, &j.Filename, &opts, &j.Status, &j.Processed, &j.Total, &j.Error, &j.CreatedAt, &started, &finished,
+	}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(opts), &j.Options); err != nil {
+		return nil, err
+	}
+	if started.Valid {
+		j.StartedAt = &started.Time
+	}
+	if finished.Valid {
+		j.FinishedAt = &finished.Time
+	}
+	return &j, nil
+}
+
+func (is *importJobStore) CreateImportJob(orgID, userID int64, source, filename string, opts *pkg.ImportOptions, data []byte) (int64, error) {
+	raw, err := json.Marshal(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := is.db.Exec(
+		"INSERT import_job SET org_id = ?, user_id = ?, source = ?, filename = ?, options = ?, data = ?, status = ?",
+		orgID, userID, source, truncate(filename, 255), string(raw), data, pkg.ImportJobQueued,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListImportJobs returns the jobs of the user in the organization, newest first, without their reports.
+func (is *importJobStore) ListImportJobs(orgID, userID int64) ([]pkg.ImportJob, error) {
+	rows, err := is.db.Query(
+		"SELECT "+importJobColumns+" FROM import_job WHERE org_id = ? AND user_id = ? ORDER BY id DESC",
+		orgID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	jobs := make([]pkg.ImportJob, 0)
+
+	for rows.Next() {
+		j, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+func (is *importJobStore) GetImportJob(orgID, userID, jobID int64) (*pkg.ImportJob, error) {
+	var report sql.NullString
+
+	j, err := scanImportJob(is.db.QueryRow(
+		"SELECT "+importJobColumns+", report FROM import_job WHERE org_id = ? AND user_id = ? AND id = ?",
+		orgID, userID, jobID,
+	), &report)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such import job: %d", jobID))
+	} else if err != nil {
+		return nil, err
+	}
+
+	if report.Valid {
+		j.Report = &pkg.ImportReport{}
+		if err = json.Unmarshal([]byte(report.String), j.Report); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// ClaimImportJob takes the oldest queued job, or a running job whose worker has not recorded progress
+// for the lease, since it has likely stopped. Jobs whose lease ran out maxClaims times fail instead, as
+// they likely stop every worker. It returns nil if there is no job to take.
+func (is *importJobStore) ClaimImportJob(now time.Time, lease time.Duration, maxClaims int) (*ClaimedImportJob, error) {
+	tx, err := is.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(
+		"UPDATE import_job SET status = ?, error = ?, data = '', finished_at = ? WHERE status = ? AND heartbeat_at < ? AND claims >= ?",
+		pkg.ImportJobFailed, fmt.Sprintf("the import stopped %d times without finishing", maxClaims), now.UTC(),
+		pkg.ImportJobRunning, now.Add(-lease).UTC(), maxClaims,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var c ClaimedImportJob
+
+	j, err := scanImportJob(tx.QueryRow(
+		"SELECT "+importJobColumns+", org_id, user_id, data, claims FROM import_job "+
+			"WHERE status = ? OR (status = ? AND heartbeat_at < ?) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED",
+		pkg.ImportJobQueued, pkg.ImportJobRunning, now.Add(-lease).UTC(),
+	), &c.OrgID, &c.UserID, &c.Data, &c.Claim)
+	if err == sql.ErrNoRows {
+		return nil, tx.Commit()
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE import_job SET status = ?, processed = 0, claims = claims + 1, started_at = ?, heartbeat_at = ? WHERE id = ?",
+		pkg.ImportJobRunning, now.UTC(), now.UTC(), j.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	c.ImportJob = *j
+	c.Status, c.Processed, c.StartedAt = pkg.ImportJobRunning, 0, &now
+	c.Claim++
+	return &c, nil
+}
+
+// UpdateImportProgress records the progress of a running job, which also renews its lease. It fails
+// with ErrImportJobLost if the claim has ended.
+func (is *importJobStore) UpdateImportProgress(jobID int64, claim, processed, total int) error {
+	res, err := is.db.Exec(
+		"UPDATE import_job SET processed = ?, total = ?, heartbeat_at = ? WHERE id = ? AND claims = ? AND status = ?",
+		processed, total, time.Now().UTC(), jobID, claim, pkg.ImportJobRunning,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+
+	// MySQL doesn't count rows that are left as they were, as with progress recorded twice in a second.
+	var (
+		claims int
+		status string
+	)
+	err = is.db.QueryRow("SELECT claims, status FROM import_job WHERE id = ?", jobID).Scan(&claims, &status)
+	if err == sql.ErrNoRows || (err == nil && (claims != claim || status != pkg.ImportJobRunning)) {
+		return ErrImportJobLost
+	}
+	return err
+}
+
+// FinishImportJob stores the report of a job that is done, or the error of one that failed, and drops
+// the file. It fails with ErrImportJobLost if the claim has ended.
+func (is *importJobStore) FinishImportJob(jobID int64, claim int, report *pkg.ImportReport, jobErr string) error {
+	var (
+		status = pkg.ImportJobDone
+		raw    interface{}
+	)
+
+	if jobErr != "" {
+		status = pkg.ImportJobFailed
+	}
+
+	if report != nil {
+		b, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+
+	res, err := is.db.Exec(
+		"UPDATE import_job SET status = ?, report = ?, error = ?, data = '', finished_at = ? WHERE id = ? AND claims = ? AND status = ?",
+		status, raw, truncate(jobErr, maxErrorLen), time.Now().UTC(), jobID, claim, pkg.ImportJobRunning,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrImportJobLost
+	}
+	return nil
+}
+
+// PurgeImportJobs deletes jobs that finished before the given time.
+func (is *importJobStore) PurgeImportJobs(before time.Time) (int64, error) {
+	res, err := is.db.Exec("DELETE FROM import_job WHERE finished_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
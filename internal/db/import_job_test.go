@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_ClaimImportJob(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	is := NewImportJobStore(conn)
+
+	var (
+		now     = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		expired = now.Add(-2 * time.Minute)
+		created = now.Add(-time.Hour)
+	)
+
+	// Jobs that ran out of claims fail before the next one is taken.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE import_job SET status = ?, error = ?, data = '', finished_at = ? WHERE status = ? AND heartbeat_at < ? AND claims >= ?").
+		WithArgs(pkg.ImportJobFailed, "the import stopped 3 times without finishing", now, pkg.ImportJobRunning, expired, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT "+importJobColumns+", org_id, user_id, data, claims FROM import_job "+
+		"WHERE status = ? OR (status = ? AND heartbeat_at < ?) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED").
+		WithArgs(pkg.ImportJobQueued, pkg.ImportJobRunning, expired).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "source", "filename", "options", "status", "processed", "total", "error", "created_at", "started_at",
+			"finished_at", "org_id", "user_id", "data", "claims",
+		}).AddRow(7, "todoist", "a.csv", "{}", pkg.ImportJobRunning, 50, 100, "", created, expired, nil, 1, 2, []byte("x"), 1))
+	mock.ExpectExec("UPDATE import_job SET status = ?, processed = 0, claims = claims + 1, started_at = ?, heartbeat_at = ? WHERE id = ?").
+		WithArgs(pkg.ImportJobRunning, now, now, int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	j, err := is.ClaimImportJob(now, 2*time.Minute, 3)
+	assert.NoError(err)
+	if assert.NotNil(j) {
+		assert.Equal(int64(7), j.ID)
+		assert.Equal(2, j.Claim)
+		assert.Equal(0, j.Processed)
+	}
+
+	// The previous worker can no longer record anything.
+	const progress = "UPDATE import_job SET processed = ?, total = ?, heartbeat_at = ? WHERE id = ? AND claims = ? AND status = ?"
+
+	mock.ExpectExec(progress).WithArgs(60, 100, sqlmock.AnyArg(), int64(7), 1, pkg.ImportJobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT claims, status FROM import_job WHERE id = ?").WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"claims", "status"}).AddRow(2, pkg.ImportJobRunning))
+	assert.ErrorIs(is.UpdateImportProgress(7, 1, 60, 100), ErrImportJobLost)
+
+	mock.ExpectExec("UPDATE import_job SET status = ?, report = ?, error = ?, data = '', finished_at = ? WHERE id = ? AND claims = ? AND status = ?").
+		WithArgs(pkg.ImportJobDone, sqlmock.AnyArg(), "", sqlmock.AnyArg(), int64(7), 1, pkg.ImportJobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(is.FinishImportJob(7, 1, &pkg.ImportReport{}, ""), ErrImportJobLost)
+
+	// Progress recorded again within a second changes no row, but the claim holds.
+	mock.ExpectExec(progress).WithArgs(0, 100, sqlmock.AnyArg(), int64(7), 2, pkg.ImportJobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT claims, status FROM import_job WHERE id = ?").WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"claims", "status"}).AddRow(2, pkg.ImportJobRunning))
+	assert.NoError(is.UpdateImportProgress(7, 2, 0, 100))
+
+	// Without a job to take, the failed ones are still committed.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE import_job SET status = ?, error = ?, data = '', finished_at = ? WHERE status = ? AND heartbeat_at < ? AND claims >= ?").
+		WithArgs(pkg.ImportJobFailed, "the import stopped 3 times without finishing", now, pkg.ImportJobRunning, expired, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT "+importJobColumns+", org_id, user_id, data, claims FROM import_job "+
+		"WHERE status = ? OR (status = ? AND heartbeat_at < ?) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED").
+		WithArgs(pkg.ImportJobQueued, pkg.ImportJobRunning, expired).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectCommit()
+
+	j, err = is.ClaimImportJob(now, 2*time.Minute, 3)
+	assert.NoError(err)
+	assert.Nil(j)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MFA holds a user's TOTP enrollment. Secret is stored encrypted.
+type MFA struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type MFADB interface {
+	GetMFA(userID int64) (*MFA, error)
+	SetPendingSecret(userID int64, secret string) error
+	EnableMFA(userID int64, recoveryCodeHashes []string) error
+	DisableMFA(userID int64) error
+	UseStep(userID, step int64) (bool, error)
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+}
+
+type mfaStore struct {
+	db *sql.DB
+}
+
+func NewMFAStore(db *sql.DB) MFADB {
+	return &mfaStore{db: db}
+}
+
+// GetMFA returns the enrollment of the user, or nil if the user never started one.
+func (ms *mfaStore) GetMFA(userID int64) (*MFA, error) {
+	row := ms.db.QueryRow("SELECT secret, enabled, last_step FROM mfa WHERE user_id = ?", userID)
+
+	r := MFA{}
+	err := row.Scan(&r.Secret, &r.Enabled, &r.LastStep)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SetPendingSecret starts a new enrollment that only becomes active once EnableMFA is called.
+func (ms *mfaStore) SetPendingSecret(userID int64, secret string) error {
+	_, err := ms.db.Exec(
+		"INSERT mfa SET user_id = ?, secret = ?, enabled = 0, last_step = 0 "+
+			"ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = 0, last_step = 0",
+		userID, secret,
+	)
+	return err
+}
+
+// EnableMFA activates the pending enrollment and replaces the user's recovery codes.
+func (ms *mfaStore) EnableMFA(userID int64, recoveryCodeHashes []string) error {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.Exec("UPDATE mfa SET enabled = 1, enabled_at = ? WHERE user_id = ?", time.Now().UTC(), userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	for _, h := range recoveryCodeHashes {
+		if _, err = tx.Exec("INSERT mfa_recovery_code SET user_id = ?, code_hash = ?", userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (ms *mfaStore) DisableMFA(userID int64) error {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.Exec("DELETE FROM mfa WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep records step as the last accepted TOTP step. It reports false if the step, or a later
+// one, was already used, so a code can never be replayed.
+func (ms *mfaStore) UseStep(userID, step int64) (bool, error) {
+	res, err := ms.db.Exec("UPDATE mfa SET last_step = ? WHERE user_id = ? AND last_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UseRecoveryCode consumes an unused recovery code and reports whether one matched.
+func (ms *mfaStore) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	res, err := ms.db.Exec(
+		"UPDATE mfa_recovery_code SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
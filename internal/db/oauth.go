@@ -0,0 +1,307 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoOAuthGrant is returned for tokens of clients the user has not authorized, or no longer does.
+var ErrNoOAuthGrant = errors.New("the user has not authorized the client")
+
+type OAuthClient struct {
+	ID           string
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+	OwnerID      int64
+	CreatedAt    time.Time
+}
+
+func (oc *OAuthClient) Public() bool {
+	return oc.SecretHash == ""
+}
+
+type OAuthCode struct {
+	ClientID    string
+	UserID      int64
+	OrgID       int64
+	RedirectURI string
+	Scope       string
+	Challenge   string
+}
+
+type OAuthToken struct {
+	ID        string
+	ClientID  string
+	UserID    int64
+	OrgID     int64
+	Email     string
+	Scope     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// OAuthGrant is a user's consent for a client to act on their behalf.
+type OAuthGrant struct {
+	ClientID   string
+	ClientName string
+	Scope      string
+	CreatedAt  time.Time
+}
+
+type OAuthDB interface {
+	CreateClient(oc *OAuthClient) error
+	GetClient(clientID string) (*OAuthClient, error)
+	ListClients(ownerID int64) ([]OAuthClient, error)
+	DeleteClient(ownerID int64, clientID string) error
+	SaveCode(codeHash string, code *OAuthCode, expiresAt time.Time) error
+	ConsumeCode(codeHash string) (*OAuthCode, error)
+	SaveGrant(userID int64, clientID, scope string) error
+	ListGrants(userID int64) ([]OAuthGrant, error)
+	DeleteGrant(userID int64, clientID string) error
+	CreateToken(t *OAuthToken) error
+	GetToken(tokenID string) (*OAuthToken, error)
+	RevokeToken(tokenID string) error
+	RevokeUserTokens(userID int64) error
+}
+
+type oauthStore struct {
+	db *sql.DB
+}
+
+func NewOAuthStore(db *sql.DB) OAuthDB {
+	return &oauthStore{db: db}
+}
+
+func (oa *oauthStore) CreateClient(oc *OAuthClient) error {
+	_, err := oa.db.Exec(
+		"INSERT oauth_client SET id = ?, secret_hash = ?, name = ?, redirect_uris = ?, owner_id = ?",
+		oc.ID, oc.SecretHash, oc.Name, strings.Join(oc.RedirectURIs, "\n"), oc.OwnerID,
+	)
+	return err
+}
+
+func (oa *oauthStore) GetClient(clientID string) (*OAuthClient, error) {
+	row := oa.db.QueryRow("SELECT id, secret_hash, name, redirect_uris, owner_id, created_at FROM oauth_client WHERE id = ?", clientID)
+
+	var (
+		r   = OAuthClient{}
+		uri string
+	)
+
+	err := row.Scan(&r.ID, &r.SecretHash, &r.Name, &uri, &r.OwnerID, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such client: %s", clientID))
+	} else if err != nil {
+		return nil, err
+	}
+	r.RedirectURIs = strings.Split(uri, "\n")
+	return &r, nil
+}
+
+func (oa *oauthStore) ListClients(ownerID int64) ([]OAuthClient, error) {
+	rows, err := oa.db.Query("SELECT id, name, redirect_uris, owner_id, created_at FROM oauth_client WHERE owner_id = ?", ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	clients := make([]OAuthClient, 0)
+
+	for rows.Next() {
+		var (
+			r   = OAuthClient{}
+			uri string
+		)
+
+		if err = rows.Scan(&r.ID, &r.Name, &uri, &r.OwnerID, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.RedirectURIs = strings.Split(uri, "\n")
+		clients = append(clients, r)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteClient removes a client registration. Its codes, grants and tokens go with it through
+// ON DELETE CASCADE.
+func (oa *oauthStore) DeleteClient(ownerID int64, clientID string) error {
+	res, err := oa.db.Exec("DELETE FROM oauth_client WHERE owner_id = ? AND id = ?", ownerID, clientID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such client: %s", clientID))
+	}
+	return nil
+}
+
+func (oa *oauthStore) SaveCode(codeHash string, code *OAuthCode, expiresAt time.Time) error {
+	_, err := oa.db.Exec(
+		"INSERT oauth_code SET code_hash = ?, client_id = ?, user_id = ?, org_id = ?, redirect_uri = ?, scope = ?, challenge = ?, expires_at = ?",
+		codeHash, code.ClientID, code.UserID, code.OrgID, code.RedirectURI, code.Scope, code.Challenge, expiresAt.UTC(),
+	)
+	return err
+}
+
+// ConsumeCode returns and deletes an unexpired authorization code. It returns nil if the code is unknown.
+func (oa *oauthStore) ConsumeCode(codeHash string) (*OAuthCode, error) {
+	tx, err := oa.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	row := tx.QueryRow(
+		"SELECT client_id, user_id, org_id, redirect_uri, scope, challenge FROM oauth_code WHERE code_hash = ? AND expires_at > ? FOR UPDATE",
+		codeHash, time.Now().UTC(),
+	)
+
+	r := OAuthCode{}
+	err = row.Scan(&r.ClientID, &r.UserID, &r.OrgID, &r.RedirectURI, &r.Scope, &r.Challenge)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("DELETE FROM oauth_code WHERE code_hash = ? OR expires_at <= ?", codeHash, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return &r, tx.Commit()
+}
+
+func (oa *oauthStore) SaveGrant(userID int64, clientID, scope string) error {
+	_, err := oa.db.Exec(
+		"INSERT oauth_grant SET user_id = ?, client_id = ?, scope = ? ON DUPLICATE KEY UPDATE scope = VALUES(scope)",
+		userID, clientID, scope,
+	)
+	return err
+}
+
+func (oa *oauthStore) ListGrants(userID int64) ([]OAuthGrant, error) {
+	rows, err := oa.db.Query(
+		"SELECT g.client_id, c.name, g.scope, g.created_at FROM oauth_grant g JOIN oauth_client c ON c.id = g.client_id WHERE g.user_id = ?",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	grants := make([]OAuthGrant, 0)
+
+	for rows.Next() {
+		r := OAuthGrant{}
+		if err = rows.Scan(&r.ClientID, &r.ClientName, &r.Scope, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, r)
+	}
+	return grants, rows.Err()
+}
+
+// DeleteGrant withdraws the user's consent, deletes the client's unused codes for the user and revokes
+// every token the client holds for the user.
+func (oa *oauthStore) DeleteGrant(userID int64, clientID string) error {
+	tx, err := oa.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.Exec("DELETE FROM oauth_grant WHERE user_id = ? AND client_id = ?", userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such authorized app: %s", clientID))
+	}
+
+	if _, err = tx.Exec("DELETE FROM oauth_code WHERE user_id = ? AND client_id = ?", userID, clientID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE oauth_token SET revoked_at = ? WHERE user_id = ? AND client_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID, clientID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateToken stores a token while the user's grant for the client exists, and returns ErrNoOAuthGrant
+// otherwise. The insert reads the grant under a lock, so it can't slip past a concurrent DeleteGrant.
+func (oa *oauthStore) CreateToken(t *OAuthToken) error {
+	res, err := oa.db.Exec(
+		"INSERT INTO oauth_token (id, client_id, user_id, org_id, scope, issued_at, expires_at) "+
+			"SELECT ?, ?, ?, ?, ?, ?, ? FROM oauth_grant WHERE user_id = ? AND client_id = ?",
+		t.ID, t.ClientID, t.UserID, t.OrgID, t.Scope, t.IssuedAt.UTC(), t.ExpiresAt.UTC(), t.UserID, t.ClientID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoOAuthGrant
+	}
+	return nil
+}
+
+// GetToken returns the token only while it is neither revoked nor expired and its user is not
+// disabled, and nil otherwise.
+func (oa *oauthStore) GetToken(tokenID string) (*OAuthToken, error) {
+	row := oa.db.QueryRow(
+		"SELECT t.id, t.client_id, t.user_id, t.org_id, u.email, t.scope, t.issued_at, t.expires_at FROM oauth_token t "+
+			"JOIN user u ON u.id = t.user_id WHERE t.id = ? AND t.revoked_at IS NULL AND t.expires_at > ? AND u.disabled_at IS NULL",
+		tokenID, time.Now().UTC(),
+	)
+
+	r := OAuthToken{}
+	err := row.Scan(&r.ID, &r.ClientID, &r.UserID, &r.OrgID, &r.Email, &r.Scope, &r.IssuedAt, &r.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (oa *oauthStore) RevokeToken(tokenID string) error {
+	_, err := oa.db.Exec("UPDATE oauth_token SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), tokenID)
+	return err
+}
+
+func (oa *oauthStore) RevokeUserTokens(userID int64) error {
+	_, err := oa.db.Exec("UPDATE oauth_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	return err
+}
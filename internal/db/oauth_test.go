@@ -0,0 +1,49 @@
+package db
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_DeleteGrant(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	oa := NewOAuthStore(conn)
+
+	// Codes issued before the grant was withdrawn go with it, as do the tokens.
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM oauth_grant WHERE user_id = ? AND client_id = ?").
+		WithArgs(1, "app").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM oauth_code WHERE user_id = ? AND client_id = ?").
+		WithArgs(1, "app").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE oauth_token SET revoked_at = ? WHERE user_id = ? AND client_id = ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 1, "app").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(oa.DeleteGrant(1, "app"))
+}
+
+func Test_CreateToken(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	oa := NewOAuthStore(conn)
+
+	const insert = "INSERT INTO oauth_token (id, client_id, user_id, org_id, scope, issued_at, expires_at) " +
+		"SELECT ?, ?, ?, ?, ?, ?, ? FROM oauth_grant WHERE user_id = ? AND client_id = ?"
+
+	now := time.Now()
+	tok := &OAuthToken{ID: "t1", ClientID: "app", UserID: 1, OrgID: 2, Scope: "profile", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	mock.ExpectExec(insert).WithArgs("t1", "app", 1, 2, "profile", now.UTC(), now.Add(time.Hour).UTC(), 1, "app").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(oa.CreateToken(tok))
+
+	// Without the grant nothing is inserted.
+	mock.ExpectExec(insert).WithArgs("t1", "app", 1, 2, "profile", now.UTC(), now.Add(time.Hour).UTC(), 1, "app").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(oa.CreateToken(tok), ErrNoOAuthGrant)
+}
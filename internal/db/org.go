@@ -0,0 +1,288 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// OrgInvitation is a pending invitation to join an organization.
+type OrgInvitation struct {
+	OrgID     int64
+	Email     string
+	Role      string
+	InvitedBy int64
+}
+
+type OrgDB interface {
+	CreateOrg(name string, settings *pkg.OrgSettings, ownerID int64) (int64, error)
+	GetOrg(orgID int64) (*pkg.Org, error)
+	ListUserOrgs(userID int64) ([]pkg.Org, error)
+	GetDefaultOrgID(userID int64) (int64, error)
+	UpdateOrgSettings(orgID int64, settings *pkg.OrgSettings) error
+	GetMemberRole(orgID, userID int64) (string, error)
+	ListMembers(orgID int64) ([]pkg.OrgMember, error)
+	AddMember(orgID, userID int64, role string) error
+	SetMemberRole(orgID, userID int64, role string) error
+	RemoveMember(orgID, userID int64) error
+	CreateInvitation(tokenHash string, inv *OrgInvitation, expiresAt time.Time) error
+	GetInvitation(tokenHash string) (*OrgInvitation, error)
+	AcceptInvitation(tokenHash string, userID int64) error
+}
+
+type orgStore struct {
+	db *sql.DB
+}
+
+func NewOrgStore(db *sql.DB) OrgDB {
+	return &orgStore{db: db}
+}
+
+// CreateOrg creates the organization and makes ownerID its owner in one transaction.
+func (og *orgStore) CreateOrg(name string, settings *pkg.OrgSettings, ownerID int64) (int64, error) {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := og.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.Exec("INSERT organization SET name = ?, settings = ?", name, string(raw))
+	if err != nil {
+		return 0, err
+	}
+
+	orgID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec("INSERT org_member SET org_id = ?, user_id = ?, role = ?", orgID, ownerID, pkg.OrgRoleOwner); err != nil {
+		return 0, err
+	}
+	return orgID, tx.Commit()
+}
+
+func scanOrg(row scanner) (*pkg.Org, error) {
+	var (
+		r   = pkg.Org{}
+		raw string
+	)
+
+	if err := row.Scan(&r.ID, &r.Name, &raw, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw), &r.Settings); err != nil {
+		return nil, fmt.Errorf("invalid settings for organization %d: %w", r.ID, err)
+	}
+	return &r, nil
+}
+
+func (og *orgStore) GetOrg(orgID int64) (*pkg.Org, error) {
+	r, err := scanOrg(og.db.QueryRow("SELECT id, name, settings, created_at FROM organization WHERE id = ?", orgID))
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such organization: %d", orgID))
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (og *orgStore) ListUserOrgs(userID int64) ([]pkg.Org, error) {
+	rows, err := og.db.Query(
+		"SELECT o.id, o.name, o.settings, o.created_at, m.role FROM organization o "+
+			"JOIN org_member m ON m.org_id = o.id WHERE m.user_id = ? ORDER BY m.created_at, o.id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	orgs := make([]pkg.Org, 0)
+
+	for rows.Next() {
+		var (
+			r   = pkg.Org{}
+			raw string
+		)
+
+		if err = rows.Scan(&r.ID, &r.Name, &raw, &r.CreatedAt, &r.Role); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(raw), &r.Settings); err != nil {
+			return nil, fmt.Errorf("invalid settings for organization %d: %w", r.ID, err)
+		}
+		orgs = append(orgs, r)
+	}
+	return orgs, rows.Err()
+}
+
+// GetDefaultOrgID returns the organization the user joined first, or zero if the user has none.
+func (og *orgStore) GetDefaultOrgID(userID int64) (int64, error) {
+	row := og.db.QueryRow("SELECT org_id FROM org_member WHERE user_id = ? ORDER BY created_at, org_id LIMIT 1", userID)
+
+	var r int64
+	err := row.Scan(&r)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return r, nil
+}
+
+func (og *orgStore) UpdateOrgSettings(orgID int64, settings *pkg.OrgSettings) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = og.db.Exec("UPDATE organization SET settings = ? WHERE id = ?", string(raw), orgID)
+	return err
+}
+
+// GetMemberRole returns the user's role in the organization, or an empty string if the user is not a member.
+func (og *orgStore) GetMemberRole(orgID, userID int64) (string, error) {
+	row := og.db.QueryRow("SELECT role FROM org_member WHERE org_id = ? AND user_id = ?", orgID, userID)
+
+	var r string
+	err := row.Scan(&r)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+func (og *orgStore) ListMembers(orgID int64) ([]pkg.OrgMember, error) {
+	rows, err := og.db.Query(
+		"SELECT u.id, u.email, u.user_name, m.role, m.created_at FROM org_member m "+
+			"JOIN user u ON u.id = m.user_id WHERE m.org_id = ? ORDER BY m.created_at",
+		orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	members := make([]pkg.OrgMember, 0)
+
+	for rows.Next() {
+		r := pkg.OrgMember{}
+		if err = rows.Scan(&r.UserID, &r.Email, &r.Username, &r.Role, &r.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, r)
+	}
+	return members, rows.Err()
+}
+
+func (og *orgStore) AddMember(orgID, userID int64, role string) error {
+	_, err := og.db.Exec("INSERT org_member SET org_id = ?, user_id = ?, role = ?", orgID, userID, role)
+	return err
+}
+
+func (og *orgStore) SetMemberRole(orgID, userID int64, role string) error {
+	_, err := og.db.Exec("UPDATE org_member SET role = ? WHERE org_id = ? AND user_id = ?", role, orgID, userID)
+	return err
+}
+
+// RemoveMember removes the membership. The member's todos in the organization are kept but stay
+// unreachable unless the user joins again.
+func (og *orgStore) RemoveMember(orgID, userID int64) error {
+	res, err := og.db.Exec("DELETE FROM org_member WHERE org_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such member: %d", userID))
+	}
+	return nil
+}
+
+func (og *orgStore) CreateInvitation(tokenHash string, inv *OrgInvitation, expiresAt time.Time) error {
+	_, err := og.db.Exec(
+		"INSERT org_invitation SET token_hash = ?, org_id = ?, email = ?, role = ?, invited_by = ?, expires_at = ?",
+		tokenHash, inv.OrgID, inv.Email, inv.Role, inv.InvitedBy, expiresAt.UTC(),
+	)
+	return err
+}
+
+func (og *orgStore) GetInvitation(tokenHash string) (*OrgInvitation, error) {
+	row := og.db.QueryRow(
+		"SELECT org_id, email, role, invited_by FROM org_invitation WHERE token_hash = ? AND expires_at > ?",
+		tokenHash, time.Now().UTC(),
+	)
+
+	r := OrgInvitation{}
+	err := row.Scan(&r.OrgID, &r.Email, &r.Role, &r.InvitedBy)
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid or expired invitation")
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AcceptInvitation adds the member and deletes the invitation in one transaction, so that every link
+// works only once.
+func (og *orgStore) AcceptInvitation(tokenHash string, userID int64) error {
+	tx, err := og.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = acceptInvitation(tx, tokenHash, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func acceptInvitation(tx *sql.Tx, tokenHash string, userID int64) error {
+	res, err := tx.Exec(
+		"INSERT org_member (org_id, user_id, role) SELECT org_id, ?, role FROM org_invitation WHERE token_hash = ? AND expires_at > ?",
+		userID, tokenHash, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired invitation")
+	}
+
+	_, err = tx.Exec("DELETE FROM org_invitation WHERE token_hash = ?", tokenHash)
+	return err
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/internal/outbox"
+	"strings"
+	"time"
+)
+
+type OutboxDB interface {
+	outbox.Store
+	PurgeOutbox(before time.Time) (int64, error)
+}
+
+type outboxStore struct {
+	db *sql.DB
+}
+
+func NewOutboxStore(db *sql.DB) OutboxDB {
+	return &outboxStore{db: db}
+}
+
+// relayLock is the name of the MySQL user lock held by the running relay.
+const relayLock = "todo.outbox.relay"
+
+// writeEvent adds an event to the outbox in the transaction of the change it describes. Changes of one
+// aggregate lock its row before writing their event, so the ids of its events follow the commit order.
+func writeEvent(tx *sql.Tx, eventType, aggregateType string, aggregateID int64, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT outbox_event SET event_type = ?, aggregate_type = ?, aggregate_id = ?, payload = ?",
+		eventType, aggregateType, aggregateID, string(raw),
+	)
+	return err
+}
+
+// LockRelay takes a user lock on a connection of its own rather than locking outbox rows, so that the
+// relay never blocks the transactions that write events.
+func (ob *outboxStore) LockRelay(ctx context.Context) (func(), bool, error) {
+	conn, err := ob.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", relayLock).Scan(&ok); err != nil || ok.Int64 != 1 {
+		_ = conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		_, _ = conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", relayLock)
+		_ = conn.Close()
+	}
+	return unlock, true, nil
+}
+
+func (ob *outboxStore) PendingEvents(limit int) ([]outbox.Event, error) {
+	rows, err := ob.db.Query(
+		"SELECT id, event_type, aggregate_type, aggregate_id, payload, created_at FROM outbox_event "+
+			"WHERE published_at IS NULL ORDER BY id LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var events []outbox.Event
+
+	for rows.Next() {
+		var (
+			e   outbox.Event
+			raw string
+		)
+
+		if err = rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &raw, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(raw)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (ob *outboxStore) MarkPublished(ids []int64) error {
+	var (
+		qs     = make([]string, 0, len(ids))
+		params = []interface{}{time.Now().UTC()}
+	)
+
+	for _, id := range ids {
+		qs = append(qs, "?")
+		params = append(params, id)
+	}
+
+	_, err := ob.db.Exec("UPDATE outbox_event SET published_at = ? WHERE id IN ("+strings.Join(qs, ", ")+")", params...)
+	return err
+}
+
+// PurgeOutbox deletes events that were published before the given time.
+func (ob *outboxStore) PurgeOutbox(before time.Time) (int64, error) {
+	res, err := ob.db.Exec("DELETE FROM outbox_event WHERE published_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
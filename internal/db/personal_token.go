@@ -0,0 +1,106 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type PersonalTokenDB interface {
+	CreatePersonalToken(userID int64, name, tokenHash string, expiresAt *time.Time) (int64, error)
+	ListPersonalTokens(userID int64) ([]pkg.PersonalToken, error)
+	DeletePersonalToken(userID, tokenID int64) error
+	UsePersonalToken(tokenHash string) (int64, error)
+}
+
+type personalTokenStore struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenStore(db *sql.DB) PersonalTokenDB {
+	return &personalTokenStore{db: db}
+}
+
+func (ps *personalTokenStore) CreatePersonalToken(userID int64, name, tokenHash string, expiresAt *time.Time) (int64, error) {
+	var exp interface{}
+	if expiresAt != nil {
+		exp = expiresAt.UTC()
+	}
+
+	res, err := ps.db.Exec("INSERT personal_token SET user_id = ?, name = ?, token_hash = ?, expires_at = ?", userID, name, tokenHash, exp)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (ps *personalTokenStore) ListPersonalTokens(userID int64) ([]pkg.PersonalToken, error) {
+	rows, err := ps.db.Query("SELECT id, name, created_at, last_used_at, expires_at FROM personal_token WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	tokens := make([]pkg.PersonalToken, 0)
+
+	for rows.Next() {
+		var (
+			r         = pkg.PersonalToken{}
+			used, exp sql.NullTime
+		)
+
+		if err = rows.Scan(&r.ID, &r.Name, &r.CreatedAt, &used, &exp); err != nil {
+			return nil, err
+		}
+		if used.Valid {
+			r.LastUsedAt = &used.Time
+		}
+		if exp.Valid {
+			r.ExpiresAt = &exp.Time
+		}
+		tokens = append(tokens, r)
+	}
+	return tokens, rows.Err()
+}
+
+func (ps *personalTokenStore) DeletePersonalToken(userID, tokenID int64) error {
+	res, err := ps.db.Exec("DELETE FROM personal_token WHERE user_id = ? AND id = ?", userID, tokenID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such token: %d", tokenID))
+	}
+	return nil
+}
+
+// UsePersonalToken returns the owner of an unexpired token, or zero, and records that it was used.
+func (ps *personalTokenStore) UsePersonalToken(tokenHash string) (int64, error) {
+	now := time.Now().UTC()
+
+	var userID int64
+	err := ps.db.QueryRow(
+		"SELECT user_id FROM personal_token WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)",
+		tokenHash, now,
+	).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if _, err = ps.db.Exec("UPDATE personal_token SET last_used_at = ? WHERE token_hash = ?", now, tokenHash); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
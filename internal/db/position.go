@@ -0,0 +1,308 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/rank"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// maxPositionLen is the longest position a move or a new todo may get. Longer keys make the list get
+// rebalanced right away instead of waiting for RebalancePositions.
+const maxPositionLen = 64
+
+// listItem is a todo of a manually ordered list.
+type listItem struct {
+	id       int64
+	position string
+}
+
+// listScope returns the condition selecting the live todos of a list, which is either a project or the
+// todos without a project.
+func listScope(orgID, userID int64, projectID *int64) (string, []interface{}) {
+	if projectID == nil {
+		return "org_id = ? AND user_id = ? AND project_id IS NULL AND deleted_at IS NULL", []interface{}{orgID, userID}
+	}
+	return "org_id = ? AND user_id = ? AND project_id = ? AND deleted_at IS NULL", []interface{}{orgID, userID, *projectID}
+}
+
+// lockList returns the todos of the list in their order, except the given todo, and locks them.
+func lockList(tx *sql.Tx, orgID, userID int64, projectID *int64, except int64) ([]listItem, error) {
+	scope, args := listScope(orgID, userID, projectID)
+
+	rows, err := tx.Query(
+		"SELECT id, position FROM todo WHERE "+scope+" AND id != ? ORDER BY position, id FOR UPDATE",
+		append(args, except)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	items := make([]listItem, 0)
+
+	for rows.Next() {
+		var it listItem
+		if err = rows.Scan(&it.id, &it.position); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// rebalanceList gives the items evenly spread positions in their current order. The revision of the
+// todos is left alone since their order does not change.
+func rebalanceList(tx *sql.Tx, items []listItem) error {
+	for i, key := range rank.Spread(len(items)) {
+		if _, err := tx.Exec("UPDATE todo SET position = ? WHERE id = ?", key, items[i].id); err != nil {
+			return err
+		}
+		items[i].position = key
+	}
+	return nil
+}
+
+// positionAt returns a position for a todo inserted at index i of the items, rebalancing them if
+// their positions leave no usable room there.
+func positionAt(tx *sql.Tx, items []listItem, i int) (string, error) {
+	var a, b string
+	if i > 0 {
+		a = items[i-1].position
+	}
+	if i < len(items) {
+		b = items[i].position
+	}
+
+	// Todos created before lists were ordered have no position, which Between would take for an end of
+	// the list.
+	unset := (i > 0 && !rank.Valid(a)) || (i < len(items) && !rank.Valid(b))
+
+	key, err := rank.Between(a, b)
+	if err == nil && !unset && len(key) <= maxPositionLen {
+		return key, nil
+	}
+
+	if err = rebalanceList(tx, items); err != nil {
+		return "", err
+	}
+	return positionAt(tx, items, i)
+}
+
+// endPosition returns a position after every todo of the list.
+func endPosition(tx *sql.Tx, orgID, userID int64, projectID *int64, except int64) (string, error) {
+	items, err := lockList(tx, orgID, userID, projectID, except)
+	if err != nil {
+		return "", err
+	}
+	return positionAt(tx, items, len(items))
+}
+
+// anchorProject returns the project of a live todo used as an anchor of a move.
+func anchorProject(tx *sql.Tx, orgID, userID, todoID int64) (*int64, error) {
+	var pid sql.NullInt64
+
+	err := tx.QueryRow(
+		"SELECT project_id FROM todo WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NULL",
+		orgID, userID, todoID,
+	).Scan(&pid)
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !pid.Valid {
+		return nil, nil
+	}
+	return &pid.Int64, nil
+}
+
+func sameProject(a, b *int64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func indexOf(items []listItem, todoID int64) int {
+	for i, it := range items {
+		if it.id == todoID {
+			return i
+		}
+	}
+	return -1
+}
+
+// MoveTodo places the todo right after mr.After and right before mr.Before. The todo joins the list of
+// the anchors, so moving it next to a todo of another project moves it to that project. Unless the list
+// needs a rebalance, only the moved todo is written. Unless revision is zero, the todo has to be at that
+// revision.
+func (ts *todoStore) MoveTodo(orgID, userID, todoID, revision int64, mr *pkg.MoveRequest, actor *pkg.Actor) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	before, err := lockTodo(tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRevision(tx, todoID, revision); err != nil {
+		return err
+	}
+
+	var (
+		projectID *int64
+		anchors   []int64
+	)
+	if mr.After != nil {
+		anchors = append(anchors, *mr.After)
+	}
+	if mr.Before != nil {
+		anchors = append(anchors, *mr.Before)
+	}
+
+	for i, anchor := range anchors {
+		if anchor == todoID {
+			return echo.NewHTTPError(http.StatusBadRequest, "a todo can't be moved next to itself")
+		}
+
+		pid, err := anchorProject(tx, orgID, userID, anchor)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			projectID = pid
+		} else if !sameProject(projectID, pid) {
+			return echo.NewHTTPError(http.StatusBadRequest, "before and after are in different lists")
+		}
+	}
+
+	items, err := lockList(tx, orgID, userID, projectID, todoID)
+	if err != nil {
+		return err
+	}
+
+	at := -1
+	if mr.After != nil {
+		at = indexOf(items, *mr.After) + 1
+	}
+	if mr.Before != nil {
+		i := indexOf(items, *mr.Before)
+		if at >= 0 && at != i {
+			return echo.NewHTTPError(http.StatusBadRequest, "before and after are not next to each other")
+		}
+		at = i
+	}
+
+	position, err := positionAt(tx, items, at)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE todo SET position = ?, project_id = ?, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?",
+		position, projectID, orgID, userID, todoID,
+	)
+	if err != nil {
+		return err
+	}
+
+	after, err := lockTodo(tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	// Only moves to another project show up in the history, but webhooks are told of every move.
+	if changes := diffTodo(before, after); len(changes) > 0 {
+		a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityUpdate}
+		err = recordActivity(tx, a, changes)
+	} else {
+		err = enqueueTodoEvent(tx, orgID, userID, todoID, pkg.EventTodoUpdated)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RebalancePositions gives evenly spread positions to every list that has a todo without a position or
+// with a position longer than maxLen, and returns the number of rebalanced lists.
+func (ts *todoStore) RebalancePositions(maxLen int) (int64, error) {
+	rows, err := ts.db.Query(
+		"SELECT DISTINCT org_id, user_id, project_id FROM todo WHERE deleted_at IS NULL AND (position = '' OR LENGTH(position) > ?)",
+		maxLen,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	type list struct {
+		orgID, userID int64
+		projectID     *int64
+	}
+
+	var lists []list
+
+	for rows.Next() {
+		var (
+			l   list
+			pid sql.NullInt64
+		)
+		if err = rows.Scan(&l.orgID, &l.userID, &pid); err != nil {
+			return 0, err
+		}
+		if pid.Valid {
+			l.projectID = &pid.Int64
+		}
+		lists = append(lists, l)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	for _, l := range lists {
+		if err = ts.rebalance(l.orgID, l.userID, l.projectID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (ts *todoStore) rebalance(orgID, userID int64, projectID *int64) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	items, err := lockList(tx, orgID, userID, projectID, 0)
+	if err != nil {
+		return err
+	}
+
+	if err = rebalanceList(tx, items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/harsha-aqfer/todo/internal/rank"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Test_MoveTodoUnpositioned moves a todo in a list whose todos have no positions yet, which have to be
+// given some before the moved todo can go between them.
+func Test_MoveTodoUnpositioned(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	var (
+		after  = int64(5)
+		before = int64(6)
+		keys   = rank.Spread(2)
+	)
+
+	want, err := rank.Between(keys[0], keys[1])
+	assert.NoError(err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(7)).WillReturnRows(lockedTodo("c"))
+	for _, id := range []int64{after, before} {
+		mock.ExpectQuery("SELECT project_id FROM todo WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NULL").
+			WithArgs(int64(1), int64(2), id).WillReturnRows(sqlmock.NewRows([]string{"project_id"}).AddRow(nil))
+	}
+	mock.ExpectQuery("SELECT id, position FROM todo WHERE org_id = ? AND user_id = ? AND project_id IS NULL AND deleted_at IS NULL "+
+		"AND id != ? ORDER BY position, id FOR UPDATE").
+		WithArgs(int64(1), int64(2), int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "position"}).AddRow(after, "").AddRow(before, ""))
+	for i, id := range []int64{after, before} {
+		mock.ExpectExec("UPDATE todo SET position = ? WHERE id = ?").WithArgs(keys[i], id).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("UPDATE todo SET position = ?, project_id = ?, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?").
+		WithArgs(want, nil, int64(1), int64(2), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(7)).WillReturnRows(lockedTodo("c"))
+	expectWebhooks(mock, "todo.updated", 0)
+	mock.ExpectCommit()
+
+	assert.NoError(ts.MoveTodo(1, 2, 7, 0, &pkg.MoveRequest{After: &after, Before: &before}, &pkg.Actor{UserID: 2}))
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ProjectDB interface {
+	ListProjects(orgID int64) ([]pkg.Project, error)
+	GetProject(orgID, projectID int64) (*pkg.Project, error)
+	CreateProject(orgID, userID int64, name string) (int64, error)
+	RenameProject(orgID, projectID int64, name string) error
+	DeleteProject(orgID, projectID int64) error
+}
+
+type projectStore struct {
+	db *sql.DB
+}
+
+func NewProjectStore(db *sql.DB) ProjectDB {
+	return &projectStore{db: db}
+}
+
+func (ps *projectStore) ListProjects(orgID int64) ([]pkg.Project, error) {
+	rows, err := ps.db.Query("SELECT id, name, created_by, created_at FROM project WHERE org_id = ? ORDER BY name", orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	projects := make([]pkg.Project, 0)
+
+	for rows.Next() {
+		p := pkg.Project{}
+		if err = rows.Scan(&p.ID, &p.Name, &p.CreatedBy, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+func (ps *projectStore) GetProject(orgID, projectID int64) (*pkg.Project, error) {
+	row := ps.db.QueryRow("SELECT id, name, created_by, created_at FROM project WHERE org_id = ? AND id = ?", orgID, projectID)
+
+	p := pkg.Project{}
+	err := row.Scan(&p.ID, &p.Name, &p.CreatedBy, &p.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such project: %d", projectID))
+	} else if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (ps *projectStore) CreateProject(orgID, userID int64, name string) (int64, error) {
+	res, err := ps.db.Exec("INSERT project SET org_id = ?, name = ?, created_by = ?", orgID, name, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (ps *projectStore) RenameProject(orgID, projectID int64, name string) error {
+	_, err := ps.db.Exec("UPDATE project SET name = ? WHERE org_id = ? AND id = ?", name, orgID, projectID)
+	return err
+}
+
+// DeleteProject removes the project. Its todos are kept and lose their project through ON DELETE SET NULL.
+func (ps *projectStore) DeleteProject(orgID, projectID int64) error {
+	_, err := ps.db.Exec("DELETE FROM project WHERE org_id = ? AND id = ?", orgID, projectID)
+	return err
+}
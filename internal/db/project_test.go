@@ -0,0 +1,30 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_ProjectOrgScope(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ps := NewProjectStore(conn)
+
+	mock.ExpectQuery("SELECT id, name, created_by, created_at FROM project WHERE org_id = ? AND id = ?").
+		WithArgs(int64(1), int64(7)).WillReturnError(sql.ErrNoRows)
+	_, err := ps.GetProject(1, 7)
+	assertStatus(assert, http.StatusNotFound, err)
+
+	// Changes are limited to the organization as well, in case a handler forgets to look the project up.
+	mock.ExpectExec("UPDATE project SET name = ? WHERE org_id = ? AND id = ?").
+		WithArgs("Mine", int64(1), int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(ps.RenameProject(1, 7, "Mine"))
+
+	mock.ExpectExec("DELETE FROM project WHERE org_id = ? AND id = ?").
+		WithArgs(int64(1), int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(ps.DeleteProject(1, 7))
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+// Session is a signed-in device. OrgID is the organization its tokens were last issued for, which is
+// zero for sessions that started before sessions kept it.
+type Session struct {
+	ID        string
+	UserID    int64
+	Email     string
+	OrgID     int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type SessionDB interface {
+	CreateSession(userID, orgID int64, refreshHash string, expiresAt time.Time) (string, error)
+	GetSession(sessionID string) (*Session, error)
+	RefreshSession(refreshHash, newRefreshHash string, expiresAt time.Time) (*Session, error)
+	SetSessionOrg(sessionID string, orgID int64) error
+	RevokeSession(sessionID string) error
+	RevokeUserSessions(userID int64, except string) error
+}
+
+type sessionStore struct {
+	db *sql.DB
+}
+
+func NewSessionStore(db *sql.DB) SessionDB {
+	return &sessionStore{db: db}
+}
+
+func (ss *sessionStore) CreateSession(userID, orgID int64, refreshHash string, expiresAt time.Time) (string, error) {
+	id := uuid.NewV4().String()
+
+	_, err := ss.db.Exec(
+		"INSERT session SET id = ?, user_id = ?, org_id = ?, refresh_hash = ?, expires_at = ?",
+		id, userID, orgID, refreshHash, expiresAt.UTC(),
+	)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// GetSession returns the session only while it is neither revoked nor expired, and the user is not disabled.
+func (ss *sessionStore) GetSession(sessionID string) (*Session, error) {
+	row := ss.db.QueryRow(
+		"SELECT s.id, s.user_id, u.email, s.org_id, s.created_at, s.expires_at FROM session s JOIN user u ON u.id = s.user_id "+
+			"WHERE s.id = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.disabled_at IS NULL",
+		sessionID, time.Now().UTC(),
+	)
+
+	r := Session{}
+	err := row.Scan(&r.ID, &r.UserID, &r.Email, &r.OrgID, &r.CreatedAt, &r.ExpiresAt)
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "session expired or revoked")
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// RefreshSession replaces the refresh token of a live session and extends it. Each refresh token works
+// once. A used one that comes back has likely been stolen, and as there is no telling the thief from the
+// owner, the session is revoked.
+func (ss *sessionStore) RefreshSession(refreshHash, newRefreshHash string, expiresAt time.Time) (*Session, error) {
+	now := time.Now().UTC()
+
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	r := Session{}
+	err = tx.QueryRow(
+		"SELECT s.id, s.user_id, u.email, s.org_id FROM session s JOIN user u ON u.id = s.user_id "+
+			"WHERE s.refresh_hash = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.disabled_at IS NULL FOR UPDATE",
+		refreshHash, now,
+	).Scan(&r.ID, &r.UserID, &r.Email, &r.OrgID)
+	if err == sql.ErrNoRows {
+		return nil, revokeReplayedSession(tx, refreshHash, now)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("INSERT used_refresh_token SET refresh_hash = ?, session_id = ?", refreshHash, r.ID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE session SET refresh_hash = ?, expires_at = ? WHERE id = ?", newRefreshHash, expiresAt.UTC(), r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	r.ExpiresAt = expiresAt.UTC()
+	return &r, nil
+}
+
+// revokeReplayedSession revokes the session a used refresh token belonged to. Either way the token is
+// rejected.
+func revokeReplayedSession(tx *sql.Tx, refreshHash string, now time.Time) error {
+	var sessionID string
+
+	err := tx.QueryRow("SELECT session_id FROM used_refresh_token WHERE refresh_hash = ?", refreshHash).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired refresh token")
+	} else if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE session SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, sessionID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return echo.NewHTTPError(http.StatusUnauthorized, "refresh token was used already, the session is revoked")
+}
+
+// SetSessionOrg records the organization the session switched to, so that refreshed tokens keep it.
+func (ss *sessionStore) SetSessionOrg(sessionID string, orgID int64) error {
+	_, err := ss.db.Exec("UPDATE session SET org_id = ? WHERE id = ?", orgID, sessionID)
+	return err
+}
+
+func (ss *sessionStore) RevokeSession(sessionID string) error {
+	_, err := ss.db.Exec("UPDATE session SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), sessionID)
+	return err
+}
+
+// RevokeUserSessions revokes every active session of the user except the one given, which may be empty.
+func (ss *sessionStore) RevokeUserSessions(userID int64, except string) error {
+	_, err := ss.db.Exec(
+		"UPDATE session SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID, except,
+	)
+	return err
+}
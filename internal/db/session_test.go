@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const selectSession = "SELECT s.id, s.user_id, u.email, s.org_id, s.created_at, s.expires_at FROM session s JOIN user u ON u.id = s.user_id " +
+	"WHERE s.id = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.disabled_at IS NULL"
+
+func Test_GetSession(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ss := NewSessionStore(conn)
+
+	var (
+		created = time.Now().Add(-time.Hour).UTC()
+		expires = time.Now().Add(time.Hour).UTC()
+	)
+	mock.ExpectQuery(selectSession).WithArgs("s1", sqlmock.AnyArg()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "email", "org_id", "created_at", "expires_at"}).
+			AddRow("s1", 1, "ann@example.com", 2, created, expires),
+	)
+	s, err := ss.GetSession("s1")
+	assert.NoError(err)
+	assert.Equal(&Session{ID: "s1", UserID: 1, Email: "ann@example.com", OrgID: 2, CreatedAt: created, ExpiresAt: expires}, s)
+
+	// Revoked and expired sessions are not found, which signs their tokens out.
+	mock.ExpectQuery(selectSession).WithArgs("s2", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	_, err = ss.GetSession("s2")
+	if he, ok := err.(*echo.HTTPError); assert.True(ok) {
+		assert.Equal(http.StatusUnauthorized, he.Code)
+	}
+}
+
+func Test_RevokeSessions(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ss := NewSessionStore(conn)
+
+	mock.ExpectExec("UPDATE session SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), "s1").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(ss.RevokeSession("s1"))
+
+	// Changing the password keeps the session it was changed in.
+	mock.ExpectExec("UPDATE session SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), int64(1), "s2").WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(ss.RevokeUserSessions(1, "s2"))
+
+	// Signing a user out everywhere keeps none.
+	mock.ExpectExec("UPDATE session SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), int64(1), "").WillReturnResult(sqlmock.NewResult(0, 3))
+	assert.NoError(ss.RevokeUserSessions(1, ""))
+}
+
+func Test_RefreshSession(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ss := NewSessionStore(conn)
+
+	const (
+		lockSession = "SELECT s.id, s.user_id, u.email, s.org_id FROM session s JOIN user u ON u.id = s.user_id " +
+			"WHERE s.refresh_hash = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND u.disabled_at IS NULL FOR UPDATE"
+		selectUsed = "SELECT session_id FROM used_refresh_token WHERE refresh_hash = ?"
+	)
+
+	expires := time.Now().Add(time.Hour).UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockSession).WithArgs("h1", sqlmock.AnyArg()).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "email", "org_id"}).AddRow("s1", 1, "ann@example.com", 2),
+	)
+	mock.ExpectExec("INSERT used_refresh_token SET refresh_hash = ?, session_id = ?").WithArgs("h1", "s1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE session SET refresh_hash = ?, expires_at = ? WHERE id = ?").WithArgs("h2", expires, "s1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	s, err := ss.RefreshSession("h1", "h2", expires)
+	assert.NoError(err)
+	assert.Equal(&Session{ID: "s1", UserID: 1, Email: "ann@example.com", OrgID: 2, ExpiresAt: expires}, s)
+
+	// Using the token again revokes the session, since one of the two callers has stolen it.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockSession).WithArgs("h1", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(selectUsed).WithArgs("h1").WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow("s1"))
+	mock.ExpectExec("UPDATE session SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL").WithArgs(sqlmock.AnyArg(), "s1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = ss.RefreshSession("h1", "h3", expires)
+	if he, ok := err.(*echo.HTTPError); assert.True(ok, "%v", err) {
+		assert.Equal(http.StatusUnauthorized, he.Code)
+		assert.Contains(he.Message, "revoked")
+	}
+
+	// Unknown tokens are just rejected.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockSession).WithArgs("h9", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(selectUsed).WithArgs("h9").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = ss.RefreshSession("h9", "h4", expires)
+	if he, ok := err.(*echo.HTTPError); assert.True(ok, "%v", err) {
+		assert.Equal(http.StatusUnauthorized, he.Code)
+	}
+}
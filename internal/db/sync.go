@@ -0,0 +1,487 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sync tokens are positions in the activity log of a user's todos in an organization. Activity ids are
+// assigned when a change is written but become visible when it commits, so a change can show up after
+// one with a higher id. Tokens therefore never move past activity younger than a settling time, and the
+// changes after them are sent again until they are settled.
+type SyncDB interface {
+	SyncSnapshot(orgID, userID int64, settled time.Time) ([]pkg.TodoResponse, int64, error)
+	SyncCursor(orgID, userID int64, settled time.Time) (int64, error)
+	SyncChanges(orgID, userID, since int64, limit int, settled time.Time) (*SyncPage, error)
+	LatestActivityID(orgID, userID int64) (int64, error)
+	GetTodoByClientUID(orgID, userID int64, clientUID string) (*pkg.TodoResponse, error)
+	ApplySyncMutation(orgID, userID int64, m *SyncMutation, actor *pkg.Actor) (*SyncOutcome, error)
+}
+
+type syncStore struct {
+	db *sql.DB
+}
+
+func NewSyncStore(db *sql.DB) SyncDB {
+	return &syncStore{db: db}
+}
+
+// SyncPage is a page of changes and the cursor to continue from.
+type SyncPage struct {
+	Changes []pkg.SyncChange
+	Cursor  int64
+	More    bool
+}
+
+// SyncMutation is a validated mutation of a sync client, with the values in the form of lockTodo. Server
+// changes after Base and up to Before conflict with it: Before excludes the changes made by earlier
+// mutations of the same push. Unless Revision is zero, the todo has to exist at that revision. Restore
+// takes a todo in the trash out of it before the values are applied, instead of rejecting the update.
+type SyncMutation struct {
+	Delete          bool
+	Restore         bool
+	TodoID          int64
+	ClientUID       string
+	Base            int64
+	Before          int64
+	Revision        int64
+	Values          map[string]interface{}
+	DefaultCategory string
+}
+
+// SyncOutcome is the result of a mutation and the event to publish for it, which is empty if nothing
+// changed.
+type SyncOutcome struct {
+	Result pkg.SyncResult
+	Event  string
+}
+
+// SyncCursor returns the cursor before the first activity that isn't settled yet.
+func (ss *syncStore) SyncCursor(orgID, userID int64, settled time.Time) (int64, error) {
+	var cursor int64
+	err := ss.db.QueryRow(
+		"SELECT COALESCE(MIN(CASE WHEN created_at >= ? THEN id END) - 1, MAX(id), 0) FROM todo_activity WHERE org_id = ? AND user_id = ?",
+		settled.UTC(), orgID, userID,
+	).Scan(&cursor)
+	return cursor, err
+}
+
+// SyncSnapshot returns every todo and the cursor to get the later changes from.
+func (ss *syncStore) SyncSnapshot(orgID, userID int64, settled time.Time) ([]pkg.TodoResponse, int64, error) {
+	cursor, err := ss.SyncCursor(orgID, userID, settled)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The cursor is taken first, so that changes made while the todos are read are sent again later.
+	ts := &todoStore{db: ss.db}
+	todos, err := ts.queryTodos("SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL ORDER BY id", orgID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return todos, cursor, nil
+}
+
+// SyncChanges returns the todos changed after the cursor since, up to limit activity entries: upserts
+// for live todos and tombstones for those in the trash or purged.
+func (ss *syncStore) SyncChanges(orgID, userID, since int64, limit int, settled time.Time) (*SyncPage, error) {
+	rows, err := ss.db.Query(
+		"SELECT id, todo_id, created_at FROM todo_activity WHERE org_id = ? AND user_id = ? AND id > ? ORDER BY id LIMIT ?",
+		orgID, userID, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		page    = &SyncPage{Cursor: since, Changes: make([]pkg.SyncChange, 0)}
+		ids     []int64
+		seen    = make(map[int64]bool)
+		params  = []interface{}{orgID, userID}
+		n       int
+		settle  = true
+		touched time.Time
+	)
+
+	for rows.Next() {
+		var id, todoID int64
+		if err = rows.Scan(&id, &todoID, &touched); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		n++
+
+		if settle && touched.Before(settled) {
+			page.Cursor = id
+		} else {
+			settle = false
+		}
+
+		if !seen[todoID] {
+			seen[todoID] = true
+			ids = append(ids, todoID)
+			params = append(params, todoID)
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	page.More = n == limit && page.Cursor > since
+
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	ts := &todoStore{db: ss.db}
+	todos, err := ts.queryTodos(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		params...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*pkg.TodoResponse, len(todos))
+	for i := range todos {
+		byID[todos[i].Id] = &todos[i]
+	}
+
+	for _, id := range ids {
+		t, ok := byID[id]
+		switch {
+		case !ok:
+			page.Changes = append(page.Changes, pkg.SyncChange{Op: pkg.SyncDelete, ID: id})
+		case t.DeletedAt != nil:
+			page.Changes = append(page.Changes, pkg.SyncChange{Op: pkg.SyncDelete, ID: id, ClientUID: t.ClientUID})
+		default:
+			page.Changes = append(page.Changes, pkg.SyncChange{Op: pkg.SyncUpsert, ID: id, ClientUID: t.ClientUID, Todo: t})
+		}
+	}
+	return page, nil
+}
+
+// LatestActivityID returns the id of the latest activity on the user's todos in the organization.
+func (ss *syncStore) LatestActivityID(orgID, userID int64) (int64, error) {
+	var r int64
+	err := ss.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM todo_activity WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&r)
+	return r, err
+}
+
+// GetTodoByClientUID returns the todo with the client UID, including todos in the trash, or nil.
+func (ss *syncStore) GetTodoByClientUID(orgID, userID int64, clientUID string) (*pkg.TodoResponse, error) {
+	t, err := scanTodo(ss.db.QueryRow(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND client_uid = ?",
+		orgID, userID, clientUID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// findSyncTodo locks the todo a mutation addresses. It returns a zero id if there is no such todo.
+func findSyncTodo(tx *sql.Tx, orgID, userID int64, m *SyncMutation) (int64, bool, error) {
+	query := "SELECT id, deleted_at IS NOT NULL FROM todo WHERE org_id = ? AND user_id = ? AND "
+	params := []interface{}{orgID, userID}
+
+	if m.TodoID != 0 {
+		query += "id = ?"
+		params = append(params, m.TodoID)
+	} else {
+		query += "client_uid = ?"
+		params = append(params, m.ClientUID)
+	}
+
+	var (
+		id      int64
+		trashed bool
+	)
+
+	err := tx.QueryRow(query+" FOR UPDATE", params...).Scan(&id, &trashed)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return id, trashed, err
+}
+
+// changedSince returns the fields of the todo that changed after the activity base, up to before. A zero
+// base stands for a client that can't tell what it has seen, so nothing conflicts.
+func changedSince(tx *sql.Tx, todoID, base, before int64) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	if base == 0 {
+		return fields, nil
+	}
+
+	rows, err := tx.Query("SELECT changes FROM todo_activity WHERE todo_id = ? AND id > ? AND id <= ?", todoID, base, before)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			raw     string
+			changes map[string]pkg.FieldChange
+		)
+
+		if err = rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(raw), &changes); err != nil {
+			return nil, fmt.Errorf("invalid changes in activity of todo %d: %w", todoID, err)
+		}
+		for field := range changes {
+			fields[field] = true
+		}
+	}
+	return fields, rows.Err()
+}
+
+func sortedFields(values map[string]interface{}) []string {
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ApplySyncMutation applies a mutation in a transaction of its own. Fields are last writer wins by the
+// time the server applies them: a mutation overwrites the fields it sets, and reports a conflict for each
+// one that was also changed on the server since the client's base. Deleting wins over updating, so
+// updates of a todo in the trash are rejected with a conflict unless they restore it.
+func (ss *syncStore) ApplySyncMutation(orgID, userID int64, m *SyncMutation, actor *pkg.Actor) (*SyncOutcome, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	todoID, trashed, err := findSyncTodo(tx, orgID, userID, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Revision != 0 {
+		if todoID == 0 {
+			return nil, echo.NewHTTPError(http.StatusPreconditionFailed, "the todo does not exist")
+		}
+		if err = checkRevision(tx, todoID, m.Revision); err != nil {
+			return nil, err
+		}
+	}
+
+	o := &SyncOutcome{Result: pkg.SyncResult{ID: todoID, ClientUID: m.ClientUID, Status: http.StatusOK}}
+
+	switch {
+	case todoID == 0 && m.Delete, trashed && m.Delete:
+		// The todo is gone already.
+		return o, nil
+	case todoID == 0 && m.TodoID != 0:
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", m.TodoID))
+	case trashed && m.Restore:
+		tt := &todoTx{tx: tx}
+		if err = tt.RestoreTodo(orgID, userID, todoID, actor); err != nil {
+			return nil, err
+		}
+		o.Event = pkg.EventTodoCreated
+	case trashed:
+		o.Result.Status = http.StatusConflict
+		o.Result.Error = fmt.Sprintf("todo %d was deleted", todoID)
+		o.Result.Conflicts = []pkg.SyncConflict{{Field: "deleted", Server: true, Client: false, Winner: pkg.SyncServerWins}}
+		return o, nil
+	case todoID == 0:
+		if todoID, err = createSyncTodo(tx, orgID, userID, m, actor); err != nil {
+			return nil, err
+		}
+		o.Result.ID, o.Result.Status, o.Event = todoID, http.StatusCreated, pkg.EventTodoCreated
+	}
+
+	before, err := lockTodo(tx, orgID, userID, todoID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := changedSince(tx, todoID, m.Base, m.Before)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Delete {
+		for _, field := range sortedFields(before) {
+			if changed[field] {
+				o.Result.Conflicts = append(o.Result.Conflicts, pkg.SyncConflict{Field: field, Server: before[field], Winner: pkg.SyncClientWins})
+			}
+		}
+
+		tt := &todoTx{tx: tx}
+		if err = tt.DeleteTodo(orgID, userID, todoID, 0, actor); err != nil {
+			return nil, err
+		}
+		o.Event = pkg.EventTodoDeleted
+		return o, tx.Commit()
+	}
+
+	for _, field := range sortedFields(m.Values) {
+		if changed[field] && before[field] != m.Values[field] {
+			o.Result.Conflicts = append(o.Result.Conflicts, pkg.SyncConflict{
+				Field:  field,
+				Server: before[field],
+				Client: m.Values[field],
+				Winner: pkg.SyncClientWins,
+			})
+		}
+	}
+
+	changes, err := applySyncValues(tx, orgID, userID, todoID, before, m.Values, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Event == "" && len(changes) > 0 {
+		o.Event = pkg.EventTodoUpdated
+		if c, ok := changes["done"]; ok && c.To == true {
+			o.Event = pkg.EventTodoCompleted
+		}
+	}
+	return o, tx.Commit()
+}
+
+// createSyncTodo creates the todo of an upsert with the fields CreateTodo takes. The others are applied
+// as an update.
+func createSyncTodo(tx *sql.Tx, orgID, userID int64, m *SyncMutation, actor *pkg.Actor) (int64, error) {
+	tr := &pkg.TodoRequest{Category: m.DefaultCategory}
+	tr.Task, _ = m.Values["task"].(string)
+
+	if tr.Task == "" {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "inadequate input parameters. Required field: task")
+	}
+
+	if v, ok := m.Values["category"].(string); ok {
+		tr.Category = v
+	}
+	if v, ok := m.Values["priority"].(string); ok {
+		tr.Priority = v
+	}
+	if v, ok := m.Values["project_id"].(int64); ok {
+		tr.ProjectID = &v
+	}
+	if v, ok := m.Values["recurrence"].(string); ok {
+		tr.Recurrence = &v
+	}
+
+	tt := &todoTx{tx: tx}
+
+	todoID, err := tt.CreateTodo(orgID, userID, tr, actor)
+	if err != nil {
+		return 0, err
+	}
+
+	if m.ClientUID != "" {
+		_, err = tx.Exec("UPDATE todo SET client_uid = ? WHERE id = ?", m.ClientUID, todoID)
+		if isDuplicate(err) {
+			return 0, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the client_uid %q already exists", m.ClientUID))
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return todoID, nil
+}
+
+// applySyncValues sets the values that differ from the locked state before and records the activity.
+func applySyncValues(tx *sql.Tx, orgID, userID, todoID int64, before, values map[string]interface{}, actor *pkg.Actor) (map[string]pkg.FieldChange, error) {
+	var (
+		qs     []string
+		params []interface{}
+	)
+
+	for _, field := range sortedFields(values) {
+		v := values[field]
+		if before[field] == v {
+			continue
+		}
+
+		switch field {
+		case "done":
+			var completed interface{}
+			if v == true {
+				completed = time.Now().UTC()
+			}
+			qs = append(qs, "done = ?", "completed_at = ?")
+			params = append(params, v, completed)
+		case "due_at":
+			var due interface{}
+			if s, ok := v.(string); ok {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					return nil, err
+				}
+				due = t.UTC()
+			}
+			qs = append(qs, "due_at = ?")
+			params = append(params, due)
+		case "project_id":
+			var pid *int64
+			if id, ok := v.(int64); ok {
+				pid = &id
+			}
+
+			// Todos moved to another project go to the end of its list.
+			position, err := endPosition(tx, orgID, userID, pid, todoID)
+			if err != nil {
+				return nil, err
+			}
+			qs = append(qs, "project_id = ?", "position = ?")
+			params = append(params, v, position)
+		case "recurrence":
+			rule, _ := v.(string)
+			qs = append(qs, "recurrence = ?")
+			params = append(params, rule)
+		default:
+			qs = append(qs, field+" = ?")
+			params = append(params, v)
+		}
+	}
+
+	if len(qs) == 0 {
+		return nil, nil
+	}
+
+	qs = append(qs, "revision = revision + 1")
+	params = append(params, todoID, orgID, userID)
+
+	_, err := tx.Exec(fmt.Sprintf("UPDATE todo SET %s WHERE id = ? AND org_id = ? AND user_id = ?", strings.Join(qs, ", ")), params...)
+	if isDuplicate(err) {
+		return nil, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", values["task"]))
+	} else if err != nil {
+		return nil, err
+	}
+
+	after, err := lockTodo(tx, orgID, userID, todoID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffTodo(before, after)
+	if len(changes) > 0 {
+		a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityUpdate}
+		if err = recordActivity(tx, a, changes); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test_ApplySyncMutationRestore checks that a mutation restoring a todo from the trash does so in its
+// own transaction, and changes nothing if the restore fails.
+func Test_ApplySyncMutationRestore(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ss := NewSyncStore(conn)
+
+	const (
+		findTodo = "SELECT id, deleted_at IS NOT NULL FROM todo WHERE org_id = ? AND user_id = ? AND id = ? FOR UPDATE"
+		restore  = "UPDATE todo SET deleted_at = NULL, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?"
+	)
+
+	m := &SyncMutation{Restore: true, TodoID: 5, Values: map[string]interface{}{"task": "a"}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(findTodo).WithArgs(int64(1), int64(2), int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trashed"}).AddRow(5, true))
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec(restore).WithArgs(int64(1), int64(2), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityRestore, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.restored", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.created", 0)
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectCommit()
+
+	o, err := ss.ApplySyncMutation(1, 2, m, &pkg.Actor{UserID: 2})
+	if assert.NoError(err) {
+		assert.Equal(http.StatusOK, o.Result.Status)
+		assert.Equal(pkg.EventTodoCreated, o.Event)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(findTodo).WithArgs(int64(1), int64(2), int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trashed"}).AddRow(5, true))
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec(restore).WithArgs(int64(1), int64(2), int64(5)).WillReturnError(&mysql.MySQLError{Number: 1062})
+	mock.ExpectRollback()
+
+	_, err = ss.ApplySyncMutation(1, 2, m, &pkg.Actor{UserID: 2})
+	assertStatus(assert, http.StatusConflict, err)
+
+	// Without Restore, updates of a todo in the trash conflict.
+	m.Restore = false
+	mock.ExpectBegin()
+	mock.ExpectQuery(findTodo).WithArgs(int64(1), int64(2), int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "trashed"}).AddRow(5, true))
+	mock.ExpectRollback()
+
+	o, err = ss.ApplySyncMutation(1, 2, m, &pkg.Actor{UserID: 2})
+	if assert.NoError(err) {
+		assert.Equal(http.StatusConflict, o.Result.Status)
+	}
+}
@@ -3,34 +3,130 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"github.com/harsha-aqfer/todo/internal/outbox"
+	"github.com/harsha-aqfer/todo/internal/search"
 	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
 	"strings"
 	"time"
 )
 
+// TodoTx holds the todo mutations that can be combined in one transaction through TodoDB.InTx.
+type TodoTx interface {
+	CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, actor *pkg.Actor) (int64, error)
+	UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, actor *pkg.Actor) error
+	ReplaceTodo(orgID, userID, todoID int64, tr *pkg.TodoRequest, actor *pkg.Actor) error
+	DeleteTodo(orgID, userID, todoID, revision int64, actor *pkg.Actor) error
+}
+
 type TodoDB interface {
-	ListTodos(userID int64, all bool) ([]pkg.TodoResponse, error)
-	GetTodo(userID, todoID int64) (*pkg.TodoResponse, error)
-	CreateTodo(userID int64, tr *pkg.TodoRequest) error
-	UpdateTodo(userID, todoID int64, tr *pkg.TodoRequest) error
-	DeleteTodo(userID, todoID int64) error
+	TodoTx
+	InTx(fn func(t TodoTx) error) error
+	ListTodos(orgID, userID int64, all bool, sort search.Sort) ([]pkg.TodoResponse, error)
+	ExportTodos(orgID, userID int64, fn func(t *pkg.TodoResponse) error) error
+	GetTodo(orgID, userID, todoID int64) (*pkg.TodoResponse, error)
+	SearchTodos(orgID, userID int64, q *search.Query, sort search.Sort, limit, offset int) ([]pkg.TodoResponse, error)
+	BulkTodos(orgID, userID int64, br *pkg.BulkRequest, actor *pkg.Actor) ([]int64, error)
+	MoveTodo(orgID, userID, todoID, revision int64, mr *pkg.MoveRequest, actor *pkg.Actor) error
+	RebalancePositions(maxLen int) (int64, error)
+	ListTrash(orgID, userID int64) ([]pkg.TodoResponse, error)
+	RestoreTodo(orgID, userID, todoID int64, actor *pkg.Actor) error
+	PurgeTodo(orgID, userID, todoID int64, actor *pkg.Actor) error
+	PurgeTrash(before time.Time) (int64, error)
+	CountTodos(userID int64) (*pkg.TodoCounts, error)
 }
 
 type todoStore struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect search.Dialect
 }
 
 func NewTodoStore(db *sql.DB) TodoDB {
-	return &todoStore{db: db}
+	return &todoStore{db: db, dialect: search.MySQL}
 }
 
-func (ts *todoStore) ListTodos(userID int64, all bool) ([]pkg.TodoResponse, error) {
-	query := "SELECT id, task, category, priority, created_at, completed_at FROM todo WHERE user_id = ?"
+// todoTx runs todo mutations inside a transaction.
+type todoTx struct {
+	tx *sql.Tx
+}
 
-	if !all {
-		query += " AND NOT done"
+// InTx runs fn in a transaction that is committed if fn succeeds and rolled back otherwise.
+func (ts *todoStore) InTx(fn func(t TodoTx) error) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = fn(&todoTx{tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ts *todoStore) CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, actor *pkg.Actor) (int64, error) {
+	var todoID int64
+
+	err := ts.InTx(func(t TodoTx) (err error) {
+		todoID, err = t.CreateTodo(orgID, userID, tr, actor)
+		return err
+	})
+	return todoID, err
+}
+
+func (ts *todoStore) UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, actor *pkg.Actor) error {
+	return ts.InTx(func(t TodoTx) error {
+		return t.UpdateTodo(orgID, userID, todoID, revision, tr, actor)
+	})
+}
+
+func (ts *todoStore) ReplaceTodo(orgID, userID, todoID int64, tr *pkg.TodoRequest, actor *pkg.Actor) error {
+	return ts.InTx(func(t TodoTx) error {
+		return t.ReplaceTodo(orgID, userID, todoID, tr, actor)
+	})
+}
+
+func (ts *todoStore) DeleteTodo(orgID, userID, todoID, revision int64, actor *pkg.Actor) error {
+	return ts.InTx(func(t TodoTx) error {
+		return t.DeleteTodo(orgID, userID, todoID, revision, actor)
+	})
+}
+
+const todoColumns = "id, task, category, priority, project_id, due_at, position, revision, created_at, completed_at, deleted_at, client_uid, recurrence"
+
+func scanTodo(row scanner) (*pkg.TodoResponse, error) {
+	var (
+		t          = pkg.TodoResponse{}
+		ct, dt, du sql.NullTime
+		pid        sql.NullInt64
+		uid        sql.NullString
+	)
+
+	if err := row.Scan(&t.Id, &t.Task, &t.Category, &t.Priority, &pid, &du, &t.Position, &t.Revision, &t.CreatedAt, &ct, &dt, &uid, &t.Recurrence); err != nil {
+		return nil, err
+	}
+	if pid.Valid {
+		t.ProjectID = &pid.Int64
+	}
+	if du.Valid {
+		t.DueAt = &du.Time
+	}
+	if ct.Valid {
+		t.CompletedAt = &ct.Time
 	}
-	rows, err := ts.db.Query(query, userID)
+	if dt.Valid {
+		t.DeletedAt = &dt.Time
+	}
+	t.ClientUID = uid.String
+	return &t, nil
+}
+
+func (ts *todoStore) queryTodos(query string, args ...interface{}) ([]pkg.TodoResponse, error) {
+	rows, err := ts.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -42,26 +138,73 @@ func (ts *todoStore) ListTodos(userID int64, all bool) ([]pkg.TodoResponse, erro
 	todos := make([]pkg.TodoResponse, 0)
 
 	for rows.Next() {
-		t := pkg.TodoResponse{}
-		var ct sql.NullTime
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *t)
+	}
+	return todos, rows.Err()
+}
 
-		err = rows.Scan(&t.Id, &t.Task, &t.Category, &t.Priority, &t.CreatedAt, &ct)
+func (ts *todoStore) ListTodos(orgID, userID int64, all bool, sort search.Sort) ([]pkg.TodoResponse, error) {
+	query := "SELECT " + todoColumns + " FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL"
 
+	if !all {
+		query += " AND NOT done"
+	}
+	return ts.queryTodos(query+" ORDER BY "+sort.OrderBy(), orgID, userID)
+}
+
+// ExportTodos calls fn with every todo, grouped by project, and stops at the first error. Todos are read
+// one at a time, so that exports of any size can be streamed.
+func (ts *todoStore) ExportTodos(orgID, userID int64, fn func(t *pkg.TodoResponse) error) error {
+	rows, err := ts.db.Query(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL ORDER BY "+search.SortPosition.OrderBy(),
+		orgID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		t, err := scanTodo(rows)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if ct.Valid {
-			t.CompletedAt = &ct.Time
+		if err = fn(t); err != nil {
+			return err
 		}
-		todos = append(todos, t)
 	}
-	return todos, nil
+	return rows.Err()
+}
+
+// SearchTodos returns the todos that match the query in the given order. Relative days in the query
+// are resolved against the current time.
+func (ts *todoStore) SearchTodos(orgID, userID int64, q *search.Query, sort search.Sort, limit, offset int) ([]pkg.TodoResponse, error) {
+	compiled, err := search.Compile(q, ts.dialect, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]interface{}{orgID, userID}, compiled.Args...)
+	args = append(args, limit, offset)
+
+	return ts.queryTodos(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL AND ("+compiled.Where+
+			") ORDER BY "+sort.OrderBy()+" LIMIT ? OFFSET ?",
+		args...,
+	)
 }
 
-func (ts *todoStore) CreateTodo(userID int64, tr *pkg.TodoRequest) error {
+func (tt *todoTx) CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, actor *pkg.Actor) (int64, error) {
 	var (
-		query  = "INSERT todo SET user_id = ?, task = ?"
-		params = []interface{}{userID, tr.Task}
+		query  = "INSERT todo SET org_id = ?, user_id = ?, task = ?"
+		params = []interface{}{orgID, userID, tr.Task}
 	)
 
 	if tr.Category != "" {
@@ -74,44 +217,85 @@ func (ts *todoStore) CreateTodo(userID int64, tr *pkg.TodoRequest) error {
 		params = append(params, tr.Priority)
 	}
 
-	_, err := ts.db.Exec(query, params...)
-	return err
-}
+	if tr.ProjectID != nil {
+		query += ", project_id = ?"
+		params = append(params, *tr.ProjectID)
+	}
+
+	if tr.DueAt != nil {
+		query += ", due_at = ?"
+		params = append(params, tr.DueAt.UTC())
+	}
 
-func (ts *todoStore) GetTodo(userID, todoID int64) (*pkg.TodoResponse, error) {
-	query := "SELECT id, task, category, priority, created_at, completed_at FROM todo WHERE user_id = ? AND id = ?"
+	if tr.Recurrence != nil && *tr.Recurrence != "" {
+		query += ", recurrence = ?"
+		params = append(params, *tr.Recurrence)
+	}
 
-	rows, err := ts.db.Query(query, userID, todoID)
+	// New todos go to the end of their list.
+	position, err := endPosition(tt.tx, orgID, userID, tr.ProjectID, 0)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	defer func() {
-		_ = rows.Close()
-	}()
+	query += ", position = ?"
+	params = append(params, position)
 
-	for rows.Next() {
-		t := pkg.TodoResponse{}
-		var ct sql.NullTime
+	res, err := tt.tx.Exec(query, params...)
+	if isDuplicate(err) {
+		return 0, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", tr.Task))
+	} else if err != nil {
+		return 0, err
+	}
 
-		err = rows.Scan(&t.Id, &t.Task, &t.Category, &t.Priority, &t.CreatedAt, &ct)
+	todoID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
-		if ct.Valid {
-			t.CompletedAt = &ct.Time
-		}
-		return &t, nil
+	after, err := lockTodo(tt.tx, orgID, userID, todoID, false)
+	if err != nil {
+		return 0, err
 	}
-	return nil, nil
+
+	a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityCreate}
+	return todoID, recordActivity(tt.tx, a, diffTodo(nil, after))
 }
 
-func (ts *todoStore) UpdateTodo(userID, todoID int64, tr *pkg.TodoRequest) error {
-	var (
-		qs     []string
-		params []interface{}
-	)
+func (ts *todoStore) GetTodo(orgID, userID, todoID int64) (*pkg.TodoResponse, error) {
+	t, err := scanTodo(ts.db.QueryRow(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NULL",
+		orgID, userID, todoID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// checkRevision fails with 412 Precondition Failed unless the locked todo is at the given revision.
+// A zero revision matches any.
+func checkRevision(tx *sql.Tx, todoID, revision int64) error {
+	if revision == 0 {
+		return nil
+	}
+
+	var current int64
+	if err := tx.QueryRow("SELECT revision FROM todo WHERE id = ?", todoID).Scan(&current); err != nil {
+		return err
+	}
+
+	if current != revision {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Sprintf("todo %d has been modified, its revision is %d", todoID, current))
+	}
+	return nil
+}
+
+// UpdateTodo applies the set fields of the request. Unless revision is zero, the todo has to be at that
+// revision.
+func (tt *todoTx) UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, actor *pkg.Actor) error {
+	qs := []string{"revision = revision + 1"}
+	var params []interface{}
 
 	if tr.Task != "" {
 		qs = append(qs, "task = ?")
@@ -128,6 +312,21 @@ func (ts *todoStore) UpdateTodo(userID, todoID int64, tr *pkg.TodoRequest) error
 		params = append(params, tr.Priority)
 	}
 
+	if tr.ProjectID != nil {
+		qs = append(qs, "project_id = ?")
+		params = append(params, *tr.ProjectID)
+	}
+
+	if tr.DueAt != nil {
+		qs = append(qs, "due_at = ?")
+		params = append(params, tr.DueAt.UTC())
+	}
+
+	if tr.Recurrence != nil {
+		qs = append(qs, "recurrence = ?")
+		params = append(params, *tr.Recurrence)
+	}
+
 	if tr.Done {
 		qs = append(qs, "done = ?")
 		params = append(params, int64(1))
@@ -136,12 +335,316 @@ func (ts *todoStore) UpdateTodo(userID, todoID int64, tr *pkg.TodoRequest) error
 		params = append(params, time.Now().UTC())
 	}
 
-	params = append(params, todoID, userID)
-	_, err := ts.db.Exec(fmt.Sprintf("UPDATE todo SET %s WHERE id = ? AND user_id = ?", strings.Join(qs, ", ")), params...)
-	return err
+	before, err := lockTodo(tt.tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRevision(tt.tx, todoID, revision); err != nil {
+		return err
+	}
+
+	// Todos moved to another project go to the end of its list.
+	if tr.ProjectID != nil && before["project_id"] != *tr.ProjectID {
+		position, err := endPosition(tt.tx, orgID, userID, tr.ProjectID, todoID)
+		if err != nil {
+			return err
+		}
+
+		qs = append(qs, "position = ?")
+		params = append(params, position)
+	}
+
+	params = append(params, todoID, orgID, userID)
+	_, err = tt.tx.Exec(fmt.Sprintf("UPDATE todo SET %s WHERE id = ? AND org_id = ? AND user_id = ?", strings.Join(qs, ", ")), params...)
+	if isDuplicate(err) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", tr.Task))
+	} else if err != nil {
+		return err
+	}
+
+	after, err := lockTodo(tt.tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	// Updates that leave every field as it was are not worth a history entry.
+	if changes := diffTodo(before, after); len(changes) > 0 {
+		a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityUpdate}
+		return recordActivity(tt.tx, a, changes)
+	}
+	return nil
 }
 
-func (ts *todoStore) DeleteTodo(userID, todoID int64) error {
-	_, err := ts.db.Exec("DELETE FROM todo WHERE user_id = ? AND id = ?", userID, todoID)
+// ReplaceTodo sets every field of the todo to the request's. Fields the request leaves empty are cleared,
+// and the todo is only done if the request is.
+func (tt *todoTx) ReplaceTodo(orgID, userID, todoID int64, tr *pkg.TodoRequest, actor *pkg.Actor) error {
+	before, err := lockTodo(tt.tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{
+		"task":       tr.Task,
+		"done":       tr.Done,
+		"category":   tr.Category,
+		"priority":   tr.Priority,
+		"project_id": nil,
+		"due_at":     nil,
+		"recurrence": nil,
+	}
+	if tr.ProjectID != nil {
+		values["project_id"] = *tr.ProjectID
+	}
+	if tr.DueAt != nil {
+		values["due_at"] = tr.DueAt.UTC().Truncate(time.Second).Format(time.RFC3339)
+	}
+	if tr.Recurrence != nil && *tr.Recurrence != "" {
+		values["recurrence"] = *tr.Recurrence
+	}
+
+	_, err = applySyncValues(tt.tx, orgID, userID, todoID, before, values, actor)
 	return err
 }
+
+// DeleteTodo moves the todo to the trash. Unless revision is zero, the todo has to be at that revision.
+func (tt *todoTx) DeleteTodo(orgID, userID, todoID, revision int64, actor *pkg.Actor) error {
+	before, err := lockTodo(tt.tx, orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+
+	if err = checkRevision(tt.tx, todoID, revision); err != nil {
+		return err
+	}
+
+	_, err = tt.tx.Exec("UPDATE todo SET deleted_at = ?, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?", time.Now().UTC(), orgID, userID, todoID)
+	if err != nil {
+		return err
+	}
+
+	a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityDelete}
+	return recordActivity(tt.tx, a, diffTodo(before, nil))
+}
+
+// BulkTodos applies the action to every todo that matches the filter in one transaction, and returns
+// the ids of the affected todos.
+func (ts *todoStore) BulkTodos(orgID, userID int64, br *pkg.BulkRequest, actor *pkg.Actor) ([]int64, error) {
+	var (
+		query  = "SELECT id FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL"
+		params = []interface{}{orgID, userID}
+		f      = br.Filter
+	)
+
+	if f.Done != nil {
+		query += " AND done = ?"
+		params = append(params, *f.Done)
+	}
+
+	if f.Category != "" {
+		query += " AND category = ?"
+		params = append(params, f.Category)
+	}
+
+	if f.Priority != "" {
+		query += " AND priority = ?"
+		params = append(params, f.Priority)
+	}
+
+	if f.ProjectID != nil {
+		query += " AND project_id = ?"
+		params = append(params, *f.ProjectID)
+	}
+
+	// Completing a todo again would only move its completion time.
+	if br.Action == pkg.BulkComplete {
+		query += " AND NOT done"
+	}
+
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.Query(query+" ORDER BY id FOR UPDATE", params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0)
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	tt := &todoTx{tx: tx}
+
+	for _, id := range ids {
+		switch br.Action {
+		case pkg.BulkDelete:
+			err = tt.DeleteTodo(orgID, userID, id, 0, actor)
+		case pkg.BulkComplete:
+			err = tt.UpdateTodo(orgID, userID, id, 0, &pkg.TodoRequest{Done: true}, actor)
+		default:
+			err = fmt.Errorf("unknown bulk action %s", br.Action)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (ts *todoStore) ListTrash(orgID, userID int64) ([]pkg.TodoResponse, error) {
+	return ts.queryTodos(
+		"SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC",
+		orgID, userID,
+	)
+}
+
+// RestoreTodo moves the todo out of the trash. It fails with a conflict if another todo with the same
+// task was created in the meantime.
+func (ts *todoStore) RestoreTodo(orgID, userID, todoID int64, actor *pkg.Actor) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tt := &todoTx{tx: tx}
+	if err = tt.RestoreTodo(orgID, userID, todoID, actor); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (tt *todoTx) RestoreTodo(orgID, userID, todoID int64, actor *pkg.Actor) error {
+	after, err := lockTodo(tt.tx, orgID, userID, todoID, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = tt.tx.Exec("UPDATE todo SET deleted_at = NULL, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?", orgID, userID, todoID)
+	if isDuplicate(err) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", after["task"]))
+	} else if err != nil {
+		return err
+	}
+
+	a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityRestore}
+	return recordActivity(tt.tx, a, diffTodo(nil, after))
+}
+
+// PurgeTodo permanently deletes a todo from the trash.
+func (ts *todoStore) PurgeTodo(orgID, userID, todoID int64, actor *pkg.Actor) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = lockTodo(tx, orgID, userID, todoID, true); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM todo WHERE org_id = ? AND user_id = ? AND id = ?", orgID, userID, todoID); err != nil {
+		return err
+	}
+
+	a := &todoActivity{orgID: orgID, userID: userID, todoID: todoID, actor: actor, action: pkg.ActivityPurge}
+	if err = recordActivity(tx, a, map[string]pkg.FieldChange{}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeTrash permanently deletes todos that were trashed before the given time. Their trashing is
+// already recorded in the activity log, but their purging is published as an event.
+func (ts *todoStore) PurgeTrash(before time.Time) (int64, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(
+		"INSERT outbox_event (event_type, aggregate_type, aggregate_id, payload) "+
+			"SELECT ?, ?, id, JSON_OBJECT('org_id', org_id, 'user_id', user_id, 'todo_id', id, 'changes', JSON_OBJECT()) "+
+			"FROM todo WHERE deleted_at < ? ORDER BY id",
+		outbox.TodoPurged, outbox.AggregateTodo, before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("DELETE FROM todo WHERE deleted_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (ts *todoStore) CountTodos(userID int64) (*pkg.TodoCounts, error) {
+	rows, err := ts.db.Query("SELECT done, category, priority, COUNT(*) FROM todo WHERE user_id = ? AND deleted_at IS NULL GROUP BY done, category, priority", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	counts := &pkg.TodoCounts{ByCategory: make(map[string]int), ByPriority: make(map[string]int)}
+
+	for rows.Next() {
+		var (
+			done               bool
+			category, priority string
+			n                  int
+		)
+
+		if err = rows.Scan(&done, &category, &priority, &n); err != nil {
+			return nil, err
+		}
+
+		counts.Total += n
+		if done {
+			counts.Done += n
+		} else {
+			counts.Open += n
+		}
+		counts.ByCategory[category] += n
+		counts.ByPriority[priority] += n
+	}
+	return counts, rows.Err()
+}
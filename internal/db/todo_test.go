@@ -0,0 +1,332 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	lockLiveTodo = "SELECT task, done, category, priority, project_id, due_at, recurrence FROM todo " +
+		"WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NULL FOR UPDATE"
+	lockTrashedTodo = "SELECT task, done, category, priority, project_id, due_at, recurrence FROM todo " +
+		"WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NOT NULL FOR UPDATE"
+	insertActivity = "INSERT todo_activity SET org_id = ?, user_id = ?, todo_id = ?, actor_id = ?, client_id = ?, action = ?, changes = ?"
+	insertEvent    = "INSERT outbox_event SET event_type = ?, aggregate_type = ?, aggregate_id = ?, payload = ?"
+	countWebhooks  = "SELECT COUNT(*) FROM webhook WHERE org_id = ? AND user_id = ? AND active AND (events = '' OR FIND_IN_SET(?, events))"
+)
+
+// expectWebhooks expects the count of the webhooks of organization 1 and user 2 that subscribe to an event.
+func expectWebhooks(mock sqlmock.Sqlmock, event string, n int) {
+	mock.ExpectQuery(countWebhooks).WithArgs(int64(1), int64(2), event).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(n))
+}
+
+// lockedTodo returns the row lockTodo reads for a todo with the given task.
+func lockedTodo(task string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"task", "done", "category", "priority", "project_id", "due_at", "recurrence"}).
+		AddRow(task, false, "work", "low", nil, nil, "")
+}
+
+func assertStatus(assert *asserts.Assertions, code int, err error) {
+	if he, ok := err.(*echo.HTTPError); assert.True(ok, "%v", err) {
+		assert.Equal(code, he.Code)
+	}
+}
+
+// Test_TodoOrgScope checks that todos are only found within the organization and user they belong to,
+// so that the todo 5 of another organization cannot be read or changed.
+func Test_TodoOrgScope(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	mock.ExpectQuery("SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND id = ? AND deleted_at IS NULL").
+		WithArgs(int64(1), int64(2), int64(5)).WillReturnError(sql.ErrNoRows)
+	todo, err := ts.GetTodo(1, 2, 5)
+	assert.NoError(err)
+	assert.Nil(todo)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	assertStatus(assert, http.StatusNotFound, ts.UpdateTodo(1, 2, 5, 0, &pkg.TodoRequest{Task: "taken over"}, &pkg.Actor{UserID: 2}))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	assertStatus(assert, http.StatusNotFound, ts.DeleteTodo(1, 2, 5, 0, &pkg.Actor{UserID: 2}))
+}
+
+func Test_UpdateTodoRecurrence(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	const update = "UPDATE todo SET revision = revision + 1, %s WHERE id = ? AND org_id = ? AND user_id = ?"
+	weekly := sqlmock.NewRows([]string{"task", "done", "category", "priority", "project_id", "due_at", "recurrence"}).
+		AddRow("a", false, "work", "low", nil, nil, "FREQ=WEEKLY")
+
+	// Updates without a recurrence leave it alone.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(weekly)
+	mock.ExpectExec(fmt.Sprintf(update, "task = ?")).WithArgs("b", int64(5), int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"task", "done", "category", "priority", "project_id", "due_at", "recurrence"}).
+			AddRow("b", false, "work", "low", nil, nil, "FREQ=WEEKLY"),
+	)
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityUpdate, `{"task":{"from":"a","to":"b"}}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.updated", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.updated", 0)
+	mock.ExpectCommit()
+	assert.NoError(ts.UpdateTodo(1, 2, 5, 0, &pkg.TodoRequest{Task: "b"}, &pkg.Actor{UserID: 2}))
+
+	// An empty one clears it.
+	clear := ""
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"task", "done", "category", "priority", "project_id", "due_at", "recurrence"}).
+			AddRow("b", false, "work", "low", nil, nil, "FREQ=WEEKLY"),
+	)
+	mock.ExpectExec(fmt.Sprintf(update, "recurrence = ?")).WithArgs("", int64(5), int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("b"))
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityUpdate, `{"recurrence":{"from":"FREQ=WEEKLY","to":null}}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.updated", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.updated", 0)
+	mock.ExpectCommit()
+	assert.NoError(ts.UpdateTodo(1, 2, 5, 0, &pkg.TodoRequest{Recurrence: &clear}, &pkg.Actor{UserID: 2}))
+}
+
+func Test_ReplaceTodo(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	due := time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)
+
+	// The fields the request leaves empty are cleared and the todo is no longer done.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(
+		sqlmock.NewRows([]string{"task", "done", "category", "priority", "project_id", "due_at", "recurrence"}).
+			AddRow("a", true, "home", "low", nil, due, "FREQ=WEEKLY"),
+	)
+	mock.ExpectExec("UPDATE todo SET category = ?, done = ?, completed_at = ?, due_at = ?, recurrence = ?, revision = revision + 1 "+
+		"WHERE id = ? AND org_id = ? AND user_id = ?").
+		WithArgs("work", false, nil, nil, "", int64(5), int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityUpdate, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.updated", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.updated", 0)
+	mock.ExpectCommit()
+	assert.NoError(ts.ReplaceTodo(1, 2, 5, &pkg.TodoRequest{Task: "a", Category: "work", Priority: "low"}, &pkg.Actor{UserID: 2}))
+
+	// Replacing a todo with what it is already changes nothing.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectCommit()
+	assert.NoError(ts.ReplaceTodo(1, 2, 5, &pkg.TodoRequest{Task: "a", Category: "work", Priority: "low"}, &pkg.Actor{UserID: 2}))
+}
+
+func Test_ListTrash(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	deleted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT "+todoColumns+" FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC").
+		WithArgs(int64(1), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "task", "category", "priority", "project_id", "due_at", "position", "revision", "created_at",
+			"completed_at", "deleted_at", "client_uid", "recurrence",
+		}).AddRow(5, "a", "work", "low", nil, nil, "n", 3, deleted, nil, deleted, nil, ""))
+
+	todos, err := ts.ListTrash(1, 2)
+	assert.NoError(err)
+	if assert.Len(todos, 1) {
+		assert.Equal(int64(5), todos[0].Id)
+		assert.Equal(&deleted, todos[0].DeletedAt)
+	}
+}
+
+func Test_RestoreTodo(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	const restore = "UPDATE todo SET deleted_at = NULL, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec(restore).WithArgs(int64(1), int64(2), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityRestore, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).WithArgs("todo.restored", "todo", int64(5), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectWebhooks(mock, "todo.created", 0)
+	mock.ExpectCommit()
+	assert.NoError(ts.RestoreTodo(1, 2, 5, &pkg.Actor{UserID: 2}))
+
+	// A live todo with the same task keeps the trashed one where it is.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(6)).WillReturnRows(lockedTodo("b"))
+	mock.ExpectExec(restore).WithArgs(int64(1), int64(2), int64(6)).WillReturnError(&mysql.MySQLError{Number: 1062})
+	mock.ExpectRollback()
+	err := ts.RestoreTodo(1, 2, 6, &pkg.Actor{UserID: 2})
+	assertStatus(assert, http.StatusConflict, err)
+	assert.Contains(err.Error(), `"b"`)
+
+	// Only todos in the trash can be restored.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(7)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	assertStatus(assert, http.StatusNotFound, ts.RestoreTodo(1, 2, 7, &pkg.Actor{UserID: 2}))
+}
+
+func Test_PurgeTodo(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec("DELETE FROM todo WHERE org_id = ? AND user_id = ? AND id = ?").
+		WithArgs(int64(1), int64(2), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertActivity).
+		WithArgs(int64(1), int64(2), int64(5), int64(2), "", pkg.ActivityPurge, "{}").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertEvent).
+		WithArgs("todo.purged", "todo", int64(5), `{"actor_id":2,"changes":{},"client_id":"","org_id":1,"todo_id":5,"user_id":2}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.NoError(ts.PurgeTodo(1, 2, 5, &pkg.Actor{UserID: 2}))
+
+	// Live todos have to be deleted first.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockTrashedTodo).WithArgs(int64(1), int64(2), int64(6)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	assertStatus(assert, http.StatusNotFound, ts.PurgeTodo(1, 2, 6, &pkg.Actor{UserID: 2}))
+}
+
+func Test_PurgeTrash(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	before := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT outbox_event (event_type, aggregate_type, aggregate_id, payload) "+
+		"SELECT ?, ?, id, JSON_OBJECT('org_id', org_id, 'user_id', user_id, 'todo_id', id, 'changes', JSON_OBJECT()) "+
+		"FROM todo WHERE deleted_at < ? ORDER BY id").
+		WithArgs("todo.purged", "todo", before.UTC()).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM todo WHERE deleted_at < ?").WithArgs(before.UTC()).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	n, err := ts.PurgeTrash(before)
+	assert.NoError(err)
+	assert.Equal(int64(3), n)
+}
+
+func Test_TodoInTx(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(ts.InTx(func(TodoTx) error { return nil }))
+
+	// Failures roll back whatever the transaction did.
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	err := ts.InTx(func(tx TodoTx) error {
+		return tx.DeleteTodo(1, 2, 5, 0, &pkg.Actor{UserID: 2})
+	})
+	assertStatus(assert, http.StatusNotFound, err)
+}
+
+func Test_BulkTodos(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	ts := NewTodoStore(conn)
+
+	var (
+		done    = true
+		project = int64(4)
+		actor   = &pkg.Actor{UserID: 2}
+	)
+
+	// Every filter narrows the selection, which is locked before anything changes.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL AND done = ? "+
+		"AND category = ? AND priority = ? AND project_id = ? ORDER BY id FOR UPDATE").
+		WithArgs(int64(1), int64(2), true, "work", "low", int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	for _, id := range []int64{5, 6} {
+		mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), id).WillReturnRows(lockedTodo("a"))
+		mock.ExpectExec("UPDATE todo SET deleted_at = ?, revision = revision + 1 WHERE org_id = ? AND user_id = ? AND id = ?").
+			WithArgs(sqlmock.AnyArg(), int64(1), int64(2), id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertActivity).
+			WithArgs(int64(1), int64(2), id, int64(2), "", pkg.ActivityDelete, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(insertEvent).WithArgs("todo.deleted", "todo", id, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectWebhooks(mock, "todo.deleted", 0)
+	}
+	mock.ExpectCommit()
+
+	ids, err := ts.BulkTodos(1, 2, &pkg.BulkRequest{
+		Action: pkg.BulkDelete,
+		Filter: pkg.TodoFilter{Done: &done, Category: "work", Priority: "low", ProjectID: &project},
+	}, actor)
+	assert.NoError(err)
+	assert.Equal([]int64{5, 6}, ids)
+
+	// Completing skips todos that are done already.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL AND priority = ? AND NOT done ORDER BY id FOR UPDATE").
+		WithArgs(int64(1), int64(2), "high").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	ids, err = ts.BulkTodos(1, 2, &pkg.BulkRequest{Action: pkg.BulkComplete, Filter: pkg.TodoFilter{Priority: "high"}}, actor)
+	assert.NoError(err)
+	assert.Empty(ids)
+
+	// A failure on one todo leaves all of them as they were.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM todo WHERE org_id = ? AND user_id = ? AND deleted_at IS NULL AND category = ? AND NOT done ORDER BY id FOR UPDATE").
+		WithArgs(int64(1), int64(2), "home").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectQuery(lockLiveTodo).WithArgs(int64(1), int64(2), int64(5)).WillReturnRows(lockedTodo("a"))
+	mock.ExpectExec("UPDATE todo SET revision = revision + 1, done = ?, completed_at = ? WHERE id = ? AND org_id = ? AND user_id = ?").
+		WithArgs(int64(1), sqlmock.AnyArg(), int64(5), int64(1), int64(2)).WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	ids, err = ts.BulkTodos(1, 2, &pkg.BulkRequest{Action: pkg.BulkComplete, Filter: pkg.TodoFilter{Category: "home"}}, actor)
+	assert.EqualError(err, "lock wait timeout")
+	assert.Nil(ids)
+}
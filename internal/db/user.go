@@ -2,16 +2,32 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/harsha-aqfer/todo/internal/outbox"
 	"github.com/harsha-aqfer/todo/pkg"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strings"
+	"time"
 )
 
+var ErrUserNotFound = errors.New("no such user")
+
 type UserDB interface {
-	CreateUser(ui *pkg.User) error
+	CreateUser(ui *pkg.User, invitation string) error
 	GetUser(email string) (*pkg.User, error)
 	GetUserID(email string) (int64, error)
+	GetUserByID(userID int64) (*pkg.User, error)
+	UpdateUsername(userID int64, username string) error
+	UpdatePassword(userID int64, password string) error
+	SetPendingEmail(userID int64, email, tokenHash string, expiresAt time.Time) error
+	ConfirmEmail(tokenHash string) (int64, error)
+	ScheduleDeletion(userID int64, deleteAfter *time.Time) error
+	PurgeDeletedUsers(now time.Time) (int64, error)
+	SearchUsers(query string, limit, offset int) ([]pkg.User, error)
+	SetRole(userID int64, role string) error
+	SetDisabled(userID int64, disabled bool) error
 }
 
 type userStore struct {
@@ -22,23 +38,76 @@ func NewUserStore(db *sql.DB) UserDB {
 	return &userStore{db: db}
 }
 
-func (us *userStore) CreateUser(ui *pkg.User) error {
-	_, err := us.db.Exec("INSERT user SET email = ?, user_name = ?, password = ?", ui.Email, ui.Username, ui.Password)
-	return err
+const userColumns = "id, email, user_name, password, role, created_at, updated_at, delete_after, disabled_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (us *userStore) GetUser(email string) (*pkg.User, error) {
-	row := us.db.QueryRow("SELECT email, user_name, password FROM user WHERE email = ?", email)
+func scanUser(row scanner) (*pkg.User, error) {
+	var (
+		r      = pkg.User{}
+		da, dd sql.NullTime
+	)
+
+	if err := row.Scan(&r.ID, &r.Email, &r.Username, &r.Password, &r.Role, &r.CreatedAt, &r.UpdatedAt, &da, &dd); err != nil {
+		return nil, err
+	}
+	if da.Valid {
+		r.DeleteAfter = &da.Time
+	}
+	if dd.Valid {
+		r.DisabledAt = &dd.Time
+	}
+	return &r, nil
+}
 
-	r := pkg.User{}
-	err := row.Scan(&r.Email, &r.Username, &r.Password)
+// CreateUser creates the user. With the hash of an invitation, the user joins its organization in the
+// same transaction, so that the account is only created if the invitation is still valid.
+func (us *userStore) CreateUser(ui *pkg.User, invitation string) error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.Exec("INSERT user SET email = ?, user_name = ?, password = ?", ui.Email, ui.Username, ui.Password)
+	if isDuplicate(err) {
+		return echo.NewHTTPError(http.StatusConflict, "email already registered")
+	} else if err != nil {
+		return err
+	}
+
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if invitation != "" {
+		if err = acceptInvitation(tx, invitation, userID); err != nil {
+			return err
+		}
+	}
+
+	payload := map[string]interface{}{"user_id": userID, "email": ui.Email, "user_name": ui.Username}
+	if err = writeEvent(tx, outbox.UserSignedUp, outbox.AggregateUser, userID, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (us *userStore) GetUser(email string) (*pkg.User, error) {
+	r, err := scanUser(us.db.QueryRow("SELECT "+userColumns+" FROM user WHERE email = ?", email))
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no such user: %s", email)
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, email)
 	} else if err != nil {
 		return nil, err
 	}
-	return &r, nil
+	return r, nil
 }
 
 func (us *userStore) GetUserID(email string) (int64, error) {
@@ -54,3 +123,197 @@ func (us *userStore) GetUserID(email string) (int64, error) {
 	}
 	return r, nil
 }
+
+func (us *userStore) GetUserByID(userID int64) (*pkg.User, error) {
+	r, err := scanUser(us.db.QueryRow("SELECT "+userColumns+" FROM user WHERE id = ?", userID))
+
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such user: %d", userID))
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (us *userStore) UpdateUsername(userID int64, username string) error {
+	_, err := us.db.Exec("UPDATE user SET user_name = ? WHERE id = ?", username, userID)
+	return err
+}
+
+func (us *userStore) UpdatePassword(userID int64, password string) error {
+	_, err := us.db.Exec("UPDATE user SET password = ? WHERE id = ?", password, userID)
+	return err
+}
+
+// SetPendingEmail stores the address a user wants to switch to together with the hash of the
+// verification token that was mailed to it. The current email stays active until ConfirmEmail.
+func (us *userStore) SetPendingEmail(userID int64, email, tokenHash string, expiresAt time.Time) error {
+	_, err := us.db.Exec(
+		"UPDATE user SET pending_email = ?, email_token = ?, email_token_expires_at = ? WHERE id = ?",
+		email, tokenHash, expiresAt.UTC(), userID,
+	)
+	return err
+}
+
+// ConfirmEmail promotes the pending email matching the token hash and returns the owning user id.
+func (us *userStore) ConfirmEmail(tokenHash string) (int64, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var (
+		userID int64
+		email  string
+	)
+	err = tx.QueryRow(
+		"SELECT id, pending_email FROM user WHERE email_token = ? AND pending_email IS NOT NULL AND email_token_expires_at > ? FOR UPDATE",
+		tokenHash, time.Now().UTC(),
+	).Scan(&userID, &email)
+
+	if err == sql.ErrNoRows {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification token")
+	} else if err != nil {
+		return 0, err
+	}
+
+	// The address may have been taken by another account since the change was requested.
+	_, err = tx.Exec(
+		"UPDATE user SET email = pending_email, pending_email = NULL, email_token = NULL, email_token_expires_at = NULL WHERE id = ?",
+		userID,
+	)
+	if isDuplicate(err) {
+		return 0, echo.NewHTTPError(http.StatusConflict, "email is already in use")
+	} else if err != nil {
+		return 0, err
+	}
+
+	payload := map[string]interface{}{"user_id": userID, "email": email}
+	if err = writeEvent(tx, outbox.UserEmailChanged, outbox.AggregateUser, userID, payload); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// ScheduleDeletion marks the account for removal after deleteAfter. A nil deleteAfter cancels
+// a previously scheduled deletion.
+func (us *userStore) ScheduleDeletion(userID int64, deleteAfter *time.Time) error {
+	var (
+		v         interface{}
+		eventType = outbox.UserDeletionCanceled
+		payload   = map[string]interface{}{"user_id": userID}
+	)
+
+	if deleteAfter != nil {
+		v = deleteAfter.UTC()
+		eventType = outbox.UserDeletionScheduled
+		payload["delete_after"] = deleteAfter.UTC()
+	}
+
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.Exec("UPDATE user SET delete_after = ? WHERE id = ?", v, userID); err != nil {
+		return err
+	}
+
+	if err = writeEvent(tx, eventType, outbox.AggregateUser, userID, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeDeletedUsers removes accounts whose grace period is over. Todos and sessions are removed
+// by the ON DELETE CASCADE constraints, without events of their own.
+func (us *userStore) PurgeDeletedUsers(now time.Time) (int64, error) {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(
+		"INSERT outbox_event (event_type, aggregate_type, aggregate_id, payload) "+
+			"SELECT ?, ?, id, JSON_OBJECT('user_id', id) FROM user WHERE delete_after IS NOT NULL AND delete_after <= ? ORDER BY id",
+		outbox.UserDeleted, outbox.AggregateUser, now.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("DELETE FROM user WHERE delete_after IS NOT NULL AND delete_after <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// SearchUsers matches query against email and user name. An empty query lists every user.
+func (us *userStore) SearchUsers(query string, limit, offset int) ([]pkg.User, error) {
+	var (
+		q      = "SELECT " + userColumns + " FROM user"
+		params []interface{}
+	)
+
+	if query != "" {
+		like := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(query) + "%"
+		q += " WHERE email LIKE ? OR user_name LIKE ?"
+		params = append(params, like, like)
+	}
+
+	q += " ORDER BY id LIMIT ? OFFSET ?"
+	params = append(params, limit, offset)
+
+	rows, err := us.db.Query(q, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	users := make([]pkg.User, 0)
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		u.Password = ""
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (us *userStore) SetRole(userID int64, role string) error {
+	_, err := us.db.Exec("UPDATE user SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
+func (us *userStore) SetDisabled(userID int64, disabled bool) error {
+	var v interface{}
+	if disabled {
+		v = time.Now().UTC()
+	}
+	_, err := us.db.Exec("UPDATE user SET disabled_at = ? WHERE id = ?", v, userID)
+	return err
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test_CreateUser checks that invited users join the organization in the transaction that creates
+// them, so that an invalid invitation leaves no account behind.
+func Test_CreateUser(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	us := NewUserStore(conn)
+
+	const (
+		insertUser   = "INSERT user SET email = ?, user_name = ?, password = ?"
+		insertMember = "INSERT org_member (org_id, user_id, role) SELECT org_id, ?, role FROM org_invitation WHERE token_hash = ? AND expires_at > ?"
+	)
+
+	u := &pkg.User{Email: "ann@example.org", Username: "ann", Password: "hash"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertUser).WithArgs("ann@example.org", "ann", "hash").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(insertMember).WithArgs(int64(3), "invitation", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM org_invitation WHERE token_hash = ?").WithArgs("invitation").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT outbox_event SET event_type = ?, aggregate_type = ?, aggregate_id = ?, payload = ?").
+		WithArgs("user.signed_up", "user", int64(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(us.CreateUser(u, "invitation"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertUser).WithArgs("ann@example.org", "ann", "hash").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(insertMember).WithArgs(int64(3), "expired", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := us.CreateUser(u, "expired")
+	if he, ok := err.(*echo.HTTPError); assert.True(ok) {
+		assert.Equal(http.StatusBadRequest, he.Code)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertUser).WithArgs("ann@example.org", "ann", "hash").WillReturnError(&mysql.MySQLError{Number: 1062})
+	mock.ExpectRollback()
+
+	err = us.CreateUser(u, "")
+	if he, ok := err.(*echo.HTTPError); assert.True(ok) {
+		assert.Equal(http.StatusConflict, he.Code)
+	}
+}
+
+func Test_ConfirmEmail(t *testing.T) {
+	assert := asserts.New(t)
+
+	conn, mock := newMock(t)
+	us := NewUserStore(conn)
+
+	const selectPending = "SELECT id, pending_email FROM user WHERE email_token = ? AND pending_email IS NOT NULL " +
+		"AND email_token_expires_at > ? FOR UPDATE"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPending).WithArgs("hash", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "pending_email"}).AddRow(1, "ann@example.org"))
+	mock.ExpectExec("UPDATE user SET email = pending_email, pending_email = NULL, email_token = NULL, email_token_expires_at = NULL WHERE id = ?").
+		WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT outbox_event SET event_type = ?, aggregate_type = ?, aggregate_id = ?, payload = ?").
+		WithArgs("user.email_changed", "user", int64(1), `{"email":"ann@example.org","user_id":1}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	userID, err := us.ConfirmEmail("hash")
+	assert.NoError(err)
+	assert.Equal(int64(1), userID)
+
+	// Unknown and expired tokens change nothing.
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPending).WithArgs("other", sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err = us.ConfirmEmail("other")
+	if he, ok := err.(*echo.HTTPError); assert.True(ok) {
+		assert.Equal(http.StatusBadRequest, he.Code)
+	}
+
+	// Addresses taken by another account in the meantime conflict.
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPending).WithArgs("taken", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "pending_email"}).AddRow(1, "bob@example.org"))
+	mock.ExpectExec("UPDATE user SET email = pending_email, pending_email = NULL, email_token = NULL, email_token_expires_at = NULL WHERE id = ?").
+		WithArgs(int64(1)).WillReturnError(&mysql.MySQLError{Number: 1062})
+	mock.ExpectRollback()
+
+	_, err = us.ConfirmEmail("taken")
+	if he, ok := err.(*echo.HTTPError); assert.True(ok) {
+		assert.Equal(http.StatusConflict, he.Code)
+	}
+}
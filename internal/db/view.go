@@ -0,0 +1,116 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ViewDB interface {
+	ListViews(orgID, userID int64) ([]pkg.View, error)
+	GetView(orgID, userID, viewID int64) (*pkg.View, error)
+	CreateView(orgID, userID int64, vr *pkg.ViewRequest) (int64, error)
+	UpdateView(orgID, userID, viewID int64, vr *pkg.ViewRequest) error
+	DeleteView(orgID, userID, viewID int64) error
+}
+
+type viewStore struct {
+	db *sql.DB
+}
+
+func NewViewStore(db *sql.DB) ViewDB {
+	return &viewStore{db: db}
+}
+
+const viewColumns = "id, name, query, sort, pinned, created_at, updated_at"
+
+func scanView(row scanner) (*pkg.View, error) {
+	v := pkg.View{}
+	if err := row.Scan(&v.ID, &v.Name, &v.Query, &v.Sort, &v.Pinned, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListViews returns the saved views of the user in the organization, pinned ones first.
+func (vs *viewStore) ListViews(orgID, userID int64) ([]pkg.View, error) {
+	rows, err := vs.db.Query(
+		"SELECT "+viewColumns+" FROM view WHERE org_id = ? AND user_id = ? ORDER BY pinned DESC, name",
+		orgID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	views := make([]pkg.View, 0)
+
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, *v)
+	}
+	return views, rows.Err()
+}
+
+func (vs *viewStore) GetView(orgID, userID, viewID int64) (*pkg.View, error) {
+	row := vs.db.QueryRow(
+		"SELECT "+viewColumns+" FROM view WHERE org_id = ? AND user_id = ? AND id = ?",
+		orgID, userID, viewID,
+	)
+
+	v, err := scanView(row)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such view: %d", viewID))
+	} else if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (vs *viewStore) CreateView(orgID, userID int64, vr *pkg.ViewRequest) (int64, error) {
+	res, err := vs.db.Exec(
+		"INSERT view SET org_id = ?, user_id = ?, name = ?, query = ?, sort = ?, pinned = ?",
+		orgID, userID, vr.Name, vr.Query, vr.Sort, vr.Pinned,
+	)
+	if isDuplicate(err) {
+		return 0, echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("view already exists: %s", vr.Name))
+	} else if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateView replaces the view. Callers check that it exists first, since MySQL reports no affected
+// rows for an update that changes nothing.
+func (vs *viewStore) UpdateView(orgID, userID, viewID int64, vr *pkg.ViewRequest) error {
+	_, err := vs.db.Exec(
+		"UPDATE view SET name = ?, query = ?, sort = ?, pinned = ? WHERE org_id = ? AND user_id = ? AND id = ?",
+		vr.Name, vr.Query, vr.Sort, vr.Pinned, orgID, userID, viewID,
+	)
+	if isDuplicate(err) {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("view already exists: %s", vr.Name))
+	}
+	return err
+}
+
+func (vs *viewStore) DeleteView(orgID, userID, viewID int64) error {
+	res, err := vs.db.Exec("DELETE FROM view WHERE org_id = ? AND user_id = ? AND id = ?", orgID, userID, viewID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such view: %d", viewID))
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/webhook"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type WebhookDB interface {
+	webhook.Store
+	ListWebhooks(orgID, userID int64) ([]pkg.Webhook, error)
+	GetWebhook(orgID, userID, webhookID int64) (*pkg.Webhook, error)
+	CreateWebhook(orgID, userID int64, url, secret string, events []string) (int64, error)
+	UpdateWebhook(orgID, userID, webhookID int64, wr *pkg.WebhookRequest) error
+	DeleteWebhook(orgID, userID, webhookID int64) error
+	ListDeliveries(webhookID int64, limit, offset int) ([]pkg.WebhookDelivery, error)
+	GetDelivery(webhookID, deliveryID int64) (*pkg.WebhookDelivery, error)
+	Redeliver(webhookID, deliveryID int64) (int64, error)
+	PurgeDeliveries(before time.Time) (int64, error)
+}
+
+type webhookStore struct {
+	db *sql.DB
+}
+
+func NewWebhookStore(db *sql.DB) WebhookDB {
+	return &webhookStore{db: db}
+}
+
+// maxErrorLen is the length of the error columns of deliveries and attempts.
+const maxErrorLen = 1024
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+const webhookColumns = "id, url, events, active, failure_count, disabled_at, created_at"
+
+func scanWebhook(row scanner) (*pkg.Webhook, error) {
+	var (
+		w        = pkg.Webhook{}
+		events   string
+		disabled sql.NullTime
+	)
+
+	if err := row.Scan(&w.ID, &w.URL, &events, &w.Active, &w.FailureCount, &disabled, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	w.Events = make([]string, 0)
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	if disabled.Valid {
+		w.DisabledAt = &disabled.Time
+	}
+	return &w, nil
+}
+
+func (ws *webhookStore) ListWebhooks(orgID, userID int64) ([]pkg.Webhook, error) {
+	rows, err := ws.db.Query("SELECT "+webhookColumns+" FROM webhook WHERE org_id = ? AND user_id = ? ORDER BY id", orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	webhooks := make([]pkg.Webhook, 0)
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (ws *webhookStore) GetWebhook(orgID, userID, webhookID int64) (*pkg.Webhook, error) {
+	w, err := scanWebhook(ws.db.QueryRow(
+		"SELECT "+webhookColumns+" FROM webhook WHERE org_id = ? AND user_id = ? AND id = ?",
+		orgID, userID, webhookID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such webhook: %d", webhookID))
+	} else if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (ws *webhookStore) CreateWebhook(orgID, userID int64, url, secret string, events []string) (int64, error) {
+	res, err := ws.db.Exec(
+		"INSERT webhook SET org_id = ?, user_id = ?, url = ?, secret = ?, events = ?",
+		orgID, userID, url, secret, strings.Join(events, ","),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateWebhook replaces the url and events of the webhook, and activates or deactivates it if asked
+// to. Activating a webhook clears its failures.
+func (ws *webhookStore) UpdateWebhook(orgID, userID, webhookID int64, wr *pkg.WebhookRequest) error {
+	var (
+		qs     = []string{"url = ?", "events = ?"}
+		params = []interface{}{wr.URL, strings.Join(wr.Events, ",")}
+	)
+
+	if wr.Active != nil {
+		qs = append(qs, "active = ?")
+		params = append(params, *wr.Active)
+
+		if *wr.Active {
+			qs = append(qs, "failure_count = 0", "disabled_at = NULL")
+		}
+	}
+
+	params = append(params, orgID, userID, webhookID)
+	_, err := ws.db.Exec(fmt.Sprintf("UPDATE webhook SET %s WHERE org_id = ? AND user_id = ? AND id = ?", strings.Join(qs, ", ")), params...)
+	return err
+}
+
+// DeleteWebhook removes the webhook together with its deliveries.
+func (ws *webhookStore) DeleteWebhook(orgID, userID, webhookID int64) error {
+	res, err := ws.db.Exec("DELETE FROM webhook WHERE org_id = ? AND user_id = ? AND id = ?", orgID, userID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such webhook: %d", webhookID))
+	}
+	return nil
+}
+
+// subscribedWebhooks selects the active webhooks of an organization and user that subscribe to an event.
+const subscribedWebhooks = "FROM webhook WHERE org_id = ? AND user_id = ? AND active AND (events = '' OR FIND_IN_SET(?, events))"
+
+// webhookEvent returns the event webhooks get for an activity, or "" if they get none. To webhooks a
+// restored todo is a new one, and purged todos were deleted before.
+func webhookEvent(action string, changes map[string]pkg.FieldChange) string {
+	switch action {
+	case pkg.ActivityCreate, pkg.ActivityRestore:
+		return pkg.EventTodoCreated
+	case pkg.ActivityDelete:
+		return pkg.EventTodoDeleted
+	case pkg.ActivityPurge:
+		return ""
+	}
+
+	if c, ok := changes["done"]; ok && c.To == true {
+		return pkg.EventTodoCompleted
+	}
+	return pkg.EventTodoUpdated
+}
+
+// enqueueTodoEvent queues the event of a todo for every webhook of its owner that subscribes to it. It
+// runs in the transaction of the change, so that the deliveries are committed with the change or not
+// at all.
+func enqueueTodoEvent(tx *sql.Tx, orgID, userID, todoID int64, event string) error {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) "+subscribedWebhooks, orgID, userID, event).Scan(&n); err != nil || n == 0 {
+		return err
+	}
+
+	e := &pkg.TodoEvent{ID: uuid.NewV4().String(), Type: event, TodoID: todoID, Time: time.Now().UTC()}
+
+	if event != pkg.EventTodoDeleted {
+		t, err := scanTodo(tx.QueryRow("SELECT "+todoColumns+" FROM todo WHERE id = ?", todoID))
+		if err != nil {
+			return err
+		}
+		e.Todo = t
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO webhook_delivery (webhook_id, event, payload, status, next_attempt_at) SELECT id, ?, ?, ?, ? "+subscribedWebhooks,
+		event, payload, pkg.WebhookPending, time.Now().UTC(), orgID, userID, event,
+	)
+	return err
+}
+
+func (ws *webhookStore) ClaimDeliveries(now time.Time, limit int, lease time.Duration) ([]webhook.Job, error) {
+	tx, err := ws.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.Query(
+		"SELECT d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.attempts FROM webhook_delivery d "+
+			"JOIN webhook w ON w.id = d.webhook_id WHERE d.status = ? AND d.next_attempt_at <= ? AND w.active "+
+			"ORDER BY d.next_attempt_at, d.id LIMIT ? FOR UPDATE SKIP LOCKED",
+		pkg.WebhookPending, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		jobs   []webhook.Job
+		ids    []string
+		params = []interface{}{now.Add(lease).UTC()}
+	)
+
+	for rows.Next() {
+		var j webhook.Job
+		if err = rows.Scan(&j.DeliveryID, &j.WebhookID, &j.URL, &j.Secret, &j.Event, &j.Payload, &j.Attempts); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, j)
+		ids = append(ids, "?")
+		params = append(params, j.DeliveryID)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	// Other dispatchers skip the claimed deliveries until the lease ends.
+	if _, err = tx.Exec("UPDATE webhook_delivery SET next_attempt_at = ? WHERE id IN ("+strings.Join(ids, ", ")+")", params...); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (ws *webhookStore) RecordAttempt(job *webhook.Job, a *pkg.WebhookAttempt, status string, next time.Time, disableAfter int) error {
+	tx, err := ws.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	errMsg := truncate(a.Error, maxErrorLen)
+
+	_, err = tx.Exec(
+		"INSERT webhook_attempt SET delivery_id = ?, status_code = ?, error = ?, duration_ms = ?",
+		job.DeliveryID, a.StatusCode, errMsg, a.DurationMS,
+	)
+	if err != nil {
+		return err
+	}
+
+	var nextAt interface{}
+	if status == pkg.WebhookPending {
+		nextAt = next.UTC()
+	}
+
+	_, err = tx.Exec(
+		"UPDATE webhook_delivery SET attempts = attempts + 1, status = ?, next_attempt_at = ?, last_status_code = ?, last_error = ? WHERE id = ?",
+		status, nextAt, a.StatusCode, errMsg, job.DeliveryID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if a.Error == "" {
+		_, err = tx.Exec("UPDATE webhook SET failure_count = 0 WHERE id = ?", job.WebhookID)
+	} else {
+		_, err = tx.Exec("UPDATE webhook SET failure_count = failure_count + 1 WHERE id = ?", job.WebhookID)
+		if err == nil && disableAfter > 0 {
+			_, err = tx.Exec(
+				"UPDATE webhook SET active = 0, disabled_at = ? WHERE id = ? AND active AND failure_count >= ?",
+				time.Now().UTC(), job.WebhookID, disableAfter,
+			)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, last_status_code, last_error, next_attempt_at, created_at"
+
+func scanDelivery(row scanner) (*pkg.WebhookDelivery, error) {
+	var (
+		d       = pkg.WebhookDelivery{}
+		payload []byte
+		next    sql.NullTime
+	)
+
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.AttemptCount, &d.LastStatusCode, &d.LastError, &next, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = payload
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	return &d, nil
+}
+
+// ListDeliveries returns the deliveries of the webhook, newest first.
+func (ws *webhookStore) ListDeliveries(webhookID int64, limit, offset int) ([]pkg.WebhookDelivery, error) {
+	rows, err := ws.db.Query(
+		"SELECT "+deliveryColumns+" FROM webhook_delivery WHERE webhook_id = ? ORDER BY id DESC LIMIT ? OFFSET ?",
+		webhookID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	deliveries := make([]pkg.WebhookDelivery, 0)
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetDelivery returns the delivery with the log of its attempts.
+func (ws *webhookStore) GetDelivery(webhookID, deliveryID int64) (*pkg.WebhookDelivery, error) {
+	d, err := scanDelivery(ws.db.QueryRow(
+		"SELECT "+deliveryColumns+" FROM webhook_delivery WHERE webhook_id = ? AND id = ?",
+		webhookID, deliveryID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such delivery: %d", deliveryID))
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := ws.db.Query(
+		"SELECT status_code, error, duration_ms, created_at FROM webhook_attempt WHERE delivery_id = ? ORDER BY id",
+		deliveryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	d.Attempts = make([]pkg.WebhookAttempt, 0)
+
+	for rows.Next() {
+		a := pkg.WebhookAttempt{}
+		if err = rows.Scan(&a.StatusCode, &a.Error, &a.DurationMS, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.Attempts = append(d.Attempts, a)
+	}
+	return d, rows.Err()
+}
+
+// Redeliver queues the payload of a delivery again as a new delivery, and returns its id.
+func (ws *webhookStore) Redeliver(webhookID, deliveryID int64) (int64, error) {
+	res, err := ws.db.Exec(
+		"INSERT INTO webhook_delivery (webhook_id, event, payload, status, next_attempt_at) "+
+			"SELECT webhook_id, event, payload, ?, ? FROM webhook_delivery WHERE webhook_id = ? AND id = ?",
+		pkg.WebhookPending, time.Now().UTC(), webhookID, deliveryID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such delivery: %d", deliveryID))
+	}
+	return res.LastInsertId()
+}
+
+// PurgeDeliveries deletes finished deliveries created before the given time, with their attempts.
+func (ws *webhookStore) PurgeDeliveries(before time.Time) (int64, error) {
+	res, err := ws.db.Exec("DELETE FROM webhook_delivery WHERE status != ? AND created_at < ?", pkg.WebhookPending, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,43 @@
+// Package events delivers todo changes to the event streams of their owners.
+//
+// A Broker fans events out to the subscribers of a topic and keeps enough history for subscribers to
+// resume after a reconnect. The in-process broker serves a single instance. Deployments with several
+// instances plug in a Broker backed by a shared system, so that a change made through one instance
+// reaches streams served by the others.
+package events
+
+import (
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+)
+
+// ErrGone is returned by Subscribe when the events after the given id are no longer available.
+// Subscribers have to reload their state and subscribe again without an id.
+var ErrGone = errors.New("events: last event id is no longer available")
+
+// Broker publishes events to topics.
+type Broker interface {
+	// Publish assigns the event its id and delivers it to the current subscribers of the topic.
+	Publish(topic string, e *pkg.TodoEvent) error
+
+	// Subscribe subscribes to the topic. With a non-empty lastID, the events published after the event
+	// with that id are delivered first.
+	Subscribe(topic, lastID string) (Subscription, error)
+}
+
+// Subscription is a stream of events of a topic.
+type Subscription interface {
+	// Events returns the events of the subscription. The channel is closed when the subscription is
+	// closed, or when the subscriber falls too far behind. In that case it resumes by subscribing again
+	// with the id of the last event it received.
+	Events() <-chan pkg.TodoEvent
+
+	// Close ends the subscription.
+	Close()
+}
+
+// Topic returns the topic of the todo events of a user in an organization.
+func Topic(orgID, userID int64) string {
+	return fmt.Sprintf("org.%d.user.%d", orgID, userID)
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriptionBuffer is the number of events a subscriber may fall behind before it is dropped.
+const subscriptionBuffer = 64
+
+type published struct {
+	topic string
+	seq   uint64
+	event pkg.TodoEvent
+}
+
+type memoryBroker struct {
+	mu      sync.Mutex
+	epoch   string
+	seq     uint64
+	history []published
+	size    int
+	subs    map[string]map[*memorySubscription]struct{}
+}
+
+// NewMemoryBroker returns a Broker for a single instance that keeps the last size events for resuming
+// subscribers. Event ids are only valid for the lifetime of the broker.
+func NewMemoryBroker(size int) Broker {
+	return &memoryBroker{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  size,
+		subs:  make(map[string]map[*memorySubscription]struct{}),
+	}
+}
+
+func (mb *memoryBroker) Publish(topic string, e *pkg.TodoEvent) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.seq++
+	e.ID = fmt.Sprintf("%s-%d", mb.epoch, mb.seq)
+
+	if mb.size > 0 {
+		if len(mb.history) == mb.size {
+			copy(mb.history, mb.history[1:])
+			mb.history = mb.history[:mb.size-1]
+		}
+		mb.history = append(mb.history, published{topic: topic, seq: mb.seq, event: *e})
+	}
+
+	for sub := range mb.subs[topic] {
+		select {
+		case sub.ch <- *e:
+		default:
+			mb.drop(topic, sub)
+		}
+	}
+	return nil
+}
+
+// replay returns the events of the topic after lastID. The caller holds the lock.
+func (mb *memoryBroker) replay(topic, lastID string) ([]pkg.TodoEvent, error) {
+	epoch, seqStr, ok := strings.Cut(lastID, "-")
+	if !ok || epoch != mb.epoch {
+		return nil, ErrGone
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > mb.seq {
+		return nil, ErrGone
+	}
+
+	// Every event after seq has to still be in the history.
+	if seq < mb.seq && (len(mb.history) == 0 || mb.history[0].seq > seq+1) {
+		return nil, ErrGone
+	}
+
+	var events []pkg.TodoEvent
+	for _, p := range mb.history {
+		if p.seq > seq && p.topic == topic {
+			events = append(events, p.event)
+		}
+	}
+	return events, nil
+}
+
+func (mb *memoryBroker) Subscribe(topic, lastID string) (Subscription, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	var backlog []pkg.TodoEvent
+	if lastID != "" {
+		var err error
+		if backlog, err = mb.replay(topic, lastID); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &memorySubscription{
+		broker: mb,
+		topic:  topic,
+		ch:     make(chan pkg.TodoEvent, len(backlog)+subscriptionBuffer),
+	}
+	for _, e := range backlog {
+		sub.ch <- e
+	}
+
+	if mb.subs[topic] == nil {
+		mb.subs[topic] = make(map[*memorySubscription]struct{})
+	}
+	mb.subs[topic][sub] = struct{}{}
+	return sub, nil
+}
+
+// drop ends the subscription. The caller holds the lock.
+func (mb *memoryBroker) drop(topic string, sub *memorySubscription) {
+	if _, ok := mb.subs[topic][sub]; !ok {
+		return
+	}
+
+	delete(mb.subs[topic], sub)
+	if len(mb.subs[topic]) == 0 {
+		delete(mb.subs, topic)
+	}
+	close(sub.ch)
+}
+
+type memorySubscription struct {
+	broker *memoryBroker
+	topic  string
+	ch     chan pkg.TodoEvent
+}
+
+func (ms *memorySubscription) Events() <-chan pkg.TodoEvent {
+	return ms.ch
+}
+
+func (ms *memorySubscription) Close() {
+	ms.broker.mu.Lock()
+	defer ms.broker.mu.Unlock()
+
+	ms.broker.drop(ms.topic, ms)
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func receive(sub Subscription) []int64 {
+	var ids []int64
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return ids
+			}
+			ids = append(ids, e.TodoID)
+		default:
+			return ids
+		}
+	}
+}
+
+func Test_MemoryBroker(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		b     = NewMemoryBroker(3)
+		mine  = Topic(1, 1)
+		other = Topic(1, 2)
+	)
+
+	sub, err := b.Subscribe(mine, "")
+	assert.NoError(err)
+
+	first := &pkg.TodoEvent{Type: pkg.EventTodoCreated, TodoID: 1}
+	assert.NoError(b.Publish(mine, first))
+	assert.NoError(b.Publish(other, &pkg.TodoEvent{Type: pkg.EventTodoCreated, TodoID: 2}))
+	assert.NoError(b.Publish(mine, &pkg.TodoEvent{Type: pkg.EventTodoUpdated, TodoID: 3}))
+
+	assert.NotEmpty(first.ID)
+	assert.Equal([]int64{1, 3}, receive(sub))
+
+	// Resuming replays the events of the topic after the given one.
+	resumed, err := b.Subscribe(mine, first.ID)
+	assert.NoError(err)
+	assert.Equal([]int64{3}, receive(resumed))
+
+	assert.NoError(b.Publish(mine, &pkg.TodoEvent{Type: pkg.EventTodoDeleted, TodoID: 4}))
+	assert.Equal([]int64{4}, receive(resumed))
+
+	// The history holds three events. Once the event after the first is gone, it can't be resumed from.
+	_, err = b.Subscribe(mine, first.ID)
+	assert.NoError(err)
+
+	assert.NoError(b.Publish(other, &pkg.TodoEvent{Type: pkg.EventTodoCreated, TodoID: 5}))
+
+	_, err = b.Subscribe(mine, first.ID)
+	assert.Equal(ErrGone, err)
+
+	_, err = b.Subscribe(mine, "other-epoch-1")
+	assert.Equal(ErrGone, err)
+
+	assert.Equal([]int64{4}, receive(sub))
+
+	sub.Close()
+	sub.Close()
+
+	_, ok := <-sub.Events()
+	assert.False(ok)
+}
+
+func Test_MemoryBrokerDropsSlowSubscribers(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		b     = NewMemoryBroker(100)
+		topic = Topic(1, 1)
+	)
+
+	sub, err := b.Subscribe(topic, "")
+	assert.NoError(err)
+
+	var last string
+	for i := 0; i <= subscriptionBuffer; i++ {
+		e := &pkg.TodoEvent{Type: pkg.EventTodoUpdated, TodoID: int64(i)}
+		assert.NoError(b.Publish(topic, e))
+		if i == subscriptionBuffer-1 {
+			last = e.ID
+		}
+	}
+
+	// The subscription got the events that fit its buffer and was closed.
+	assert.Len(receive(sub), subscriptionBuffer)
+
+	resumed, err := b.Subscribe(topic, last)
+	assert.NoError(err)
+	assert.Equal([]int64{subscriptionBuffer}, receive(resumed))
+}
@@ -0,0 +1,149 @@
+// Package ical writes todos as iCalendar (RFC 5545) VTODO components.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar data.
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	prodID        = "-//Todo//Todo//EN"
+	maxLineOctets = 75
+	dateTimeUTC   = "20060102T150405Z"
+)
+
+// Priorities of VTODOs. RFC 5545 ranks 1 to 4 as high, 5 as medium and 6 to 9 as low.
+const (
+	PriorityHigh   = 1
+	PriorityMedium = 5
+	PriorityLow    = 9
+)
+
+var priorities = map[string]int{"high": PriorityHigh, "medium": PriorityMedium, "low": PriorityLow}
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeUTC)
+}
+
+// Encoder writes a calendar of VTODOs. Calls after an error do nothing, and End reports the error.
+type Encoder struct {
+	w      *bufio.Writer
+	domain string
+	err    error
+}
+
+// NewEncoder returns an encoder that writes to w. Todos without a client UID get the UID
+// todo-<id>@<domain>.
+func NewEncoder(w io.Writer, domain string) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w), domain: domain}
+}
+
+// line writes a content line, folded after 75 octets without splitting characters.
+func (e *Encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+
+	var (
+		s     = name + ":" + value
+		limit = maxLineOctets
+	)
+
+	for len(s) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+
+		if _, e.err = e.w.WriteString(s[:n] + "\r\n "); e.err != nil {
+			return
+		}
+		s = s[n:]
+
+		// The leading space of continuation lines counts towards their length.
+		limit = maxLineOctets - 1
+	}
+	_, e.err = e.w.WriteString(s + "\r\n")
+}
+
+// Begin starts the calendar. The name is shown by calendar apps.
+func (e *Encoder) Begin(name string) {
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", prodID)
+	e.line("CALSCALE", "GREGORIAN")
+
+	if name != "" {
+		e.line("X-WR-CALNAME", escapeText(name))
+	}
+}
+
+// UID returns the UID of the todo's VTODO.
+func (e *Encoder) UID(t *pkg.TodoResponse) string {
+	if t.ClientUID != "" {
+		return t.ClientUID
+	}
+	return fmt.Sprintf("todo-%d@%s", t.Id, e.domain)
+}
+
+// Todo writes a todo as VTODO. now is its DTSTAMP.
+func (e *Encoder) Todo(t *pkg.TodoResponse, now time.Time) {
+	e.line("BEGIN", "VTODO")
+	e.line("UID", escapeText(e.UID(t)))
+	e.line("DTSTAMP", formatTime(now))
+
+	if t.CreatedAt != nil {
+		e.line("CREATED", formatTime(*t.CreatedAt))
+	}
+
+	e.line("SUMMARY", escapeText(t.Task))
+
+	if p, ok := priorities[t.Priority]; ok {
+		e.line("PRIORITY", fmt.Sprint(p))
+	}
+
+	if t.CompletedAt != nil {
+		e.line("STATUS", "COMPLETED")
+		e.line("COMPLETED", formatTime(*t.CompletedAt))
+	} else {
+		e.line("STATUS", "NEEDS-ACTION")
+	}
+
+	if t.DueAt != nil {
+		e.line("DUE", formatTime(*t.DueAt))
+	}
+
+	if t.Category != "" {
+		e.line("CATEGORIES", escapeText(t.Category))
+	}
+
+	if t.Recurrence != "" {
+		e.line("RRULE", t.Recurrence)
+	}
+
+	e.line("SEQUENCE", fmt.Sprint(t.Revision))
+	e.line("END", "VTODO")
+}
+
+// End ends the calendar and flushes it.
+func (e *Encoder) End() error {
+	e.line("END", "VCALENDAR")
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
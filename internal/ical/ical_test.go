@@ -0,0 +1,120 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Encoder(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		created   = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		due       = time.Date(2026, 1, 9, 17, 0, 0, 0, time.FixedZone("CET", 3600))
+		completed = time.Date(2026, 1, 8, 12, 0, 0, 0, time.UTC)
+		now       = time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+		buf       bytes.Buffer
+	)
+
+	enc := NewEncoder(&buf, "todo.example.com")
+	enc.Begin("Work")
+	enc.Todo(&pkg.TodoResponse{Id: 7, Task: "Call Bob; then, Alice", Category: "work", Priority: "high", DueAt: &due, CreatedAt: &created, Revision: 3, Recurrence: "FREQ=WEEKLY"}, now)
+	enc.Todo(&pkg.TodoResponse{Id: 8, Task: "Done", Priority: "low", CompletedAt: &completed, ClientUID: "abc-1", Revision: 1}, now)
+	assert.NoError(enc.End())
+
+	assert.Equal(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Todo//Todo//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Work",
+		"BEGIN:VTODO",
+		"UID:todo-7@todo.example.com",
+		"DTSTAMP:20260110T000000Z",
+		"CREATED:20260102T030405Z",
+		`SUMMARY:Call Bob\; then\, Alice`,
+		"PRIORITY:1",
+		"STATUS:NEEDS-ACTION",
+		"DUE:20260109T160000Z",
+		"CATEGORIES:work",
+		"RRULE:FREQ=WEEKLY",
+		"SEQUENCE:3",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:abc-1",
+		"DTSTAMP:20260110T000000Z",
+		"SUMMARY:Done",
+		"PRIORITY:9",
+		"STATUS:COMPLETED",
+		"COMPLETED:20260108T120000Z",
+		"SEQUENCE:1",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), buf.String())
+}
+
+func Test_Folding(t *testing.T) {
+	assert := asserts.New(t)
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, "x")
+	enc.line("SUMMARY", strings.Repeat("ä", 100)+"end")
+	assert.NoError(enc.End())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	var unfolded string
+	for i, l := range lines[:len(lines)-1] {
+		assert.LessOrEqual(len(l), maxLineOctets, l)
+		if i > 0 {
+			assert.True(strings.HasPrefix(l, " "))
+			l = l[1:]
+		}
+		unfolded += l
+	}
+	assert.Equal("SUMMARY:"+strings.Repeat("ä", 100)+"end", unfolded)
+	assert.Equal("END:VCALENDAR", lines[len(lines)-1])
+}
+
+func Test_EscapeText(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal(`a\\b\;c\,d\ne`, escapeText("a\\b;c,d\r\ne"))
+}
+
+func Test_ParseRecurrence(t *testing.T) {
+	assert := asserts.New(t)
+
+	r, err := ParseRecurrence(" freq=weekly;byday=mo,we;until=20261231T000000Z ")
+	assert.NoError(err)
+	assert.Equal("FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20261231T000000Z", r)
+
+	for _, rule := range []string{
+		"FREQ=DAILY;COUNT=3;INTERVAL=2",
+		"FREQ=MONTHLY;BYDAY=-1FR,+2MO,1TU;BYSETPOS=-1",
+		"FREQ=YEARLY;BYMONTH=1,12;BYMONTHDAY=-31,1;BYYEARDAY=366;BYWEEKNO=-53",
+		"FREQ=DAILY;BYHOUR=0,23;BYMINUTE=59;BYSECOND=60;WKST=SU",
+	} {
+		_, err = ParseRecurrence(rule)
+		assert.NoError(err, rule)
+	}
+
+	for _, rule := range []string{
+		"", "BYDAY=MO", "FREQ=FORTNIGHTLY", "FREQ=DAILY;COUNT=0", "FREQ=DAILY;COUNT=2;UNTIL=20260101",
+		"FREQ=DAILY;FREQ=WEEKLY", "FREQ=DAILY;COLOR=RED", "FREQ=DAILY;UNTIL=tomorrow", "FREQ", strings.Repeat("X", 300),
+		"FREQ=DAILY;COUNT=+3", "FREQ=DAILY;INTERVAL=99999999999",
+		"FREQ=WEEKLY;BYDAY=XX", "FREQ=WEEKLY;BYDAY=MO,", "FREQ=MONTHLY;BYDAY=54MO", "FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYDAY=--1FR", "FREQ=WEEKLY;WKST=MONDAY", "FREQ=WEEKLY;WKST=-1MO",
+		"FREQ=DAILY;BYHOUR=24", "FREQ=DAILY;BYHOUR=-1", "FREQ=DAILY;BYMINUTE=1.5", "FREQ=YEARLY;BYMONTH=13",
+		"FREQ=MONTHLY;BYMONTHDAY=0", "FREQ=MONTHLY;BYMONTHDAY=-32", "FREQ=YEARLY;BYWEEKNO=54", "FREQ=YEARLY;BYSETPOS=",
+		"FREQ=WEEKLY;BYDAY=MO\r\nATTENDEE:mailto:eve@example.com", "FREQ=WEEKLY;BYDAY=MO\tTU", "FREQ=DAILY\x00",
+	} {
+		_, err = ParseRecurrence(rule)
+		assert.Error(err, rule)
+	}
+}
@@ -0,0 +1,230 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCalendarSize bounds the calendars ParseTodo reads.
+const maxCalendarSize = 1 << 20
+
+// ErrNoTodo is returned for calendars without a VTODO.
+var ErrNoTodo = errors.New("calendar has no VTODO")
+
+// Todo holds the properties of a VTODO that map to a todo.
+type Todo struct {
+	UID        string
+	Summary    string
+	Priority   int
+	Status     string
+	Completed  *time.Time
+	Due        *time.Time
+	Categories []string
+	RRule      string
+}
+
+// Done reports whether the VTODO is completed.
+func (t *Todo) Done() bool {
+	return t.Status == "COMPLETED" || t.Completed != nil
+}
+
+// PriorityName maps the priority onto low, medium and high. Undefined priorities are low.
+func (t *Todo) PriorityName() string {
+	switch {
+	case t.Priority >= 1 && t.Priority <= 4:
+		return "high"
+	case t.Priority == 5:
+		return "medium"
+	}
+	return "low"
+}
+
+// contentLine is a property with its parameters.
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold reads the content lines of a calendar, joining folded lines.
+func unfold(r io.Reader) ([]string, error) {
+	var (
+		lines []string
+		sc    = bufio.NewScanner(io.LimitReader(r, maxCalendarSize))
+	)
+	sc.Buffer(make([]byte, 0, 4096), maxCalendarSize)
+
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if l == "" {
+			continue
+		}
+		if (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, sc.Err()
+}
+
+// parseLine splits a content line. Quoted parameter values may contain ':', ';' and ','.
+func parseLine(l string) (*contentLine, error) {
+	var (
+		cl     = &contentLine{params: make(map[string]string)}
+		quoted bool
+		start  int
+		key    string
+	)
+
+	for i := 0; i < len(l); i++ {
+		switch ch := l[i]; {
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == '=' && cl.name != "" && key == "":
+			key = strings.ToUpper(l[start:i])
+			start = i + 1
+		case ch == ';' || ch == ':':
+			if cl.name == "" {
+				cl.name = strings.ToUpper(l[:i])
+			} else if key != "" {
+				cl.params[key] = strings.Trim(l[start:i], `"`)
+				key = ""
+			}
+			start = i + 1
+
+			if ch == ':' {
+				cl.value = l[i+1:]
+				return cl, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid content line: %q", l)
+}
+
+// unescapeText reverses escapeText.
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// splitText splits a TEXT list at the commas that are not escaped.
+func splitText(s string) []string {
+	var (
+		r    []string
+		last int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			r = append(r, unescapeText(s[last:i]))
+			last = i + 1
+		}
+	}
+	return append(r, unescapeText(s[last:]))
+}
+
+// parseTime reads a DATE or DATE-TIME value. Dates are midnight UTC, floating times are taken as UTC and
+// times with an unknown TZID too.
+func parseTime(cl *contentLine) (time.Time, error) {
+	if cl.params["VALUE"] == "DATE" || len(cl.value) == 8 {
+		return time.Parse("20060102", cl.value)
+	}
+
+	if strings.HasSuffix(cl.value, "Z") {
+		return time.Parse(dateTimeUTC, cl.value)
+	}
+
+	loc := time.UTC
+	if tz, ok := cl.params["TZID"]; ok {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tz, "/")); err == nil {
+			loc = l
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", cl.value, loc)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// ParseTodo reads the first VTODO of a calendar.
+func ParseTodo(r io.Reader) (*Todo, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t     *Todo
+		depth int
+	)
+
+	for _, l := range lines {
+		cl, err := parseLine(l)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case cl.name == "BEGIN" && strings.EqualFold(cl.value, "VTODO") && t == nil:
+			t, depth = &Todo{}, 1
+			continue
+		case t == nil || depth == 0:
+			continue
+		case cl.name == "BEGIN":
+			depth++
+			continue
+		case cl.name == "END":
+			depth--
+			continue
+		case depth > 1:
+			// Properties of nested components such as VALARM.
+			continue
+		}
+
+		switch cl.name {
+		case "UID":
+			t.UID = unescapeText(cl.value)
+		case "SUMMARY":
+			t.Summary = unescapeText(cl.value)
+		case "PRIORITY":
+			if t.Priority, err = strconv.Atoi(cl.value); err != nil {
+				return nil, fmt.Errorf("invalid PRIORITY: %s", cl.value)
+			}
+		case "STATUS":
+			t.Status = strings.ToUpper(cl.value)
+		case "COMPLETED", "DUE":
+			v, err := parseTime(cl)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", cl.name, cl.value)
+			}
+			if cl.name == "DUE" {
+				t.Due = &v
+			} else {
+				t.Completed = &v
+			}
+		case "CATEGORIES":
+			t.Categories = append(t.Categories, splitText(cl.value)...)
+		case "RRULE":
+			t.RRule = cl.value
+		}
+	}
+
+	if t == nil {
+		return nil, ErrNoTodo
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unterminated VTODO")
+	}
+	return t, nil
+}
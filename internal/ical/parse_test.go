@@ -0,0 +1,83 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseTodo(t *testing.T) {
+	assert := asserts.New(t)
+
+	cal := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VTODO",
+		"UID:ABC-123",
+		`SUMMARY:Call Bob\; then\, Alice about the long`,
+		"  summary",
+		"PRIORITY:3",
+		"STATUS:needs-action",
+		`DUE;TZID="Europe/Berlin":20260109T180000`,
+		`CATEGORIES:Work,Home\,Garden`,
+		"RRULE:FREQ=WEEKLY;BYDAY=MO",
+		"BEGIN:VALARM",
+		"SUMMARY:Alarm",
+		"END:VALARM",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	todo, err := ParseTodo(strings.NewReader(cal))
+	assert.NoError(err)
+	assert.Equal("ABC-123", todo.UID)
+	assert.Equal("Call Bob; then, Alice about the long summary", todo.Summary)
+	assert.Equal("high", todo.PriorityName())
+	assert.False(todo.Done())
+	assert.Equal(time.Date(2026, 1, 9, 17, 0, 0, 0, time.UTC), *todo.Due)
+	assert.Equal([]string{"Work", "Home,Garden"}, todo.Categories)
+	assert.Equal("FREQ=WEEKLY;BYDAY=MO", todo.RRule)
+
+	todo, err = ParseTodo(strings.NewReader("BEGIN:VTODO\nUID:x\nCOMPLETED:20260108T120000Z\nDUE;VALUE=DATE:20260110\nEND:VTODO\n"))
+	assert.NoError(err)
+	assert.True(todo.Done())
+	assert.Equal("low", todo.PriorityName())
+	assert.Equal(time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), *todo.Due)
+
+	_, err = ParseTodo(strings.NewReader("BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\nEND:VCALENDAR\n"))
+	assert.Equal(ErrNoTodo, err)
+
+	_, err = ParseTodo(strings.NewReader("BEGIN:VTODO\nPRIORITY:high\nEND:VTODO\n"))
+	assert.Error(err)
+
+	_, err = ParseTodo(strings.NewReader("BEGIN:VTODO\nUID:x\n"))
+	assert.Error(err)
+}
+
+func Test_ParseEncoded(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		due = time.Date(2026, 1, 9, 17, 0, 0, 0, time.UTC)
+		buf bytes.Buffer
+	)
+
+	enc := NewEncoder(&buf, "todo.example.com")
+	enc.Begin("")
+	enc.Todo(&pkg.TodoResponse{Id: 7, Task: strings.Repeat("Ünïcödé, ", 20), Category: "work", Priority: "medium", DueAt: &due}, due)
+	assert.NoError(enc.End())
+
+	todo, err := ParseTodo(&buf)
+	assert.NoError(err)
+	assert.Equal("todo-7@todo.example.com", todo.UID)
+	assert.Equal(strings.Repeat("Ünïcödé, ", 20), todo.Summary)
+	assert.Equal("medium", todo.PriorityName())
+	assert.Equal(due, *todo.Due)
+	assert.Equal([]string{"work"}, todo.Categories)
+}
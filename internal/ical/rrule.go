@@ -0,0 +1,128 @@
+package ical
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxRecurrenceLen is the length of the recurrence column of todos.
+const MaxRecurrenceLen = 255
+
+var (
+	frequencies = []string{"SECONDLY", "MINUTELY", "HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+	weekdays    = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+	ruleParts   = []string{
+		"FREQ", "UNTIL", "COUNT", "INTERVAL", "BYSECOND", "BYMINUTE", "BYHOUR", "BYDAY", "BYMONTHDAY",
+		"BYYEARDAY", "BYWEEKNO", "BYMONTH", "BYSETPOS", "WKST",
+	}
+
+	// byNumbers are the ranges of the numeric BY parts. Signed ones also take negative numbers down to
+	// -max, which count from the end of the period.
+	byNumbers = map[string]struct {
+		min, max int
+		signed   bool
+	}{
+		"BYSECOND":   {0, 60, false},
+		"BYMINUTE":   {0, 59, false},
+		"BYHOUR":     {0, 23, false},
+		"BYMONTHDAY": {1, 31, true},
+		"BYYEARDAY":  {1, 366, true},
+		"BYWEEKNO":   {1, 53, true},
+		"BYMONTH":    {1, 12, false},
+		"BYSETPOS":   {1, 366, true},
+	}
+)
+
+// validNumber reports whether v is a number from min to max, or from -max to -min if it may be signed.
+func validNumber(v string, min, max int, signed bool) bool {
+	if signed && v != "" && (v[0] == '+' || v[0] == '-') {
+		v = v[1:]
+	}
+	if v == "" || strings.Trim(v, "0123456789") != "" {
+		return false
+	}
+
+	n, err := strconv.Atoi(v)
+	return err == nil && n >= min && n <= max
+}
+
+// validWeekday reports whether v is a weekday of BYDAY, optionally preceded by the number of its
+// occurrence within the period, such as -1FR for the last Friday.
+func validWeekday(v string) bool {
+	if len(v) < 2 || !util.Contains(weekdays, v[len(v)-2:]) {
+		return false
+	}
+	return len(v) == 2 || validNumber(v[:len(v)-2], 1, 53, true)
+}
+
+// validList reports whether every element of the comma separated list v is valid.
+func validList(v string, valid func(string) bool) bool {
+	for _, e := range strings.Split(v, ",") {
+		if !valid(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseRecurrence checks the syntax of an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,WE" and returns it
+// in upper case. It checks the parts it can without evaluating the rule.
+func ParseRecurrence(rule string) (string, error) {
+	if len(rule) > MaxRecurrenceLen {
+		return "", fmt.Errorf("recurrence is longer than %d characters", MaxRecurrenceLen)
+	}
+
+	// Rules end up in iCalendar files, where line breaks would start new properties.
+	if strings.IndexFunc(rule, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("invalid recurrence: %q", rule)
+	}
+
+	var (
+		r    = strings.ToUpper(strings.TrimSpace(rule))
+		seen = make(map[string]bool)
+	)
+
+	for _, part := range strings.Split(r, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" || !util.Contains(ruleParts, name) || seen[name] {
+			return "", fmt.Errorf("invalid recurrence: %s", rule)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			ok = util.Contains(frequencies, value)
+		case "COUNT", "INTERVAL":
+			ok = validNumber(value, 1, math.MaxInt32, false)
+		case "UNTIL":
+			_, err := time.Parse(dateTimeUTC, value)
+			if err != nil {
+				_, err = time.Parse("20060102", value)
+			}
+			ok = err == nil
+		case "BYDAY":
+			ok = validList(value, validWeekday)
+		case "WKST":
+			ok = util.Contains(weekdays, value)
+		default:
+			n := byNumbers[name]
+			ok = validList(value, func(v string) bool { return validNumber(v, n.min, n.max, n.signed) })
+		}
+		if !ok {
+			return "", fmt.Errorf("invalid %s in recurrence: %s", name, value)
+		}
+	}
+
+	if !seen["FREQ"] {
+		return "", fmt.Errorf("invalid recurrence, FREQ is required: %s", rule)
+	}
+	if seen["COUNT"] && seen["UNTIL"] {
+		return "", fmt.Errorf("invalid recurrence, COUNT and UNTIL exclude each other: %s", rule)
+	}
+	return r, nil
+}
@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type logMailer struct{}
+
+// NewLogMailer returns a Mailer that only logs messages. It is used when no SMTP server is configured.
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (lm *logMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, from, username, password string) Mailer {
+	m := &smtpMailer{addr: addr, from: from}
+
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (sm *smtpMailer) Send(to, subject, body string) error {
+	msg := strings.Join([]string{
+		fmt.Sprintf("From: %s", sm.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(sm.addr, sm.auth, sm.from, []string{to}, []byte(msg))
+}
@@ -0,0 +1,278 @@
+// Package natsd is a minimal NATS server for development and tests. It implements the core client
+// protocol (CONNECT, PUB, SUB, UNSUB, PING and PONG) with wildcard subjects and queue groups, and
+// keeps nothing: messages go to the subscribers connected at the time. It ignores credentials.
+package natsd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const maxPayload = 1 << 20
+
+type subscription struct {
+	client  *client
+	sid     string
+	subject string
+	queue   string
+}
+
+type client struct {
+	conn net.Conn
+	mu   sync.Mutex
+	subs map[string]*subscription
+}
+
+func (cl *client) send(s string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	_, _ = io.WriteString(cl.conn, s)
+}
+
+// Server is a running stand-in server.
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	clients map[*client]bool
+	wg      sync.WaitGroup
+}
+
+// Listen starts a server on addr, such as ":4222", or "127.0.0.1:0" for a random port.
+func Listen(addr string) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{ln: ln, clients: make(map[*client]bool)}
+
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// URL returns the nats:// URL of the server.
+func (s *Server) URL() string {
+	return "nats://" + s.Addr()
+}
+
+// Close stops the server and disconnects every client.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for cl := range s.clients {
+		_ = cl.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		cl := &client{conn: conn, subs: make(map[string]*subscription)}
+
+		s.mu.Lock()
+		s.clients[cl] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(cl)
+	}
+}
+
+func (s *Server) serve(cl *client) {
+	defer s.wg.Done()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, cl)
+		s.mu.Unlock()
+		_ = cl.conn.Close()
+	}()
+
+	cl.send(fmt.Sprintf(`INFO {"server_id":"natsd","version":"0.0.0","proto":0,"headers":false,"max_payload":%d}`+"\r\n", maxPayload))
+
+	r := bufio.NewReader(cl.conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if err = s.handle(cl, r, strings.TrimRight(line, "\r\n")); err != nil {
+			cl.send(fmt.Sprintf("-ERR '%s'\r\n", err))
+			return
+		}
+	}
+}
+
+func (s *Server) handle(cl *client, r *bufio.Reader, line string) error {
+	op, args := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		op, args = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch strings.ToUpper(op) {
+	case "CONNECT", "PONG":
+		return nil
+	case "PING":
+		cl.send("PONG\r\n")
+		return nil
+	case "PUB":
+		return s.pub(r, strings.Fields(args))
+	case "SUB":
+		return s.sub(cl, strings.Fields(args))
+	case "UNSUB":
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			return errors.New("Invalid Unsubscribe")
+		}
+		s.mu.Lock()
+		delete(cl.subs, fields[0])
+		s.mu.Unlock()
+		return nil
+	}
+	return errors.New("Unknown Protocol Operation")
+}
+
+// pub reads the payload of "PUB <subject> [reply-to] <size>" and delivers it.
+func (s *Server) pub(r *bufio.Reader, fields []string) error {
+	if len(fields) != 2 && len(fields) != 3 {
+		return errors.New("Invalid Publish")
+	}
+
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 || size > maxPayload {
+		return errors.New("Invalid Publish")
+	}
+
+	payload := make([]byte, size+2)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	payload = payload[:size]
+
+	subject, reply := fields[0], ""
+	if len(fields) == 3 {
+		reply = fields[1] + " "
+	}
+	if !validSubject(subject, false) {
+		return errors.New("Invalid Subject")
+	}
+
+	for _, sub := range s.match(subject) {
+		sub.client.send(fmt.Sprintf("MSG %s %s %s%d\r\n%s\r\n", subject, sub.sid, reply, size, payload))
+	}
+	return nil
+}
+
+// sub handles "SUB <subject> [queue group] <sid>".
+func (s *Server) sub(cl *client, fields []string) error {
+	if len(fields) != 2 && len(fields) != 3 {
+		return errors.New("Invalid Subscription")
+	}
+
+	sub := &subscription{client: cl, subject: fields[0], sid: fields[len(fields)-1]}
+	if len(fields) == 3 {
+		sub.queue = fields[1]
+	}
+	if !validSubject(sub.subject, true) {
+		return errors.New("Invalid Subject")
+	}
+
+	s.mu.Lock()
+	cl.subs[sub.sid] = sub
+	s.mu.Unlock()
+	return nil
+}
+
+// match returns the subscriptions that get a message on subject: every plain subscription, and one
+// member of each queue group.
+func (s *Server) match(subject string) []*subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		r      []*subscription
+		queues = make(map[string]bool)
+	)
+
+	for cl := range s.clients {
+		for _, sub := range cl.subs {
+			if !matchSubject(sub.subject, subject) {
+				continue
+			}
+			if sub.queue != "" {
+				if queues[sub.queue] {
+					continue
+				}
+				queues[sub.queue] = true
+			}
+			r = append(r, sub)
+		}
+	}
+	return r
+}
+
+// validSubject reports whether subject is made of non-empty tokens. Wildcards are allowed only in
+// subscriptions: "*" as a whole token and ">" as the last one.
+func validSubject(subject string, wildcards bool) bool {
+	tokens := strings.Split(subject, ".")
+
+	for i, t := range tokens {
+		switch {
+		case t == "":
+			return false
+		case t == "*" || t == ">":
+			if !wildcards || (t == ">" && i != len(tokens)-1) {
+				return false
+			}
+		case strings.ContainsAny(t, "*> \t"):
+			return false
+		}
+	}
+	return true
+}
+
+// matchSubject reports whether subject matches pattern, where "*" matches one token and a final ">"
+// matches one or more.
+func matchSubject(pattern, subject string) bool {
+	var (
+		p = strings.Split(pattern, ".")
+		s = strings.Split(subject, ".")
+	)
+
+	for i, t := range p {
+		if t == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (t != "*" && t != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
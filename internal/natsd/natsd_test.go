@@ -0,0 +1,33 @@
+package natsd
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_MatchSubject(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.True(matchSubject("todo.created", "todo.created"))
+	assert.True(matchSubject("todo.*", "todo.created"))
+	assert.True(matchSubject("*.created", "todo.created"))
+	assert.True(matchSubject(">", "todo.created"))
+	assert.True(matchSubject("todo.>", "todo.todo.created"))
+
+	assert.False(matchSubject("todo.*", "todo.todo.created"))
+	assert.False(matchSubject("todo.>", "todo"))
+	assert.False(matchSubject("todo.created", "todo"))
+	assert.False(matchSubject("todo", "todo.created"))
+}
+
+func Test_ValidSubject(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.True(validSubject("todo.created", false))
+	assert.True(validSubject("todo.*.>", true))
+
+	assert.False(validSubject("todo.*", false))
+	assert.False(validSubject("todo..created", false))
+	assert.False(validSubject("todo.>.created", true))
+	assert.False(validSubject("todo.cre*ted", true))
+}
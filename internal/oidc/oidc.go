@@ -0,0 +1,313 @@
+// Package oidc implements the relying party side of the OpenID Connect authorization code flow
+// with PKCE, as used for single sign-on against an external identity provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+type Config struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims the service relies on.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.StandardClaims
+}
+
+// Provider is a configured identity provider. Discovery and key retrieval happen lazily on first use
+// and are cached.
+type Provider struct {
+	conf   Config
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys map[string]*rsa.PublicKey
+}
+
+func NewProvider(conf Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{conf: conf, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.conf.Name
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState returns a random value suitable for the state and nonce parameters.
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// Challenge derives the S256 PKCE code challenge from a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var d discovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.conf.Issuer, "/")+discoveryPath, &d); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+
+	if d.Issuer != p.conf.Issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", d.Issuer, p.conf.Issuer)
+	}
+	p.meta = &d
+	return p.meta, nil
+}
+
+// AuthCodeURL returns the URL the user agent is sent to in order to authenticate.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.conf.ClientID)
+	v.Set("redirect_uri", p.conf.RedirectURL)
+	v.Set("scope", strings.Join(p.conf.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.conf.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.conf.ClientID), url.QueryEscape(p.conf.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tr tokenResponse
+	if err = json.Unmarshal(body, &tr); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("token exchange failed: %s %s", tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.Verify(ctx, tr.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, d, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(d.Issuer, true) {
+		return nil, fmt.Errorf("invalid id token: unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.conf.ClientID, true) {
+		return nil, errors.New("invalid id token: unexpected audience")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+	return claims, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// key returns the signing key for kid, refreshing the key set once if the key is unknown so that
+// provider key rotation is picked up.
+func (p *Provider) key(ctx context.Context, d *discovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	k, ok := p.keys[kid]
+	p.mu.Unlock()
+
+	if ok {
+		return k, nil
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("could not fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, j := range set.Keys {
+		if j.Kty != "RSA" {
+			continue
+		}
+		pk, err := rsaKey(j)
+		if err != nil {
+			return nil, err
+		}
+		keys[j.Kid] = pk
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if k, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k, nil
+}
+
+func rsaKey(j jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %w", j.Kid, err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %w", j.Kid, err)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
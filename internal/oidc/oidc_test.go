@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"context"
+	"github.com/harsha-aqfer/todo/internal/oidc/oidctest"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func authorize(t *testing.T, authURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc.Query()
+}
+
+func Test_AuthorizationCodeFlowWithPKCE(t *testing.T) {
+	assert := asserts.New(t)
+
+	idp := oidctest.NewServer("todo", "secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "1234", Email: "bob@example.com", EmailVerified: true, Name: "Bob"})
+
+	p := NewProvider(Config{
+		Name:         "test",
+		Issuer:       idp.Issuer(),
+		ClientID:     "todo",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/v1/oidc/test/callback",
+	}, idp.Client())
+
+	ctx := context.Background()
+	verifier, _ := NewVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	assert.Nil(err)
+
+	q := authorize(t, authURL)
+	assert.Equal("state-1", q.Get("state"))
+
+	claims, err := p.Exchange(ctx, q.Get("code"), verifier, "nonce-1")
+	assert.Nil(err)
+	assert.Equal("1234", claims.Subject)
+	assert.Equal("bob@example.com", claims.Email)
+	assert.True(claims.EmailVerified)
+}
+
+func Test_ExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	assert := asserts.New(t)
+
+	idp := oidctest.NewServer("todo", "secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "1234", Email: "bob@example.com"})
+
+	p := NewProvider(Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "todo",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	}, idp.Client())
+
+	ctx := context.Background()
+	verifier, _ := NewVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, "s", "n", verifier)
+	assert.Nil(err)
+
+	_, err = p.Exchange(ctx, authorize(t, authURL).Get("code"), "wrong-verifier", "n")
+	assert.NotNil(err)
+
+	authURL, err = p.AuthCodeURL(ctx, "s", "n", verifier)
+	assert.Nil(err)
+
+	_, err = p.Exchange(ctx, authorize(t, authURL).Get("code"), verifier, "other-nonce")
+	assert.EqualError(err, "invalid id token: nonce mismatch")
+}
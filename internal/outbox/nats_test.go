@@ -0,0 +1,82 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/natsd"
+	asserts "github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subscribe connects to the server and subscribes to subject, returning a reader of its messages.
+func subscribe(t *testing.T, addr, subject string) *bufio.Reader {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	if _, err = r.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PONG confirms the subscription is in place.
+	_, _ = fmt.Fprintf(conn, "CONNECT {}\r\nSUB %s 1\r\nPING\r\n", subject)
+	if line, err := r.ReadString('\n'); err != nil || line != "PONG\r\n" {
+		t.Fatalf("unexpected reply %q: %v", line, err)
+	}
+	return r
+}
+
+func Test_NATSPublisher(t *testing.T) {
+	assert := asserts.New(t)
+
+	server, err := natsd.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := subscribe(t, server.Addr(), "todo.todo.*")
+
+	pub, err := NewNATSPublisher(server.URL(), "todo")
+	assert.NoError(err)
+
+	e := &Event{ID: 7, Type: TodoCompleted, AggregateType: AggregateTodo, AggregateID: 3, Payload: json.RawMessage(`{"todo_id":3}`)}
+	assert.NoError(pub.Publish(context.Background(), e))
+
+	head, err := sub.ReadString('\n')
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(head, "MSG todo.todo.completed 1 "), head)
+
+	body, err := sub.ReadString('\n')
+	assert.NoError(err)
+
+	var got Event
+	assert.NoError(json.Unmarshal([]byte(strings.TrimSpace(body)), &got))
+	assert.Equal(int64(7), got.ID)
+	assert.JSONEq(`{"todo_id":3}`, string(got.Payload))
+
+	// Publishing fails while the server is down and works again once a server is back.
+	addr := server.Addr()
+	assert.NoError(server.Close())
+	assert.Error(pub.Publish(context.Background(), e))
+
+	if server, err = natsd.Listen(addr); err != nil {
+		t.Skip("could not listen on the same address again:", err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+	assert.NoError(pub.Publish(context.Background(), e))
+	assert.NoError(pub.Close())
+
+	_, err = NewNATSPublisher("http://localhost:4222", "todo")
+	assert.Error(err)
+}
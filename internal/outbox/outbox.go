@@ -0,0 +1,123 @@
+// Package outbox publishes domain events that the stores write to an outbox table in the same
+// transaction as the change they describe.
+//
+// A Relay reads the events in the order they were written and hands them to a Publisher. Events are
+// marked as published only after the publisher accepted them, so every event is published at least
+// once. Consumers deduplicate by event id. Events of the same aggregate, such as one todo, are
+// published in order: once one of them fails, the later ones wait for the next round.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Aggregate types.
+const (
+	AggregateTodo = "todo"
+	AggregateUser = "user"
+)
+
+// Event types.
+const (
+	TodoCreated   = "todo.created"
+	TodoUpdated   = "todo.updated"
+	TodoCompleted = "todo.completed"
+	TodoDeleted   = "todo.deleted"
+	TodoRestored  = "todo.restored"
+	TodoPurged    = "todo.purged"
+
+	UserSignedUp          = "user.signed_up"
+	UserEmailChanged      = "user.email_changed"
+	UserDeletionScheduled = "user.deletion_scheduled"
+	UserDeletionCanceled  = "user.deletion_canceled"
+	UserDeleted           = "user.deleted"
+)
+
+// Event is a domain event. ID orders the events and identifies them for deduplication.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+func (e *Event) aggregate() string {
+	return fmt.Sprintf("%s/%d", e.AggregateType, e.AggregateID)
+}
+
+// Store is the outbox table.
+type Store interface {
+	// LockRelay makes sure only one relay runs at a time, across instances. It returns false if
+	// another relay holds the lock, and otherwise a function that releases it.
+	LockRelay(ctx context.Context) (unlock func(), ok bool, err error)
+
+	// PendingEvents returns up to limit unpublished events in the order they were written.
+	PendingEvents(limit int) ([]Event, error)
+
+	// MarkPublished marks the events as published.
+	MarkPublished(ids []int64) error
+}
+
+// Publisher hands events to consumers.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+	Close() error
+}
+
+// Relay moves events from the outbox to a publisher.
+type Relay struct {
+	Store     Store
+	Publisher Publisher
+	BatchSize int
+}
+
+// RelayOnce publishes a batch of pending events and returns how many were published. It returns the
+// first publishing error, after marking the events that did get published.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	unlock, ok, err := r.Store.LockRelay(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer unlock()
+
+	events, err := r.Store.PendingEvents(r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		published []int64
+		failed    = make(map[string]bool)
+		firstErr  error
+	)
+
+	for i := range events {
+		e := &events[i]
+
+		// A later event of an aggregate must not overtake an earlier one that failed.
+		if failed[e.aggregate()] {
+			continue
+		}
+
+		if err = r.Publisher.Publish(ctx, e); err != nil {
+			failed[e.aggregate()] = true
+			if firstErr == nil {
+				firstErr = fmt.Errorf("could not publish event %d: %w", e.ID, err)
+			}
+			continue
+		}
+		published = append(published, e.ID)
+	}
+
+	if len(published) > 0 {
+		if err = r.Store.MarkPublished(published); err != nil {
+			return 0, err
+		}
+	}
+	return len(published), firstErr
+}
@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type memoryStore struct {
+	events    []Event
+	published map[int64]bool
+	locked    bool
+}
+
+func (ms *memoryStore) LockRelay(context.Context) (func(), bool, error) {
+	if ms.locked {
+		return nil, false, nil
+	}
+	ms.locked = true
+	return func() { ms.locked = false }, true, nil
+}
+
+func (ms *memoryStore) PendingEvents(limit int) ([]Event, error) {
+	var r []Event
+	for _, e := range ms.events {
+		if !ms.published[e.ID] && len(r) < limit {
+			r = append(r, e)
+		}
+	}
+	return r, nil
+}
+
+func (ms *memoryStore) MarkPublished(ids []int64) error {
+	for _, id := range ids {
+		ms.published[id] = true
+	}
+	return nil
+}
+
+func Test_Relay(t *testing.T) {
+	assert := asserts.New(t)
+
+	store := &memoryStore{published: make(map[int64]bool)}
+	for i, agg := range []int64{1, 2, 1, 3, 2} {
+		store.events = append(store.events, Event{ID: int64(i + 1), Type: TodoUpdated, AggregateType: AggregateTodo, AggregateID: agg})
+	}
+
+	var (
+		pub  = NewMemoryPublisher()
+		got  []int64
+		fail = map[int64]bool{1: true}
+	)
+
+	pub.Subscribe(func(_ context.Context, e *Event) error {
+		if fail[e.ID] {
+			return errors.New("unavailable")
+		}
+		got = append(got, e.ID)
+		return nil
+	})
+
+	r := &Relay{Store: store, Publisher: pub, BatchSize: 4}
+
+	// Event 3 waits for event 1 of the same todo, event 5 is beyond the batch.
+	n, err := r.RelayOnce(context.Background())
+	assert.Error(err)
+	assert.Equal(2, n)
+	assert.Equal([]int64{2, 4}, got)
+	assert.False(store.locked)
+
+	delete(fail, 1)
+	n, err = r.RelayOnce(context.Background())
+	assert.NoError(err)
+	assert.Equal(3, n)
+	assert.Equal([]int64{2, 4, 1, 3, 5}, got)
+
+	n, err = r.RelayOnce(context.Background())
+	assert.NoError(err)
+	assert.Equal(0, n)
+
+	// Another relay holds the lock.
+	store.events = append(store.events, Event{ID: 6, AggregateType: AggregateUser, AggregateID: 1})
+	store.locked = true
+	n, err = r.RelayOnce(context.Background())
+	assert.NoError(err)
+	assert.Equal(0, n)
+}
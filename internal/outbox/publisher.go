@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type logPublisher struct{}
+
+// NewLogPublisher returns a Publisher that only logs events. It is used when no other publisher is
+// configured.
+func NewLogPublisher() Publisher {
+	return &logPublisher{}
+}
+
+func (lp *logPublisher) Publish(_ context.Context, e *Event) error {
+	log.Printf("event %d %s of %s %d: %s", e.ID, e.Type, e.AggregateType, e.AggregateID, e.Payload)
+	return nil
+}
+
+func (lp *logPublisher) Close() error {
+	return nil
+}
+
+// MemoryPublisher delivers events to handlers in the same process.
+type MemoryPublisher struct {
+	mu       sync.RWMutex
+	handlers []func(context.Context, *Event) error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Subscribe adds a handler for every published event. A handler error fails the publication, so that
+// the event is published again later, to every handler.
+func (mp *MemoryPublisher) Subscribe(handler func(context.Context, *Event) error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.handlers = append(mp.handlers, handler)
+}
+
+func (mp *MemoryPublisher) Publish(ctx context.Context, e *Event) error {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	for _, h := range mp.handlers {
+		if err := h(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mp *MemoryPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package rank generates lexicographic rank keys for manually ordered lists.
+//
+// A key is a string of base-62 digits that never ends in the smallest digit, so that there is always
+// another key between two different keys. Keys compare with plain byte order, which makes them usable
+// as an ORDER BY column with a binary collation. Placing an item between two others only needs a new
+// key for that item, at the cost of keys getting longer over time: keys at either end of a list grow
+// by a digit about every 31 items, and keys squeezed into the same gap about every 6. Spread hands out
+// short keys again.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// Digits are the digits of keys in ascending byte order.
+const Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(Digits)
+
+// ErrOrder is returned when the bounds of Between are not in ascending order.
+var ErrOrder = errors.New("rank: keys are not in ascending order")
+
+// ErrInvalid is returned for keys with characters outside Digits or a trailing smallest digit.
+var ErrInvalid = errors.New("rank: invalid key")
+
+// Valid reports whether key is a non-empty key.
+func Valid(key string) bool {
+	if key == "" || key[len(key)-1] == Digits[0] {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(Digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Between returns a key that sorts after a and before b. An empty a stands for the start of the
+// list and an empty b for its end.
+func Between(a, b string) (string, error) {
+	if (a != "" && !Valid(a)) || (b != "" && !Valid(b)) {
+		return "", ErrInvalid
+	}
+
+	switch {
+	case a == "" && b == "":
+		return Digits[base/2 : base/2+1], nil
+	case b == "":
+		return after(a), nil
+	case a == "":
+		return before(b), nil
+	case a >= b:
+		return "", ErrOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// after returns a short key greater than a by incrementing its first digit that is not the largest.
+func after(a string) string {
+	for i := 0; i < len(a); i++ {
+		if d := strings.IndexByte(Digits, a[i]); d < base-1 {
+			return a[:i] + Digits[d+1:d+2]
+		}
+	}
+	return a + Digits[base/2:base/2+1]
+}
+
+// before returns a short key smaller than b by decrementing its first digit that is not the smallest.
+func before(b string) string {
+	for i := 0; i < len(b); i++ {
+		d := strings.IndexByte(Digits, b[i])
+		if d > 1 {
+			return b[:i] + Digits[d-1:d]
+		}
+		if d == 1 {
+			return b[:i] + Digits[:1] + Digits[base/2:base/2+1]
+		}
+	}
+	// Unreachable for valid keys, which do not end in the smallest digit.
+	return b
+}
+
+// midpoint returns a key between a and b, with a < b and both valid.
+func midpoint(a, b string) string {
+	// Skip the common prefix, reading missing digits of a as the smallest digit.
+	n := 0
+	for n < len(b) && digit(a, n) == strings.IndexByte(Digits, b[n]) {
+		n++
+	}
+	if n > 0 {
+		return b[:n] + midpointFrom(a[min(n, len(a)):], b[n:])
+	}
+	return midpointFrom(a, b)
+}
+
+// midpointFrom is midpoint for keys whose first digits differ. An empty b stands for the end.
+func midpointFrom(a, b string) string {
+	da, db := digit(a, 0), base
+	if b != "" {
+		db = strings.IndexByte(Digits, b[0])
+	}
+
+	if db-da > 1 {
+		m := (da + db + 1) / 2
+		return Digits[m : m+1]
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return Digits[da:da+1] + midpointFrom(rest, "")
+}
+
+func digit(key string, i int) int {
+	if i >= len(key) {
+		return 0
+	}
+	return strings.IndexByte(Digits, key[i])
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Spread returns n ascending keys of equal length, evenly spread so that every gap leaves room for
+// further moves.
+func Spread(n int) []string {
+	width := 1
+	for capacity := base; capacity < 2*(n+1); capacity *= base {
+		width++
+	}
+
+	var (
+		keys  = make([]string, n)
+		total = 1
+	)
+	for i := 0; i < width; i++ {
+		total *= base
+	}
+	step := total / (n + 1)
+
+	for i := range keys {
+		v := step * (i + 1)
+		buf := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			buf[j] = Digits[v%base]
+			v /= base
+		}
+		keys[i] = strings.TrimRight(string(buf), Digits[:1])
+	}
+	return keys
+}
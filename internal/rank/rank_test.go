@@ -0,0 +1,112 @@
+package rank
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func Test_Between(t *testing.T) {
+	assert := asserts.New(t)
+
+	cases := []struct{ a, b, key string }{
+		{"", "", "V"},
+		{"V", "", "W"},
+		{"z", "", "zV"},
+		{"zz1", "", "zz2"},
+		{"", "V", "U"},
+		{"", "1", "0V"},
+		{"", "01", "00V"},
+		{"A", "C", "B"},
+		{"A", "B", "AV"},
+		{"A", "B1", "B"},
+		{"A1", "A2", "A1V"},
+		{"Az", "B", "AzV"},
+	}
+
+	for _, c := range cases {
+		key, err := Between(c.a, c.b)
+		if assert.NoError(err, "%q %q", c.a, c.b) {
+			assert.Equal(c.key, key, "%q %q", c.a, c.b)
+		}
+	}
+
+	_, err := Between("B", "A")
+	assert.Equal(ErrOrder, err)
+
+	_, err = Between("A", "A")
+	assert.Equal(ErrOrder, err)
+
+	_, err = Between("A0", "")
+	assert.Equal(ErrInvalid, err)
+
+	_, err = Between("", "A-")
+	assert.Equal(ErrInvalid, err)
+}
+
+func Test_BetweenRandom(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		r    = rand.New(rand.NewSource(1))
+		keys []string
+	)
+
+	for i := 0; i < 2000; i++ {
+		pos := r.Intn(len(keys) + 1)
+
+		var a, b string
+		if pos > 0 {
+			a = keys[pos-1]
+		}
+		if pos < len(keys) {
+			b = keys[pos]
+		}
+
+		key, err := Between(a, b)
+		if !assert.NoError(err) || !assert.True(Valid(key), key) {
+			return
+		}
+		assert.True(a == "" || a < key, "%q < %q", a, key)
+		assert.True(b == "" || key < b, "%q < %q", key, b)
+
+		keys = append(keys[:pos], append([]string{key}, keys[pos:]...)...)
+	}
+	assert.True(sort.StringsAreSorted(keys))
+}
+
+func Test_AppendKeepsKeysShort(t *testing.T) {
+	assert := asserts.New(t)
+
+	last, first := "", ""
+	for i := 0; i < 1000; i++ {
+		last, _ = Between(last, "")
+		first, _ = Between("", first)
+	}
+	// Keys at either end grow by a digit about every base/2 items.
+	assert.LessOrEqual(len(last), 1000/(base/2)+1)
+	assert.LessOrEqual(len(first), 1000/(base/2)+1)
+}
+
+func Test_Spread(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Empty(Spread(0))
+	assert.Equal([]string{"V"}, Spread(1))
+
+	for _, n := range []int{2, 30, 31, 1000, 100000} {
+		keys := Spread(n)
+		assert.Len(keys, n)
+
+		for i, key := range keys {
+			assert.True(Valid(key), key)
+			if i > 0 {
+				assert.Less(keys[i-1], key)
+
+				_, err := Between(keys[i-1], key)
+				assert.NoError(err)
+			}
+		}
+	}
+}
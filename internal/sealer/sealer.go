@@ -0,0 +1,55 @@
+// Package sealer encrypts small secrets, such as TOTP seeds, before they are written to the database.
+package sealer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// New returns a Sealer using AES-GCM. The key is the base64 encoding of 16, 24 or 32 random bytes.
+func New(key string) (*Sealer, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts plaintext and returns the nonce and ciphertext as base64.
+func (s *Sealer) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (s *Sealer) Open(sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	n := s.aead.NonceSize()
+	if len(raw) < n {
+		return nil, fmt.Errorf("sealed value is too short")
+	}
+	return s.aead.Open(nil, raw[:n], raw[n:], nil)
+}
@@ -0,0 +1,153 @@
+// Package search parses the todo search language and compiles it to parameterized SQL.
+//
+// A query is a list of terms that all have to match:
+//
+//	buy milk                free text, matched against the task
+//	"buy milk"              a phrase
+//	priority:high           priority is low, medium or high
+//	category:work           category, quoted if it contains spaces
+//	is:done, is:open        completion state
+//	due:<2026-11-01         due date, compared with <, <=, >, >= or = (the default)
+//	due:<=+7d               days relative to today: today, tomorrow, yesterday, +Nd or -Nd
+//	completed:>=-7d         completion date, with the same comparisons
+//	-word, -is:done         negation of any term
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is the format of fixed dates in date terms.
+const DateLayout = "2006-01-02"
+
+// Term is a single condition of a query.
+type Term interface {
+	fmt.Stringer
+	term()
+}
+
+// Query is the conjunction of its terms.
+type Query struct {
+	Terms []Term
+}
+
+func (q *Query) String() string {
+	parts := make([]string, len(q.Terms))
+	for i, t := range q.Terms {
+		parts[i] = t.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// Text matches todos whose task contains a word, or a phrase if Phrase is set.
+type Text struct {
+	Value  string
+	Phrase bool
+}
+
+func (t *Text) String() string {
+	if t.Phrase {
+		return quote(t.Value)
+	}
+	return t.Value
+}
+
+// Field matches todos whose field equals the value. Field is "priority" or "category".
+type Field struct {
+	Name  string
+	Value string
+}
+
+func (f *Field) String() string {
+	v := f.Value
+	if strings.ContainsAny(v, " :\"") || strings.HasPrefix(v, "-") || v == "" {
+		v = quote(v)
+	}
+	return f.Name + ":" + v
+}
+
+// State matches todos by completion, with Done set for completed todos.
+type State struct {
+	Done bool
+}
+
+func (s *State) String() string {
+	if s.Done {
+		return "is:done"
+	}
+	return "is:open"
+}
+
+// Op is a comparison operator of date terms.
+type Op string
+
+const (
+	OpEq Op = "="
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// Day is a calendar day, either a fixed date or a number of days from the day the query is evaluated.
+type Day struct {
+	Date     time.Time
+	Offset   int
+	Relative bool
+}
+
+func (d Day) String() string {
+	if !d.Relative {
+		return d.Date.Format(DateLayout)
+	}
+	if d.Offset == 0 {
+		return "today"
+	}
+	return fmt.Sprintf("%+dd", d.Offset)
+}
+
+// At returns the start of the day in UTC, with relative days counted from now.
+func (d Day) At(now time.Time) time.Time {
+	if !d.Relative {
+		return d.Date.UTC()
+	}
+	y, m, day := now.UTC().Date()
+	return time.Date(y, m, day+d.Offset, 0, 0, 0, 0, time.UTC)
+}
+
+// Date compares a date of todos with a day. Field is "due" or "completed". Todos without the date
+// never match.
+type Date struct {
+	Field string
+	Op    Op
+	Day   Day
+}
+
+func (d *Date) String() string {
+	op := string(d.Op)
+	if d.Op == OpEq {
+		op = ""
+	}
+	return d.Field + ":" + op + d.Day.String()
+}
+
+// Not matches todos that do not match its term.
+type Not struct {
+	Term Term
+}
+
+func (n *Not) String() string {
+	return "-" + n.Term.String()
+}
+
+func (*Text) term()  {}
+func (*Field) term() {}
+func (*State) term() {}
+func (*Date) term()  {}
+func (*Not) term()   {}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
@@ -0,0 +1,156 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect selects how free text is matched.
+type Dialect int
+
+const (
+	// MySQL matches text through the FULLTEXT index on the task column in boolean mode.
+	MySQL Dialect = iota
+
+	// Generic matches text with LIKE and works with any SQL backend, without an index.
+	Generic
+)
+
+// SQL is a compiled query: a boolean expression over the todo columns with ? placeholders.
+type SQL struct {
+	Where string
+	Args  []interface{}
+}
+
+// booleanOperators have a special meaning in MySQL boolean mode full-text searches.
+const booleanOperators = `+-<>()~*"@`
+
+// Compile turns the query into a condition on the todo table. Values only ever end up in Args.
+// Relative days are resolved against now.
+func Compile(q *Query, d Dialect, now time.Time) (*SQL, error) {
+	r := &SQL{Where: "TRUE"}
+
+	var (
+		conds []string
+		words []string
+	)
+
+	for _, t := range q.Terms {
+		// Positive text terms of MySQL queries are combined into a single full-text match.
+		if tt, ok := t.(*Text); ok && d == MySQL {
+			if w := fullTextTerm(tt); w != "" {
+				words = append(words, "+"+w)
+			}
+			continue
+		}
+
+		cond, args, err := compileTerm(t, d, now)
+		if err != nil {
+			return nil, err
+		}
+		if cond != "" {
+			conds = append(conds, cond)
+			r.Args = append(r.Args, args...)
+		}
+	}
+
+	if len(words) > 0 {
+		conds = append([]string{"MATCH(task) AGAINST(? IN BOOLEAN MODE)"}, conds...)
+		r.Args = append([]interface{}{strings.Join(words, " ")}, r.Args...)
+	}
+
+	if len(conds) > 0 {
+		r.Where = strings.Join(conds, " AND ")
+	}
+	return r, nil
+}
+
+// compileTerm returns a condition that is never NULL, so that it can be negated safely. An empty
+// condition matches everything.
+func compileTerm(t Term, d Dialect, now time.Time) (string, []interface{}, error) {
+	switch t := t.(type) {
+	case *Text:
+		if d == MySQL {
+			w := fullTextTerm(t)
+			if w == "" {
+				return "", nil, nil
+			}
+			return "MATCH(task) AGAINST(? IN BOOLEAN MODE)", []interface{}{w}, nil
+		}
+		return "task LIKE ? ESCAPE '!'", []interface{}{"%" + escapeLike(t.Value) + "%"}, nil
+
+	case *Field:
+		switch t.Name {
+		case "priority", "category":
+			return t.Name + " = ?", []interface{}{t.Value}, nil
+		}
+		return "", nil, fmt.Errorf("unknown field %s", t.Name)
+
+	case *State:
+		if t.Done {
+			return "done", nil, nil
+		}
+		return "NOT done", nil, nil
+
+	case *Date:
+		return compileDate(t, now)
+
+	case *Not:
+		cond, args, err := compileTerm(t.Term, d, now)
+		if err != nil || cond == "" {
+			// Negating a term that matches everything would match nothing.
+			return "FALSE", nil, err
+		}
+		return "NOT (" + cond + ")", args, nil
+	}
+	return "", nil, fmt.Errorf("unknown term %T", t)
+}
+
+var dateColumns = map[string]string{"due": "due_at", "completed": "completed_at"}
+
+func compileDate(t *Date, now time.Time) (string, []interface{}, error) {
+	col, ok := dateColumns[t.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown field %s", t.Field)
+	}
+
+	var (
+		day  = t.Day.At(now)
+		next = day.AddDate(0, 0, 1)
+	)
+
+	switch t.Op {
+	case OpEq:
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s >= ? AND %[1]s < ?)", col), []interface{}{day, next}, nil
+	case OpLt:
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s < ?)", col), []interface{}{day}, nil
+	case OpLe:
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s < ?)", col), []interface{}{next}, nil
+	case OpGt:
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s >= ?)", col), []interface{}{next}, nil
+	case OpGe:
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s >= ?)", col), []interface{}{day}, nil
+	}
+	return "", nil, fmt.Errorf("unknown operator %s", t.Op)
+}
+
+// fullTextTerm returns the text as a quoted phrase for a boolean mode search, without any characters
+// that would act as operators. Quoting also makes single words match exactly.
+func fullTextTerm(t *Text) string {
+	v := strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(booleanOperators, r) {
+			return ' '
+		}
+		return r
+	}, t.Value)), " ")
+
+	if v == "" {
+		return ""
+	}
+	return `"` + v + `"`
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Compile(t *testing.T) {
+	assert := asserts.New(t)
+
+	q, err := Parse(`buy "oat+milk" priority:high -is:done due:<2026-11-01 -cheap`)
+	assert.NoError(err)
+
+	r, err := Compile(q, MySQL, time.Now())
+	assert.NoError(err)
+
+	assert.Equal("MATCH(task) AGAINST(? IN BOOLEAN MODE) AND priority = ? AND NOT (done) AND "+
+		"(due_at IS NOT NULL AND due_at < ?) AND NOT (MATCH(task) AGAINST(? IN BOOLEAN MODE))", r.Where)
+	assert.Equal([]interface{}{
+		`+"buy" +"oat milk"`, "high", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), `"cheap"`,
+	}, r.Args)
+
+	r, err = Compile(q, Generic, time.Now())
+	assert.NoError(err)
+
+	assert.Equal("task LIKE ? ESCAPE '!' AND task LIKE ? ESCAPE '!' AND priority = ? AND NOT (done) AND "+
+		"(due_at IS NOT NULL AND due_at < ?) AND NOT (task LIKE ? ESCAPE '!')", r.Where)
+	assert.Equal("%oat+milk%", r.Args[1])
+
+	q, err = Parse(`100% -"_"`)
+	assert.NoError(err)
+
+	r, err = Compile(q, Generic, time.Now())
+	assert.NoError(err)
+	assert.Equal([]interface{}{"%100!%%", "%!_%"}, r.Args)
+
+	r, err = Compile(&Query{}, MySQL, time.Now())
+	assert.NoError(err)
+	assert.Equal("TRUE", r.Where)
+	assert.Empty(r.Args)
+
+	// Text made only of operators matches everything, and its negation nothing.
+	q, err = Parse(`+++ -"()"`)
+	assert.NoError(err)
+
+	r, err = Compile(q, MySQL, time.Now())
+	assert.NoError(err)
+	assert.Equal("FALSE", r.Where)
+}
+
+func Test_CompileDue(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		day  = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+		next = day.Add(24 * time.Hour)
+	)
+
+	cases := map[string][]interface{}{
+		"due:2026-11-01":   {day, next},
+		"due:<2026-11-01":  {day},
+		"due:<=2026-11-01": {next},
+		"due:>2026-11-01":  {next},
+		"due:>=2026-11-01": {day},
+	}
+
+	for src, args := range cases {
+		q, err := Parse(src)
+		assert.NoError(err, src)
+
+		r, err := Compile(q, MySQL, time.Now())
+		assert.NoError(err, src)
+		assert.Equal(args, r.Args, src)
+	}
+}
+
+func Test_CompileRelativeDates(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		now   = time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+		today = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	)
+
+	cases := map[string][]interface{}{
+		"due:today":            {today, today.AddDate(0, 0, 1)},
+		"due:<tomorrow":        {today.AddDate(0, 0, 1)},
+		"due:<=+7d":            {today.AddDate(0, 0, 8)},
+		"completed:>=-7d":      {today.AddDate(0, 0, -7)},
+		"completed:>yesterday": {today},
+	}
+
+	for src, args := range cases {
+		q, err := Parse(src)
+		assert.NoError(err, src)
+
+		r, err := Compile(q, MySQL, now)
+		assert.NoError(err, src)
+		assert.Equal(args, r.Args, src)
+	}
+
+	q, err := Parse("completed:<2026-10-01")
+	assert.NoError(err)
+
+	r, err := Compile(q, MySQL, now)
+	assert.NoError(err)
+	assert.Equal("(completed_at IS NOT NULL AND completed_at < ?)", r.Where)
+}
+
+func Test_ParseSort(t *testing.T) {
+	assert := asserts.New(t)
+
+	s, err := ParseSort("")
+	assert.NoError(err)
+	assert.Equal(DefaultSort, s)
+
+	s, err = ParseSort("due_asc")
+	assert.NoError(err)
+	assert.Equal("due_at IS NULL, due_at ASC, id DESC", s.OrderBy())
+
+	s, err = ParseSort("priority_desc,position")
+	assert.NoError(err)
+	assert.Equal("priority DESC, project_id IS NOT NULL, project_id ASC, position ASC, id DESC", s.OrderBy())
+
+	s, err = ParseSort("position,created_asc")
+	assert.NoError(err)
+	assert.Equal("project_id IS NOT NULL, project_id ASC, position ASC, id ASC", s.OrderBy())
+
+	_, err = ParseSort("id; DROP TABLE todo")
+	assert.Error(err)
+
+	_, err = ParseSort("position,")
+	assert.Error(err)
+
+	_, err = ParseSort("position,position,position,position,position")
+	assert.Error(err)
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		`buy milk`,
+		`"oat milk" -is:done`,
+		`priority:high category:"side project"`,
+		`due:<=2026-11-01 -due:2026-01-01`,
+		`-"a" -b: c:d "`,
+		`100% _!`,
+		`due:tomorrow completed:>=-7d due:<=+30d`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		q, err := Parse(src)
+		if err != nil {
+			if _, ok := err.(*SyntaxError); !ok {
+				t.Fatalf("Parse(%q) returned %T, not a *SyntaxError", src, err)
+			}
+			return
+		}
+
+		// Printing and parsing again gives the same query.
+		again, err := Parse(q.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) of the printed form of %q failed: %v", q.String(), src, err)
+		}
+		if again.String() != q.String() {
+			t.Fatalf("round trip of %q changed %q to %q", src, q.String(), again.String())
+		}
+
+		for _, d := range []Dialect{MySQL, Generic} {
+			r, err := Compile(q, d, time.Now())
+			if err != nil {
+				t.Fatalf("Compile(%q) failed: %v", src, err)
+			}
+
+			// Every value is passed as an argument, never spliced into the SQL.
+			if n := strings.Count(r.Where, "?"); n != len(r.Args) {
+				t.Fatalf("Compile(%q) has %d placeholders for %d arguments: %s", src, n, len(r.Args), r.Where)
+			}
+			if strings.ContainsAny(r.Where, `";`) {
+				t.Fatalf("Compile(%q) produced unexpected characters: %s", src, r.Where)
+			}
+		}
+	})
+}
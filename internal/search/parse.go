@@ -0,0 +1,254 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxQueryLen = 512
+	MaxTerms    = 32
+)
+
+var priorities = []string{"low", "medium", "high"}
+
+// SyntaxError describes an invalid query. Pos is the byte offset of the problem in the query.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d: %s", e.Pos, e.Msg)
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// Parse parses a query. An empty query has no terms and matches every todo.
+func Parse(src string) (*Query, error) {
+	if len(src) > MaxQueryLen {
+		return nil, &SyntaxError{Pos: MaxQueryLen, Msg: fmt.Sprintf("the query is longer than %d bytes", MaxQueryLen)}
+	}
+	if !utf8.ValidString(src) {
+		return nil, &SyntaxError{Pos: 0, Msg: "the query is not valid UTF-8"}
+	}
+
+	p := &parser{src: src}
+	q := &Query{}
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return q, nil
+		}
+
+		if len(q.Terms) == MaxTerms {
+			return nil, p.errorf("the query has more than %d terms", MaxTerms)
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		q.Terms = append(q.Terms, t)
+	}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
+
+func (p *parser) next() rune {
+	r, n := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += n
+	return r
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos, format, args...)
+}
+
+func (p *parser) errorAt(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) term() (Term, error) {
+	start := p.pos
+
+	if p.peek() == '-' {
+		p.next()
+		if p.eof() || unicode.IsSpace(p.peek()) {
+			return nil, p.errorAt(start, "expected a term after '-'")
+		}
+		if p.peek() == '-' {
+			return nil, p.errorAt(start, "a term can only be negated once")
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Term: t}, nil
+	}
+
+	if p.peek() == '"' {
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return nil, p.errorAt(start, "empty phrase")
+		}
+		return &Text{Value: s, Phrase: true}, nil
+	}
+
+	word := p.word()
+
+	if p.eof() || p.peek() != ':' {
+		if p.peek() == '"' {
+			return nil, p.errorf("unexpected '\"', put a space before the phrase")
+		}
+		return &Text{Value: word}, nil
+	}
+	p.next()
+
+	valuePos := p.pos
+
+	var value string
+	if !p.eof() && p.peek() == '"' {
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		value = s
+	} else {
+		value = p.word()
+		if !p.eof() && (p.peek() == ':' || p.peek() == '"') {
+			return nil, p.errorf("unexpected '%c' in the value of %s:", p.peek(), word)
+		}
+	}
+
+	return p.field(start, strings.ToLower(word), valuePos, value)
+}
+
+// word reads up to the next space, colon or quote.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() {
+		if r := p.peek(); unicode.IsSpace(r) || r == ':' || r == '"' {
+			break
+		}
+		p.next()
+	}
+	return p.src[start:p.pos]
+}
+
+// quoted reads a string in double quotes.
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.next()
+
+	end := strings.IndexByte(p.src[p.pos:], '"')
+	if end < 0 {
+		return "", p.errorAt(start, "unterminated quote")
+	}
+
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	if !p.eof() && !unicode.IsSpace(p.peek()) {
+		return "", p.errorf("expected a space after the closing quote")
+	}
+	return strings.Join(strings.Fields(s), " "), nil
+}
+
+func (p *parser) field(start int, name string, valuePos int, value string) (Term, error) {
+	if value == "" {
+		if name == "" {
+			return nil, p.errorAt(start, "unexpected ':'")
+		}
+		return nil, p.errorAt(valuePos, "missing value for %s:", name)
+	}
+
+	switch name {
+	case "priority":
+		v := strings.ToLower(value)
+		for _, pr := range priorities {
+			if v == pr {
+				return &Field{Name: name, Value: v}, nil
+			}
+		}
+		return nil, p.errorAt(valuePos, "unknown priority %q, expected one of %s", value, strings.Join(priorities, ", "))
+
+	case "category":
+		return &Field{Name: name, Value: strings.ToLower(value)}, nil
+
+	case "is":
+		switch strings.ToLower(value) {
+		case "done":
+			return &State{Done: true}, nil
+		case "open":
+			return &State{Done: false}, nil
+		}
+		return nil, p.errorAt(valuePos, "unknown state %q, expected done or open", value)
+
+	case "due", "completed":
+		return p.date(name, valuePos, value)
+
+	case "":
+		return nil, p.errorAt(start, "missing field name before ':'")
+	}
+	return nil, p.errorAt(start, "unknown field %q, expected one of priority, category, is, due, completed", name)
+}
+
+// maxDayOffset bounds relative days to about ten years.
+const maxDayOffset = 3660
+
+var namedDays = map[string]int{"yesterday": -1, "today": 0, "tomorrow": 1}
+
+func (p *parser) date(name string, valuePos int, value string) (Term, error) {
+	op := OpEq
+	for _, o := range []Op{OpLe, OpGe, OpLt, OpGt, OpEq} {
+		if strings.HasPrefix(value, string(o)) {
+			op, value = o, value[len(o):]
+			valuePos += len(o)
+			break
+		}
+	}
+
+	if offset, ok := namedDays[strings.ToLower(value)]; ok {
+		return &Date{Field: name, Op: op, Day: Day{Offset: offset, Relative: true}}, nil
+	}
+
+	if len(value) > 2 && (value[0] == '+' || value[0] == '-') && strings.HasSuffix(value, "d") {
+		offset, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || offset < -maxDayOffset || offset > maxDayOffset {
+			return nil, p.errorAt(valuePos, "invalid number of days %q, expected +Nd or -Nd with N up to %d", value, maxDayOffset)
+		}
+		return &Date{Field: name, Op: op, Day: Day{Offset: offset, Relative: true}}, nil
+	}
+
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return nil, p.errorAt(valuePos, "invalid %s date %q, expected YYYY-MM-DD, today, tomorrow, yesterday, +Nd or -Nd", name, value)
+	}
+	return &Date{Field: name, Op: op, Day: Day{Date: date}}, nil
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Parse(t *testing.T) {
+	assert := asserts.New(t)
+
+	q, err := Parse(`buy  "Oat Milk" priority:HIGH category:"side project" -is:done due:<=2026-11-01 -milk`)
+	assert.NoError(err)
+
+	assert.Equal([]Term{
+		&Text{Value: "buy"},
+		&Text{Value: "Oat Milk", Phrase: true},
+		&Field{Name: "priority", Value: "high"},
+		&Field{Name: "category", Value: "side project"},
+		&Not{Term: &State{Done: true}},
+		&Date{Field: "due", Op: OpLe, Day: Day{Date: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)}},
+		&Not{Term: &Text{Value: "milk"}},
+	}, q.Terms)
+
+	assert.Equal(`buy "Oat Milk" priority:high category:"side project" -is:done due:<=2026-11-01 -milk`, q.String())
+
+	q, err = Parse("due:Tomorrow completed:>=-7d due:<=+0d")
+	assert.NoError(err)
+	assert.Equal([]Term{
+		&Date{Field: "due", Op: OpEq, Day: Day{Offset: 1, Relative: true}},
+		&Date{Field: "completed", Op: OpGe, Day: Day{Offset: -7, Relative: true}},
+		&Date{Field: "due", Op: OpLe, Day: Day{Relative: true}},
+	}, q.Terms)
+	assert.Equal("due:+1d completed:>=-7d due:<=today", q.String())
+
+	q, err = Parse("   ")
+	assert.NoError(err)
+	assert.Empty(q.Terms)
+}
+
+func Test_ParseErrors(t *testing.T) {
+	assert := asserts.New(t)
+
+	cases := map[string]string{
+		`"unterminated`:     `invalid search query at position 0: unterminated quote`,
+		`owner:me`:          `invalid search query at position 0: unknown field "owner", expected one of priority, category, is, due, completed`,
+		`work priority:top`: `invalid search query at position 14: unknown priority "top", expected one of low, medium, high`,
+		`is:`:               `invalid search query at position 3: missing value for is:`,
+		`is:later`:          `invalid search query at position 3: unknown state "later", expected done or open`,
+		`due:>someday`:      `invalid search query at position 5: invalid due date "someday", expected YYYY-MM-DD, today, tomorrow, yesterday, +Nd or -Nd`,
+		`completed:+99999d`: `invalid search query at position 10: invalid number of days "+99999d", expected +Nd or -Nd with N up to 3660`,
+		`milk -`:            `invalid search query at position 5: expected a term after '-'`,
+		`--milk`:            `invalid search query at position 0: a term can only be negated once`,
+		`:milk`:             `invalid search query at position 0: missing field name before ':'`,
+		`""`:                `invalid search query at position 0: empty phrase`,
+		`"a"b`:              `invalid search query at position 3: expected a space after the closing quote`,
+		`a"b"`:              `invalid search query at position 1: unexpected '"', put a space before the phrase`,
+	}
+
+	for src, msg := range cases {
+		_, err := Parse(src)
+		if assert.Error(err, src) {
+			assert.Equal(msg, err.Error(), src)
+		}
+	}
+
+	_, err := Parse(strings.Repeat("a ", MaxTerms+1))
+	assert.Error(err)
+
+	_, err = Parse(strings.Repeat("a", MaxQueryLen+1))
+	assert.Error(err)
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sort is the order of search results: one or more comma separated keys, the first one taking
+// precedence, like "priority_desc,position".
+type Sort string
+
+const (
+	SortCreatedDesc   Sort = "created_desc"
+	SortCreatedAsc    Sort = "created_asc"
+	SortDueAsc        Sort = "due_asc"
+	SortPriorityDesc  Sort = "priority_desc"
+	SortCompletedDesc Sort = "completed_desc"
+	SortPosition      Sort = "position"
+)
+
+// DefaultSort lists the newest todos first.
+const DefaultSort = SortCreatedDesc
+
+// MaxSortKeys is the number of keys a sort may combine.
+const MaxSortKeys = 4
+
+// orderBy maps each sort key to its ORDER BY clause. Todos without the date sort last. Positions only
+// order todos within a list, so todos are grouped by project first, starting with those without one.
+var orderBy = map[Sort]string{
+	SortCreatedDesc:   "id DESC",
+	SortCreatedAsc:    "id ASC",
+	SortDueAsc:        "due_at IS NULL, due_at ASC",
+	SortPriorityDesc:  "priority DESC",
+	SortCompletedDesc: "completed_at IS NULL, completed_at DESC",
+	SortPosition:      "project_id IS NOT NULL, project_id ASC, position ASC",
+}
+
+// ParseSort returns the sort named s. An empty name is the default sort.
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return DefaultSort, nil
+	}
+
+	keys := strings.Split(s, ",")
+	if len(keys) > MaxSortKeys {
+		return "", fmt.Errorf("too many sort keys, at most %d are allowed", MaxSortKeys)
+	}
+
+	for _, key := range keys {
+		if _, ok := orderBy[Sort(key)]; !ok {
+			return "", fmt.Errorf("unknown sort %q, expected one of created_desc, created_asc, due_asc, priority_desc, completed_desc, position", key)
+		}
+	}
+	return Sort(s), nil
+}
+
+// OrderBy returns the ORDER BY clause of the sort, falling back to the default sort for unknown keys.
+// The id breaks ties, so that pages don't overlap.
+func (s Sort) OrderBy() string {
+	var (
+		clauses []string
+		byID    bool
+	)
+
+	for _, key := range strings.Split(string(s), ",") {
+		o, ok := orderBy[Sort(key)]
+		if !ok {
+			return orderBy[DefaultSort]
+		}
+		clauses = append(clauses, o)
+		byID = byID || Sort(key) == SortCreatedDesc || Sort(key) == SortCreatedAsc
+	}
+
+	if !byID {
+		clauses = append(clauses, "id DESC")
+	}
+	return strings.Join(clauses, ", ")
+}
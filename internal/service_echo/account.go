@@ -0,0 +1,229 @@
+package service_echo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"time"
+)
+
+const (
+	emailTokenExpiry = 24 * time.Hour
+
+	// reauthWindow is how recently users without a password must have signed in through their identity
+	// provider to make sensitive account changes.
+	reauthWindow = 10 * time.Minute
+)
+
+// checkPassword re-authenticates the caller before a sensitive account change. Users without a password
+// re-authenticate by signing in again through their identity provider instead.
+func checkPassword(s *Service, sc *SecurityContext, password string) (*pkg.User, error) {
+	user, err := s.db.User.GetUserByID(sc.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Password == "" {
+		if sc.SignedInAt.IsZero() || time.Since(sc.SignedInAt) > reauthWindow {
+			return nil, echo.NewHTTPError(http.StatusForbidden, pkg.NewMsgResp("sign in again with your identity provider to confirm"))
+		}
+		return user, nil
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, echo.NewHTTPError(http.StatusForbidden, pkg.NewMsgResp("incorrect password"))
+	}
+	return user, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func getProfile(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	user, err := s.db.User.GetUserByID(sc.UserID)
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func updateProfile(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.ProfileUpdate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := s.db.User.UpdateUsername(sc.UserID, req.Username); err != nil {
+		return err
+	}
+	return getProfile(c)
+}
+
+func changePassword(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.PasswordChange
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := checkPassword(s, sc, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.User.UpdatePassword(sc.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Keep the caller signed in, but sign out every other device.
+	if err = s.db.Session.RevokeUserSessions(sc.UserID, sc.SessionID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Password changed, other sessions were signed out"))
+}
+
+func changeEmail(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.EmailChange
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := checkPassword(s, sc, req.Password); err != nil {
+		return err
+	}
+
+	if _, err := s.db.User.GetUserID(req.Email); err == nil {
+		return echo.NewHTTPError(http.StatusConflict, "email is already in use")
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.User.SetPendingEmail(sc.UserID, req.Email, hashToken(token), time.Now().Add(emailTokenExpiry)); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"Confirm your new email address by submitting this token to %s/v1/verify_email:\n\n%s\n\nThe token expires in %s.",
+		s.conf.PublicURL, token, emailTokenExpiry,
+	)
+	if err = s.mailer.Send(req.Email, "Confirm your new email address", body); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, pkg.NewMsgResp("Verification email sent"))
+}
+
+func verifyEmail(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	var req pkg.EmailVerification
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "inadequate input parameters. Required token")
+	}
+
+	if _, err := s.db.User.ConfirmEmail(hashToken(req.Token)); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Email address verified"))
+}
+
+func deleteAccount(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.AccountDeletion
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := checkPassword(s, sc, req.Password)
+	if err != nil {
+		return err
+	}
+
+	deleteAfter := time.Now().Add(time.Duration(s.conf.AccountDeletionGraceHours) * time.Hour)
+	if err = s.db.User.ScheduleDeletion(sc.UserID, &deleteAfter); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"Your account is scheduled for deletion on %s. Sign in and call %s/v1/me/restore before then to keep it.",
+		deleteAfter.UTC().Format(time.RFC3339), s.conf.PublicURL,
+	)
+	if err = s.mailer.Send(user.Email, "Your account will be deleted", body); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, pkg.NewMsgResp(fmt.Sprintf("Account scheduled for deletion on %s", deleteAfter.UTC().Format(time.RFC3339))))
+}
+
+func restoreAccount(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := s.db.User.ScheduleDeletion(sc.UserID, nil); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Account deletion cancelled"))
+}
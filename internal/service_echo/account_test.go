@@ -0,0 +1,349 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/oidc"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryUserStore struct {
+	db.UserDB
+	mu      sync.Mutex
+	users   map[int64]*pkg.User
+	pending map[string]pendingEmail
+}
+
+type pendingEmail struct {
+	userID    int64
+	email     string
+	expiresAt time.Time
+}
+
+func (ms *memoryUserStore) GetUserByID(userID int64) (*pkg.User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	u, ok := ms.users[userID]
+	if !ok {
+		return nil, db.ErrUserNotFound
+	}
+	c := *u
+	return &c, nil
+}
+
+func (ms *memoryUserStore) CreateUser(u *pkg.User, _ string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	c := *u
+	c.ID = int64(len(ms.users) + 1)
+	ms.users[c.ID] = &c
+	return nil
+}
+
+func (ms *memoryUserStore) GetUser(email string) (*pkg.User, error) {
+	id, err := ms.GetUserID(email)
+	if err != nil {
+		return nil, err
+	}
+	return ms.GetUserByID(id)
+}
+
+func (ms *memoryUserStore) GetUserID(email string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, u := range ms.users {
+		if u.Email == email {
+			return u.ID, nil
+		}
+	}
+	return 0, db.ErrUserNotFound
+}
+
+func (ms *memoryUserStore) UpdatePassword(userID int64, password string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.users[userID].Password = password
+	return nil
+}
+
+func (ms *memoryUserStore) SetPendingEmail(userID int64, email, tokenHash string, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.pending[tokenHash] = pendingEmail{userID: userID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (ms *memoryUserStore) ConfirmEmail(tokenHash string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	p, ok := ms.pending[tokenHash]
+	if !ok || time.Now().After(p.expiresAt) {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid or expired verification token")
+	}
+	delete(ms.pending, tokenHash)
+	ms.users[p.userID].Email = p.email
+	return p.userID, nil
+}
+
+func (ms *memoryUserStore) ScheduleDeletion(userID int64, deleteAfter *time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.users[userID].DeleteAfter = deleteAfter
+	return nil
+}
+
+type memorySessionStore struct {
+	db.SessionDB
+	mu       sync.Mutex
+	sessions map[string]*db.Session
+	revoked  map[string]bool
+}
+
+func (ms *memorySessionStore) CreateSession(userID, orgID int64, _ string, expiresAt time.Time) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id := fmt.Sprintf("new%d", len(ms.sessions)+1)
+	ms.sessions[id] = &db.Session{ID: id, UserID: userID, OrgID: orgID, ExpiresAt: expiresAt}
+	return id, nil
+}
+
+func (ms *memorySessionStore) GetSession(sessionID string) (*db.Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[sessionID]
+	if !ok || ms.revoked[sessionID] {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "session expired or revoked")
+	}
+	return s, nil
+}
+
+func (ms *memorySessionStore) RevokeSession(sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.revoked[sessionID] = true
+	return nil
+}
+
+func (ms *memorySessionStore) RevokeUserSessions(userID int64, except string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, s := range ms.sessions {
+		if s.UserID == userID && id != except {
+			ms.revoked[id] = true
+		}
+	}
+	return nil
+}
+
+// newAccountService returns a service with ann, user 1 with the password "secret" and three sessions,
+// and bob, user 2 with one session.
+func newAccountService(t *testing.T) (*Service, *memoryUserStore, *memorySessionStore, *memoryMailer) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		users = &memoryUserStore{
+			users: map[int64]*pkg.User{
+				1: {ID: 1, Email: "ann@example.com", Password: string(hash)},
+				2: {ID: 2, Email: "bob@example.com", Password: string(hash)},
+			},
+			pending: map[string]pendingEmail{},
+		}
+		sessions = &memorySessionStore{
+			sessions: map[string]*db.Session{
+				"s1": {ID: "s1", UserID: 1},
+				"s2": {ID: "s2", UserID: 1},
+				"s3": {ID: "s3", UserID: 1},
+				"s4": {ID: "s4", UserID: 2},
+			},
+			revoked: map[string]bool{},
+		}
+		mailer = &memoryMailer{}
+	)
+
+	s := &Service{conf: NewConfig(), db: &db.DB{User: users, Session: sessions}, mailer: mailer}
+	return s, users, sessions, mailer
+}
+
+func Test_ChangePassword(t *testing.T) {
+	assert := asserts.New(t)
+
+	s, users, sessions, _ := newAccountService(t)
+	sc := &SecurityContext{UserID: 1, SessionID: "s1"}
+
+	change := func(body string) *httptest.ResponseRecorder {
+		return serveAs(s, sc, changePassword, http.MethodPost, "/v1/me/password", "/v1/me/password", body)
+	}
+
+	assert.Equal(http.StatusBadRequest, change(`{"current_password":"secret","new_password":"secret"}`).Code)
+	assert.Equal(http.StatusForbidden, change(`{"current_password":"wrong","new_password":"hunter2"}`).Code)
+	assert.Empty(sessions.revoked)
+
+	assert.Equal(http.StatusOK, change(`{"current_password":"secret","new_password":"hunter2"}`).Code)
+	assert.NoError(bcrypt.CompareHashAndPassword([]byte(users.users[1].Password), []byte("hunter2")))
+
+	// The caller stays signed in, the other sessions of the user are signed out and bob's are not.
+	assert.Equal(map[string]bool{"s2": true, "s3": true}, sessions.revoked)
+}
+
+func Test_ChangeEmail(t *testing.T) {
+	assert := asserts.New(t)
+
+	s, users, _, mailer := newAccountService(t)
+	sc := &SecurityContext{UserID: 1, SessionID: "s1"}
+
+	change := func(body string) *httptest.ResponseRecorder {
+		return serveAs(s, sc, changeEmail, http.MethodPost, "/v1/me/email", "/v1/me/email", body)
+	}
+	verify := func(token string) *httptest.ResponseRecorder {
+		return serveAs(s, nil, verifyEmail, http.MethodPost, "/v1/verify_email", "/v1/verify_email", `{"token":"`+token+`"}`)
+	}
+
+	assert.Equal(http.StatusForbidden, change(`{"email":"ann@example.org","password":"wrong"}`).Code)
+	assert.Equal(http.StatusConflict, change(`{"email":"bob@example.com","password":"secret"}`).Code)
+	assert.Empty(mailer.sent)
+
+	assert.Equal(http.StatusAccepted, change(`{"email":"ann@example.org","password":"secret"}`).Code)
+
+	// The token goes to the new address, and the old one stays until it is used.
+	m := mailer.last()
+	assert.Equal("ann@example.org", m.to)
+	assert.Equal("ann@example.com", users.users[1].Email)
+
+	parts := strings.Split(m.body, "\n\n")
+	if !assert.Len(parts, 3) {
+		return
+	}
+	token := parts[1]
+
+	assert.Equal(http.StatusBadRequest, verify("not-the-token").Code)
+	assert.Equal(http.StatusOK, verify(token).Code)
+	assert.Equal("ann@example.org", users.users[1].Email)
+
+	// Tokens work once.
+	assert.Equal(http.StatusBadRequest, verify(token).Code)
+}
+
+func Test_DeleteAccount(t *testing.T) {
+	assert := asserts.New(t)
+
+	s, users, _, mailer := newAccountService(t)
+	sc := &SecurityContext{UserID: 1, SessionID: "s1"}
+
+	del := func(body string) *httptest.ResponseRecorder {
+		return serveAs(s, sc, deleteAccount, http.MethodDelete, "/v1/me", "/v1/me", body)
+	}
+
+	assert.Equal(http.StatusForbidden, del(`{"password":"wrong"}`).Code)
+	assert.Nil(users.users[1].DeleteAfter)
+
+	before := time.Now()
+	assert.Equal(http.StatusAccepted, del(`{"password":"secret"}`).Code)
+
+	grace := time.Duration(s.conf.AccountDeletionGraceHours) * time.Hour
+	if assert.NotNil(users.users[1].DeleteAfter) {
+		assert.WithinDuration(before.Add(grace), *users.users[1].DeleteAfter, time.Minute)
+	}
+	assert.Equal("ann@example.com", mailer.last().to)
+	assert.Nil(users.users[2].DeleteAfter)
+
+	rec := serveAs(s, sc, restoreAccount, http.MethodPost, "/v1/me/restore", "/v1/me/restore", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Nil(users.users[1].DeleteAfter)
+}
+
+// Test_SSOAccount checks that users provisioned through single sign-on confirm account changes by
+// signing in again, since they have no password.
+func Test_SSOAccount(t *testing.T) {
+	assert := asserts.New(t)
+
+	now := time.Now()
+	s, users, _, _ := newAccountService(t)
+	s.guard, _ = newTestGuard(&now)
+
+	user, err := provisionUser(s, &oidc.Claims{Email: "cat@example.com", EmailVerified: true})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("cat", user.Username)
+	assert.Empty(user.Password)
+
+	// Without a password there is nothing to sign in with, not even an empty one.
+	for _, password := range []string{"", "not-a-real-password"} {
+		rec := serveAs(s, nil, signIn, http.MethodPost, "/v1/sign_in", "/v1/sign_in",
+			`{"email":"cat@example.com","password":"`+password+`"}`)
+		assert.Equal(http.StatusUnauthorized, rec.Code)
+	}
+
+	sc := &SecurityContext{UserID: user.ID, SessionID: "s5", SignedInAt: time.Now().Add(-time.Hour)}
+	change := func(body string) *httptest.ResponseRecorder {
+		return serveAs(s, sc, changePassword, http.MethodPost, "/v1/me/password", "/v1/me/password", body)
+	}
+
+	assert.Equal(http.StatusForbidden, change(`{"new_password":"hunter2"}`).Code)
+	sc.SignedInAt = time.Time{}
+	assert.Equal(http.StatusForbidden, change(`{"new_password":"hunter2"}`).Code)
+
+	// A fresh sign-in through the identity provider confirms the change.
+	sc.SignedInAt = time.Now().Add(-time.Minute)
+	assert.Equal(http.StatusOK, change(`{"new_password":"hunter2"}`).Code)
+	assert.NoError(bcrypt.CompareHashAndPassword([]byte(users.users[user.ID].Password), []byte("hunter2")))
+
+	// From then on the password is asked for like for everybody else.
+	assert.Equal(http.StatusForbidden, change(`{"new_password":"hunter3"}`).Code)
+	assert.Equal(http.StatusOK, change(`{"current_password":"hunter2","new_password":"hunter3"}`).Code)
+}
+
+// Test_IssueToken checks that sessions outlive their first token, now that tokens are refreshed.
+func Test_IssueToken(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+		sess   = ot.s.db.Session.(*memorySessionStore)
+	)
+
+	user, err := ot.s.db.User.GetUserByID(1)
+	assert.NoError(err)
+
+	rec := serveAs(ot.s, nil, func(c echo.Context) error {
+		return issueToken(c, ot.s, user)
+	}, http.MethodPost, "/v1/sign_in", "/v1/sign_in", "")
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var token pkg.Token
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &token))
+	assert.Equal(tokenExpirySec, token.ExpiresIn)
+	assert.NotEmpty(token.RefreshToken)
+
+	claims, err := parseToken(token.JWTToken, ot.s.conf.SigningKey)
+	if assert.NoError(err) {
+		session := sess.sessions[claims.Id]
+		if assert.NotNil(session) {
+			assert.Equal(int64(1), session.OrgID)
+			assert.WithinDuration(time.Now().Add(30*24*time.Hour), session.ExpiresAt, time.Minute)
+		}
+	}
+}
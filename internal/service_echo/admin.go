@@ -0,0 +1,338 @@
+package service_echo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// roleRank orders roles so that a higher role includes the permissions of the lower ones.
+var roleRank = map[string]int{
+	pkg.RoleUser:    0,
+	pkg.RoleSupport: 1,
+	pkg.RoleAdmin:   2,
+}
+
+// RequireRole rejects callers whose token does not carry at least the given role.
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sc := c.Get("security_context").(*SecurityContext)
+
+			if sc.ClientID != "" || roleRank[sc.Role] < roleRank[role] {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient role")
+			}
+			return next(c)
+		}
+	}
+}
+
+// audited records the admin action in the audit trail, including attempts that were denied or failed.
+// It has to run before RequireRole to see the denials. Handlers can add details by setting
+// "audit_detail" on the context.
+func audited(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			var (
+				s  = c.Get("service").(*Service)
+				sc = c.Get("security_context").(*SecurityContext)
+			)
+
+			a := &pkg.AdminAction{
+				ActorID:    sc.UserID,
+				ActorEmail: sc.Email,
+				Action:     action,
+				Outcome:    pkg.AdminSucceeded,
+				IP:         c.RealIP(),
+			}
+			if id, err := strconv.ParseInt(c.Param("id"), 10, 64); err == nil {
+				a.TargetUserID = &id
+			}
+			if d, ok := c.Get("audit_detail").(string); ok {
+				a.Detail = d
+			}
+
+			if err != nil {
+				a.Outcome = pkg.AdminFailed
+
+				var he *echo.HTTPError
+				if errors.As(err, &he) && (he.Code == http.StatusUnauthorized || he.Code == http.StatusForbidden) {
+					a.Outcome = pkg.AdminDenied
+				}
+				if a.Detail == "" {
+					a.Detail = errorMessage(err)
+				}
+			}
+
+			// The response is already written on success, so a failure to record can only be logged.
+			if rerr := s.db.AdminAudit.RecordAdminAction(a); rerr != nil {
+				log.Printf("could not record admin action %s by %d: %v", action, sc.UserID, rerr)
+			}
+			return err
+		}
+	}
+}
+
+// errorMessage returns the message of an error as a client would see it.
+func errorMessage(err error) string {
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		return err.Error()
+	}
+
+	switch m := he.Message.(type) {
+	case *pkg.MsgResp:
+		return m.Message
+	case string:
+		return m
+	}
+	return http.StatusText(he.Code)
+}
+
+func getPage(c echo.Context) (int, int, error) {
+	limit, offset := defaultPageSize, 0
+
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit given %s", v)
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		limit = n
+	}
+
+	if v := c.QueryParam("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset given %s", v)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+func listUsers(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	q := c.QueryParam("q")
+	c.Set("audit_detail", "q="+q)
+
+	users, err := s.db.User.SearchUsers(q, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+func getUser(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	userID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	user, err := s.db.User.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func getUserTodoCounts(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	userID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	counts, err := s.db.Todo.CountTodos(userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, counts)
+}
+
+// signOutEverywhere revokes all sessions and OAuth tokens of the user.
+func signOutEverywhere(s *Service, userID int64) error {
+	if err := s.db.Session.RevokeUserSessions(userID, ""); err != nil {
+		return err
+	}
+	return s.db.OAuth.RevokeUserTokens(userID)
+}
+
+func setUserDisabled(disabled bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var (
+			s  = c.Get("service").(*Service)
+			sc = c.Get("security_context").(*SecurityContext)
+		)
+
+		userID, err := getID(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if userID == sc.UserID {
+			return echo.NewHTTPError(http.StatusBadRequest, "you cannot disable your own account")
+		}
+
+		if _, err = s.db.User.GetUserByID(userID); err != nil {
+			return err
+		}
+
+		if err = s.db.User.SetDisabled(userID, disabled); err != nil {
+			return err
+		}
+
+		if disabled {
+			if err = signOutEverywhere(s, userID); err != nil {
+				return err
+			}
+			return c.JSON(http.StatusOK, pkg.NewMsgResp("Account disabled"))
+		}
+		return c.JSON(http.StatusOK, pkg.NewMsgResp("Account enabled"))
+	}
+}
+
+func setUserRole(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	userID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var req pkg.RoleChange
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if userID == sc.UserID {
+		return echo.NewHTTPError(http.StatusBadRequest, "you cannot change your own role")
+	}
+
+	if _, err = s.db.User.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	if err = s.db.User.SetRole(userID, req.Role); err != nil {
+		return err
+	}
+	c.Set("audit_detail", "role="+req.Role)
+
+	// Roles are carried in the token, so existing sessions have to sign in again to pick up the change.
+	if err = s.db.Session.RevokeUserSessions(userID, ""); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Role changed"))
+}
+
+func resetUserMFA(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	userID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err = s.db.User.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	if err = s.db.MFA.DisableMFA(userID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Two-factor authentication reset"))
+}
+
+func forceSignOut(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	userID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err = s.db.User.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	if err = signOutEverywhere(s, userID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("User signed out everywhere"))
+}
+
+func unlockSignIn(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	var req pkg.UnlockRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	c.Set("audit_detail", fmt.Sprintf("email=%s ip=%s", req.Email, req.IP))
+
+	// An account is locked out of the password and the two-factor steps of signing in separately.
+	if req.Email != "" {
+		for _, key := range []string{accountKey(req.Email), mfaKey(req.Email)} {
+			if err := s.guard.unlock(key, c.RealIP()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.IP != "" {
+		if err := s.guard.unlock(ipKey(req.IP), c.RealIP()); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Sign-in unlocked"))
+}
+
+func listAdminActions(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	actions, err := s.db.AdminAudit.ListAdminActions(limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, actions)
+}
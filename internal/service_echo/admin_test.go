@@ -0,0 +1,215 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func (ms *memoryUserStore) SearchUsers(string, int, int) ([]pkg.User, error) {
+	return []pkg.User{}, nil
+}
+
+func (ms *memoryUserStore) SetRole(userID int64, role string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.users[userID].Role = role
+	return nil
+}
+
+func (ms *memoryUserStore) SetDisabled(int64, bool) error {
+	return nil
+}
+
+func (ms *memoryOAuthStore) RevokeUserTokens(int64) error {
+	return nil
+}
+
+type memoryAuditStore struct {
+	db.AdminAuditDB
+	mu      sync.Mutex
+	actions []pkg.AdminAction
+}
+
+func (ms *memoryAuditStore) RecordAdminAction(a *pkg.AdminAction) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.actions = append(ms.actions, *a)
+	return nil
+}
+
+func (ms *memoryAuditStore) ListAdminActions(int, int) ([]pkg.AdminAction, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]pkg.AdminAction{}, ms.actions...), nil
+}
+
+type adminStores struct {
+	db.TodoDB
+	db.MFADB
+	db.OrgDB
+}
+
+func (adminStores) CountTodos(int64) (*pkg.TodoCounts, error) {
+	return &pkg.TodoCounts{}, nil
+}
+
+func (adminStores) DisableMFA(int64) error {
+	return nil
+}
+
+func (adminStores) GetMemberRole(int64, int64) (string, error) {
+	return "", nil
+}
+
+func (adminStores) RecordEvent(string, string, string) error {
+	return nil
+}
+
+func Test_AdminRoles(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		users = &memoryUserStore{users: map[int64]*pkg.User{
+			1: {ID: 1, Email: "ann@example.com", Role: pkg.RoleAdmin},
+			2: {ID: 2, Email: "sam@example.com", Role: pkg.RoleSupport},
+			3: {ID: 3, Email: "una@example.com", Role: pkg.RoleUser},
+			4: {ID: 4, Email: "dan@example.com", Role: pkg.RoleUser},
+		}}
+		sessions = &memorySessionStore{
+			sessions: map[string]*db.Session{
+				pkg.RoleAdmin:   {ID: pkg.RoleAdmin, UserID: 1, Email: "ann@example.com"},
+				pkg.RoleSupport: {ID: pkg.RoleSupport, UserID: 2, Email: "sam@example.com"},
+				pkg.RoleUser:    {ID: pkg.RoleUser, UserID: 3, Email: "una@example.com"},
+			},
+			revoked: map[string]bool{},
+		}
+		audit  = &memoryAuditStore{}
+		stores = adminStores{}
+		conf   = NewConfig()
+	)
+	conf.SigningKey = "key"
+
+	s := &Service{
+		conf: conf,
+		db: &db.DB{
+			User:       users,
+			Session:    sessions,
+			OAuth:      newMemoryOAuthStore(),
+			AdminAudit: audit,
+			Todo:       stores,
+			MFA:        stores,
+			Org:        stores,
+		},
+		guard: newLoginGuard(conf, db.NewMemoryAttemptStore(), stores),
+	}
+	h := s.Handler()
+
+	call := func(role, method, target, body string) int {
+		token, err := generateToken(role+"@example.com", role, role, 0, conf.SigningKey)
+		assert.NoError(err)
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		// Sessions are signed out by some of the actions, which the next calls must not notice.
+		sessions.revoked = map[string]bool{}
+		return rec.Code
+	}
+
+	routes := []struct {
+		method, target, body string
+		action, role         string
+	}{
+		{http.MethodGet, "/v1/admin/users?q=dan", "", "user.list", pkg.RoleSupport},
+		{http.MethodGet, "/v1/admin/users/4", "", "user.view", pkg.RoleSupport},
+		{http.MethodGet, "/v1/admin/users/4/todo_counts", "", "user.todo_counts", pkg.RoleSupport},
+		{http.MethodPost, "/v1/admin/users/4/sign_out", "", "user.sign_out", pkg.RoleSupport},
+		{http.MethodPost, "/v1/admin/unlock", `{"email":"dan@example.com"}`, "sign_in.unlock", pkg.RoleSupport},
+		{http.MethodPost, "/v1/admin/users/4/disable", "", "user.disable", pkg.RoleAdmin},
+		{http.MethodPost, "/v1/admin/users/4/enable", "", "user.enable", pkg.RoleAdmin},
+		{http.MethodPost, "/v1/admin/users/4/reset_mfa", "", "user.reset_mfa", pkg.RoleAdmin},
+		{http.MethodPut, "/v1/admin/users/4/role", `{"role":"user"}`, "user.set_role", pkg.RoleAdmin},
+		{http.MethodGet, "/v1/admin/audit", "", "", pkg.RoleAdmin},
+	}
+
+	for _, r := range routes {
+		for _, role := range pkg.Roles {
+			audit.actions = nil
+
+			allowed := roleRank[role] >= roleRank[r.role]
+			code := call(role, r.method, r.target, r.body)
+
+			if allowed {
+				assert.Equal(http.StatusOK, code, "%s %s as %s", r.method, r.target, role)
+			} else {
+				assert.Equal(http.StatusForbidden, code, "%s %s as %s", r.method, r.target, role)
+			}
+
+			if r.action == "" {
+				assert.Empty(audit.actions)
+				continue
+			}
+
+			// Every attempt is recorded, including the denied ones.
+			if assert.Len(audit.actions, 1, "%s %s as %s", r.method, r.target, role) {
+				a := audit.actions[0]
+				assert.Equal(r.action, a.Action)
+				assert.Equal(sessions.sessions[role].UserID, a.ActorID)
+
+				if allowed {
+					assert.Equal(pkg.AdminSucceeded, a.Outcome)
+				} else {
+					assert.Equal(pkg.AdminDenied, a.Outcome)
+					assert.Equal("insufficient role", a.Detail)
+				}
+			}
+		}
+	}
+
+	// Actions that fail are recorded too.
+	audit.actions = nil
+	assert.Equal(http.StatusBadRequest, call(pkg.RoleAdmin, http.MethodPost, "/v1/admin/users/1/disable", ""))
+	if assert.Len(audit.actions, 1) {
+		assert.Equal(pkg.AdminFailed, audit.actions[0].Outcome)
+		assert.Equal("you cannot disable your own account", audit.actions[0].Detail)
+		assert.Equal(int64(1), *audit.actions[0].TargetUserID)
+	}
+
+	audit.actions = nil
+	assert.Equal(http.StatusBadRequest, call(pkg.RoleAdmin, http.MethodPut, "/v1/admin/users/4/role", `{"role":"root"}`))
+	if assert.Len(audit.actions, 1) {
+		assert.Equal(pkg.AdminFailed, audit.actions[0].Outcome)
+	}
+	assert.Equal(pkg.RoleUser, users.users[4].Role)
+
+	// Unlocking an account lifts the lockout of both steps of signing in.
+	for i := 0; i < conf.LoginLockoutAfter; i++ {
+		assert.NoError(s.guard.fail(accountKey("dan@example.com"), s.guard.account, "192.0.2.1"))
+		assert.NoError(s.guard.fail(mfaKey("dan@example.com"), s.guard.account, "192.0.2.1"))
+	}
+	for _, key := range []string{accountKey("dan@example.com"), mfaKey("dan@example.com")} {
+		wait, err := s.guard.retryAfter(key)
+		assert.NoError(err)
+		assert.Greater(wait, time.Duration(0), key)
+	}
+
+	assert.Equal(http.StatusOK, call(pkg.RoleSupport, http.MethodPost, "/v1/admin/unlock", `{"email":"dan@example.com"}`))
+	for _, key := range []string{accountKey("dan@example.com"), mfaKey("dan@example.com")} {
+		wait, err := s.guard.retryAfter(key)
+		assert.NoError(err)
+		assert.Zero(wait, key)
+	}
+}
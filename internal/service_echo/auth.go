@@ -1,20 +1,38 @@
 package service_echo
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/util"
 	"github.com/harsha-aqfer/todo/pkg"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const tokenExpirySec = 24 * 3600 // 2 hours
+const (
+	tokenExpirySec    = 24 * 3600 // 2 hours
+	mfaTokenExpirySec = 5 * 60
+
+	// refreshTokenExpiry is how long a session lasts without being refreshed.
+	refreshTokenExpiry = 30 * 24 * time.Hour
+
+	mfaAudience = "mfa"
+)
 
 type Claims struct {
-	Email string `json:"email"`
+	Email    string `json:"email"`
+	Role     string `json:"role,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	OrgID    int64  `json:"org_id,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -36,7 +54,17 @@ func signUp(c echo.Context) error {
 	}
 	req.Password = hashedPassword
 
-	if err = s.db.User.CreateUser(&req); err != nil {
+	// Signing up through an invitation link joins the inviting organization, subject to its
+	// allowed email domains, together with creating the account.
+	var invitation string
+	if req.Invitation != "" {
+		invitation = hashToken(req.Invitation)
+		if _, err = checkInvitation(s, invitation, req.Email); err != nil {
+			return err
+		}
+	}
+
+	if err = s.db.User.CreateUser(&req, invitation); err != nil {
 		return err
 	}
 	return c.JSON(http.StatusOK, pkg.NewMsgResp("Successfully signed up!"))
@@ -50,22 +78,158 @@ func signIn(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
+	ip := c.RealIP()
+
+	wait, err := s.guard.retryAfter(accountKey(req.Email), ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
 	user, err := s.db.User.GetUser(req.Email)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		return err
+	}
+
+	// Unknown users are checked against a dummy hash so that both failure modes take the same time
+	// and produce the same response.
+	hash := dummyPasswordHash()
+	if user != nil && user.Password != "" {
+		hash = user.Password
+	}
+
+	// Accounts provisioned through single sign-on have no password.
+	if err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)); err != nil || user == nil || user.Password == "" {
+		if err = s.guard.failed(req.Email, ip); err != nil {
+			return err
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, pkg.NewMsgResp("invalid email or password"))
+	}
+
+	if err = s.guard.succeeded(req.Email); err != nil {
+		return err
+	}
+
+	mfa, err := s.db.MFA.GetMFA(user.ID)
 	if err != nil {
 		return err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	// With two-factor authentication enabled the password only buys a short-lived challenge token
+	// that has to be exchanged at /v1/sign_in/mfa.
+	if mfa != nil && mfa.Enabled {
+		token, err := generateMFAToken(user.Email, s.conf.SigningKey)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, &pkg.MFAChallenge{MFARequired: true, MFAToken: token, ExpiresIn: mfaTokenExpirySec})
+	}
+	return issueToken(c, s, user)
+}
+
+// issueToken starts a new session for the user and responds with its JWT.
+func issueToken(c echo.Context, s *Service, user *pkg.User) error {
+	if user.DisabledAt != nil {
+		return echo.NewHTTPError(http.StatusForbidden, pkg.NewMsgResp("account is disabled"))
+	}
+
+	orgID, err := defaultOrg(s, user)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, pkg.NewMsgResp("incorrect password"))
+		return err
 	}
 
-	token, err := generateToken(user.Email, s.conf.SigningKey)
+	refresh, err := randomToken()
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, &pkg.Token{ExpiresIn: tokenExpirySec, JWTToken: token})
+	sessionID, err := s.db.Session.CreateSession(user.ID, orgID, hashToken(refresh), time.Now().Add(refreshTokenExpiry))
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(user.Email, user.Role, sessionID, orgID, s.conf.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &pkg.Token{ExpiresIn: tokenExpirySec, JWTToken: token, RefreshToken: refresh})
+}
+
+// refreshToken exchanges a refresh token for a new token of the same session and organization, and a
+// new refresh token.
+func refreshToken(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	var req pkg.RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	session, err := s.db.Session.RefreshSession(hashToken(req.RefreshToken), hashToken(refresh), time.Now().Add(refreshTokenExpiry))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.db.User.GetUser(session.Email)
+	if err != nil {
+		return err
+	}
+
+	orgID := session.OrgID
+	if orgID == 0 {
+		if orgID, err = defaultOrg(s, user); err != nil {
+			return err
+		}
+	}
+
+	token, err := generateToken(user.Email, user.Role, session.ID, orgID, s.conf.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &pkg.Token{ExpiresIn: tokenExpirySec, JWTToken: token, RefreshToken: refresh})
+}
+
+func tooManyAttempts(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return echo.NewHTTPError(http.StatusTooManyRequests, pkg.NewMsgResp("too many sign-in attempts, try again later"))
+}
+
+func signOut(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := s.db.Session.RevokeSession(sc.SessionID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Successfully signed out!"))
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		h, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+		dummyHash = string(h)
+	})
+	return dummyHash
 }
 
 func hashPassword(password string) (string, error) {
@@ -80,23 +244,95 @@ func mkJwtToken(signKey []byte, claims jwt.Claims) (string, error) {
 	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signKey)
 }
 
-func generateToken(email string, signingKey string) (string, error) {
+func generateToken(email, role, sessionID string, orgID int64, signingKey string) (string, error) {
 	now := time.Now().Unix()
 
 	claims := Claims{
 		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
 			IssuedAt:  now,
 			ExpiresAt: now + tokenExpirySec,
 		},
 		Email: email,
+		Role:  role,
+		OrgID: orgID,
+	}
+
+	return mkJwtToken([]byte(signingKey), claims)
+}
+
+func generateMFAToken(email string, signingKey string) (string, error) {
+	now := time.Now().Unix()
+
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  mfaAudience,
+			IssuedAt:  now,
+			ExpiresAt: now + mfaTokenExpirySec,
+		},
+		Email: email,
 	}
 
 	return mkJwtToken([]byte(signingKey), claims)
 }
 
+// parseToken verifies the signature and expiry of a token issued by this service.
+func parseToken(authToken, signingKey string) (*Claims, error) {
+	claims := &Claims{}
+
+	tkn, err := jwt.ParseWithClaims(authToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("error parsing the token")
+		}
+		return []byte(signingKey), nil
+	})
+
+	if err != nil {
+		// Expired tokens are unauthorized rather than bad, so that clients know to refresh them.
+		var ve *jwt.ValidationError
+		if err == jwt.ErrSignatureInvalid || errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, echo.NewHTTPError(http.StatusUnauthorized)
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest)
+	}
+
+	if !tkn.Valid {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized)
+	}
+	return claims, nil
+}
+
 type SecurityContext struct {
-	Email  string
-	UserID int64
+	Email     string
+	UserID    int64
+	SessionID string
+	Role      string
+
+	// SignedInAt is when the session started, which is zero for tokens without a session.
+	SignedInAt time.Time
+
+	// OrgID is the active organization and OrgRole the caller's membership role in it, which is
+	// empty if the caller is not a member.
+	OrgID   int64
+	OrgRole string
+
+	// ClientID and Scopes are set for OAuth access tokens issued to third-party clients.
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope reports whether the caller may perform operations covered by scope. First-party
+// sessions are unrestricted.
+func (sc *SecurityContext) HasScope(scope string) bool {
+	if sc.ClientID == "" {
+		return true
+	}
+	return util.Contains(sc.Scopes, scope)
+}
+
+// Actor returns who performs changes on behalf of this request.
+func (sc *SecurityContext) Actor() *pkg.Actor {
+	return &pkg.Actor{UserID: sc.UserID, ClientID: sc.ClientID}
 }
 
 func IsAuthorized(next echo.HandlerFunc) echo.HandlerFunc {
@@ -112,35 +348,60 @@ func IsAuthorized(next echo.HandlerFunc) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusUnauthorized)
 		}
 
-		var (
-			authToken = strings.Trim(h[len(authBearer):], " ")
-			claims    = &Claims{}
-		)
+		claims, err := parseToken(strings.Trim(h[len(authBearer):], " "), s.conf.SigningKey)
+		if err != nil {
+			return err
+		}
 
-		tkn, err := jwt.ParseWithClaims(authToken, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("error parsing the token")
-			}
-			return []byte(s.conf.SigningKey), nil
-		})
+		// MFA challenge tokens are only accepted by /v1/sign_in/mfa.
+		if claims.Audience != "" {
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		}
 
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
+		if claims.ClientID != "" {
+			t, err := s.db.OAuth.GetToken(claims.Id)
+			if err != nil {
+				return err
+			}
+			if t == nil {
 				return echo.NewHTTPError(http.StatusUnauthorized)
 			}
-			return echo.NewHTTPError(http.StatusBadRequest)
+
+			orgRole, err := s.db.Org.GetMemberRole(t.OrgID, t.UserID)
+			if err != nil {
+				return err
+			}
+
+			c.Set("security_context", &SecurityContext{
+				Email:    t.Email,
+				UserID:   t.UserID,
+				OrgID:    t.OrgID,
+				OrgRole:  orgRole,
+				ClientID: t.ClientID,
+				Scopes:   strings.Fields(t.Scope),
+			})
+			return next(c)
 		}
 
-		if !tkn.Valid {
-			return echo.NewHTTPError(http.StatusUnauthorized)
+		session, err := s.db.Session.GetSession(claims.Id)
+		if err != nil {
+			return err
 		}
 
-		userID, err := s.db.User.GetUserID(claims.Email)
+		orgRole, err := s.db.Org.GetMemberRole(claims.OrgID, session.UserID)
 		if err != nil {
 			return err
 		}
 
-		c.Set("security_context", &SecurityContext{Email: claims.Email, UserID: userID})
+		c.Set("security_context", &SecurityContext{
+			Email:      session.Email,
+			UserID:     session.UserID,
+			SessionID:  session.ID,
+			Role:       claims.Role,
+			SignedInAt: session.CreatedAt,
+			OrgID:      claims.OrgID,
+			OrgRole:    orgRole,
+		})
 		return next(c)
 	}
 }
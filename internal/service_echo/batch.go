@@ -0,0 +1,197 @@
+package service_echo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// batchResult turns the outcome of an operation into its result. Errors that are not HTTP errors are
+// logged and reported without details.
+func batchResult(id int64, status int, err error) pkg.BatchResult {
+	if err == nil {
+		return pkg.BatchResult{ID: id, Status: status}
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		msg := fmt.Sprint(he.Message)
+		if mr, ok := he.Message.(*pkg.MsgResp); ok {
+			msg = mr.Message
+		}
+		return pkg.BatchResult{ID: id, Status: he.Code, Error: msg}
+	}
+
+	log.Printf("batch operation on todo %d failed: %v", id, err)
+	return pkg.BatchResult{ID: id, Status: http.StatusInternalServerError, Error: http.StatusText(http.StatusInternalServerError)}
+}
+
+// publishBatch pushes the events of the operations that were applied.
+func publishBatch(s *Service, sc *SecurityContext, ops []pkg.BatchOperation, results []pkg.BatchResult) {
+	for i, op := range ops {
+		if results[i].Error != "" {
+			continue
+		}
+
+		switch op.Op {
+		case pkg.BatchCreate:
+			publishTodo(s, sc, pkg.EventTodoCreated, results[i].ID)
+		case pkg.BatchDelete:
+			publishTodo(s, sc, pkg.EventTodoDeleted, results[i].ID)
+		case pkg.BatchComplete:
+			publishTodo(s, sc, pkg.EventTodoCompleted, results[i].ID)
+		default:
+			if op.Todo != nil && op.Todo.Done {
+				publishTodo(s, sc, pkg.EventTodoCompleted, results[i].ID)
+				continue
+			}
+			publishTodo(s, sc, pkg.EventTodoUpdated, results[i].ID)
+		}
+	}
+}
+
+func applyBatchOperation(t db.TodoTx, sc *SecurityContext, op *pkg.BatchOperation) pkg.BatchResult {
+	switch op.Op {
+	case pkg.BatchCreate:
+		id, err := t.CreateTodo(sc.OrgID, sc.UserID, op.Todo, sc.Actor())
+		return batchResult(id, http.StatusCreated, err)
+	case pkg.BatchUpdate:
+		return batchResult(op.ID, http.StatusOK, t.UpdateTodo(sc.OrgID, sc.UserID, op.ID, op.Revision, op.Todo, sc.Actor()))
+	case pkg.BatchComplete:
+		return batchResult(op.ID, http.StatusOK, t.UpdateTodo(sc.OrgID, sc.UserID, op.ID, op.Revision, &pkg.TodoRequest{Done: true}, sc.Actor()))
+	default:
+		return batchResult(op.ID, http.StatusOK, t.DeleteTodo(sc.OrgID, sc.UserID, op.ID, op.Revision, sc.Actor()))
+	}
+}
+
+// batchTodos applies a list of operations and reports a result for each. Without atomic every
+// operation stands on its own. With atomic, set in the body or as query parameter, they run in one
+// transaction: if one fails, none is applied and the response carries the status of the failure.
+func batchTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.BatchRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	atomic := req.Atomic || c.QueryParam("atomic") == "true"
+
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		results = make([]pkg.BatchResult, len(req.Operations))
+		valid   = make([]bool, len(req.Operations))
+		failed  = -1
+	)
+
+	for i := range req.Operations {
+		op := &req.Operations[i]
+
+		err := op.Validate()
+		if err != nil {
+			err = echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		} else if op.Todo != nil {
+			err = checkTodoRequest(s, org, op.Todo, op.Op == pkg.BatchCreate)
+		}
+
+		if err != nil {
+			results[i] = batchResult(op.ID, 0, err)
+			if failed < 0 {
+				failed = i
+			}
+			continue
+		}
+		valid[i] = true
+	}
+
+	if !atomic {
+		for i := range req.Operations {
+			if valid[i] {
+				results[i] = applyBatchOperation(s.db.Todo, sc, &req.Operations[i])
+			}
+		}
+
+		publishBatch(s, sc, req.Operations, results)
+		return c.JSON(http.StatusOK, &pkg.BatchResponse{Results: results})
+	}
+
+	if failed < 0 {
+		err = s.db.Todo.InTx(func(t db.TodoTx) error {
+			for i := range req.Operations {
+				results[i] = applyBatchOperation(t, sc, &req.Operations[i])
+				if results[i].Error != "" {
+					failed = i
+					return errors.New(results[i].Error)
+				}
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			return err
+		}
+	}
+
+	if failed < 0 {
+		publishBatch(s, sc, req.Operations, results)
+		return c.JSON(http.StatusOK, &pkg.BatchResponse{Results: results})
+	}
+
+	// Nothing was applied, so only the failure keeps its result.
+	for i := range results {
+		if i != failed {
+			results[i] = pkg.BatchResult{
+				ID:     req.Operations[i].ID,
+				Status: http.StatusFailedDependency,
+				Error:  "not applied because another operation failed",
+			}
+		}
+	}
+	// Returned as an error, so that an idempotency key is freed for retries of the batch.
+	return echo.NewHTTPError(results[failed].Status, &pkg.BatchResponse{Results: results})
+}
+
+// bulkTodos applies an action to every todo that matches a filter, in one transaction.
+func bulkTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.BulkRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ids, err := s.db.Todo.BulkTodos(sc.OrgID, sc.UserID, &req, sc.Actor())
+	if err != nil {
+		return err
+	}
+
+	eventType := pkg.EventTodoCompleted
+	if req.Action == pkg.BulkDelete {
+		eventType = pkg.EventTodoDeleted
+	}
+	for _, id := range ids {
+		publishTodo(s, sc, eventType, id)
+	}
+	return c.JSON(http.StatusOK, &pkg.BulkResponse{Affected: len(ids), IDs: ids})
+}
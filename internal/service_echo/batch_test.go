@@ -0,0 +1,125 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/events"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// publishedEvents drains the events that were published to sub so far.
+func publishedEvents(sub events.Subscription) []string {
+	var types []string
+	for {
+		select {
+		case e := <-sub.Events():
+			types = append(types, e.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func Test_BatchTodos(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+	)
+
+	sub, err := ot.s.broker.Subscribe(events.Topic(1, 1), "")
+	assert.NoError(err)
+	defer sub.Close()
+
+	batch := func(target, body string) (int, []pkg.BatchResult) {
+		rec := ot.call("ann", 1, http.MethodPost, target, body)
+
+		var br pkg.BatchResponse
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &br), rec.Body.String())
+		return rec.Code, br.Results
+	}
+
+	rentID := ot.todos.add(1, 1, pkg.TodoResponse{Task: "pay rent", Priority: "high", Revision: 3})
+	plantsID := ot.todos.add(1, 1, pkg.TodoResponse{Task: "water plants", Priority: "low"})
+	bobID := ot.todos.add(2, 2, pkg.TodoResponse{Task: "bob's todo", Priority: "low"})
+
+	// Every operation stands on its own and gets its own result.
+	code, results := batch("/v1/todos:batch", `{"operations":[
+		{"op":"create","todo":{"task":"buy milk","priority":"low"}},
+		{"op":"create","todo":{"task":"pay rent","priority":"low"}},
+		{"op":"create","todo":{"task":"spam","priority":"low","category":"spam"}},
+		{"op":"update","id":99,"todo":{"task":"ghost"}},
+		{"op":"update","id":`+fmt.Sprint(bobID)+`,"todo":{"task":"taken over"}},
+		{"op":"update","id":`+fmt.Sprint(plantsID)+`},
+		{"op":"delete","id":`+fmt.Sprint(rentID)+`,"revision":2},
+		{"op":"complete","id":`+fmt.Sprint(plantsID)+`}
+	]}`)
+	assert.Equal(http.StatusOK, code)
+	if assert.Len(results, 8) {
+		assert.Equal(http.StatusCreated, results[0].Status)
+		assert.Equal("buy milk", ot.todos.get(results[0].ID).Task)
+		assert.Equal(http.StatusConflict, results[1].Status)
+		assert.Equal(http.StatusBadRequest, results[2].Status)
+		assert.Equal("unknown category value: spam", results[2].Error)
+		assert.Equal(pkg.BatchResult{ID: 99, Status: http.StatusNotFound, Error: "no such todo: 99"}, results[3])
+		assert.Equal(http.StatusNotFound, results[4].Status)
+		assert.Equal(http.StatusBadRequest, results[5].Status)
+		assert.Equal(http.StatusPreconditionFailed, results[6].Status)
+		assert.Equal(pkg.BatchResult{ID: plantsID, Status: http.StatusOK}, results[7])
+	}
+	assert.Equal([]string{pkg.EventTodoCreated, pkg.EventTodoCompleted}, publishedEvents(sub))
+
+	assert.Nil(ot.todos.get(rentID).DeletedAt)
+	assert.NotNil(ot.todos.get(plantsID).CompletedAt)
+	assert.Equal("bob's todo", ot.todos.get(bobID).Task)
+
+	// Atomic batches apply nothing if one operation fails, and respond with the status of the failure.
+	before := ot.todos.list(1, 1, func(*memoryTodo) bool { return true })
+
+	code, results = batch("/v1/todos:batch", `{"atomic":true,"operations":[
+		{"op":"create","todo":{"task":"call mom","priority":"high"}},
+		{"op":"update","id":`+fmt.Sprint(rentID)+`,"todo":{"priority":"low"}},
+		{"op":"delete","id":`+fmt.Sprint(rentID)+`,"revision":4},
+		{"op":"delete","id":`+fmt.Sprint(bobID)+`}
+	]}`)
+	assert.Equal(http.StatusNotFound, code)
+	if assert.Len(results, 4) {
+		for _, r := range results[:3] {
+			assert.Equal(http.StatusFailedDependency, r.Status)
+		}
+		assert.Equal(pkg.BatchResult{ID: bobID, Status: http.StatusNotFound, Error: "no such todo: " + fmt.Sprint(bobID)}, results[3])
+	}
+	assert.Equal(before, ot.todos.list(1, 1, func(*memoryTodo) bool { return true }))
+	assert.Empty(publishedEvents(sub))
+
+	// That includes failures found before the transaction starts.
+	code, results = batch("/v1/todos:batch?atomic=true", `{"operations":[
+		{"op":"create","todo":{"task":"call mom","priority":"high"}},
+		{"op":"rename","id":`+fmt.Sprint(rentID)+`}
+	]}`)
+	assert.Equal(http.StatusBadRequest, code)
+	if assert.Len(results, 2) {
+		assert.Equal(http.StatusFailedDependency, results[0].Status)
+		assert.Equal(http.StatusBadRequest, results[1].Status)
+	}
+	assert.Equal(before, ot.todos.list(1, 1, func(*memoryTodo) bool { return true }))
+
+	code, results = batch("/v1/todos:batch?atomic=true", `{"operations":[
+		{"op":"create","todo":{"task":"call mom","priority":"high"}},
+		{"op":"update","id":`+fmt.Sprint(rentID)+`,"revision":3,"todo":{"priority":"low"}},
+		{"op":"delete","id":`+fmt.Sprint(rentID)+`,"revision":4}
+	]}`)
+	assert.Equal(http.StatusOK, code)
+	if assert.Len(results, 3) {
+		assert.Equal(http.StatusCreated, results[0].Status)
+		assert.Equal(pkg.BatchResult{ID: rentID, Status: http.StatusOK}, results[1])
+		assert.Equal(pkg.BatchResult{ID: rentID, Status: http.StatusOK}, results[2])
+	}
+	assert.Equal([]string{pkg.EventTodoCreated, pkg.EventTodoUpdated, pkg.EventTodoDeleted}, publishedEvents(sub))
+
+	rent := ot.todos.get(rentID)
+	assert.Equal("low", rent.Priority)
+	assert.NotNil(rent.DeletedAt)
+}
@@ -0,0 +1,970 @@
+package service_echo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/dav"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The CalDAV tree has the principal of the caller and a calendar home with one calendar per list: the
+// inbox of each organization the caller belongs to, for the todos without a project, and each of its
+// projects. Todos are the VTODO resources of their list, named after their client UID or todo-<id>.
+const (
+	davPrefix   = "/dav"
+	davSyncPath = "/dav/sync/"
+	davInbox    = "inbox"
+	davSuffix   = ".ics"
+	davRealm    = `Basic realm="Todo"`
+	davXML      = "application/xml; charset=utf-8"
+	davTodoType = "text/calendar; charset=utf-8; component=VTODO"
+)
+
+// Kinds of CalDAV resources.
+const (
+	davRoot = iota
+	davPrincipal
+	davHome
+	davCalendar
+	davObject
+)
+
+var (
+	propResourceType = dav.Name(dav.NS, "resourcetype")
+	propDisplayName  = dav.Name(dav.NS, "displayname")
+	propPrincipal    = dav.Name(dav.NS, "current-user-principal")
+	propPrincipalURL = dav.Name(dav.NS, "principal-URL")
+	propPrivileges   = dav.Name(dav.NS, "current-user-privilege-set")
+	propReports      = dav.Name(dav.NS, "supported-report-set")
+	propSyncToken    = dav.Name(dav.NS, "sync-token")
+	propETag         = dav.Name(dav.NS, "getetag")
+	propContentType  = dav.Name(dav.NS, "getcontenttype")
+	propHomeSet      = dav.Name(dav.NSCalDAV, "calendar-home-set")
+	propAddressSet   = dav.Name(dav.NSCalDAV, "calendar-user-address-set")
+	propComponents   = dav.Name(dav.NSCalDAV, "supported-calendar-component-set")
+	propCalendarData = dav.Name(dav.NSCalDAV, "calendar-data")
+	propCTag         = dav.Name(dav.NSCalendarServ, "getctag")
+
+	elemProp            = dav.Name(dav.NS, "prop")
+	elemHref            = dav.Name(dav.NS, "href")
+	elemSyncToken       = dav.Name(dav.NS, "sync-token")
+	elemSyncReport      = dav.Name(dav.NS, "sync-collection")
+	elemQueryReport     = dav.Name(dav.NSCalDAV, "calendar-query")
+	elemMultiget        = dav.Name(dav.NSCalDAV, "calendar-multiget")
+	elemFilter          = dav.Name(dav.NSCalDAV, "filter")
+	elemCompFilter      = dav.Name(dav.NSCalDAV, "comp-filter")
+	elemPropFilter      = dav.Name(dav.NSCalDAV, "prop-filter")
+	elemTextMatch       = dav.Name(dav.NSCalDAV, "text-match")
+	elemIsNotDefined    = dav.Name(dav.NSCalDAV, "is-not-defined")
+	elemValidToken      = dav.Name(dav.NS, "valid-sync-token")
+	elemSupportedReport = dav.Name(dav.NS, "supported-report")
+)
+
+// davPath is a parsed path below /dav. A nil projectID stands for the inbox.
+type davPath struct {
+	kind      int
+	orgID     int64
+	projectID *int64
+	name      string
+}
+
+func parseDAVPath(p string) (*davPath, bool) {
+	if p != davPrefix && !strings.HasPrefix(p, davPrefix+"/") {
+		return nil, false
+	}
+
+	segs := strings.FieldsFunc(strings.TrimPrefix(p, davPrefix), func(r rune) bool { return r == '/' })
+
+	switch {
+	case len(segs) == 0:
+		return &davPath{kind: davRoot}, true
+	case len(segs) == 1 && segs[0] == "principal":
+		return &davPath{kind: davPrincipal}, true
+	case segs[0] != "calendars" || len(segs) > 3:
+		return nil, false
+	case len(segs) == 1:
+		return &davPath{kind: davHome}, true
+	}
+
+	org, list, _ := strings.Cut(segs[1], "-")
+
+	orgID, err := strconv.ParseInt(org, 10, 64)
+	if err != nil || orgID <= 0 {
+		return nil, false
+	}
+
+	dp := &davPath{kind: davCalendar, orgID: orgID}
+
+	if list != davInbox {
+		projectID, err := strconv.ParseInt(list, 10, 64)
+		if err != nil || projectID <= 0 {
+			return nil, false
+		}
+		dp.projectID = &projectID
+	}
+
+	if len(segs) == 3 {
+		if !strings.HasSuffix(segs[2], davSuffix) || segs[2] == davSuffix {
+			return nil, false
+		}
+		dp.kind, dp.name = davObject, strings.TrimSuffix(segs[2], davSuffix)
+	}
+	return dp, true
+}
+
+func calendarPath(orgID int64, projectID *int64) string {
+	list := davInbox
+	if projectID != nil {
+		list = strconv.FormatInt(*projectID, 10)
+	}
+	return fmt.Sprintf("%s/calendars/%d-%s/", davPrefix, orgID, list)
+}
+
+// davName returns the resource name of a todo. Client UIDs that don't fit in a path segment are replaced
+// by the id.
+func davName(t *pkg.TodoResponse) string {
+	if t.ClientUID != "" && !strings.Contains(t.ClientUID, "/") {
+		return t.ClientUID
+	}
+	return fmt.Sprintf("todo-%d", t.Id)
+}
+
+// davTodoID returns the id in a resource name of the form todo-<id>.
+func davTodoID(name string) (int64, bool) {
+	if !strings.HasPrefix(name, "todo-") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(name, "todo-"), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// davSyncToken returns the sync token of a cursor. RFC 6578 requires tokens to be URIs.
+func davSyncToken(publicURL string, cursor int64) string {
+	return strings.TrimSuffix(publicURL, "/") + davSyncPath + encodeSyncToken(cursor)
+}
+
+func parseDAVSyncToken(token string) (int64, error) {
+	i := strings.Index(token, davSyncPath)
+	if i < 0 {
+		return 0, fmt.Errorf("invalid sync token given %s", token)
+	}
+	return decodeSyncToken(token[i+len(davSyncPath):])
+}
+
+// davList is a calendar: the inbox of an organization if project is nil, or a project.
+type davList struct {
+	org     *pkg.Org
+	project *pkg.Project
+}
+
+func (l *davList) path() string {
+	if l.project == nil {
+		return calendarPath(l.org.ID, nil)
+	}
+	return calendarPath(l.org.ID, &l.project.ID)
+}
+
+func (l *davList) name() string {
+	if l.project == nil {
+		return l.org.Name
+	}
+	return l.project.Name
+}
+
+// has reports whether the todo is a live member of the list.
+func (l *davList) has(t *pkg.TodoResponse) bool {
+	if t == nil || t.DeletedAt != nil {
+		return false
+	}
+	if l.project == nil {
+		return t.ProjectID == nil
+	}
+	return t.ProjectID != nil && *t.ProjectID == l.project.ID
+}
+
+func (l *davList) objectPath(t *pkg.TodoResponse) string {
+	return l.path() + davName(t) + davSuffix
+}
+
+// davAuthorized authenticates CalDAV clients, which only support passwords, with a personal access
+// token as Basic auth password. The user name is ignored.
+func davAuthorized(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := c.Get("service").(*Service)
+
+		_, password, ok := c.Request().BasicAuth()
+		if !ok || password == "" {
+			return davChallenge(c)
+		}
+
+		userID, err := s.db.Token.UsePersonalToken(hashToken(password))
+		if err != nil {
+			return err
+		}
+		if userID == 0 {
+			return davChallenge(c)
+		}
+
+		user, err := s.db.User.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt != nil {
+			return davChallenge(c)
+		}
+
+		c.Set("security_context", &SecurityContext{Email: user.Email, UserID: user.ID, Role: user.Role})
+		return next(c)
+	}
+}
+
+func davChallenge(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, davRealm)
+	return echo.NewHTTPError(http.StatusUnauthorized)
+}
+
+func davTarget(c echo.Context) (*davPath, error) {
+	p, ok := parseDAVPath(c.Request().URL.Path)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "no such resource")
+	}
+	return p, nil
+}
+
+// davListOf loads the calendar of the path and makes its organization the active one of the request.
+func davListOf(s *Service, sc *SecurityContext, p *davPath) (*davList, error) {
+	role, err := s.db.Org.GetMemberRole(p.orgID, sc.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "no such calendar")
+	}
+
+	org, err := s.db.Org.GetOrg(p.orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &davList{org: org}
+	if p.projectID != nil {
+		if l.project, err = s.db.Project.GetProject(p.orgID, *p.projectID); err != nil {
+			return nil, err
+		}
+	}
+
+	sc.OrgID, sc.OrgRole = org.ID, role
+	return l, nil
+}
+
+// davLists returns the calendars of the caller in every organization.
+func davLists(s *Service, sc *SecurityContext) ([]davList, error) {
+	orgs, err := s.db.Org.ListUserOrgs(sc.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lists []davList
+	for i := range orgs {
+		projects, err := s.db.Project.ListProjects(orgs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, davList{org: &orgs[i]})
+		for j := range projects {
+			lists = append(lists, davList{org: &orgs[i], project: &projects[j]})
+		}
+	}
+	return lists, nil
+}
+
+// findDAVObject returns the todo with the resource name in the active organization, which may be in
+// the trash, or nil.
+func findDAVObject(s *Service, sc *SecurityContext, name string) (*pkg.TodoResponse, error) {
+	t, err := s.db.Sync.GetTodoByClientUID(sc.OrgID, sc.UserID, name)
+	if err != nil || t != nil {
+		return t, err
+	}
+
+	if id, ok := davTodoID(name); ok {
+		return s.db.Todo.GetTodo(sc.OrgID, sc.UserID, id)
+	}
+	return nil, nil
+}
+
+// writeDAVObject writes a todo as a calendar of its own. The creation time is its DTSTAMP, so that the
+// data only changes with the ETag.
+func writeDAVObject(w io.Writer, s *Service, t *pkg.TodoResponse) error {
+	stamp := time.Now()
+	if t.CreatedAt != nil {
+		stamp = *t.CreatedAt
+	}
+
+	enc := ical.NewEncoder(w, feedDomain(s))
+	enc.Begin("")
+	enc.Todo(t, stamp)
+	return enc.End()
+}
+
+// selectProps answers a request for the properties names out of props. Without names all properties
+// but calendar-data are returned, as for allprop.
+func selectProps(href string, props []dav.Prop, names []xml.Name) dav.Response {
+	r := dav.Response{Href: href}
+
+	if names == nil {
+		for _, p := range props {
+			if p.Name != propCalendarData {
+				r.Found = append(r.Found, p)
+			}
+		}
+		return r
+	}
+
+next:
+	for _, n := range names {
+		for _, p := range props {
+			if p.Name == n {
+				r.Found = append(r.Found, p)
+				continue next
+			}
+		}
+		r.NotFound = append(r.NotFound, n)
+	}
+	return r
+}
+
+func wantsProp(names []xml.Name, name xml.Name) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func principalProps(sc *SecurityContext, root bool) []dav.Prop {
+	resourceType := dav.Raw(dav.Name(dav.NS, "principal"), "")
+	if root {
+		resourceType = dav.Raw(dav.Name(dav.NS, "collection"), "")
+	}
+
+	return []dav.Prop{
+		{Name: propResourceType, Inner: resourceType},
+		dav.TextProp(propDisplayName, sc.Email),
+		dav.HrefProp(propPrincipal, davPrefix+"/principal/"),
+		dav.HrefProp(propPrincipalURL, davPrefix+"/principal/"),
+		dav.HrefProp(propHomeSet, davPrefix+"/calendars/"),
+		dav.URLProp(propAddressSet, "mailto:"+sc.Email),
+	}
+}
+
+func homeProps() []dav.Prop {
+	return []dav.Prop{
+		{Name: propResourceType, Inner: dav.Raw(dav.Name(dav.NS, "collection"), "")},
+		dav.TextProp(propDisplayName, "Calendars"),
+		dav.HrefProp(propPrincipal, davPrefix+"/principal/"),
+	}
+}
+
+// davTags are the ctag and the sync token of the calendars of an organization, which change together.
+type davTags struct {
+	ctag      string
+	syncToken string
+}
+
+func calendarTags(s *Service, orgID, userID int64) (*davTags, error) {
+	latest, err := s.db.Sync.LatestActivityID(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.db.Sync.SyncCursor(orgID, userID, time.Now().Add(-syncSettle))
+	if err != nil {
+		return nil, err
+	}
+	return &davTags{ctag: strconv.FormatInt(latest, 10), syncToken: davSyncToken(s.conf.PublicURL, cursor)}, nil
+}
+
+func calendarProps(l *davList, tags *davTags) []dav.Prop {
+	var privileges, reports string
+	for _, p := range []string{"read", "write-content", "bind", "unbind"} {
+		privileges += dav.Raw(dav.Name(dav.NS, "privilege"), dav.Raw(dav.Name(dav.NS, p), ""))
+	}
+	for _, r := range []xml.Name{elemQueryReport, elemMultiget, elemSyncReport} {
+		reports += dav.Raw(dav.Name(dav.NS, "supported-report"), dav.Raw(dav.Name(dav.NS, "report"), dav.Raw(r, "")))
+	}
+
+	return []dav.Prop{
+		{Name: propResourceType, Inner: dav.Raw(dav.Name(dav.NS, "collection"), "") + dav.Raw(dav.Name(dav.NSCalDAV, "calendar"), "")},
+		dav.TextProp(propDisplayName, l.name()),
+		dav.HrefProp(propPrincipal, davPrefix+"/principal/"),
+		{Name: propComponents, Inner: `<c:comp name="VTODO"/>`},
+		{Name: propPrivileges, Inner: privileges},
+		{Name: propReports, Inner: reports},
+		dav.TextProp(propCTag, tags.ctag),
+		dav.TextProp(propSyncToken, tags.syncToken),
+	}
+}
+
+func objectProps(s *Service, t *pkg.TodoResponse, withData bool) ([]dav.Prop, error) {
+	props := []dav.Prop{
+		{Name: propResourceType},
+		dav.TextProp(propETag, todoETag(t.Revision)),
+		dav.TextProp(propContentType, davTodoType),
+	}
+
+	if withData {
+		var b bytes.Buffer
+		if err := writeDAVObject(&b, s, t); err != nil {
+			return nil, err
+		}
+		props = append(props, dav.TextProp(propCalendarData, b.String()))
+	}
+	return props, nil
+}
+
+func addObject(ms *dav.Multistatus, s *Service, l *davList, t *pkg.TodoResponse, names []xml.Name) error {
+	props, err := objectProps(s, t, wantsProp(names, propCalendarData))
+	if err != nil {
+		return err
+	}
+	ms.Add(selectProps(l.objectPath(t), props, names))
+	return nil
+}
+
+func davMultistatus(c echo.Context, ms *dav.Multistatus) error {
+	return c.Blob(http.StatusMultiStatus, davXML, ms.Bytes())
+}
+
+// requestedProps returns the properties in the prop element of a PROPFIND or REPORT body, or nil for
+// all of them.
+func requestedProps(body *dav.Element) []xml.Name {
+	if prop := body.Child(elemProp); prop != nil {
+		return prop.Names()
+	}
+	return nil
+}
+
+func wellKnownCalDAV(c echo.Context) error {
+	return c.Redirect(http.StatusMovedPermanently, davPrefix+"/")
+}
+
+func davOptions(c echo.Context) error {
+	c.Response().Header().Set("DAV", "1, calendar-access")
+	c.Response().Header().Set(echo.HeaderAllow, "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+	return c.NoContent(http.StatusOK)
+}
+
+// davPropfind returns the properties of a resource and, unless the Depth is 0, of its members. Depth
+// infinity is treated as 1.
+func davPropfind(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	p, err := davTarget(c)
+	if err != nil {
+		return err
+	}
+
+	body, err := dav.Parse(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var (
+		names   = requestedProps(body)
+		members = c.Request().Header.Get("Depth") != "0"
+		ms      = &dav.Multistatus{}
+	)
+
+	switch p.kind {
+	case davRoot:
+		ms.Add(selectProps(davPrefix+"/", principalProps(sc, true), names))
+	case davPrincipal:
+		ms.Add(selectProps(davPrefix+"/principal/", principalProps(sc, false), names))
+	case davHome:
+		ms.Add(selectProps(davPrefix+"/calendars/", homeProps(), names))
+		if !members {
+			break
+		}
+
+		lists, err := davLists(s, sc)
+		if err != nil {
+			return err
+		}
+
+		tags := make(map[int64]*davTags)
+		for i := range lists {
+			l := &lists[i]
+			if tags[l.org.ID] == nil {
+				if tags[l.org.ID], err = calendarTags(s, l.org.ID, sc.UserID); err != nil {
+					return err
+				}
+			}
+			ms.Add(selectProps(l.path(), calendarProps(l, tags[l.org.ID]), names))
+		}
+	case davCalendar:
+		l, err := davListOf(s, sc, p)
+		if err != nil {
+			return err
+		}
+
+		tags, err := calendarTags(s, sc.OrgID, sc.UserID)
+		if err != nil {
+			return err
+		}
+		ms.Add(selectProps(l.path(), calendarProps(l, tags), names))
+		if !members {
+			break
+		}
+
+		todos, err := s.db.Todo.ListTodos(sc.OrgID, sc.UserID, true, search.SortPosition)
+		if err != nil {
+			return err
+		}
+		for i := range todos {
+			if l.has(&todos[i]) {
+				if err = addObject(ms, s, l, &todos[i], names); err != nil {
+					return err
+				}
+			}
+		}
+	case davObject:
+		l, err := davListOf(s, sc, p)
+		if err != nil {
+			return err
+		}
+
+		t, err := findDAVObject(s, sc, p.name)
+		if err != nil {
+			return err
+		}
+		if !l.has(t) {
+			return echo.NewHTTPError(http.StatusNotFound, "no such todo")
+		}
+		if err = addObject(ms, s, l, t, names); err != nil {
+			return err
+		}
+	}
+	return davMultistatus(c, ms)
+}
+
+// davReport answers the calendar-query, calendar-multiget and sync-collection reports of a calendar.
+func davReport(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	p, err := davTarget(c)
+	if err != nil {
+		return err
+	}
+
+	body, err := dav.Parse(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if p.kind != davCalendar || body == nil {
+		return c.Blob(http.StatusForbidden, davXML, dav.Error(elemSupportedReport))
+	}
+
+	l, err := davListOf(s, sc, p)
+	if err != nil {
+		return err
+	}
+
+	var (
+		names = requestedProps(body)
+		ms    = &dav.Multistatus{}
+	)
+
+	switch body.Name {
+	case elemQueryReport:
+		todos, open := davQueryFilter(body)
+		if !todos {
+			break
+		}
+
+		list, err := s.db.Todo.ListTodos(sc.OrgID, sc.UserID, !open, search.SortPosition)
+		if err != nil {
+			return err
+		}
+		for i := range list {
+			if l.has(&list[i]) {
+				if err = addObject(ms, s, l, &list[i], names); err != nil {
+					return err
+				}
+			}
+		}
+	case elemMultiget:
+		for _, h := range body.All(elemHref) {
+			t, err := multigetObject(s, sc, l, h.Text)
+			if err != nil {
+				return err
+			}
+
+			if t == nil {
+				ms.Add(dav.Response{Href: h.Text, Status: http.StatusNotFound})
+				continue
+			}
+			if err = addObject(ms, s, l, t, names); err != nil {
+				return err
+			}
+		}
+	case elemSyncReport:
+		var token string
+		if e := body.Child(elemSyncToken); e != nil {
+			token = e.Text
+		}
+		return davSyncCollection(c, s, sc, l, token, names)
+	default:
+		return c.Blob(http.StatusForbidden, davXML, dav.Error(elemSupportedReport))
+	}
+	return davMultistatus(c, ms)
+}
+
+// davQueryFilter tells whether a calendar-query asks for VTODOs at all and whether it only asks for open
+// ones, as clients do with COMPLETED is-not-defined or a STATUS that is not COMPLETED. Other filters are
+// not applied, so the result may hold more todos than asked for.
+func davQueryFilter(query *dav.Element) (todos bool, open bool) {
+	cal := query.Child(elemFilter).Child(elemCompFilter)
+	if cal == nil {
+		return true, false
+	}
+	if !strings.EqualFold(cal.Attr("name"), "VCALENDAR") {
+		return false, false
+	}
+
+	comp := cal.Child(elemCompFilter)
+	if comp == nil {
+		return true, false
+	}
+	if !strings.EqualFold(comp.Attr("name"), "VTODO") {
+		return false, false
+	}
+
+	for _, pf := range comp.All(elemPropFilter) {
+		switch strings.ToUpper(pf.Attr("name")) {
+		case "COMPLETED":
+			if pf.Child(elemIsNotDefined) != nil {
+				open = true
+			}
+		case "STATUS":
+			tm := pf.Child(elemTextMatch)
+			if tm != nil && tm.Attr("negate-condition") == "yes" && strings.EqualFold(tm.Text, "COMPLETED") {
+				open = true
+			}
+		}
+	}
+	return true, open
+}
+
+// multigetObject returns the todo at a href of a calendar-multiget, or nil if it is not a live member of
+// the calendar.
+func multigetObject(s *Service, sc *SecurityContext, l *davList, href string) (*pkg.TodoResponse, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil, nil
+	}
+
+	p, ok := parseDAVPath(u.Path)
+	if !ok || p.kind != davObject || calendarPath(p.orgID, p.projectID) != l.path() {
+		return nil, nil
+	}
+
+	t, err := findDAVObject(s, sc, p.name)
+	if err != nil || !l.has(t) {
+		return nil, err
+	}
+	return t, nil
+}
+
+// davSyncCollection answers a sync-collection report (RFC 6578) from the changes the sync API serves.
+// Todos deleted or moved to another calendar since the token are reported as removed. Tokens can't
+// tell calendars apart, so todos the client never had may be reported as removed too.
+func davSyncCollection(c echo.Context, s *Service, sc *SecurityContext, l *davList, token string, names []xml.Name) error {
+	var (
+		settled = time.Now().Add(-syncSettle)
+		ms      = &dav.Multistatus{}
+	)
+
+	if token == "" {
+		todos, cursor, err := s.db.Sync.SyncSnapshot(sc.OrgID, sc.UserID, settled)
+		if err != nil {
+			return err
+		}
+
+		for i := range todos {
+			if l.has(&todos[i]) {
+				if err = addObject(ms, s, l, &todos[i], names); err != nil {
+					return err
+				}
+			}
+		}
+
+		ms.SyncToken = davSyncToken(s.conf.PublicURL, cursor)
+		return davMultistatus(c, ms)
+	}
+
+	cursor, err := parseDAVSyncToken(token)
+	if err != nil {
+		return c.Blob(http.StatusForbidden, davXML, dav.Error(elemValidToken))
+	}
+
+	page, err := s.db.Sync.SyncChanges(sc.OrgID, sc.UserID, cursor, syncPageSize, settled)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range page.Changes {
+		if ch.Op == pkg.SyncUpsert && l.has(ch.Todo) {
+			if err = addObject(ms, s, l, ch.Todo, names); err != nil {
+				return err
+			}
+			continue
+		}
+		ms.Add(dav.Response{Href: l.objectPath(&pkg.TodoResponse{Id: ch.ID, ClientUID: ch.ClientUID}), Status: http.StatusNotFound})
+	}
+
+	// Truncated results are marked on the collection, and the client syncs again from the new token.
+	if page.More {
+		ms.Add(dav.Response{Href: l.path(), Status: http.StatusInsufficientStorage})
+	}
+
+	ms.SyncToken = davSyncToken(s.conf.PublicURL, page.Cursor)
+	return davMultistatus(c, ms)
+}
+
+func getDAVObject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	p, err := davTarget(c)
+	if err != nil {
+		return err
+	}
+	if p.kind != davObject {
+		return echo.NewHTTPError(http.StatusMethodNotAllowed)
+	}
+
+	l, err := davListOf(s, sc, p)
+	if err != nil {
+		return err
+	}
+
+	t, err := findDAVObject(s, sc, p.name)
+	if err != nil {
+		return err
+	}
+	if !l.has(t) {
+		return echo.NewHTTPError(http.StatusNotFound, "no such todo")
+	}
+
+	c.Response().Header().Set("ETag", todoETag(t.Revision))
+
+	if notModified(c, t.Revision) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, ical.ContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	return writeDAVObject(c.Response(), s, t)
+}
+
+// davValues maps a VTODO onto the values of a sync mutation that replaces the todo with it. Categories
+// the organization doesn't have are ignored.
+func davValues(vt *ical.Todo, categories []string, projectID *int64) (map[string]interface{}, error) {
+	values := map[string]interface{}{
+		"done":       vt.Done(),
+		"priority":   vt.PriorityName(),
+		"due_at":     nil,
+		"recurrence": nil,
+		"project_id": nil,
+	}
+
+	if vt.Summary != "" {
+		values["task"] = vt.Summary
+	}
+
+	if vt.Due != nil {
+		values["due_at"] = vt.Due.UTC().Truncate(time.Second).Format(time.RFC3339)
+	}
+
+	if vt.RRule != "" {
+		rule, err := ical.ParseRecurrence(vt.RRule)
+		if err != nil {
+			return nil, err
+		}
+		values["recurrence"] = rule
+	}
+
+	if projectID != nil {
+		values["project_id"] = *projectID
+	}
+
+	for _, category := range vt.Categories {
+		if category = strings.ToLower(category); util.Contains(categories, category) {
+			values["category"] = category
+			break
+		}
+	}
+	return values, nil
+}
+
+// putDAVObject creates or replaces a todo with a VTODO. New resources have to be named after the UID,
+// which becomes the client UID of the todo. Putting a todo into another calendar moves it there, and
+// putting one that is in the trash restores it, as clients move todos by deleting and creating them.
+func putDAVObject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	p, err := davTarget(c)
+	if err != nil {
+		return err
+	}
+	if p.kind != davObject {
+		return echo.NewHTTPError(http.StatusMethodNotAllowed)
+	}
+
+	l, err := davListOf(s, sc, p)
+	if err != nil {
+		return err
+	}
+
+	vt, err := ical.ParseTodo(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	t, err := findDAVObject(s, sc, p.name)
+	if err != nil {
+		return err
+	}
+
+	exists := t != nil && t.DeletedAt == nil
+
+	if exists && c.Request().Header.Get("If-None-Match") == "*" {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "the todo already exists")
+	}
+	if !exists && c.Request().Header.Get("If-Match") != "" {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "the todo does not exist")
+	}
+
+	var revision int64
+	if exists {
+		if revision, err = ifMatchRevision(c, func() (int64, error) { return t.Revision, nil }); err != nil {
+			return err
+		}
+	}
+
+	categories := l.org.Settings.CategoryList()
+	dm := &db.SyncMutation{Revision: revision, DefaultCategory: categories[0]}
+
+	// Writing a todo in the trash restores it, together with the update.
+	switch {
+	case t != nil:
+		dm.TodoID, dm.ClientUID, dm.Restore = t.Id, t.ClientUID, !exists
+	case vt.UID != p.name:
+		return echo.NewHTTPError(http.StatusBadRequest, "the resource name has to be the UID of the VTODO")
+	case len(vt.UID) > pkg.MaxClientUIDLen:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("UID is longer than %d characters", pkg.MaxClientUIDLen))
+	default:
+		dm.ClientUID = vt.UID
+	}
+
+	var projectID *int64
+	if l.project != nil {
+		projectID = &l.project.ID
+	}
+
+	if dm.Values, err = davValues(vt, categories, projectID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	o, err := s.db.Sync.ApplySyncMutation(sc.OrgID, sc.UserID, dm, sc.Actor())
+	if err != nil {
+		return err
+	}
+	if o.Result.Status == http.StatusConflict {
+		return echo.NewHTTPError(http.StatusConflict, o.Result.Error)
+	}
+
+	if o.Event != "" {
+		publishTodo(s, sc, o.Event, o.Result.ID)
+	}
+
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, o.Result.ID)
+	if err != nil {
+		return err
+	}
+	if todo != nil {
+		c.Response().Header().Set("ETag", todoETag(todo.Revision))
+	}
+
+	if o.Result.Status == http.StatusCreated {
+		return c.NoContent(http.StatusCreated)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deleteDAVObject moves a todo to the trash. Calendars can't be deleted, since they are projects.
+func deleteDAVObject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	p, err := davTarget(c)
+	if err != nil {
+		return err
+	}
+	if p.kind != davObject {
+		return echo.NewHTTPError(http.StatusForbidden, "only todos can be deleted")
+	}
+
+	l, err := davListOf(s, sc, p)
+	if err != nil {
+		return err
+	}
+
+	t, err := findDAVObject(s, sc, p.name)
+	if err != nil {
+		return err
+	}
+	if !l.has(t) {
+		return echo.NewHTTPError(http.StatusNotFound, "no such todo")
+	}
+
+	revision, err := ifMatchRevision(c, func() (int64, error) { return t.Revision, nil })
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Todo.DeleteTodo(sc.OrgID, sc.UserID, t.Id, revision, sc.Actor()); err != nil {
+		return err
+	}
+
+	publishTodo(s, sc, pkg.EventTodoDeleted, t.Id)
+	return c.NoContent(http.StatusNoContent)
+}
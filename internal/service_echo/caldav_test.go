@@ -0,0 +1,183 @@
+package service_echo
+
+import (
+	"encoding/xml"
+	"github.com/harsha-aqfer/todo/internal/dav"
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseDAVPath(t *testing.T) {
+	assert := asserts.New(t)
+
+	project := int64(5)
+
+	for path, want := range map[string]*davPath{
+		"/dav":                           {kind: davRoot},
+		"/dav/":                          {kind: davRoot},
+		"/dav/principal/":                {kind: davPrincipal},
+		"/dav/calendars":                 {kind: davHome},
+		"/dav/calendars/2-inbox/":        {kind: davCalendar, orgID: 2},
+		"/dav/calendars/2-5":             {kind: davCalendar, orgID: 2, projectID: &project},
+		"/dav/calendars/2-inbox/abc.ics": {kind: davObject, orgID: 2, name: "abc"},
+		"/dav/calendars/2-5/todo-9.ics":  {kind: davObject, orgID: 2, projectID: &project, name: "todo-9"},
+	} {
+		got, ok := parseDAVPath(path)
+		assert.True(ok, path)
+		assert.Equal(want, got, path)
+	}
+
+	for _, path := range []string{
+		"/davx", "/dav/other", "/dav/calendars/x-inbox/", "/dav/calendars/2-x/", "/dav/calendars/0-inbox/",
+		"/dav/calendars/2-inbox/abc", "/dav/calendars/2-inbox/.ics", "/dav/calendars/2-inbox/a/b.ics",
+	} {
+		_, ok := parseDAVPath(path)
+		assert.False(ok, path)
+	}
+
+	assert.Equal("/dav/calendars/2-inbox/", calendarPath(2, nil))
+	assert.Equal("/dav/calendars/2-5/", calendarPath(2, &project))
+}
+
+func Test_DAVName(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal("abc", davName(&pkg.TodoResponse{Id: 3, ClientUID: "abc"}))
+	assert.Equal("todo-3", davName(&pkg.TodoResponse{Id: 3}))
+	assert.Equal("todo-3", davName(&pkg.TodoResponse{Id: 3, ClientUID: "a/b"}))
+
+	id, ok := davTodoID("todo-3")
+	assert.True(ok)
+	assert.Equal(int64(3), id)
+
+	for _, name := range []string{"abc", "todo-", "todo-x", "todo-0"} {
+		_, ok = davTodoID(name)
+		assert.False(ok, name)
+	}
+}
+
+func Test_DAVSyncToken(t *testing.T) {
+	assert := asserts.New(t)
+
+	token := davSyncToken("https://todo.example.com/", 42)
+	assert.True(strings.HasPrefix(token, "https://todo.example.com/dav/sync/"))
+
+	cursor, err := parseDAVSyncToken(token)
+	assert.NoError(err)
+	assert.Equal(int64(42), cursor)
+
+	for _, token := range []string{"", "42", encodeSyncToken(42), "https://todo.example.com/dav/sync/x"} {
+		_, err = parseDAVSyncToken(token)
+		assert.Error(err, token)
+	}
+}
+
+func Test_DAVList(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		project = int64(5)
+		other   = int64(6)
+		now     = time.Now()
+		inbox   = &davList{org: &pkg.Org{ID: 2, Name: "Acme"}}
+		work    = &davList{org: &pkg.Org{ID: 2, Name: "Acme"}, project: &pkg.Project{ID: project, Name: "Work"}}
+	)
+
+	assert.Equal("Acme", inbox.name())
+	assert.Equal("Work", work.name())
+	assert.Equal("/dav/calendars/2-5/todo-1.ics", work.objectPath(&pkg.TodoResponse{Id: 1}))
+
+	assert.True(inbox.has(&pkg.TodoResponse{}))
+	assert.False(inbox.has(&pkg.TodoResponse{ProjectID: &project}))
+	assert.False(inbox.has(&pkg.TodoResponse{DeletedAt: &now}))
+	assert.False(inbox.has(nil))
+	assert.True(work.has(&pkg.TodoResponse{ProjectID: &project}))
+	assert.False(work.has(&pkg.TodoResponse{ProjectID: &other}))
+	assert.False(work.has(&pkg.TodoResponse{}))
+}
+
+func Test_SelectProps(t *testing.T) {
+	assert := asserts.New(t)
+
+	props := []dav.Prop{
+		dav.TextProp(propETag, `"1"`),
+		dav.TextProp(propCalendarData, "BEGIN:VCALENDAR"),
+	}
+
+	r := selectProps("/x", props, nil)
+	assert.Equal([]dav.Prop{props[0]}, r.Found)
+	assert.Empty(r.NotFound)
+
+	r = selectProps("/x", props, []xml.Name{propCalendarData, propCTag})
+	assert.Equal([]dav.Prop{props[1]}, r.Found)
+	assert.Equal([]xml.Name{propCTag}, r.NotFound)
+}
+
+func Test_DAVQueryFilter(t *testing.T) {
+	assert := asserts.New(t)
+
+	query := func(filter string) *dav.Element {
+		e, err := dav.Parse(strings.NewReader(`<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` + filter + `</c:calendar-query>`))
+		assert.NoError(err)
+		return e
+	}
+
+	for filter, want := range map[string][2]bool{
+		``: {true, false},
+		`<c:filter><c:comp-filter name="VCALENDAR"/></c:filter>`:                                              {true, false},
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter>`:  {true, false},
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter>`: {false, false},
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO">` +
+			`<c:prop-filter name="COMPLETED"><c:is-not-defined/></c:prop-filter></c:comp-filter></c:comp-filter></c:filter>`: {true, true},
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO">` +
+			`<c:prop-filter name="STATUS"><c:text-match negate-condition="yes">COMPLETED</c:text-match></c:prop-filter></c:comp-filter></c:comp-filter></c:filter>`: {true, true},
+	} {
+		todos, open := davQueryFilter(query(filter))
+		assert.Equal(want, [2]bool{todos, open}, filter)
+	}
+}
+
+func Test_DAVValues(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		due     = time.Date(2026, 1, 9, 17, 0, 0, 500, time.UTC)
+		project = int64(5)
+	)
+
+	values, err := davValues(&ical.Todo{
+		Summary:    "Buy milk",
+		Priority:   5,
+		Status:     "COMPLETED",
+		Due:        &due,
+		Categories: []string{"Errands", "Home"},
+		RRule:      "freq=weekly",
+	}, pkg.DefaultCategories, &project)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"task":       "Buy milk",
+		"done":       true,
+		"priority":   "medium",
+		"due_at":     "2026-01-09T17:00:00Z",
+		"recurrence": "FREQ=WEEKLY",
+		"project_id": project,
+		"category":   "home",
+	}, values)
+
+	values, err = davValues(&ical.Todo{}, pkg.DefaultCategories, nil)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"done":       false,
+		"priority":   "low",
+		"due_at":     nil,
+		"recurrence": nil,
+		"project_id": nil,
+	}, values)
+
+	_, err = davValues(&ical.Todo{RRule: "FREQ=NEVER"}, pkg.DefaultCategories, nil)
+	assert.Error(err)
+}
@@ -0,0 +1,81 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func todoETag(revision int64) string {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags.
+func parseETags(header string) []string {
+	var tags []string
+
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// etagMatches reports whether etag is among tags. The weak comparison used by If-None-Match ignores the
+// W/ prefix, the strong one used by If-Match never matches weak tags.
+func etagMatches(tags []string, etag string, weak bool) bool {
+	for _, t := range tags {
+		if t == "*" {
+			return true
+		}
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether an If-None-Match header of the request matches the current revision.
+func notModified(c echo.Context, revision int64) bool {
+	h := c.Request().Header.Get("If-None-Match")
+	return h != "" && etagMatches(parseETags(h), todoETag(revision), true)
+}
+
+// ifMatchRevision returns the revision an If-Match header of the request requires, or zero if the
+// request is unconditional. current looks up the current revision in case the header lists several tags.
+func ifMatchRevision(c echo.Context, current func() (int64, error)) (int64, error) {
+	h := c.Request().Header.Get("If-Match")
+	if h == "" {
+		return 0, nil
+	}
+
+	tags := parseETags(h)
+
+	if etagMatches(tags, "*", false) {
+		return 0, nil
+	}
+
+	// Revisions start at 1. Zero would make the update unconditional, so "0" matches no todo.
+	if len(tags) == 1 {
+		if revision, err := strconv.ParseInt(strings.Trim(tags[0], `"`), 10, 64); err == nil && revision > 0 && tags[0] == todoETag(revision) {
+			return revision, nil
+		}
+		return 0, echo.NewHTTPError(http.StatusPreconditionFailed, "If-Match does not match the current revision")
+	}
+
+	// The store checks the revision again while holding the row lock.
+	revision, err := current()
+	if err != nil {
+		return 0, err
+	}
+	if !etagMatches(tags, todoETag(revision), false) {
+		return 0, echo.NewHTTPError(http.StatusPreconditionFailed, "If-Match does not match the current revision")
+	}
+	return revision, nil
+}
@@ -0,0 +1,72 @@
+package service_echo
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ETagMatches(t *testing.T) {
+	assert := asserts.New(t)
+
+	tags := parseETags(`W/"3", "4" ,`)
+	assert.Equal([]string{`W/"3"`, `"4"`}, tags)
+
+	assert.True(etagMatches(tags, todoETag(4), false))
+	assert.False(etagMatches(tags, todoETag(3), false))
+	assert.True(etagMatches(tags, todoETag(3), true))
+	assert.True(etagMatches([]string{"*"}, todoETag(7), false))
+}
+
+func Test_IfMatchRevision(t *testing.T) {
+	assert := asserts.New(t)
+
+	revisionOf := func(header string, current int64) (int64, error) {
+		req := httptest.NewRequest(http.MethodPut, "/v1/todos/1", nil)
+		if header != "" {
+			req.Header.Set("If-Match", header)
+		}
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+
+		return ifMatchRevision(c, func() (int64, error) { return current, nil })
+	}
+
+	preconditionFailed := func(err error) bool {
+		var he *echo.HTTPError
+		return errors.As(err, &he) && he.Code == http.StatusPreconditionFailed
+	}
+
+	rev, err := revisionOf("", 5)
+	assert.NoError(err)
+	assert.Equal(int64(0), rev)
+
+	rev, err = revisionOf("*", 5)
+	assert.NoError(err)
+	assert.Equal(int64(0), rev)
+
+	rev, err = revisionOf(`"3"`, 5)
+	assert.NoError(err)
+	assert.Equal(int64(3), rev)
+
+	rev, err = revisionOf(`"3", "5"`, 5)
+	assert.NoError(err)
+	assert.Equal(int64(5), rev)
+
+	_, err = revisionOf(`"3", "4"`, 5)
+	assert.True(preconditionFailed(err))
+
+	_, err = revisionOf(`W/"5"`, 5)
+	assert.True(preconditionFailed(err))
+
+	_, err = revisionOf(`"x"`, 5)
+	assert.True(preconditionFailed(err))
+
+	// Zero stands for an unconditional request in the store, and no todo is at a negative revision.
+	for _, header := range []string{`"0"`, `"-0"`, `"-1"`, `"0", "0"`} {
+		_, err = revisionOf(header, 5)
+		assert.True(preconditionFailed(err), header)
+	}
+}
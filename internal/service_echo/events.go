@@ -0,0 +1,201 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/events"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publishTodo pushes a change of a todo to the event streams of its owner. The change has been made
+// already, so failures are only logged. Webhooks get the change from the transaction that made it.
+func publishTodo(s *Service, sc *SecurityContext, eventType string, todoID int64) {
+	e := &pkg.TodoEvent{Type: eventType, TodoID: todoID, Time: time.Now().UTC()}
+
+	if eventType != pkg.EventTodoDeleted {
+		todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+		if err != nil {
+			log.Printf("could not load todo %d for its event: %v", todoID, err)
+			return
+		}
+		e.Todo = todo
+	}
+
+	if err := s.broker.Publish(events.Topic(sc.OrgID, sc.UserID), e); err != nil {
+		log.Printf("could not publish event of todo %d: %v", todoID, err)
+	}
+}
+
+// tokenFromQuery takes the access token from the access_token query parameter if there is no
+// Authorization header, for clients that can't set headers such as the browser's EventSource and
+// WebSocket. Such tokens can end up in access logs, so clients should prefer the header.
+func tokenFromQuery(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if token := c.QueryParam("access_token"); token != "" && req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return next(c)
+	}
+}
+
+// streamEvents streams the todo events of the caller in the active organization, as Server-Sent
+// Events or, for WebSocket upgrade requests, as JSON messages over a WebSocket. Clients resume with the
+// Last-Event-ID header or the last_event_id query parameter. If the events after that id are gone, the
+// stream starts with a reset event.
+func streamEvents(c echo.Context) error {
+	var (
+		s      = c.Get("service").(*Service)
+		sc     = c.Get("security_context").(*SecurityContext)
+		req    = c.Request()
+		lastID = req.Header.Get("Last-Event-ID")
+	)
+
+	if lastID == "" {
+		lastID = c.QueryParam("last_event_id")
+	}
+
+	topic := events.Topic(sc.OrgID, sc.UserID)
+
+	sub, err := s.broker.Subscribe(topic, lastID)
+	reset := err == events.ErrGone
+	if reset {
+		sub, err = s.broker.Subscribe(topic, "")
+	}
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	var (
+		heartbeat = time.Duration(s.conf.EventHeartbeatSec) * time.Second
+		first     []pkg.TodoEvent
+	)
+
+	if reset {
+		first = append(first, pkg.TodoEvent{Type: pkg.EventReset, Time: time.Now().UTC()})
+	}
+
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{
+			// Streams are authorized by token rather than cookies, so any origin may connect.
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(ws *websocket.Conn) {
+				streamWebSocket(ws, sub, first, heartbeat)
+			},
+		}.ServeHTTP(c.Response(), req)
+		return nil
+	}
+	return streamSSE(c, sub, first, heartbeat)
+}
+
+// heartbeats returns a channel that ticks every interval and a function that stops it. Intervals that
+// are not positive turn heartbeats off.
+func heartbeats(interval time.Duration) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+func writeSSE(w http.ResponseWriter, e *pkg.TodoEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if e.ID != "" {
+		if _, err = fmt.Fprintf(w, "id: %s\n", e.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+func streamSSE(c echo.Context, sub events.Subscription, first []pkg.TodoEvent, heartbeat time.Duration) error {
+	res := c.Response()
+
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	for i := range first {
+		if err := writeSSE(res, &first[i]); err != nil {
+			return nil
+		}
+	}
+	res.Flush()
+
+	ticks, stop := heartbeats(heartbeat)
+	defer stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case e, ok := <-sub.Events():
+			// A closed subscription means the client fell behind. It reconnects and resumes.
+			if !ok {
+				return nil
+			}
+			if err := writeSSE(res, &e); err != nil {
+				return nil
+			}
+		case <-ticks:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+func streamWebSocket(ws *websocket.Conn, sub events.Subscription, first []pkg.TodoEvent, heartbeat time.Duration) {
+	defer func() {
+		_ = ws.Close()
+	}()
+
+	// Clients don't send anything, reading only notices when they go away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	for i := range first {
+		if websocket.JSON.Send(ws, &first[i]) != nil {
+			return
+		}
+	}
+
+	ticks, stop := heartbeats(heartbeat)
+	defer stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case e, ok := <-sub.Events():
+			if !ok || websocket.JSON.Send(ws, &e) != nil {
+				return
+			}
+		case t := <-ticks:
+			if websocket.JSON.Send(ws, &pkg.TodoEvent{Type: pkg.EventHeartbeat, Time: t.UTC()}) != nil {
+				return
+			}
+		}
+	}
+}
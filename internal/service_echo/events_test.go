@@ -0,0 +1,180 @@
+package service_echo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/internal/events"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newEventServer(s *Service) *httptest.Server {
+	e := echo.New()
+	e.GET("/v1/events", streamEvents, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("service", s)
+			c.Set("security_context", &SecurityContext{UserID: 1, OrgID: 2})
+			return next(c)
+		}
+	})
+	return httptest.NewServer(e)
+}
+
+// readSSE returns the fields of the next event of the stream, skipping comments.
+func readSSE(r *bufio.Reader) (map[string]string, error) {
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(fields) > 0 {
+			return fields, nil
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok && name != "" {
+			fields[name] = value
+		}
+	}
+}
+
+func Test_StreamEventsSSE(t *testing.T) {
+	assert := asserts.New(t)
+
+	s := &Service{conf: NewConfig(), broker: events.NewMemoryBroker(10)}
+	srv := newEventServer(s)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/events", nil)
+	res, err := http.DefaultClient.Do(req)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	assert.Equal("text/event-stream", res.Header.Get(echo.HeaderContentType))
+
+	// Events of other users don't show up.
+	assert.NoError(s.broker.Publish(events.Topic(2, 3), &pkg.TodoEvent{Type: pkg.EventTodoCreated, TodoID: 6}))
+
+	published := &pkg.TodoEvent{Type: pkg.EventTodoDeleted, TodoID: 7}
+	assert.NoError(s.broker.Publish(events.Topic(2, 1), published))
+
+	fields, err := readSSE(bufio.NewReader(res.Body))
+	if assert.NoError(err) {
+		assert.Equal(published.ID, fields["id"])
+		assert.Equal(pkg.EventTodoDeleted, fields["event"])
+
+		var e pkg.TodoEvent
+		assert.NoError(json.Unmarshal([]byte(fields["data"]), &e))
+		assert.Equal(int64(7), e.TodoID)
+	}
+}
+
+func Test_StreamEventsResume(t *testing.T) {
+	assert := asserts.New(t)
+
+	s := &Service{conf: NewConfig(), broker: events.NewMemoryBroker(10)}
+	srv := newEventServer(s)
+	defer srv.Close()
+
+	first := &pkg.TodoEvent{Type: pkg.EventTodoCreated, TodoID: 1}
+	assert.NoError(s.broker.Publish(events.Topic(2, 1), first))
+	assert.NoError(s.broker.Publish(events.Topic(2, 1), &pkg.TodoEvent{Type: pkg.EventTodoUpdated, TodoID: 1}))
+
+	stream := func(lastID string) map[string]string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/events", nil)
+		req.Header.Set("Last-Event-ID", lastID)
+
+		res, err := http.DefaultClient.Do(req)
+		if !assert.NoError(err) {
+			return nil
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+
+		fields, err := readSSE(bufio.NewReader(res.Body))
+		assert.NoError(err)
+		return fields
+	}
+
+	assert.Equal(pkg.EventTodoUpdated, stream(first.ID)["event"])
+
+	fields := stream("unknown-1")
+	assert.Equal(pkg.EventReset, fields["event"])
+	assert.Empty(fields["id"])
+}
+
+func Test_StreamEventsWebSocket(t *testing.T) {
+	assert := asserts.New(t)
+
+	s := &Service{conf: NewConfig(), broker: events.NewMemoryBroker(10)}
+	s.conf.EventHeartbeatSec = 1
+
+	srv := newEventServer(s)
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/events", "", srv.URL)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+
+	published := &pkg.TodoEvent{Type: pkg.EventTodoUpdated, TodoID: 8}
+	assert.NoError(s.broker.Publish(events.Topic(2, 1), published))
+
+	var e pkg.TodoEvent
+	if assert.NoError(websocket.JSON.Receive(ws, &e)) {
+		assert.Equal(published.ID, e.ID)
+		assert.Equal(int64(8), e.TodoID)
+	}
+
+	// Idle streams get heartbeats.
+	if assert.NoError(websocket.JSON.Receive(ws, &e)) {
+		assert.Equal(pkg.EventHeartbeat, e.Type)
+	}
+}
+
+func Test_StreamEventsWithoutHeartbeats(t *testing.T) {
+	assert := asserts.New(t)
+
+	s := &Service{conf: NewConfig(), broker: events.NewMemoryBroker(10)}
+	s.conf.EventHeartbeatSec = 0
+
+	srv := newEventServer(s)
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/events", "", srv.URL)
+	if !assert.NoError(err) {
+		return
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+
+	assert.NoError(s.broker.Publish(events.Topic(2, 1), &pkg.TodoEvent{Type: pkg.EventTodoUpdated, TodoID: 8}))
+
+	var e pkg.TodoEvent
+	if assert.NoError(websocket.JSON.Receive(ws, &e)) {
+		assert.Equal(int64(8), e.TodoID)
+	}
+}
@@ -0,0 +1,130 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const feedSuffix = ".ics"
+
+// feedDomain is the domain of the UIDs of todos in calendars.
+func feedDomain(s *Service) string {
+	if u, err := url.Parse(s.conf.PublicURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "todo"
+}
+
+func getFeed(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	feed, err := s.db.Feed.GetFeed(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, feed)
+}
+
+// rotateFeed creates the caller's calendar feed in the active organization, or gives it a new URL. The
+// previous URL stops working.
+func rotateFeed(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Feed.SetFeed(sc.OrgID, sc.UserID, hashToken(token)); err != nil {
+		return err
+	}
+
+	feed, err := s.db.Feed.GetFeed(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	feed.URL = strings.TrimSuffix(s.conf.PublicURL, "/") + "/v1/feeds/" + token + feedSuffix
+	return c.JSON(http.StatusCreated, feed)
+}
+
+func revokeFeed(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := s.db.Feed.DeleteFeed(sc.OrgID, sc.UserID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// calendarFeed serves the todos with a due date as iCalendar. The secret token in the path is the only
+// credential, since calendar apps can't send one. Feeds of disabled users and of users who left the
+// organization look like unknown feeds.
+func calendarFeed(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	file := c.Param("file")
+	if !strings.HasSuffix(file, feedSuffix) {
+		return echo.NewHTTPError(http.StatusNotFound, "no such calendar feed")
+	}
+
+	owner, err := s.db.Feed.UseFeed(hashToken(strings.TrimSuffix(file, feedSuffix)))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.db.User.GetUserByID(owner.UserID)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.db.Org.GetMemberRole(owner.OrgID, owner.UserID)
+	if err != nil {
+		return err
+	}
+
+	if user.DisabledAt != nil || role == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "no such calendar feed")
+	}
+
+	org, err := s.db.Org.GetOrg(owner.OrgID)
+	if err != nil {
+		return err
+	}
+
+	todos, err := s.db.Todo.ListTodos(owner.OrgID, owner.UserID, true, search.SortDueAsc)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, ical.ContentType)
+	c.Response().Header().Set("Cache-Control", "private, max-age=300")
+	c.Response().WriteHeader(http.StatusOK)
+
+	var (
+		enc = ical.NewEncoder(c.Response(), feedDomain(s))
+		now = time.Now()
+	)
+
+	enc.Begin(org.Name)
+	for i := range todos {
+		if todos[i].DueAt != nil {
+			enc.Todo(&todos[i], now)
+		}
+	}
+	return enc.End()
+}
@@ -0,0 +1,122 @@
+package service_echo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+
+	// maxIdempotentBodySize bounds the bodies read into memory to fingerprint them. Imports are the
+	// largest requests that take a key.
+	maxIdempotentBodySize = maxImportSize
+)
+
+// responseRecorder passes the response through while keeping a copy of the body.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// Idempotent makes POST requests that carry an Idempotency-Key header safe to retry. The response to
+// the first request with a key in an organization is stored and replayed for retries with the same
+// key, query and body. Requests that fail with an error or a server error status are not stored and can
+// be retried.
+func Idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(headerIdempotencyKey)
+		if c.Request().Method != http.MethodPost || key == "" {
+			return next(c)
+		}
+
+		if len(key) > maxIdempotencyKeyLen {
+			return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+		}
+
+		var (
+			s  = c.Get("service").(*Service)
+			sc = c.Get("security_context").(*SecurityContext)
+		)
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxIdempotentBodySize))
+		var me *http.MaxBytesError
+		if errors.As(err, &me) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body is too large")
+		} else if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+		// Handlers read options from the query too, so it is part of the request.
+		u := c.Request().URL
+		sum := sha256.Sum256(append([]byte(c.Request().Method+" "+u.Path+"?"+u.RawQuery+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		expiresAt := time.Now().Add(time.Duration(s.conf.IdempotencyKeyTTLHours) * time.Hour)
+
+		stored, err := s.db.Idempotency.ReserveKey(sc.UserID, sc.OrgID, key, fingerprint, expiresAt)
+		if err != nil {
+			return err
+		}
+
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				return echo.NewHTTPError(http.StatusConflict, "Idempotency-Key was already used for a different request")
+			}
+			if stored.Status == 0 {
+				return echo.NewHTTPError(http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			}
+
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return c.Blob(stored.Status, stored.ContentType, stored.Body)
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = rec
+
+		err = next(c)
+		c.Response().Writer = rec.ResponseWriter
+
+		// Server errors are likely transient, so they are not replayed either.
+		if err != nil || c.Response().Status >= http.StatusInternalServerError {
+			if rerr := s.db.Idempotency.ReleaseKey(sc.UserID, sc.OrgID, key); rerr != nil {
+				log.Printf("could not release idempotency key of user %d: %v", sc.UserID, rerr)
+			}
+			return err
+		}
+
+		// The response is already written, so a failure can only be logged. Retries then see the key as
+		// in progress until it expires.
+		contentType := c.Response().Header().Get(echo.HeaderContentType)
+		if err = s.db.Idempotency.SaveResponse(sc.UserID, sc.OrgID, key, c.Response().Status, contentType, rec.body.Bytes()); err != nil {
+			log.Printf("could not store response for idempotency key of user %d: %v", sc.UserID, err)
+		}
+		return nil
+	}
+}
+
+// purgeIdempotencyKeys periodically removes expired idempotency keys.
+func (s *Service) purgeIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := s.db.Idempotency.PurgeIdempotencyKeys(time.Now()); err != nil {
+			log.Println("could not purge idempotency keys: ", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryIdempotencyStore struct {
+	requests map[string]*db.IdempotentRequest
+}
+
+func scopedKey(userID, orgID int64, key string) string {
+	return fmt.Sprintf("%d/%d/%s", userID, orgID, key)
+}
+
+func (ms *memoryIdempotencyStore) ReserveKey(userID, orgID int64, key, fingerprint string, _ time.Time) (*db.IdempotentRequest, error) {
+	key = scopedKey(userID, orgID, key)
+	if r, ok := ms.requests[key]; ok {
+		return r, nil
+	}
+	ms.requests[key] = &db.IdempotentRequest{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (ms *memoryIdempotencyStore) SaveResponse(userID, orgID int64, key string, status int, contentType string, body []byte) error {
+	r := ms.requests[scopedKey(userID, orgID, key)]
+	r.Status, r.ContentType, r.Body = status, contentType, body
+	return nil
+}
+
+func (ms *memoryIdempotencyStore) ReleaseKey(userID, orgID int64, key string) error {
+	delete(ms.requests, scopedKey(userID, orgID, key))
+	return nil
+}
+
+func (ms *memoryIdempotencyStore) PurgeIdempotencyKeys(time.Time) (int64, error) {
+	return 0, nil
+}
+
+func Test_Idempotent(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		s      = &Service{conf: NewConfig(), db: &db.DB{Idempotency: &memoryIdempotencyStore{requests: map[string]*db.IdempotentRequest{}}}}
+		calls  = 0
+		fail   = false
+		status = 0
+		orgID  = int64(1)
+	)
+
+	e := echo.New()
+	e.POST("/v1/todos", func(c echo.Context) error {
+		calls++
+		if fail {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid")
+		}
+		if status != 0 {
+			return c.JSON(status, map[string]int{"call": calls})
+		}
+		return c.JSON(http.StatusCreated, map[string]int{"call": calls})
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("service", s)
+			c.Set("security_context", &SecurityContext{UserID: 1, OrgID: orgID})
+			return next(c)
+		}
+	}, Idempotent)
+
+	postTo := func(target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(headerIdempotencyKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(key, body string) *httptest.ResponseRecorder {
+		return postTo("/v1/todos", key, body)
+	}
+
+	first := post("a", `{"task":"x"}`)
+	assert.Equal(http.StatusCreated, first.Code)
+
+	retry := post("a", `{"task":"x"}`)
+	assert.Equal(http.StatusCreated, retry.Code)
+	assert.Equal(first.Body.String(), retry.Body.String())
+	assert.Equal("true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(1, calls)
+
+	assert.Equal(http.StatusConflict, post("a", `{"task":"y"}`).Code)
+	assert.Equal(1, calls)
+
+	post("", `{"task":"x"}`)
+	post("", `{"task":"x"}`)
+	assert.Equal(3, calls)
+
+	// Failed requests are not stored, so they can be retried.
+	fail = true
+	assert.Equal(http.StatusBadRequest, post("b", `{"task":"z"}`).Code)
+	fail = false
+	assert.Equal(http.StatusCreated, post("b", `{"task":"z"}`).Code)
+	assert.Equal(5, calls)
+
+	// Nor are server errors written by the handler.
+	status = http.StatusServiceUnavailable
+	assert.Equal(http.StatusServiceUnavailable, post("d", `{"task":"z"}`).Code)
+	status = 0
+	assert.Equal(http.StatusCreated, post("d", `{"task":"z"}`).Code)
+	assert.Equal(7, calls)
+
+	// Bodies are read into memory only up to a limit.
+	assert.Equal(http.StatusRequestEntityTooLarge, post("c", strings.Repeat("x", maxIdempotentBodySize+1)).Code)
+	assert.Equal(7, calls)
+
+	// The query is part of the request, as handlers take options from it.
+	assert.Equal(http.StatusConflict, postTo("/v1/todos?dry_run=true", "a", `{"task":"x"}`).Code)
+	assert.Equal(7, calls)
+
+	// Keys are scoped to the organization.
+	orgID = 2
+	assert.Equal(http.StatusCreated, post("a", `{"task":"x"}`).Code)
+	assert.Equal(8, calls)
+}
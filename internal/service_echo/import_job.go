@@ -0,0 +1,224 @@
+package service_echo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/transfer"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// importJobLease is how long a running import job may go without recording progress before another
+// worker takes it over.
+const importJobLease = 2 * time.Minute
+
+// importJobMaxClaims is how many times an import job is taken over before it fails.
+const importJobMaxClaims = 3
+
+// createImportJob queues an import of the multipart file field "file", an export of the app named by
+// the source field. The file is read right away, so that files of the wrong kind are rejected here.
+func createImportJob(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+
+	src, ok := transfer.LookupSource(c.FormValue("source"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown source, expected one of %s", strings.Join(transfer.SourceNames(), ", ")))
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("inadequate input parameters. Required file: %v", err))
+	}
+
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseImportOptions(c, org.Settings.CategoryList())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err = src.NewDecoder(bytes.NewReader(data), fh.Filename); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("could not read the %s file: %v", src.Name, err))
+	}
+
+	id, err := s.db.ImportJob.CreateImportJob(sc.OrgID, sc.UserID, src.Name, fh.Filename, opts, data)
+	if err != nil {
+		return err
+	}
+
+	job, err := s.db.ImportJob.GetImportJob(sc.OrgID, sc.UserID, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+func listImportJobs(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	jobs, err := s.db.ImportJob.ListImportJobs(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, jobs)
+}
+
+// getImportJob returns a job with its progress and, once it is done, the report of every row.
+func getImportJob(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	id, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	job, err := s.db.ImportJob.GetImportJob(sc.OrgID, sc.UserID, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// runImportJob imports the file of a job for its user, who must still be a member of the organization.
+func (s *Service) runImportJob(j *db.ClaimedImportJob) (*pkg.ImportReport, error) {
+	src, ok := transfer.LookupSource(j.Source)
+	if !ok {
+		return nil, fmt.Errorf("unknown source: %s", j.Source)
+	}
+
+	role, err := s.db.Org.GetMemberRole(j.OrgID, j.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("not a member of the organization")
+	}
+
+	org, err := s.db.Org.GetOrg(j.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := src.NewDecoder(bytes.NewReader(j.Data), j.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the %s file: %v", src.Name, err)
+	}
+
+	sc := &SecurityContext{UserID: j.UserID, OrgID: j.OrgID, OrgRole: role}
+
+	im, err := newImporter(s, sc, org, &j.Options)
+	if err != nil {
+		return nil, err
+	}
+	im.rules = src.Rules(im.rules)
+
+	// Workers whose job was taken over stop; the other worker imports the file again.
+	progress := func(n int) error {
+		err := s.db.ImportJob.UpdateImportProgress(j.ID, j.Claim, n, dec.Len())
+		if errors.Is(err, db.ErrImportJobLost) {
+			return err
+		} else if err != nil {
+			log.Printf("could not record the progress of import job %d: %v", j.ID, err)
+		}
+		return nil
+	}
+	if err = progress(0); err != nil {
+		return nil, err
+	}
+
+	if err = im.run(dec, progress); err != nil {
+		return nil, err
+	}
+	if err = progress(im.report.Total); err != nil {
+		return nil, err
+	}
+	return im.report, nil
+}
+
+// runImportJobs periodically runs the queued import jobs, one at a time.
+func (s *Service) runImportJobs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			j, err := s.db.ImportJob.ClaimImportJob(time.Now(), importJobLease, importJobMaxClaims)
+			if err != nil {
+				log.Println("could not claim import job: ", err)
+			}
+			if err != nil || j == nil {
+				break
+			}
+
+			report, err := s.runImportJob(j)
+			if errors.Is(err, db.ErrImportJobLost) {
+				log.Printf("import job %d was taken over by another worker", j.ID)
+				continue
+			}
+
+			var jobErr string
+			if err != nil {
+				log.Printf("import job %d failed: %v", j.ID, err)
+				jobErr = err.Error()
+			}
+
+			if err = s.db.ImportJob.FinishImportJob(j.ID, j.Claim, report, jobErr); err != nil {
+				log.Printf("could not finish import job %d: %v", j.ID, err)
+			}
+		}
+	}
+}
+
+// purgeImportJobs periodically deletes import jobs that finished before the retention period.
+func (s *Service) purgeImportJobs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	retention := time.Duration(s.conf.ImportJobRetentionDays) * 24 * time.Hour
+
+	for range ticker.C {
+		n, err := s.db.ImportJob.PurgeImportJobs(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("could not purge import jobs: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d import job(s)", n)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/internal/db"
+	"log"
+	"strings"
+	"time"
+)
+
+// lockoutPolicy describes when failed sign-ins for a key start to be throttled and when the key is locked.
+type lockoutPolicy struct {
+	BackoffAfter int
+	LockoutAfter int
+}
+
+// loginGuard throttles sign-in attempts per account and per client IP. After BackoffAfter failures
+// every further failure doubles the wait before the next attempt, and after LockoutAfter failures
+// the key is locked for lockoutDuration.
+type loginGuard struct {
+	attempts db.AttemptDB
+	events   db.AuthEventDB
+
+	account lockoutPolicy
+	ip      lockoutPolicy
+
+	backoffBase     time.Duration
+	lockoutDuration time.Duration
+	window          time.Duration
+
+	now func() time.Time
+}
+
+func newLoginGuard(c *Config, attempts db.AttemptDB, events db.AuthEventDB) *loginGuard {
+	return &loginGuard{
+		attempts:        attempts,
+		events:          events,
+		account:         lockoutPolicy{BackoffAfter: c.LoginBackoffAfter, LockoutAfter: c.LoginLockoutAfter},
+		ip:              lockoutPolicy{BackoffAfter: c.LoginIPBackoffAfter, LockoutAfter: c.LoginIPLockoutAfter},
+		backoffBase:     time.Duration(c.LoginBackoffBaseSec) * time.Second,
+		lockoutDuration: time.Duration(c.LoginLockoutMinutes) * time.Minute,
+		window:          time.Duration(c.LoginAttemptWindowMinutes) * time.Minute,
+		now:             time.Now,
+	}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// retryAfter returns how long the caller has to wait before any of the keys may attempt a sign-in.
+func (g *loginGuard) retryAfter(keys ...string) (time.Duration, error) {
+	var (
+		now  = g.now()
+		wait time.Duration
+	)
+
+	for _, k := range keys {
+		a, err := g.attempts.GetAttempt(k)
+		if err != nil {
+			return 0, err
+		}
+		if d := a.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// delay returns how long a key with the given number of failures has to wait, and whether that
+// wait is a lockout.
+func (g *loginGuard) delay(p lockoutPolicy, failures int) (time.Duration, bool) {
+	if failures >= p.LockoutAfter {
+		return g.lockoutDuration, true
+	}
+	if failures < p.BackoffAfter {
+		return 0, false
+	}
+
+	d := g.backoffBase << uint(failures-p.BackoffAfter)
+	if d <= 0 || d > g.lockoutDuration {
+		d = g.lockoutDuration
+	}
+	return d, false
+}
+
+func (g *loginGuard) fail(key string, p lockoutPolicy, ip string) error {
+	now := g.now()
+
+	a, err := g.attempts.RecordFailure(key, now, g.window)
+	if err != nil {
+		return err
+	}
+
+	d, locked := g.delay(p, a.Failures)
+	if d == 0 {
+		return nil
+	}
+
+	if err = g.attempts.BlockUntil(key, now.Add(d)); err != nil {
+		return err
+	}
+
+	// Only the transition into the locked state is recorded, not every attempt made while locked.
+	if locked && a.Failures == p.LockoutAfter {
+		log.Printf("sign-in locked for %s after %d failures (ip %s)", key, a.Failures, ip)
+		return g.events.RecordEvent(db.AuthEventLockout, key, ip)
+	}
+	return nil
+}
+
+func (g *loginGuard) failed(email, ip string) error {
+	if err := g.fail(accountKey(email), g.account, ip); err != nil {
+		return err
+	}
+	return g.fail(ipKey(ip), g.ip, ip)
+}
+
+func (g *loginGuard) succeeded(email string) error {
+	return g.attempts.ResetAttempts(accountKey(email))
+}
+
+func (g *loginGuard) unlock(key, ip string) error {
+	if err := g.attempts.ResetAttempts(key); err != nil {
+		return err
+	}
+	log.Printf("sign-in unlocked for %s", key)
+	return g.events.RecordEvent(db.AuthEventUnlock, key, ip)
+}
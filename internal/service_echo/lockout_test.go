@@ -0,0 +1,151 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordedEvents struct {
+	events []string
+}
+
+func (r *recordedEvents) RecordEvent(event, subject, _ string) error {
+	r.events = append(r.events, event+" "+subject)
+	return nil
+}
+
+func newTestGuard(now *time.Time) (*loginGuard, *recordedEvents) {
+	events := &recordedEvents{}
+
+	g := newLoginGuard(&Config{
+		LoginBackoffAfter:         2,
+		LoginLockoutAfter:         5,
+		LoginIPBackoffAfter:       10,
+		LoginIPLockoutAfter:       20,
+		LoginBackoffBaseSec:       1,
+		LoginLockoutMinutes:       15,
+		LoginAttemptWindowMinutes: 60,
+	}, db.NewMemoryAttemptStore(), events)
+
+	g.now = func() time.Time { return *now }
+	return g, events
+}
+
+func Test_LoginGuardBackoffAndLockout(t *testing.T) {
+	assert := asserts.New(t)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	g, events := newTestGuard(&now)
+
+	key := accountKey("Bob@example.com")
+
+	expected := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 15 * time.Minute}
+	for i, want := range expected {
+		assert.Nil(g.failed("bob@example.com", "10.0.0.1"))
+
+		wait, err := g.retryAfter(key)
+		assert.Nil(err)
+		assert.Equal(want, wait, "failure %d", i+1)
+	}
+	assert.Equal([]string{"lockout account:bob@example.com"}, events.events)
+
+	now = now.Add(15*time.Minute + time.Second)
+	wait, err := g.retryAfter(key)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+}
+
+func Test_LoginGuardUnlockAndSuccessReset(t *testing.T) {
+	assert := asserts.New(t)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	g, events := newTestGuard(&now)
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(g.failed("alice@example.com", "10.0.0.2"))
+	}
+
+	assert.Nil(g.unlock(accountKey("alice@example.com"), "127.0.0.1"))
+	wait, err := g.retryAfter(accountKey("alice@example.com"))
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+	assert.Equal("unlock account:alice@example.com", events.events[len(events.events)-1])
+
+	// The IP counter is independent of the account and keeps counting.
+	a, err := g.attempts.GetAttempt(ipKey("10.0.0.2"))
+	assert.Nil(err)
+	assert.Equal(5, a.Failures)
+
+	assert.Nil(g.failed("alice@example.com", "10.0.0.2"))
+	assert.Nil(g.succeeded("alice@example.com"))
+	a, err = g.attempts.GetAttempt(accountKey("alice@example.com"))
+	assert.Nil(err)
+	assert.Equal(0, a.Failures)
+}
+
+func Test_SignInThrottleIgnoresForwardedFor(t *testing.T) {
+	assert := asserts.New(t)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _, _, _ := newAccountService(t)
+	s.guard, _ = newTestGuard(&now)
+	h := s.Handler()
+
+	signIn := func(email, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/sign_in", strings.NewReader(`{"email":"`+email+`","password":"wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		req.RemoteAddr = "203.0.113.7:4711"
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A new forwarded address on every attempt doesn't start a new IP counter.
+	for i := 0; i < 10; i++ {
+		assert.Equal(http.StatusUnauthorized, signIn(fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("198.51.100.%d", i)))
+	}
+	assert.Equal(http.StatusTooManyRequests, signIn("user10@example.com", "198.51.100.10"))
+
+	a, err := s.guard.attempts.GetAttempt(ipKey("203.0.113.7"))
+	assert.NoError(err)
+	assert.Equal(10, a.Failures)
+
+	// Nor can it be used to lock out somebody else's address.
+	a, err = s.guard.attempts.GetAttempt(ipKey("198.51.100.1"))
+	assert.NoError(err)
+	assert.Equal(0, a.Failures)
+}
+
+func Test_IPExtractor(t *testing.T) {
+	assert := asserts.New(t)
+
+	clientIP := func(extract echo.IPExtractor, remoteAddr, forwardedFor string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		return extract(req)
+	}
+
+	direct, err := newIPExtractor(nil)
+	assert.NoError(err)
+	assert.Equal("10.0.0.1", clientIP(direct, "10.0.0.1:80", "198.51.100.1"))
+
+	proxied, err := newIPExtractor([]string{"10.0.0.1", "192.168.0.0/16"})
+	assert.NoError(err)
+	assert.Equal("198.51.100.1", clientIP(proxied, "10.0.0.1:80", "198.51.100.1"))
+	assert.Equal("198.51.100.1", clientIP(proxied, "10.0.0.1:80", "203.0.113.9, 198.51.100.1, 192.168.3.4"))
+	assert.Equal("10.0.0.2", clientIP(proxied, "10.0.0.2:80", "198.51.100.1"))
+
+	_, err = newIPExtractor([]string{"proxy.local"})
+	assert.EqualError(err, `invalid trusted proxy "proxy.local"`)
+}
@@ -0,0 +1,264 @@
+package service_echo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/totp"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	totpSkew          = 1
+)
+
+func mfaKey(email string) string {
+	return "mfa:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	var codes, hashes []string
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+func requireSealer(s *Service) error {
+	if s.sealer == nil {
+		return echo.NewHTTPError(http.StatusNotImplemented, "two-factor authentication is not configured")
+	}
+	return nil
+}
+
+// verifyMFACode accepts either a current TOTP code or an unused recovery code. Each code can only
+// be used once.
+func verifyMFACode(s *Service, userID int64, mfa *db.MFA, code string) (bool, error) {
+	secret, err := s.sealer.Open(mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(string(secret), code, time.Now(), totpSkew); ok {
+		return s.db.MFA.UseStep(userID, step)
+	}
+
+	if !mfa.Enabled {
+		return false, nil
+	}
+	return s.db.MFA.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+}
+
+func enrollMFA(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := requireSealer(s); err != nil {
+		return err
+	}
+
+	mfa, err := s.db.MFA.GetMFA(sc.UserID)
+	if err != nil {
+		return err
+	}
+	if mfa != nil && mfa.Enabled {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := s.sealer.Seal([]byte(secret))
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.MFA.SetPendingSecret(sc.UserID, sealed); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &pkg.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.conf.MFAIssuer, sc.Email, secret),
+	})
+}
+
+func confirmMFA(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := requireSealer(s); err != nil {
+		return err
+	}
+
+	var req pkg.MFACode
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	mfa, err := s.db.MFA.GetMFA(sc.UserID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "two-factor enrollment has not been started")
+	}
+	if mfa.Enabled {
+		return echo.NewHTTPError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+
+	ok, err := verifyMFACode(s, sc.UserID, mfa, req.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, pkg.NewMsgResp("invalid code"))
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.MFA.EnableMFA(sc.UserID, hashes); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, &pkg.MFARecoveryCodes{RecoveryCodes: codes})
+}
+
+func disableMFA(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := requireSealer(s); err != nil {
+		return err
+	}
+
+	var req pkg.MFADisable
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := checkPassword(s, sc, req.Password); err != nil {
+		return err
+	}
+
+	mfa, err := s.db.MFA.GetMFA(sc.UserID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return echo.NewHTTPError(http.StatusBadRequest, "two-factor authentication is not enabled")
+	}
+
+	ok, err := verifyMFACode(s, sc.UserID, mfa, req.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, pkg.NewMsgResp("invalid code"))
+	}
+
+	if err = s.db.MFA.DisableMFA(sc.UserID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Two-factor authentication disabled"))
+}
+
+// signInMFA is the second step of the sign-in flow. It exchanges an MFA challenge token and a TOTP
+// or recovery code for a regular token.
+func signInMFA(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	if err := requireSealer(s); err != nil {
+		return err
+	}
+
+	var req pkg.MFASignIn
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	claims, err := parseToken(req.MFAToken, s.conf.SigningKey)
+	if err != nil {
+		return err
+	}
+	if claims.Audience != mfaAudience {
+		return echo.NewHTTPError(http.StatusUnauthorized)
+	}
+
+	var (
+		ip  = c.RealIP()
+		key = mfaKey(claims.Email)
+	)
+
+	wait, err := s.guard.retryAfter(key, ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
+	user, err := s.db.User.GetUser(claims.Email)
+	if err != nil {
+		return err
+	}
+
+	mfa, err := s.db.MFA.GetMFA(user.ID)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return echo.NewHTTPError(http.StatusUnauthorized)
+	}
+
+	ok, err := verifyMFACode(s, user.ID, mfa, req.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err = s.guard.fail(key, s.guard.account, ip); err != nil {
+			return err
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, pkg.NewMsgResp("invalid code"))
+	}
+
+	if err = s.guard.attempts.ResetAttempts(key); err != nil {
+		return err
+	}
+	return issueToken(c, s, user)
+}
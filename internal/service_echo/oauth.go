@@ -0,0 +1,490 @@
+package service_echo
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/oidc"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oauthCodeExpiry      = 5 * time.Minute
+	oauthTokenExpirySec  = 3600
+	oauthDefaultScope    = scopeProfile + " " + scopeTodosRead
+	oauthTokenTypeBearer = "Bearer"
+)
+
+// Scopes that third-party clients can request. First-party sessions are not scoped and may do
+// anything, including the scopeAccount operations that are never granted to a client.
+const (
+	scopeProfile    = "profile"
+	scopeTodosRead  = "todos:read"
+	scopeTodosWrite = "todos:write"
+	scopeAccount    = "account"
+)
+
+var grantableScopes = []string{scopeProfile, scopeTodosRead, scopeTodosWrite}
+
+// RequireScope rejects OAuth access tokens that were not granted scope.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sc := c.Get("security_context").(*SecurityContext)
+
+			if !sc.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, &pkg.OAuthError{
+					Error:            "insufficient_scope",
+					ErrorDescription: "token lacks the " + scope + " scope",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+func oauthError(status int, code, description string) error {
+	return echo.NewHTTPError(status, &pkg.OAuthError{Error: code, ErrorDescription: description})
+}
+
+func parseScope(scope string) ([]string, error) {
+	if scope == "" {
+		scope = oauthDefaultScope
+	}
+
+	scopes := strings.Fields(scope)
+	for _, sc := range scopes {
+		if !util.Contains(grantableScopes, sc) {
+			return nil, oauthError(http.StatusBadRequest, "invalid_scope", "unknown scope "+sc)
+		}
+	}
+	return scopes, nil
+}
+
+func toClientResponse(oc *db.OAuthClient, secret string) *pkg.OAuthClientResponse {
+	return &pkg.OAuthClientResponse{
+		ClientID:     oc.ID,
+		ClientSecret: secret,
+		Name:         oc.Name,
+		RedirectURIs: oc.RedirectURIs,
+		Public:       oc.Public(),
+		CreatedAt:    &oc.CreatedAt,
+	}
+}
+
+func createOAuthClient(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.OAuthClientRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	oc := &db.OAuthClient{
+		ID:           uuid.NewV4().String(),
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		OwnerID:      sc.UserID,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	// Public clients, such as native apps, cannot keep a secret and rely on PKCE alone.
+	var secret string
+	if !req.Public {
+		var err error
+		if secret, err = randomToken(); err != nil {
+			return err
+		}
+		oc.SecretHash = hashToken(secret)
+	}
+
+	if err := s.db.OAuth.CreateClient(oc); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, toClientResponse(oc, secret))
+}
+
+func listOAuthClients(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	clients, err := s.db.OAuth.ListClients(sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]*pkg.OAuthClientResponse, 0, len(clients))
+	for i := range clients {
+		resp = append(resp, toClientResponse(&clients[i], ""))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func deleteOAuthClient(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := s.db.OAuth.DeleteClient(sc.UserID, c.Param("client_id")); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+type authorizeRequest struct {
+	pkg.OAuthAuthorizeRequest
+	client   *db.OAuthClient
+	redirect *url.URL
+	scopes   []string
+}
+
+// parseAuthorizeRequest validates the client and redirect uri first. Errors up to that point are
+// returned to the caller, anything after is reported to the client through the redirect uri.
+func parseAuthorizeRequest(c echo.Context) (*authorizeRequest, error) {
+	s := c.Get("service").(*Service)
+
+	var ar authorizeRequest
+	if err := c.Bind(&ar.OAuthAuthorizeRequest); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	client, err := s.db.OAuth.GetClient(ar.ClientID)
+	if err != nil {
+		return nil, oauthError(http.StatusBadRequest, "invalid_client", "unknown client")
+	}
+
+	if ar.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		ar.RedirectURI = client.RedirectURIs[0]
+	}
+	if !util.Contains(client.RedirectURIs, ar.RedirectURI) {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	// Clients registered before redirect uris were checked may still have ones that are not safe to use.
+	if ar.redirect, err = pkg.ParseRedirectURI(ar.RedirectURI); err != nil {
+		return nil, oauthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	ar.client = client
+
+	if ar.ResponseType != "code" {
+		return &ar, oauthError(http.StatusBadRequest, "unsupported_response_type", "only the code response type is supported")
+	}
+
+	if ar.CodeChallenge == "" || ar.CodeChallengeMethod != "S256" {
+		return &ar, oauthError(http.StatusBadRequest, "invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+
+	if ar.scopes, err = parseScope(ar.Scope); err != nil {
+		return &ar, err
+	}
+	return &ar, nil
+}
+
+func (ar *authorizeRequest) redirectTo(params url.Values) string {
+	u := *ar.redirect
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if ar.State != "" {
+		q.Set("state", ar.State)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (ar *authorizeRequest) redirectError(err error) string {
+	params := url.Values{"error": {"server_error"}}
+
+	if he, ok := err.(*echo.HTTPError); ok {
+		if oe, ok := he.Message.(*pkg.OAuthError); ok {
+			params.Set("error", oe.Error)
+			params.Set("error_description", oe.ErrorDescription)
+		}
+	}
+	return ar.redirectTo(params)
+}
+
+// getOAuthConsent returns what the consent screen has to show for an authorization request.
+func getOAuthConsent(c echo.Context) error {
+	ar, err := parseAuthorizeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &pkg.OAuthConsent{
+		ClientID:    ar.client.ID,
+		ClientName:  ar.client.Name,
+		RedirectURI: ar.RedirectURI,
+		Scopes:      ar.scopes,
+	})
+}
+
+// authorizeOAuth records the user's decision on the consent screen and returns the redirect that
+// carries the authorization code, or the error, back to the client.
+func authorizeOAuth(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	ar, err := parseAuthorizeRequest(c)
+	if ar == nil {
+		return err
+	}
+	if err != nil {
+		return c.JSON(http.StatusOK, &pkg.OAuthRedirect{RedirectTo: ar.redirectError(err)})
+	}
+
+	if !ar.Approve {
+		return c.JSON(http.StatusOK, &pkg.OAuthRedirect{RedirectTo: ar.redirectTo(url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"the user denied the request"},
+		})})
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	scope := strings.Join(ar.scopes, " ")
+
+	if err = s.db.OAuth.SaveGrant(sc.UserID, ar.client.ID, scope); err != nil {
+		return err
+	}
+
+	err = s.db.OAuth.SaveCode(hashToken(code), &db.OAuthCode{
+		ClientID:    ar.client.ID,
+		UserID:      sc.UserID,
+		OrgID:       sc.OrgID,
+		RedirectURI: ar.RedirectURI,
+		Scope:       scope,
+		Challenge:   ar.CodeChallenge,
+	}, time.Now().Add(oauthCodeExpiry))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, &pkg.OAuthRedirect{RedirectTo: ar.redirectTo(url.Values{"code": {code}})})
+}
+
+// authenticateClient accepts client credentials through HTTP Basic auth or the request body. Public
+// clients only identify themselves.
+func authenticateClient(c echo.Context) (*db.OAuthClient, error) {
+	s := c.Get("service").(*Service)
+
+	id, secret, ok := c.Request().BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = c.FormValue("client_id"), c.FormValue("client_secret")
+	}
+
+	client, err := s.db.OAuth.GetClient(id)
+	if err != nil {
+		return nil, oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	if !client.Public() && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+func generateOAuthToken(t *db.OAuthToken, signingKey string) (string, error) {
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        t.ID,
+			Subject:   strconv.FormatInt(t.UserID, 10),
+			IssuedAt:  t.IssuedAt.Unix(),
+			ExpiresAt: t.ExpiresAt.Unix(),
+		},
+		Email:    t.Email,
+		Scope:    t.Scope,
+		ClientID: t.ClientID,
+		OrgID:    t.OrgID,
+	}
+
+	return mkJwtToken([]byte(signingKey), claims)
+}
+
+// oauthToken implements the token endpoint for the authorization code grant.
+func oauthToken(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	client, err := authenticateClient(c)
+	if err != nil {
+		return err
+	}
+
+	if c.FormValue("grant_type") != "authorization_code" {
+		return oauthError(http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+	}
+
+	code, err := s.db.OAuth.ConsumeCode(hashToken(c.FormValue("code")))
+	if err != nil {
+		return err
+	}
+
+	if code == nil || code.ClientID != client.ID || code.RedirectURI != c.FormValue("redirect_uri") ||
+		subtle.ConstantTimeCompare([]byte(oidc.Challenge(c.FormValue("code_verifier"))), []byte(code.Challenge)) != 1 {
+		return oauthError(http.StatusBadRequest, "invalid_grant", "invalid authorization code or code_verifier")
+	}
+
+	user, err := s.db.User.GetUserByID(code.UserID)
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt != nil {
+		return oauthError(http.StatusBadRequest, "invalid_grant", "the account is disabled")
+	}
+
+	now := time.Now()
+	t := &db.OAuthToken{
+		ID:        uuid.NewV4().String(),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		OrgID:     code.OrgID,
+		Email:     user.Email,
+		Scope:     code.Scope,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(oauthTokenExpirySec * time.Second),
+	}
+
+	// The user may have revoked the app since the code was issued.
+	if err = s.db.OAuth.CreateToken(t); errors.Is(err, db.ErrNoOAuthGrant) {
+		return oauthError(http.StatusBadRequest, "invalid_grant", "the authorization was revoked")
+	} else if err != nil {
+		return err
+	}
+
+	token, err := generateOAuthToken(t, s.conf.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, &pkg.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   oauthTokenTypeBearer,
+		ExpiresIn:   oauthTokenExpirySec,
+		Scope:       t.Scope,
+	})
+}
+
+// lookupOAuthToken returns the stored token behind an access token, or nil if it is not active.
+func lookupOAuthToken(s *Service, token string) (*db.OAuthToken, error) {
+	claims, err := parseToken(token, s.conf.SigningKey)
+	if err != nil || claims.ClientID == "" {
+		return nil, nil
+	}
+	return s.db.OAuth.GetToken(claims.Id)
+}
+
+// introspectOAuthToken implements RFC 7662. Clients can only introspect their own tokens.
+func introspectOAuthToken(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	client, err := authenticateClient(c)
+	if err != nil {
+		return err
+	}
+
+	t, err := lookupOAuthToken(s, c.FormValue("token"))
+	if err != nil {
+		return err
+	}
+
+	if t == nil || t.ClientID != client.ID {
+		return c.JSON(http.StatusOK, &pkg.OAuthIntrospection{Active: false})
+	}
+
+	return c.JSON(http.StatusOK, &pkg.OAuthIntrospection{
+		Active:    true,
+		Scope:     t.Scope,
+		ClientID:  t.ClientID,
+		Username:  t.Email,
+		TokenType: oauthTokenTypeBearer,
+		Exp:       t.ExpiresAt.Unix(),
+		Iat:       t.IssuedAt.Unix(),
+		Sub:       strconv.FormatInt(t.UserID, 10),
+	})
+}
+
+// revokeOAuthToken implements RFC 7009. Unknown tokens are not an error.
+func revokeOAuthToken(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	client, err := authenticateClient(c)
+	if err != nil {
+		return err
+	}
+
+	t, err := lookupOAuthToken(s, c.FormValue("token"))
+	if err != nil {
+		return err
+	}
+
+	if t != nil && t.ClientID == client.ID {
+		if err = s.db.OAuth.RevokeToken(t.ID); err != nil {
+			return err
+		}
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func listAuthorizedApps(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	grants, err := s.db.OAuth.ListGrants(sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	apps := make([]pkg.AuthorizedApp, 0, len(grants))
+	for i := range grants {
+		apps = append(apps, pkg.AuthorizedApp{
+			ClientID:     grants[i].ClientID,
+			Name:         grants[i].ClientName,
+			Scopes:       strings.Fields(grants[i].Scope),
+			AuthorizedAt: &grants[i].CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, apps)
+}
+
+func revokeAuthorizedApp(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if err := s.db.OAuth.DeleteGrant(sc.UserID, c.Param("client_id")); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
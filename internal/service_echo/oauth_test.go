@@ -0,0 +1,282 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/oidc"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryOAuthStore struct {
+	db.OAuthDB
+	mu      sync.Mutex
+	clients map[string]*db.OAuthClient
+	codes   map[string]*db.OAuthCode
+	grants  map[string]string
+	tokens  map[string]*db.OAuthToken
+}
+
+func newMemoryOAuthStore() *memoryOAuthStore {
+	return &memoryOAuthStore{
+		clients: map[string]*db.OAuthClient{},
+		codes:   map[string]*db.OAuthCode{},
+		grants:  map[string]string{},
+		tokens:  map[string]*db.OAuthToken{},
+	}
+}
+
+func (ms *memoryOAuthStore) CreateClient(oc *db.OAuthClient) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.clients[oc.ID] = oc
+	return nil
+}
+
+func (ms *memoryOAuthStore) GetClient(clientID string) (*db.OAuthClient, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	oc, ok := ms.clients[clientID]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "no such client")
+	}
+	return oc, nil
+}
+
+func (ms *memoryOAuthStore) SaveCode(codeHash string, code *db.OAuthCode, _ time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.codes[codeHash] = code
+	return nil
+}
+
+func (ms *memoryOAuthStore) ConsumeCode(codeHash string) (*db.OAuthCode, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	code := ms.codes[codeHash]
+	delete(ms.codes, codeHash)
+	return code, nil
+}
+
+func (ms *memoryOAuthStore) SaveGrant(userID int64, clientID, scope string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.grants[clientID] = scope
+	return nil
+}
+
+func (ms *memoryOAuthStore) DeleteGrant(_ int64, clientID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.grants, clientID)
+	for hash, code := range ms.codes {
+		if code.ClientID == clientID {
+			delete(ms.codes, hash)
+		}
+	}
+	return nil
+}
+
+func (ms *memoryOAuthStore) CreateToken(t *db.OAuthToken) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.grants[t.ClientID]; !ok {
+		return db.ErrNoOAuthGrant
+	}
+	ms.tokens[t.ID] = t
+	return nil
+}
+
+func Test_CreateOAuthClient(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		store = newMemoryOAuthStore()
+		s     = &Service{conf: NewConfig(), db: &db.DB{OAuth: store}}
+		sc    = &SecurityContext{UserID: 1}
+	)
+
+	create := func(uri string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(&pkg.OAuthClientRequest{Name: "app", RedirectURIs: []string{uri}})
+		return serveAs(s, sc, createOAuthClient, http.MethodPost, "/v1/oauth/clients", "/v1/oauth/clients", string(body))
+	}
+
+	for _, uri := range []string{
+		"",
+		"http://%zz",
+		"javascript:alert(document.cookie)",
+		"data:text/html,<script>alert(1)</script>",
+		"http://app.example.com/callback",
+		"https:///callback",
+		"/callback",
+		"https://app.example.com/callback#fragment",
+		"https://app.example.com/callback\nLocation: https://evil.example.com",
+		"com.example.app:/callback",
+	} {
+		assert.Equal(http.StatusBadRequest, create(uri).Code, uri)
+	}
+	assert.Empty(store.clients)
+
+	for _, uri := range []string{
+		"https://app.example.com/callback",
+		"https://app.example.com/callback?source=todo",
+		"http://127.0.0.1:8421/callback",
+		"http://[::1]/callback",
+		"http://localhost:3000/callback",
+	} {
+		assert.Equal(http.StatusCreated, create(uri).Code, uri)
+	}
+}
+
+func Test_OAuthAuthorizationCode(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		store = newMemoryOAuthStore()
+		users = &memoryUserStore{users: map[int64]*pkg.User{1: {ID: 1, Email: "ann@example.com"}}}
+		s     = &Service{conf: NewConfig(), db: &db.DB{OAuth: store, User: users}}
+		sc    = &SecurityContext{UserID: 1, OrgID: 2}
+
+		callback = "https://app.example.com/callback?source=todo"
+		verifier = "a-verifier-that-is-long-enough-to-be-used-for-pkce"
+	)
+	s.conf.SigningKey = "key"
+
+	store.clients["app"] = &db.OAuthClient{ID: "app", Name: "App", RedirectURIs: []string{callback}, SecretHash: hashToken("secret")}
+
+	// Registered before redirect uris were checked.
+	store.clients["old"] = &db.OAuthClient{ID: "old", Name: "Old", RedirectURIs: []string{"javascript:alert(1)", "http://%zz"}}
+
+	authorize := func(ar *pkg.OAuthAuthorizeRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ar)
+		return serveAs(s, sc, authorizeOAuth, http.MethodPost, "/v1/oauth/authorize", "/v1/oauth/authorize", string(body))
+	}
+
+	// redirect returns the parameters of the redirect uri an authorization returns, which has to be the
+	// callback of the client.
+	redirect := func(rec *httptest.ResponseRecorder) url.Values {
+		if !assert.Equal(http.StatusOK, rec.Code, rec.Body.String()) {
+			return url.Values{}
+		}
+
+		var r pkg.OAuthRedirect
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &r))
+		u, err := url.Parse(r.RedirectTo)
+		assert.NoError(err)
+		assert.Equal("https://app.example.com/callback", u.Scheme+"://"+u.Host+u.Path)
+		assert.Equal("todo", u.Query().Get("source"))
+		return u.Query()
+	}
+
+	exchange := func(code, redirectURI, verifier string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/v1/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.SetBasicAuth("app", "secret")
+		return serveRequest(s, nil, oauthToken, "/v1/oauth/token", req)
+	}
+
+	request := func() *pkg.OAuthAuthorizeRequest {
+		return &pkg.OAuthAuthorizeRequest{
+			ResponseType:        "code",
+			ClientID:            "app",
+			RedirectURI:         callback,
+			Scope:               "profile todos:write",
+			State:               "xyz",
+			CodeChallenge:       oidc.Challenge(verifier),
+			CodeChallengeMethod: "S256",
+			Approve:             true,
+		}
+	}
+
+	// Errors about the client or its redirect uri are not sent to the redirect uri.
+	ar := request()
+	ar.RedirectURI = "https://evil.example.com/callback"
+	assert.Equal(http.StatusBadRequest, authorize(ar).Code)
+
+	for _, uri := range []string{"javascript:alert(1)", "http://%zz"} {
+		ar = request()
+		ar.ClientID, ar.RedirectURI = "old", uri
+		assert.Equal(http.StatusBadRequest, authorize(ar).Code, uri)
+	}
+
+	// Later ones are.
+	ar = request()
+	ar.CodeChallengeMethod = "plain"
+	params := redirect(authorize(ar))
+	assert.Equal("invalid_request", params.Get("error"))
+	assert.Equal("xyz", params.Get("state"))
+
+	ar = request()
+	ar.Approve = false
+	params = redirect(authorize(ar))
+	assert.Equal("access_denied", params.Get("error"))
+	assert.Empty(store.grants)
+
+	params = redirect(authorize(request()))
+	assert.Equal("xyz", params.Get("state"))
+	assert.Equal("profile todos:write", store.grants["app"])
+
+	code := params.Get("code")
+	assert.NotEmpty(code)
+
+	// A code is used up by a failed exchange, so that verifiers cannot be guessed.
+	rec := exchange(code, callback, "another-verifier")
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "invalid_grant")
+	assert.Equal(http.StatusBadRequest, exchange(code, callback, verifier).Code)
+
+	code = redirect(authorize(request())).Get("code")
+	assert.Equal(http.StatusBadRequest, exchange(code, "https://app.example.com/other", verifier).Code)
+
+	code = redirect(authorize(request())).Get("code")
+	rec = exchange(code, callback, verifier)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var tr pkg.OAuthTokenResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &tr))
+	assert.Equal("Bearer", tr.TokenType)
+	assert.Equal("profile todos:write", tr.Scope)
+
+	claims, err := parseToken(tr.AccessToken, s.conf.SigningKey)
+	assert.NoError(err)
+	assert.Equal("app", claims.ClientID)
+	assert.Equal(int64(2), claims.OrgID)
+	assert.Contains(store.tokens, claims.Id)
+
+	// Codes work once.
+	assert.Equal(http.StatusBadRequest, exchange(code, callback, verifier).Code)
+
+	// Revoking the app voids the codes issued before.
+	code = redirect(authorize(request())).Get("code")
+	rec = serveAs(s, sc, revokeAuthorizedApp, http.MethodDelete, "/v1/me/apps/:client_id", "/v1/me/apps/app", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(http.StatusBadRequest, exchange(code, callback, verifier).Code)
+
+	// And the exchange fails without a grant, in case the app is revoked during it.
+	code = redirect(authorize(request())).Get("code")
+	delete(store.grants, "app")
+	rec = exchange(code, callback, verifier)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Contains(rec.Body.String(), "the authorization was revoked")
+}
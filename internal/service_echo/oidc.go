@@ -0,0 +1,132 @@
+package service_echo
+
+import (
+	"errors"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/oidc"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const oidcStateExpiry = 10 * time.Minute
+
+func getProvider(c echo.Context) (*oidc.Provider, error) {
+	s := c.Get("service").(*Service)
+
+	p, ok := s.providers[c.Param("provider")]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "unknown identity provider")
+	}
+	return p, nil
+}
+
+// oidcLogin starts an authorization code flow with PKCE and redirects to the identity provider.
+func oidcLogin(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	p, err := getProvider(c)
+	if err != nil {
+		return err
+	}
+
+	st := &db.OIDCState{Provider: p.Name()}
+	if st.State, err = oidc.NewState(); err != nil {
+		return err
+	}
+	if st.Nonce, err = oidc.NewState(); err != nil {
+		return err
+	}
+	if st.Verifier, err = oidc.NewVerifier(); err != nil {
+		return err
+	}
+
+	authURL, err := p.AuthCodeURL(c.Request().Context(), st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	}
+
+	if err = s.db.Identity.SaveOIDCState(st, time.Now().Add(oidcStateExpiry)); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// oidcCallback completes the flow and signs the user in with a regular token.
+func oidcCallback(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	p, err := getProvider(c)
+	if err != nil {
+		return err
+	}
+
+	st, err := s.db.Identity.ConsumeOIDCState(c.QueryParam("state"))
+	if err != nil {
+		return err
+	}
+	if st.Provider != p.Name() {
+		return echo.NewHTTPError(http.StatusBadRequest, "login state belongs to another identity provider")
+	}
+
+	if e := c.QueryParam("error"); e != "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, pkg.NewMsgResp(strings.TrimSpace(e+" "+c.QueryParam("error_description"))))
+	}
+
+	claims, err := p.Exchange(c.Request().Context(), c.QueryParam("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, pkg.NewMsgResp(err.Error()))
+	}
+
+	user, err := oidcUser(s, p.Name(), claims)
+	if err != nil {
+		return err
+	}
+	return issueToken(c, s, user)
+}
+
+// oidcUser resolves the local account for an external identity. Known identities map to their linked
+// user, otherwise the identity is linked to the account with the same verified email, or a new
+// account is provisioned.
+func oidcUser(s *Service, provider string, claims *oidc.Claims) (*pkg.User, error) {
+	userID, err := s.db.Identity.GetIdentityUserID(provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 {
+		return s.db.User.GetUserByID(userID)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "identity provider did not return a verified email address")
+	}
+
+	user, err := s.db.User.GetUser(claims.Email)
+	if errors.Is(err, db.ErrUserNotFound) {
+		user, err = provisionUser(s, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.db.Identity.LinkIdentity(user.ID, provider, claims.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates an account for a first time SSO user. The account has no password, so it can
+// only be used through the identity provider until the user sets one.
+func provisionUser(s *Service, claims *oidc.Claims) (*pkg.User, error) {
+	username := claims.Name
+	if username == "" {
+		username = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	if err := s.db.User.CreateUser(&pkg.User{Email: claims.Email, Username: username}, ""); err != nil {
+		return nil, err
+	}
+	return s.db.User.GetUser(claims.Email)
+}
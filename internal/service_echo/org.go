@@ -0,0 +1,426 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const invitationExpiry = 7 * 24 * time.Hour
+
+// orgRoleRank orders membership roles so that a higher role includes the permissions of the lower ones.
+var orgRoleRank = map[string]int{
+	pkg.OrgRoleMember: 0,
+	pkg.OrgRoleAdmin:  1,
+	pkg.OrgRoleOwner:  2,
+}
+
+// defaultOrg returns the organization a new session starts in. Users without any membership get a
+// personal organization.
+func defaultOrg(s *Service, user *pkg.User) (int64, error) {
+	orgID, err := s.db.Org.GetDefaultOrgID(user.ID)
+	if err != nil || orgID != 0 {
+		return orgID, err
+	}
+	return s.db.Org.CreateOrg(user.Username, &pkg.OrgSettings{}, user.ID)
+}
+
+// RequireOrg rejects callers that are not (or no longer) members of their active organization.
+func RequireOrg(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sc := c.Get("security_context").(*SecurityContext)
+
+		if sc.OrgRole != "" {
+			return next(c)
+		}
+
+		// Tokens issued before organizations existed carry none and have to be replaced.
+		if sc.OrgID == 0 {
+			return echo.NewHTTPError(http.StatusUnauthorized, "no active organization, sign in again")
+		}
+		return echo.NewHTTPError(http.StatusForbidden, "not a member of the active organization")
+	}
+}
+
+// requireOrgRole loads the organization in the path and checks that the caller holds at least role in it.
+func requireOrgRole(c echo.Context, role string) (*pkg.Org, error) {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	orgID, err := getID(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	r, err := s.db.Org.GetMemberRole(orgID, sc.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Non-members get the same answer as for an organization that does not exist.
+	if r == "" {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such organization: %d", orgID))
+	}
+	if orgRoleRank[r] < orgRoleRank[role] {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "insufficient organization role")
+	}
+
+	org, err := s.db.Org.GetOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+	org.Role = r
+	return org, nil
+}
+
+// checkInvitation returns the invitation behind tokenHash if it may be accepted by email.
+func checkInvitation(s *Service, tokenHash, email string) (*db.OrgInvitation, error) {
+	inv, err := s.db.Org.GetInvitation(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if inv.Email != "" && inv.Email != email {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "the invitation was issued for another email address")
+	}
+
+	org, err := s.db.Org.GetOrg(inv.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !org.Settings.AllowsEmail(email) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "the organization does not allow members with this email domain")
+	}
+	return inv, nil
+}
+
+func createOrg(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.OrgRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.Settings == nil {
+		req.Settings = &pkg.OrgSettings{}
+	}
+
+	if !req.Settings.AllowsEmail(sc.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "the allowed email domains must include your own")
+	}
+
+	orgID, err := s.db.Org.CreateOrg(req.Name, req.Settings, sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	org, err := s.db.Org.GetOrg(orgID)
+	if err != nil {
+		return err
+	}
+	org.Role = pkg.OrgRoleOwner
+
+	return c.JSON(http.StatusCreated, org)
+}
+
+func listOrgs(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	orgs, err := s.db.Org.ListUserOrgs(sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, orgs)
+}
+
+func getOrg(c echo.Context) error {
+	org, err := requireOrgRole(c, pkg.OrgRoleMember)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, org)
+}
+
+func updateOrgSettings(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var req pkg.OrgSettings
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Org.UpdateOrgSettings(org.ID, &req); err != nil {
+		return err
+	}
+	org.Settings = req
+
+	return c.JSON(http.StatusOK, org)
+}
+
+func listOrgMembers(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleMember)
+	if err != nil {
+		return err
+	}
+
+	members, err := s.db.Org.ListMembers(org.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+func getUserIDParam(c echo.Context) (int64, error) {
+	idStr := c.Param("user_id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return id, fmt.Errorf("invalid user id given %s", idStr)
+	}
+	return id, nil
+}
+
+// getMember returns the member in the path, and whether it is the organization's only owner.
+func getMember(c echo.Context, s *Service, orgID int64) (*pkg.OrgMember, bool, error) {
+	userID, err := getUserIDParam(c)
+	if err != nil {
+		return nil, false, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	members, err := s.db.Org.ListMembers(orgID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		member *pkg.OrgMember
+		owners int
+	)
+
+	for i, m := range members {
+		if m.Role == pkg.OrgRoleOwner {
+			owners++
+		}
+		if m.UserID == userID {
+			member = &members[i]
+		}
+	}
+
+	if member == nil {
+		return nil, false, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such member: %d", userID))
+	}
+	return member, member.Role == pkg.OrgRoleOwner && owners == 1, nil
+}
+
+func setOrgMemberRole(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var req pkg.OrgMemberRole
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	member, lastOwner, err := getMember(c, s, org.ID)
+	if err != nil {
+		return err
+	}
+
+	// Only owners can hand out or take away ownership.
+	if (req.Role == pkg.OrgRoleOwner || member.Role == pkg.OrgRoleOwner) && org.Role != pkg.OrgRoleOwner {
+		return echo.NewHTTPError(http.StatusForbidden, "insufficient organization role")
+	}
+
+	if lastOwner && req.Role != pkg.OrgRoleOwner {
+		return echo.NewHTTPError(http.StatusBadRequest, "the organization needs at least one owner")
+	}
+
+	if err = s.db.Org.SetMemberRole(org.ID, member.UserID, req.Role); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Role changed"))
+}
+
+func removeOrgMember(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleMember)
+	if err != nil {
+		return err
+	}
+
+	member, lastOwner, err := getMember(c, s, org.ID)
+	if err != nil {
+		return err
+	}
+
+	// Members can leave on their own; removing someone else takes an admin, and an owner for owners.
+	if member.UserID != sc.UserID {
+		required := pkg.OrgRoleAdmin
+		if member.Role == pkg.OrgRoleOwner {
+			required = pkg.OrgRoleOwner
+		}
+		if orgRoleRank[org.Role] < orgRoleRank[required] {
+			return echo.NewHTTPError(http.StatusForbidden, "insufficient organization role")
+		}
+	}
+
+	if lastOwner {
+		return echo.NewHTTPError(http.StatusBadRequest, "the organization needs at least one owner")
+	}
+
+	if err = s.db.Org.RemoveMember(org.ID, member.UserID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pkg.NewMsgResp("Member removed"))
+}
+
+func inviteToOrg(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	var req pkg.InvitationRequest
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.Email != "" && !org.Settings.AllowsEmail(req.Email) {
+		return echo.NewHTTPError(http.StatusBadRequest, "the organization does not allow members with this email domain")
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(invitationExpiry)
+
+	inv := &db.OrgInvitation{OrgID: org.ID, Email: req.Email, Role: req.Role, InvitedBy: sc.UserID}
+	if err = s.db.Org.CreateInvitation(hashToken(token), inv, expiresAt); err != nil {
+		return err
+	}
+
+	if req.Email != "" {
+		body := fmt.Sprintf(
+			"%s invited you to join %s. Submit this token to %s/v1/invitations/accept, or pass it as "+
+				"\"invitation\" when signing up at %s/v1/sign_up:\n\n%s\n\nThe invitation expires in %s.",
+			sc.Email, org.Name, s.conf.PublicURL, s.conf.PublicURL, token, invitationExpiry,
+		)
+		if err = s.mailer.Send(req.Email, "You have been invited to "+org.Name, body); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusCreated, &pkg.InvitationResponse{Token: token, ExpiresAt: &expiresAt})
+}
+
+func acceptInvitation(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.InvitationAccept
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	tokenHash := hashToken(req.Token)
+
+	inv, err := checkInvitation(s, tokenHash, sc.Email)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.db.Org.GetMemberRole(inv.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+	if role != "" {
+		return echo.NewHTTPError(http.StatusConflict, "already a member of the organization")
+	}
+
+	if err = s.db.Org.AcceptInvitation(tokenHash, sc.UserID); err != nil {
+		return err
+	}
+
+	org, err := s.db.Org.GetOrg(inv.OrgID)
+	if err != nil {
+		return err
+	}
+	org.Role = inv.Role
+
+	return c.JSON(http.StatusOK, org)
+}
+
+// switchOrg issues a token for the same session with another active organization.
+func switchOrg(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	org, err := requireOrgRole(c, pkg.OrgRoleMember)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(sc.Email, sc.Role, sc.SessionID, org.ID, s.conf.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Session.SetSessionOrg(sc.SessionID, org.ID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, &pkg.Token{ExpiresIn: tokenExpirySec, JWTToken: token})
+}
@@ -0,0 +1,445 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/events"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryOrgStore struct {
+	db.OrgDB
+	mu          sync.Mutex
+	orgs        map[int64]*pkg.Org
+	members     map[int64]map[int64]string
+	invitations map[string]*db.OrgInvitation
+}
+
+func newMemoryOrgStore() *memoryOrgStore {
+	return &memoryOrgStore{
+		orgs:        map[int64]*pkg.Org{},
+		members:     map[int64]map[int64]string{},
+		invitations: map[string]*db.OrgInvitation{},
+	}
+}
+
+// addOrg creates an organization with its members, given by user id and role.
+func (ms *memoryOrgStore) addOrg(orgID int64, name string, members map[int64]string) {
+	ms.orgs[orgID] = &pkg.Org{ID: orgID, Name: name}
+	ms.members[orgID] = members
+}
+
+func (ms *memoryOrgStore) GetOrg(orgID int64) (*pkg.Org, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	org, ok := ms.orgs[orgID]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such organization: %d", orgID))
+	}
+	c := *org
+	return &c, nil
+}
+
+func (ms *memoryOrgStore) ListUserOrgs(userID int64) ([]pkg.Org, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	orgs := make([]pkg.Org, 0)
+	for orgID, members := range ms.members {
+		if role, ok := members[userID]; ok {
+			org := *ms.orgs[orgID]
+			org.Role = role
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+	return orgs, nil
+}
+
+// GetDefaultOrgID returns the first organization the user belongs to.
+func (ms *memoryOrgStore) GetDefaultOrgID(userID int64) (int64, error) {
+	orgs, err := ms.ListUserOrgs(userID)
+	if err != nil || len(orgs) == 0 {
+		return 0, err
+	}
+	return orgs[0].ID, nil
+}
+
+func (ms *memoryOrgStore) GetMemberRole(orgID, userID int64) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.members[orgID][userID], nil
+}
+
+func (ms *memoryOrgStore) ListMembers(orgID int64) ([]pkg.OrgMember, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	members := make([]pkg.OrgMember, 0)
+	for userID, role := range ms.members[orgID] {
+		members = append(members, pkg.OrgMember{UserID: userID, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members, nil
+}
+
+func (ms *memoryOrgStore) SetMemberRole(orgID, userID int64, role string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.members[orgID][userID] = role
+	return nil
+}
+
+func (ms *memoryOrgStore) RemoveMember(orgID, userID int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.members[orgID][userID]; !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such member: %d", userID))
+	}
+	delete(ms.members[orgID], userID)
+	return nil
+}
+
+func (ms *memoryOrgStore) CreateInvitation(tokenHash string, inv *db.OrgInvitation, _ time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.invitations[tokenHash] = inv
+	return nil
+}
+
+func (ms *memoryOrgStore) GetInvitation(tokenHash string) (*db.OrgInvitation, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	inv, ok := ms.invitations[tokenHash]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid or expired invitation")
+	}
+	c := *inv
+	return &c, nil
+}
+
+func (ms *memoryOrgStore) AcceptInvitation(tokenHash string, userID int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	inv, ok := ms.invitations[tokenHash]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid or expired invitation")
+	}
+	ms.members[inv.OrgID][userID] = inv.Role
+	delete(ms.invitations, tokenHash)
+	return nil
+}
+
+type memoryProject struct {
+	orgID int64
+	pkg.Project
+}
+
+type memoryProjectStore struct {
+	db.ProjectDB
+	mu       sync.Mutex
+	projects map[int64]*memoryProject
+}
+
+func (ms *memoryProjectStore) ListProjects(orgID int64) ([]pkg.Project, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	projects := make([]pkg.Project, 0)
+	for _, p := range ms.projects {
+		if p.orgID == orgID {
+			projects = append(projects, p.Project)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+	return projects, nil
+}
+
+func (ms *memoryProjectStore) GetProject(orgID, projectID int64) (*pkg.Project, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	p, ok := ms.projects[projectID]
+	if !ok || p.orgID != orgID {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such project: %d", projectID))
+	}
+	c := p.Project
+	return &c, nil
+}
+
+func (ms *memoryProjectStore) RenameProject(orgID, projectID int64, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if p, ok := ms.projects[projectID]; ok && p.orgID == orgID {
+		p.Name = name
+	}
+	return nil
+}
+
+func (ms *memorySessionStore) SetSessionOrg(string, int64) error {
+	return nil
+}
+
+// orgTest serves the routes of the service to the users of two organizations: ann owns the first, in
+// which carl is a member, and bob owns the second. dan and eve are not in either.
+type orgTest struct {
+	*testing.T
+	s        *Service
+	h        http.Handler
+	todos    *memoryTodoStore
+	orgs     *memoryOrgStore
+	projects *memoryProjectStore
+	mailer   *memoryMailer
+}
+
+func newOrgTest(t *testing.T) *orgTest {
+	var (
+		users = &memoryUserStore{users: map[int64]*pkg.User{}}
+		sess  = &memorySessionStore{sessions: map[string]*db.Session{}, revoked: map[string]bool{}}
+		orgs  = newMemoryOrgStore()
+		conf  = NewConfig()
+	)
+	conf.SigningKey = "key"
+
+	for id, name := range []string{"ann", "bob", "carl", "dan", "eve"} {
+		email := name + "@example.com"
+		users.users[int64(id+1)] = &pkg.User{ID: int64(id + 1), Email: email, Username: name, Role: pkg.RoleUser}
+		sess.sessions[name] = &db.Session{ID: name, UserID: int64(id + 1), Email: email}
+	}
+
+	orgs.addOrg(1, "Acme", map[int64]string{1: pkg.OrgRoleOwner, 3: pkg.OrgRoleMember})
+	orgs.addOrg(2, "Globex", map[int64]string{2: pkg.OrgRoleOwner})
+
+	ot := &orgTest{
+		T:      t,
+		todos:  newMemoryTodoStore(),
+		orgs:   orgs,
+		mailer: &memoryMailer{},
+		projects: &memoryProjectStore{projects: map[int64]*memoryProject{
+			1: {orgID: 1, Project: pkg.Project{ID: 1, Name: "Launch", CreatedBy: 1}},
+			2: {orgID: 2, Project: pkg.Project{ID: 2, Name: "Secret", CreatedBy: 2}},
+		}},
+	}
+
+	ot.s = &Service{
+		conf: conf,
+		db: &db.DB{
+			User:    users,
+			Session: sess,
+			Org:     orgs,
+			Todo:    ot.todos,
+			Project: ot.projects,
+		},
+		mailer: ot.mailer,
+		broker: events.NewMemoryBroker(8),
+	}
+	ot.h = ot.s.Handler()
+	return ot
+}
+
+// call sends a request as the user with a token for the organization orgID.
+func (ot *orgTest) call(user string, orgID int64, method, target, body string) *httptest.ResponseRecorder {
+	token, err := generateToken(user+"@example.com", pkg.RoleUser, user, orgID, ot.s.conf.SigningKey)
+	asserts.NoError(ot, err)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	ot.h.ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_OrgIsolation(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+	)
+
+	annID := ot.todos.add(1, 1, pkg.TodoResponse{Task: "ann's todo"})
+	bobID := ot.todos.add(2, 2, pkg.TodoResponse{Task: "bob's todo"})
+	bobTarget := fmt.Sprintf("/v1/todos/%d", bobID)
+
+	// The todos of another organization do not exist for ann, whatever the request.
+	rec := ot.call("ann", 1, http.MethodGet, bobTarget, "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("null", strings.TrimSpace(rec.Body.String()))
+
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodPut, bobTarget, `{"task":"taken over"}`).Code)
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodPatch, bobTarget, `{"done":true}`).Code)
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodDelete, bobTarget, "").Code)
+
+	bob := ot.todos.get(bobID)
+	assert.Equal("bob's todo", bob.Task)
+	assert.Nil(bob.CompletedAt)
+	assert.Nil(bob.DeletedAt)
+	assert.Equal(int64(1), bob.Revision)
+
+	var todos []pkg.TodoResponse
+	rec = ot.call("ann", 1, http.MethodGet, "/v1/todos", "")
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &todos))
+	assert.Equal("ann's todo", taskNames(todos))
+
+	// Members of the same organization do not see each other's todos either.
+	rec = ot.call("carl", 1, http.MethodGet, fmt.Sprintf("/v1/todos/%d", annID), "")
+	assert.Equal("null", strings.TrimSpace(rec.Body.String()))
+	assert.Equal(http.StatusNotFound, ot.call("carl", 1, http.MethodDelete, fmt.Sprintf("/v1/todos/%d", annID), "").Code)
+
+	// A token for an organization the user is not a member of does not reach any todo.
+	for _, r := range []struct{ method, target, body string }{
+		{http.MethodGet, "/v1/todos", ""},
+		{http.MethodGet, bobTarget, ""},
+		{http.MethodPut, bobTarget, `{"task":"taken over"}`},
+		{http.MethodDelete, bobTarget, ""},
+		{http.MethodPost, "/v1/todos", `{"task":"planted","priority":"low"}`},
+		{http.MethodGet, "/v1/projects", ""},
+		{http.MethodGet, "/v1/projects/2", ""},
+	} {
+		assert.Equal(http.StatusForbidden, ot.call("ann", 2, r.method, r.target, r.body).Code, "%s %s", r.method, r.target)
+	}
+	assert.Equal("bob's todo", ot.todos.get(bobID).Task)
+
+	// Projects are shared within an organization only.
+	var projects []pkg.Project
+	rec = ot.call("ann", 1, http.MethodGet, "/v1/projects", "")
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &projects))
+	if assert.Len(projects, 1) {
+		assert.Equal("Launch", projects[0].Name)
+	}
+
+	assert.Equal(http.StatusOK, ot.call("carl", 1, http.MethodGet, "/v1/projects/1", "").Code)
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodGet, "/v1/projects/2", "").Code)
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodPut, "/v1/projects/2", `{"name":"Mine"}`).Code)
+	assert.Equal("Secret", ot.projects.projects[2].Name)
+
+	// Nor can todos be put into the projects of another organization.
+	assert.Equal(http.StatusBadRequest, ot.call("ann", 1, http.MethodPost, "/v1/todos", `{"task":"spy","priority":"low","project_id":2}`).Code)
+	assert.Equal(http.StatusBadRequest, ot.call("ann", 1, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", annID), `{"project_id":2}`).Code)
+	assert.Nil(ot.todos.get(annID).ProjectID)
+
+	rec = ot.call("ann", 1, http.MethodPost, "/v1/todos", `{"task":"launch","priority":"low","project_id":1}`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	// Organizations themselves are hidden from non-members.
+	for _, r := range []struct{ method, target, body string }{
+		{http.MethodGet, "/v1/orgs/2", ""},
+		{http.MethodGet, "/v1/orgs/2/members", ""},
+		{http.MethodPut, "/v1/orgs/2/settings", `{"categories":["spy"]}`},
+		{http.MethodPost, "/v1/orgs/2/switch", ""},
+		{http.MethodPost, "/v1/orgs/2/invitations", `{"email":"ann@example.com"}`},
+		{http.MethodPut, "/v1/orgs/2/members/1", `{"role":"owner"}`},
+		{http.MethodDelete, "/v1/orgs/2/members/2", ""},
+	} {
+		assert.Equal(http.StatusNotFound, ot.call("ann", 1, r.method, r.target, r.body).Code, "%s %s", r.method, r.target)
+	}
+	assert.Equal(map[int64]string{2: pkg.OrgRoleOwner}, ot.orgs.members[2])
+	assert.Empty(ot.orgs.invitations)
+
+	var orgs []pkg.Org
+	rec = ot.call("ann", 1, http.MethodGet, "/v1/orgs", "")
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &orgs))
+	if assert.Len(orgs, 1) {
+		assert.Equal("Acme", orgs[0].Name)
+	}
+}
+
+func Test_OrgInvitationsAndRoles(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+	)
+
+	invite := func(user, body string) string {
+		rec := ot.call(user, 1, http.MethodPost, "/v1/orgs/1/invitations", body)
+		if !assert.Equal(http.StatusCreated, rec.Code, rec.Body.String()) {
+			return ""
+		}
+
+		var ir pkg.InvitationResponse
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &ir))
+		return ir.Token
+	}
+
+	accept := func(user, token string) int {
+		return ot.call(user, 0, http.MethodPost, "/v1/invitations/accept", `{"token":"`+token+`"}`).Code
+	}
+
+	// Members cannot invite anyone or change roles.
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodPost, "/v1/orgs/1/invitations", `{"email":"dan@example.com"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodPut, "/v1/orgs/1/members/3", `{"role":"admin"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodPut, "/v1/orgs/1/settings", `{"categories":["work"]}`).Code)
+	assert.Empty(ot.orgs.invitations)
+	assert.Equal(pkg.OrgRoleMember, ot.orgs.members[1][3])
+
+	// Nobody can be invited as an owner.
+	assert.Equal(http.StatusBadRequest, ot.call("ann", 1, http.MethodPost, "/v1/orgs/1/invitations", `{"email":"dan@example.com","role":"owner"}`).Code)
+
+	// Invitations for an address can only be accepted by its owner, and only once.
+	token := invite("ann", `{"email":"dan@example.com"}`)
+	assert.Equal("dan@example.com", ot.mailer.last().to)
+	assert.Contains(ot.mailer.last().body, token)
+
+	assert.Equal(http.StatusForbidden, accept("eve", token))
+	assert.Equal(http.StatusBadRequest, accept("dan", "not-a-token"))
+	assert.Equal(http.StatusOK, accept("dan", token))
+	assert.Equal(pkg.OrgRoleMember, ot.orgs.members[1][4])
+	assert.Equal(http.StatusBadRequest, accept("eve", token))
+
+	// Links without an address can be used by anyone, but also only once, and not by members.
+	token = invite("ann", `{}`)
+	assert.Equal(http.StatusConflict, accept("carl", token))
+	assert.Equal(http.StatusOK, accept("eve", token))
+	assert.Equal(http.StatusBadRequest, accept("bob", token))
+	assert.Empty(ot.orgs.members[1][2])
+
+	// Admins manage members, but not owners or ownership.
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodPut, "/v1/orgs/1/members/3", `{"role":"admin"}`).Code)
+	assert.Equal(http.StatusBadRequest, ot.call("carl", 1, http.MethodPost, "/v1/orgs/1/invitations", `{"role":"owner"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodPut, "/v1/orgs/1/members/4", `{"role":"owner"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodPut, "/v1/orgs/1/members/1", `{"role":"member"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("carl", 1, http.MethodDelete, "/v1/orgs/1/members/1", "").Code)
+	assert.Equal(pkg.OrgRoleOwner, ot.orgs.members[1][1])
+
+	assert.Equal(http.StatusOK, ot.call("carl", 1, http.MethodPut, "/v1/orgs/1/members/4", `{"role":"admin"}`).Code)
+	assert.Equal(http.StatusOK, ot.call("carl", 1, http.MethodDelete, "/v1/orgs/1/members/5", "").Code)
+	assert.NotContains(ot.orgs.members[1], int64(5))
+
+	// Members can only remove themselves.
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodPut, "/v1/orgs/1/members/4", `{"role":"member"}`).Code)
+	assert.Equal(http.StatusForbidden, ot.call("dan", 1, http.MethodDelete, "/v1/orgs/1/members/3", "").Code)
+
+	// The last owner can neither step down nor leave.
+	assert.Equal(http.StatusBadRequest, ot.call("ann", 1, http.MethodPut, "/v1/orgs/1/members/1", `{"role":"admin"}`).Code)
+	assert.Equal(http.StatusBadRequest, ot.call("ann", 1, http.MethodDelete, "/v1/orgs/1/members/1", "").Code)
+	assert.Equal(pkg.OrgRoleOwner, ot.orgs.members[1][1])
+
+	// Only once there is another owner.
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodPut, "/v1/orgs/1/members/3", `{"role":"owner"}`).Code)
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodPut, "/v1/orgs/1/members/1", `{"role":"admin"}`).Code)
+
+	// Membership is checked on every request, so that removed members lose access at once.
+	assert.Equal(http.StatusOK, ot.call("dan", 1, http.MethodGet, "/v1/todos", "").Code)
+	assert.Equal(http.StatusOK, ot.call("dan", 1, http.MethodDelete, "/v1/orgs/1/members/4", "").Code)
+	assert.Equal(http.StatusForbidden, ot.call("dan", 1, http.MethodGet, "/v1/todos", "").Code)
+	assert.Equal(http.StatusNotFound, ot.call("dan", 1, http.MethodGet, "/v1/orgs/1", "").Code)
+}
@@ -0,0 +1,77 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+func listPersonalTokens(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	tokens, err := s.db.Token.ListPersonalTokens(sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// createPersonalToken creates a token for apps that only take a password, such as CalDAV clients. The
+// token is only returned here.
+func createPersonalToken(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.PersonalTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	var (
+		now       = time.Now().UTC().Truncate(time.Second)
+		expiresAt *time.Time
+	)
+
+	if req.ExpiresInDays > 0 {
+		t := now.AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	id, err := s.db.Token.CreatePersonalToken(sc.UserID, req.Name, hashToken(token), expiresAt)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, &pkg.PersonalToken{ID: id, Name: req.Name, Token: token, CreatedAt: &now, ExpiresAt: expiresAt})
+}
+
+func deletePersonalToken(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	id, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Token.DeletePersonalToken(sc.UserID, id); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,122 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func listProjects(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	projects, err := s.db.Project.ListProjects(sc.OrgID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, projects)
+}
+
+func getProject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	projectID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	project, err := s.db.Project.GetProject(sc.OrgID, projectID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, project)
+}
+
+func createProject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.ProjectRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	projectID, err := s.db.Project.CreateProject(sc.OrgID, sc.UserID, req.Name)
+	if err != nil {
+		return err
+	}
+
+	project, err := s.db.Project.GetProject(sc.OrgID, projectID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, project)
+}
+
+func renameProject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	projectID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var req pkg.ProjectRequest
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err = s.db.Project.GetProject(sc.OrgID, projectID); err != nil {
+		return err
+	}
+
+	if err = s.db.Project.RenameProject(sc.OrgID, projectID, req.Name); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// deleteProject removes a project of the active organization. It takes an organization admin since
+// it affects the todos of every member.
+func deleteProject(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if orgRoleRank[sc.OrgRole] < orgRoleRank[pkg.OrgRoleAdmin] {
+		return echo.NewHTTPError(http.StatusForbidden, "insufficient organization role")
+	}
+
+	projectID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err = s.db.Project.GetProject(sc.OrgID, projectID); err != nil {
+		return err
+	}
+
+	if err = s.db.Project.DeleteProject(sc.OrgID, projectID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
@@ -1,9 +1,22 @@
 package service_echo
 
 import (
+	"context"
 	"fmt"
 	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/events"
+	"github.com/harsha-aqfer/todo/internal/mail"
+	"github.com/harsha-aqfer/todo/internal/oidc"
+	"github.com/harsha-aqfer/todo/internal/outbox"
+	"github.com/harsha-aqfer/todo/internal/sealer"
+	"github.com/harsha-aqfer/todo/internal/webhook"
+	"github.com/harsha-aqfer/todo/pkg"
 	"github.com/labstack/echo/v4"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,15 +26,94 @@ type Config struct {
 	Host       string `json:"host"`
 	ListenAddr string `json:"listen_addr"`
 	SigningKey string `json:"signing_key"`
+	PublicURL  string `json:"public_url"`
+
+	// TrustedProxies are the addresses or CIDR ranges of the proxies in front of the server, whose
+	// X-Forwarded-For header tells the client address. Without them the peer address is used.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	SMTPAddr     string `json:"smtp_addr"`
+	SMTPUser     string `json:"smtp_user"`
+	SMTPPassword string `json:"smtp_password"`
+	MailFrom     string `json:"mail_from"`
+
+	AccountDeletionGraceHours int `json:"account_deletion_grace_hours"`
+	TrashRetentionDays        int `json:"trash_retention_days"`
+	IdempotencyKeyTTLHours    int `json:"idempotency_key_ttl_hours"`
+
+	EventHistorySize  int `json:"event_history_size"`
+	EventHeartbeatSec int `json:"event_heartbeat_sec"`
+
+	WebhookMaxAttempts           int `json:"webhook_max_attempts"`
+	WebhookDisableAfter          int `json:"webhook_disable_after"`
+	WebhookTimeoutSec            int `json:"webhook_timeout_sec"`
+	WebhookDeliveryRetentionDays int `json:"webhook_delivery_retention_days"`
+
+	EventPublisher      string `json:"event_publisher"`
+	NATSURL             string `json:"nats_url"`
+	NATSSubject         string `json:"nats_subject"`
+	OutboxRetentionDays int    `json:"outbox_retention_days"`
+
+	ImportJobRetentionDays int `json:"import_job_retention_days"`
+
+	MFAEncryptionKey string `json:"mfa_encryption_key"`
+	MFAIssuer        string `json:"mfa_issuer"`
+
+	OIDCProviders []oidc.Config `json:"oidc_providers"`
+
+	LoginAttemptStore         string `json:"login_attempt_store"`
+	LoginBackoffAfter         int    `json:"login_backoff_after"`
+	LoginLockoutAfter         int    `json:"login_lockout_after"`
+	LoginIPBackoffAfter       int    `json:"login_ip_backoff_after"`
+	LoginIPLockoutAfter       int    `json:"login_ip_lockout_after"`
+	LoginBackoffBaseSec       int    `json:"login_backoff_base_sec"`
+	LoginLockoutMinutes       int    `json:"login_lockout_minutes"`
+	LoginAttemptWindowMinutes int    `json:"login_attempt_window_minutes"`
 }
 
 func NewConfig() *Config {
-	return &Config{}
+	return &Config{
+		PublicURL:                    "http://localhost:3030",
+		MailFrom:                     "no-reply@localhost",
+		MFAIssuer:                    "Todo",
+		AccountDeletionGraceHours:    30 * 24,
+		TrashRetentionDays:           30,
+		IdempotencyKeyTTLHours:       24,
+		EventHistorySize:             1000,
+		EventHeartbeatSec:            15,
+		WebhookMaxAttempts:           8,
+		WebhookDisableAfter:          20,
+		WebhookTimeoutSec:            10,
+		WebhookDeliveryRetentionDays: 30,
+		EventPublisher:               "log",
+		NATSURL:                      "nats://localhost:4222",
+		NATSSubject:                  "todo",
+		OutboxRetentionDays:          7,
+		ImportJobRetentionDays:       30,
+		LoginAttemptStore:            "db",
+		LoginBackoffAfter:            3,
+		LoginLockoutAfter:            10,
+		LoginIPBackoffAfter:          20,
+		LoginIPLockoutAfter:          100,
+		LoginBackoffBaseSec:          1,
+		LoginLockoutMinutes:          15,
+		LoginAttemptWindowMinutes:    60,
+	}
 }
 
 type Service struct {
-	conf *Config
-	db   *db.DB
+	conf   *Config
+	db     *db.DB
+	mailer mail.Mailer
+	guard  *loginGuard
+	sealer *sealer.Sealer
+	broker events.Broker
+	hooks  *webhook.Dispatcher
+	relay  *outbox.Relay
+
+	ipExtractor echo.IPExtractor
+
+	providers map[string]*oidc.Provider
 }
 
 func NewService(c *Config) (*Service, error) {
@@ -29,16 +121,112 @@ func NewService(c *Config) (*Service, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to database: %w", err)
 	}
+	return NewServiceWithDB(c, store)
+}
+
+// NewServiceWithDB creates a service on top of the given stores, which lets tests run it without MySQL.
+func NewServiceWithDB(c *Config, store *db.DB) (*Service, error) {
+	var err error
+
+	mailer := mail.NewLogMailer()
+	if c.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(c.SMTPAddr, c.MailFrom, c.SMTPUser, c.SMTPPassword)
+	}
+
+	var seal *sealer.Sealer
+	if c.MFAEncryptionKey != "" {
+		if seal, err = sealer.New(c.MFAEncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	ipExtractor, err := newIPExtractor(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make(map[string]*oidc.Provider)
+	for _, pc := range c.OIDCProviders {
+		providers[pc.Name] = oidc.NewProvider(pc, nil)
+	}
+
+	var publisher outbox.Publisher
+	switch c.EventPublisher {
+	case "log":
+		publisher = outbox.NewLogPublisher()
+	case "memory":
+		publisher = outbox.NewMemoryPublisher()
+	case "nats":
+		if publisher, err = outbox.NewNATSPublisher(c.NATSURL, c.NATSSubject); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown event publisher: %s", c.EventPublisher)
+	}
+
+	attempts := store.Attempt
+	if c.LoginAttemptStore == "memory" {
+		attempts = db.NewMemoryAttemptStore()
+	}
 
 	return &Service{
-		conf: c,
-		db:   store,
+		conf:   c,
+		db:     store,
+		mailer: mailer,
+		guard:  newLoginGuard(c, attempts, store.AuthEvent),
+		sealer: seal,
+		broker: events.NewMemoryBroker(c.EventHistorySize),
+		hooks: &webhook.Dispatcher{
+			Store:        store.Webhook,
+			Client:       webhook.NewClient(time.Duration(c.WebhookTimeoutSec) * time.Second),
+			MaxAttempts:  c.WebhookMaxAttempts,
+			DisableAfter: c.WebhookDisableAfter,
+			BatchSize:    50,
+		},
+		relay: &outbox.Relay{Store: store.Outbox, Publisher: publisher, BatchSize: 100},
+
+		ipExtractor: ipExtractor,
+		providers:   providers,
 	}, nil
 }
 
-func (s *Service) Run() {
+// newIPExtractor returns how the client address is found behind the given proxies, which are IP
+// addresses or CIDR ranges.
+func newIPExtractor(proxies []string) (echo.IPExtractor, error) {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, p := range proxies {
+		cidr := p
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// Handler returns the routes of the API, without starting the background workers.
+func (s *Service) Handler() *echo.Echo {
 	e := echo.New()
 
+	// Sign-in throttling and audit trails rely on the client address, so headers the client could
+	// set itself are only believed when they come from a trusted proxy.
+	e.IPExtractor = s.ipExtractor
+	if e.IPExtractor == nil {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
 	// Register app (*App) to be injected into all HTTP handlers.
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -49,16 +237,292 @@ func (s *Service) Run() {
 
 	e.POST("/v1/sign_up", signUp)
 	e.POST("/v1/sign_in", signIn)
+	e.POST("/v1/sign_in/mfa", signInMFA)
+	e.POST("/v1/token/refresh", refreshToken)
+	e.POST("/v1/verify_email", verifyEmail)
+	e.GET("/v1/oidc/:provider/login", oidcLogin)
+	e.GET("/v1/oidc/:provider/callback", oidcCallback)
+	e.POST("/v1/oauth/token", oauthToken)
+	e.POST("/v1/oauth/introspect", introspectOAuthToken)
+	e.POST("/v1/oauth/revoke", revokeOAuthToken)
+	e.GET("/v1/feeds/:file", calendarFeed)
+
+	e.Match([]string{http.MethodGet, echo.PROPFIND}, "/.well-known/caldav", wellKnownCalDAV)
+	for _, path := range []string{davPrefix, davPrefix + "/*"} {
+		e.Add(http.MethodOptions, path, davOptions, davAuthorized)
+		e.Add(echo.PROPFIND, path, davPropfind, davAuthorized)
+		e.Add(echo.REPORT, path, davReport, davAuthorized)
+		e.Add(http.MethodGet, path, getDAVObject, davAuthorized)
+		e.Add(http.MethodHead, path, getDAVObject, davAuthorized)
+		e.Add(http.MethodPut, path, putDAVObject, davAuthorized)
+		e.Add(http.MethodDelete, path, deleteDAVObject, davAuthorized)
+	}
 
 	todoGrp := e.Group("")
 	todoGrp.Use(IsAuthorized)
 
-	todoGrp.POST("/v1/todos", createTodo)
-	todoGrp.GET("/v1/todos", listTodos)
+	var (
+		account    = RequireScope(scopeAccount)
+		profile    = RequireScope(scopeProfile)
+		todosRead  = RequireScope(scopeTodosRead)
+		todosWrite = RequireScope(scopeTodosWrite)
+	)
+
+	todoGrp.POST("/v1/sign_out", signOut, account)
+
+	// Registered outside the group, since the access token may have to be taken from the query first.
+	e.GET("/v1/events", streamEvents, tokenFromQuery, IsAuthorized, todosRead, RequireOrg)
+
+	todoGrp.GET("/v1/me", getProfile, profile)
+	todoGrp.PATCH("/v1/me", updateProfile, account)
+	todoGrp.DELETE("/v1/me", deleteAccount, account)
+	todoGrp.POST("/v1/me/restore", restoreAccount, account)
+	todoGrp.POST("/v1/me/password", changePassword, account)
+	todoGrp.POST("/v1/me/email", changeEmail, account)
+	todoGrp.POST("/v1/me/mfa/enroll", enrollMFA, account)
+	todoGrp.POST("/v1/me/mfa/confirm", confirmMFA, account)
+	todoGrp.POST("/v1/me/mfa/disable", disableMFA, account)
+	todoGrp.GET("/v1/me/apps", listAuthorizedApps, account)
+	todoGrp.GET("/v1/me/tokens", listPersonalTokens, account)
+	todoGrp.POST("/v1/me/tokens", createPersonalToken, account, Idempotent)
+	todoGrp.DELETE("/v1/me/tokens/:id", deletePersonalToken, account)
+	todoGrp.DELETE("/v1/me/apps/:client_id", revokeAuthorizedApp, account)
+
+	todoGrp.POST("/v1/oauth/clients", createOAuthClient, account, Idempotent)
+	todoGrp.GET("/v1/oauth/clients", listOAuthClients, account)
+	todoGrp.DELETE("/v1/oauth/clients/:client_id", deleteOAuthClient, account)
+	todoGrp.GET("/v1/oauth/authorize", getOAuthConsent, account)
+	todoGrp.POST("/v1/oauth/authorize", authorizeOAuth, account)
+
+	todoGrp.POST("/v1/webhooks", createWebhook, account, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/webhooks", listWebhooks, account, RequireOrg)
+	todoGrp.GET("/v1/webhooks/:id", getWebhook, account, RequireOrg)
+	todoGrp.PUT("/v1/webhooks/:id", updateWebhook, account, RequireOrg)
+	todoGrp.DELETE("/v1/webhooks/:id", deleteWebhook, account, RequireOrg)
+	todoGrp.GET("/v1/webhooks/:id/deliveries", listWebhookDeliveries, account, RequireOrg)
+	todoGrp.GET("/v1/webhooks/:id/deliveries/:delivery_id", getWebhookDelivery, account, RequireOrg)
+	todoGrp.POST("/v1/webhooks/:id/deliveries/:delivery_id/redeliver", redeliverWebhook, account, RequireOrg, Idempotent)
+
+	todoGrp.POST("/v1/orgs", createOrg, account, Idempotent)
+	todoGrp.GET("/v1/orgs", listOrgs, account)
+	todoGrp.GET("/v1/orgs/:id", getOrg, account)
+	todoGrp.PUT("/v1/orgs/:id/settings", updateOrgSettings, account)
+	todoGrp.POST("/v1/orgs/:id/switch", switchOrg, account)
+	todoGrp.GET("/v1/orgs/:id/members", listOrgMembers, account)
+	todoGrp.PUT("/v1/orgs/:id/members/:user_id", setOrgMemberRole, account)
+	todoGrp.DELETE("/v1/orgs/:id/members/:user_id", removeOrgMember, account)
+	todoGrp.POST("/v1/orgs/:id/invitations", inviteToOrg, account, Idempotent)
+	todoGrp.POST("/v1/invitations/accept", acceptInvitation, account, Idempotent)
+
+	todoGrp.GET("/v1/projects", listProjects, todosRead, RequireOrg)
+	todoGrp.POST("/v1/projects", createProject, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/projects/:id", getProject, todosRead, RequireOrg)
+	todoGrp.PUT("/v1/projects/:id", renameProject, todosWrite, RequireOrg)
+	todoGrp.DELETE("/v1/projects/:id", deleteProject, todosWrite, RequireOrg)
+
+	todoGrp.GET("/v1/views", listViews, todosRead, RequireOrg)
+	todoGrp.POST("/v1/views", createView, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/views/:id", getView, todosRead, RequireOrg)
+	todoGrp.PUT("/v1/views/:id", updateView, todosWrite, RequireOrg)
+	todoGrp.DELETE("/v1/views/:id", deleteView, todosWrite, RequireOrg)
+	todoGrp.GET("/v1/views/:id/todos", listViewTodos, todosRead, RequireOrg)
+
+	todoGrp.POST("/v1/todos", createTodo, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/todos", listTodos, todosRead, RequireOrg)
+	todoGrp.GET("/v1/todos/search", searchTodos, todosRead, RequireOrg)
+	todoGrp.POST("/v1/todos\\:batch", batchTodos, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/export", exportTodos, todosRead, RequireOrg)
+	todoGrp.POST("/v1/import", importTodos, todosWrite, RequireOrg, Idempotent)
+	todoGrp.POST("/v1/imports", createImportJob, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/imports", listImportJobs, todosRead, RequireOrg)
+	todoGrp.GET("/v1/imports/:id", getImportJob, todosRead, RequireOrg)
+	todoGrp.POST("/v1/todos\\:bulk", bulkTodos, todosWrite, RequireOrg, Idempotent)
+
+	todoGrp.GET("/v1/todos/:id", getTodo, todosRead, RequireOrg)
+	todoGrp.PUT("/v1/todos/:id", updateTodo, todosWrite, RequireOrg)
+	todoGrp.PATCH("/v1/todos/:id", updateTodo, todosWrite, RequireOrg)
+	todoGrp.DELETE("/v1/todos/:id", deleteTodo, todosWrite, RequireOrg)
+	todoGrp.POST("/v1/todos/:id/move", moveTodo, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/todos/:id/history", getTodoHistory, todosRead, RequireOrg)
+	todoGrp.GET("/v1/activity", listActivity, todosRead, RequireOrg)
+	todoGrp.GET("/v1/sync", getSync, todosRead, RequireOrg)
+	todoGrp.POST("/v1/sync", pushSync, todosWrite, RequireOrg, Idempotent)
+	todoGrp.GET("/v1/feed", getFeed, account, RequireOrg)
+	todoGrp.POST("/v1/feed", rotateFeed, account, RequireOrg, Idempotent)
+	todoGrp.DELETE("/v1/feed", revokeFeed, account, RequireOrg)
 
-	todoGrp.GET("/v1/todos/:id", getTodo)
-	todoGrp.PUT("/v1/todos/:id", updateTodo)
-	todoGrp.DELETE("/v1/todos/:id", deleteTodo)
+	todoGrp.GET("/v1/trash", listTrash, todosRead, RequireOrg)
+	todoGrp.POST("/v1/trash/:id/restore", restoreTodo, todosWrite, RequireOrg, Idempotent)
+	todoGrp.DELETE("/v1/trash/:id", purgeTodo, todosWrite, RequireOrg)
+
+	var (
+		support = RequireRole(pkg.RoleSupport)
+		admin   = RequireRole(pkg.RoleAdmin)
+	)
+
+	adminGrp := e.Group("/v1/admin")
+	adminGrp.Use(IsAuthorized, RequireScope(scopeAccount))
+
+	adminGrp.GET("/users", listUsers, audited("user.list"), support)
+	adminGrp.GET("/users/:id", getUser, audited("user.view"), support)
+	adminGrp.GET("/users/:id/todo_counts", getUserTodoCounts, audited("user.todo_counts"), support)
+	adminGrp.POST("/users/:id/sign_out", forceSignOut, audited("user.sign_out"), support)
+	adminGrp.POST("/users/:id/disable", setUserDisabled(true), audited("user.disable"), admin)
+	adminGrp.POST("/users/:id/enable", setUserDisabled(false), audited("user.enable"), admin)
+	adminGrp.POST("/users/:id/reset_mfa", resetUserMFA, audited("user.reset_mfa"), admin)
+	adminGrp.PUT("/users/:id/role", setUserRole, audited("user.set_role"), admin)
+	adminGrp.POST("/unlock", unlockSignIn, audited("sign_in.unlock"), support)
+	adminGrp.GET("/audit", listAdminActions, admin)
+
+	return e
+}
+
+func (s *Service) Run() {
+	e := s.Handler()
+
+	go s.purgeDeletedAccounts(time.Hour)
+	go s.purgeTrash(time.Hour)
+	go s.purgeIdempotencyKeys(time.Hour)
+	go s.rebalancePositions(time.Hour)
+	go s.deliverWebhooks(5 * time.Second)
+	go s.purgeWebhookDeliveries(time.Hour)
+	go s.relayOutbox(time.Second)
+	go s.purgeOutbox(time.Hour)
+	go s.runImportJobs(2 * time.Second)
+	go s.purgeImportJobs(time.Hour)
 
 	e.Logger.Fatal(e.Start(s.conf.ListenAddr))
 }
+
+// purgeDeletedAccounts periodically removes accounts whose deletion grace period has passed.
+func (s *Service) purgeDeletedAccounts(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := s.db.User.PurgeDeletedUsers(time.Now())
+		if err != nil {
+			log.Println("could not purge deleted accounts: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d deleted account(s)", n)
+		}
+	}
+}
+
+// purgeTrash periodically deletes todos that have been in the trash for longer than the retention period.
+func (s *Service) purgeTrash(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	retention := time.Duration(s.conf.TrashRetentionDays) * 24 * time.Hour
+
+	for range ticker.C {
+		n, err := s.db.Todo.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("could not purge trash: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d trashed todo(s)", n)
+		}
+	}
+}
+
+// rebalancePositionLen is the length of positions beyond which the rebalancing job respaces a list.
+const rebalancePositionLen = 16
+
+// rebalancePositions periodically gives short positions to the lists whose positions have grown long
+// through moves, before they hit the limit that makes a move rebalance the list itself.
+func (s *Service) rebalancePositions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := s.db.Todo.RebalancePositions(rebalancePositionLen)
+		if err != nil {
+			log.Println("could not rebalance positions: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("rebalanced %d list(s)", n)
+		}
+	}
+}
+
+// deliverWebhooks periodically sends the webhook deliveries that are due.
+func (s *Service) deliverWebhooks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Keep going while full batches come back, so that a backlog drains quickly.
+		for {
+			n, err := s.hooks.Dispatch(context.Background())
+			if err != nil {
+				log.Println("could not deliver webhooks: ", err)
+			}
+			if err != nil || n < s.hooks.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// purgeWebhookDeliveries periodically deletes finished webhook deliveries older than the retention period.
+func (s *Service) purgeWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	retention := time.Duration(s.conf.WebhookDeliveryRetentionDays) * 24 * time.Hour
+
+	for range ticker.C {
+		n, err := s.db.Webhook.PurgeDeliveries(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("could not purge webhook deliveries: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d webhook deliveries", n)
+		}
+	}
+}
+
+// relayOutbox periodically publishes the domain events written to the outbox.
+func (s *Service) relayOutbox(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Keep going while full batches come back, so that a backlog drains quickly.
+		for {
+			n, err := s.relay.RelayOnce(context.Background())
+			if err != nil {
+				log.Println("could not relay events: ", err)
+			}
+			if err != nil || n < s.relay.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// purgeOutbox periodically deletes published events older than the retention period.
+func (s *Service) purgeOutbox(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	retention := time.Duration(s.conf.OutboxRetentionDays) * 24 * time.Hour
+
+	for range ticker.C {
+		n, err := s.db.Outbox.PurgeOutbox(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("could not purge outbox: ", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d published event(s)", n)
+		}
+	}
+}
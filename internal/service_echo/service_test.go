@@ -0,0 +1,109 @@
+package service_echo
+
+import (
+	"errors"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveAs runs h for a request to target, routed as route, as the caller described by sc. A body is
+// sent as JSON.
+func serveAs(s *Service, sc *SecurityContext, h echo.HandlerFunc, method, route, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	return serveRequest(s, sc, h, route, req)
+}
+
+// serveRequest runs h for req, routed as route, as the caller described by sc.
+func serveRequest(s *Service, sc *SecurityContext, h echo.HandlerFunc, route string, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Add(req.Method, route, h, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("service", s)
+			if sc != nil {
+				c.Set("security_context", sc)
+			}
+			return next(c)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// memoryMailer keeps the messages it is asked to send.
+type memoryMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+type sentMail struct {
+	to, subject, body string
+}
+
+func (mm *memoryMailer) Send(to, subject, body string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.sent = append(mm.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (mm *memoryMailer) last() sentMail {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if len(mm.sent) == 0 {
+		return sentMail{}
+	}
+	return mm.sent[len(mm.sent)-1]
+}
+
+// purgeStore hands the cutoffs of PurgeTrash to the test, which blocks the job in between. The first
+// call fails.
+type purgeStore struct {
+	db.TodoDB
+	calls chan time.Time
+	n     int
+}
+
+func (ps *purgeStore) PurgeTrash(before time.Time) (int64, error) {
+	ps.calls <- before
+
+	if ps.n++; ps.n == 1 {
+		return 0, errors.New("connection lost")
+	}
+	return 2, nil
+}
+
+func Test_PurgeTrash(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		store = &purgeStore{calls: make(chan time.Time)}
+		s     = &Service{conf: NewConfig(), db: &db.DB{Todo: store}}
+	)
+	s.conf.TrashRetentionDays = 7
+
+	go s.purgeTrash(time.Millisecond)
+
+	// Failures do not stop the job.
+	for i := 0; i < 2; i++ {
+		select {
+		case before := <-store.calls:
+			assert.WithinDuration(time.Now().Add(-7*24*time.Hour), before, time.Minute)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the trash was not purged")
+		}
+	}
+}
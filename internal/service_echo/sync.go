@@ -0,0 +1,181 @@
+package service_echo
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// syncSettle is how long a change may take to commit after its activity id was assigned. Sync tokens
+	// stay behind younger changes, which are sent again.
+	syncSettle = 5 * time.Second
+
+	syncPageSize    = 500
+	syncTokenPrefix = "s1."
+)
+
+// encodeSyncToken wraps a cursor into the version-tagged token clients treat as opaque.
+func encodeSyncToken(cursor int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(cursor, 10)))
+}
+
+func decodeSyncToken(token string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(raw), syncTokenPrefix) {
+		return 0, fmt.Errorf("invalid sync token given %s", token)
+	}
+
+	cursor, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncTokenPrefix), 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, fmt.Errorf("invalid sync token given %s", token)
+	}
+	return cursor, nil
+}
+
+// getSync returns the changes since the token in since, or every todo if there is none.
+func getSync(c echo.Context) error {
+	var (
+		s       = c.Get("service").(*Service)
+		sc      = c.Get("security_context").(*SecurityContext)
+		settled = time.Now().Add(-syncSettle)
+	)
+
+	since := c.QueryParam("since")
+
+	if since == "" {
+		todos, cursor, err := s.db.Sync.SyncSnapshot(sc.OrgID, sc.UserID, settled)
+		if err != nil {
+			return err
+		}
+
+		changes := make([]pkg.SyncChange, 0, len(todos))
+		for i := range todos {
+			changes = append(changes, pkg.SyncChange{Op: pkg.SyncUpsert, ID: todos[i].Id, ClientUID: todos[i].ClientUID, Todo: &todos[i]})
+		}
+		return c.JSON(http.StatusOK, &pkg.SyncResponse{Changes: changes, Token: encodeSyncToken(cursor)})
+	}
+
+	cursor, err := decodeSyncToken(since)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	page, err := s.db.Sync.SyncChanges(sc.OrgID, sc.UserID, cursor, syncPageSize, settled)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, &pkg.SyncResponse{Changes: page.Changes, Token: encodeSyncToken(page.Cursor), HasMore: page.More})
+}
+
+// checkSyncMutation validates a mutation against the settings of the organization.
+func checkSyncMutation(s *Service, org *pkg.Org, m *pkg.SyncMutation) (*db.SyncMutation, error) {
+	if err := m.Validate(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var (
+		categories = org.Settings.CategoryList()
+		dm         = &db.SyncMutation{Delete: m.Op == pkg.SyncDelete, TodoID: m.ID, ClientUID: m.ClientUID, DefaultCategory: categories[0]}
+		err        error
+	)
+
+	if m.Base != "" {
+		if dm.Base, err = decodeSyncToken(m.Base); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if dm.Delete {
+		return dm, nil
+	}
+
+	if dm.Values, err = m.Values(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if v, ok := dm.Values["category"].(string); ok && !util.Contains(categories, v) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown category value: %s", v))
+	}
+
+	if v, ok := dm.Values["recurrence"].(string); ok {
+		if dm.Values["recurrence"], err = ical.ParseRecurrence(v); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if v, ok := dm.Values["project_id"].(int64); ok {
+		if err = checkProject(s, org.ID, &v); err != nil {
+			return nil, err
+		}
+	}
+	return dm, nil
+}
+
+// syncResult reports a mutation that failed.
+func syncResult(m *pkg.SyncMutation, err error) pkg.SyncResult {
+	br := batchResult(m.ID, 0, err)
+	return pkg.SyncResult{ID: m.ID, ClientUID: m.ClientUID, Status: br.Status, Error: br.Error}
+}
+
+// pushSync applies the mutations of an offline client in order, each on its own, and reports a result
+// with the conflicts for each.
+func pushSync(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.SyncRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	// Changes made by this push don't conflict with its later mutations.
+	before, err := s.db.Sync.LatestActivityID(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	results := make([]pkg.SyncResult, len(req.Mutations))
+
+	for i := range req.Mutations {
+		m := &req.Mutations[i]
+
+		dm, err := checkSyncMutation(s, org, m)
+		if err != nil {
+			results[i] = syncResult(m, err)
+			continue
+		}
+		dm.Before = before
+
+		o, err := s.db.Sync.ApplySyncMutation(sc.OrgID, sc.UserID, dm, sc.Actor())
+		if err != nil {
+			results[i] = syncResult(m, err)
+			continue
+		}
+
+		results[i] = o.Result
+		if o.Event != "" {
+			publishTodo(s, sc, o.Event, o.Result.ID)
+		}
+	}
+	return c.JSON(http.StatusOK, &pkg.SyncPushResponse{Results: results})
+}
@@ -0,0 +1,79 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_SyncToken(t *testing.T) {
+	assert := asserts.New(t)
+
+	for _, cursor := range []int64{0, 1, 1 << 40} {
+		got, err := decodeSyncToken(encodeSyncToken(cursor))
+		assert.NoError(err)
+		assert.Equal(cursor, got)
+	}
+
+	for _, token := range []string{"", "42", "czEuLTE", "eDEuMQ", "!!"} {
+		_, err := decodeSyncToken(token)
+		assert.Error(err, token)
+	}
+}
+
+func Test_CheckSyncMutation(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		s   = &Service{conf: NewConfig()}
+		org = &pkg.Org{ID: 1}
+	)
+
+	m := &pkg.SyncMutation{
+		Op:        pkg.SyncUpsert,
+		ClientUID: "c1",
+		Base:      encodeSyncToken(7),
+		Fields: map[string]json.RawMessage{
+			"task":       json.RawMessage(`"Buy milk"`),
+			"priority":   json.RawMessage(`"HIGH"`),
+			"done":       json.RawMessage(`true`),
+			"project_id": json.RawMessage(`null`),
+			"due_at":     json.RawMessage(`"2026-03-01T10:00:00.5+01:00"`),
+		},
+	}
+
+	dm, err := checkSyncMutation(s, org, m)
+	if assert.NoError(err) {
+		assert.Equal(int64(7), dm.Base)
+		assert.Equal(org.Settings.CategoryList()[0], dm.DefaultCategory)
+		assert.Equal(map[string]interface{}{
+			"task":       "Buy milk",
+			"priority":   "high",
+			"done":       true,
+			"project_id": nil,
+			"due_at":     "2026-03-01T09:00:00Z",
+		}, dm.Values)
+	}
+
+	dm, err = checkSyncMutation(s, org, &pkg.SyncMutation{Op: pkg.SyncDelete, ID: 3})
+	if assert.NoError(err) {
+		assert.True(dm.Delete)
+		assert.Equal(int64(3), dm.TodoID)
+	}
+
+	for _, m := range []*pkg.SyncMutation{
+		{Op: "move", ID: 1},
+		{Op: pkg.SyncDelete},
+		{Op: pkg.SyncUpsert, ID: 1},
+		{Op: pkg.SyncUpsert, ID: 1, Fields: map[string]json.RawMessage{"owner": json.RawMessage(`1`)}},
+		{Op: pkg.SyncUpsert, ID: 1, Fields: map[string]json.RawMessage{"task": json.RawMessage(`""`)}},
+		{Op: pkg.SyncUpsert, ID: 1, Fields: map[string]json.RawMessage{"priority": json.RawMessage(`"urgent"`)}},
+		{Op: pkg.SyncUpsert, ID: 1, Fields: map[string]json.RawMessage{"category": json.RawMessage(`"chores"`)}},
+		{Op: pkg.SyncUpsert, ID: 1, Fields: map[string]json.RawMessage{"project_id": json.RawMessage(`-1`)}},
+		{Op: pkg.SyncDelete, ID: 1, Base: "bogus"},
+	} {
+		_, err = checkSyncMutation(s, org, m)
+		assert.Error(err, m)
+	}
+}
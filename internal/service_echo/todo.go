@@ -2,10 +2,14 @@ package service_echo
 
 import (
 	"fmt"
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/internal/util"
 	"github.com/harsha-aqfer/todo/pkg"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func getID(c echo.Context) (int64, error) {
@@ -17,6 +21,50 @@ func getID(c echo.Context) (int64, error) {
 	return id, nil
 }
 
+// checkProject rejects project ids that do not belong to the organization.
+func checkProject(s *Service, orgID int64, projectID *int64) error {
+	if projectID == nil {
+		return nil
+	}
+
+	if _, err := s.db.Project.GetProject(orgID, *projectID); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid project id given %d", *projectID))
+	}
+	return nil
+}
+
+// checkTodoRequest validates a todo against the settings of the organization. Creating a todo takes
+// a complete request, updates only check the fields that are set.
+func checkTodoRequest(s *Service, org *pkg.Org, req *pkg.TodoRequest, create bool) error {
+	categories := org.Settings.CategoryList()
+
+	if create {
+		if req.Category == "" {
+			req.Category = categories[0]
+		}
+
+		if err := req.ValidateCategories(categories); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	} else if req.Category != "" {
+		category := req.Category
+		req.Category = strings.ToLower(req.Category)
+
+		if !util.Contains(categories, req.Category) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown category value: %s", category))
+		}
+	}
+
+	if req.Recurrence != nil && *req.Recurrence != "" {
+		rule, err := ical.ParseRecurrence(*req.Recurrence)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		req.Recurrence = &rule
+	}
+	return checkProject(s, org.ID, req.ProjectID)
+}
+
 func createTodo(c echo.Context) error {
 	var (
 		s  = c.Get("service").(*Service)
@@ -28,14 +76,27 @@ func createTodo(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	if err := req.Validate(); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
 	}
 
-	if err := s.db.Todo.CreateTodo(sc.UserID, &req); err != nil {
+	if err = checkTodoRequest(s, org, &req, true); err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, nil)
+
+	todoID, err := s.db.Todo.CreateTodo(sc.OrgID, sc.UserID, &req, sc.Actor())
+	if err != nil {
+		return err
+	}
+
+	publishTodo(s, sc, pkg.EventTodoCreated, todoID)
+
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, todo)
 }
 
 func getTodo(c echo.Context) error {
@@ -49,13 +110,35 @@ func getTodo(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	todo, err := s.db.Todo.GetTodo(sc.UserID, todoID)
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
 	if err != nil {
 		return err
 	}
+
+	if todo != nil {
+		c.Response().Header().Set("ETag", todoETag(todo.Revision))
+
+		if notModified(c, todo.Revision) {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
 	return c.JSON(http.StatusOK, todo)
 }
 
+// currentRevision returns a lookup of the todo's current revision for ifMatchRevision.
+func currentRevision(s *Service, sc *SecurityContext, todoID int64) func() (int64, error) {
+	return func() (int64, error) {
+		todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+		if err != nil {
+			return 0, err
+		}
+		if todo == nil {
+			return 0, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+		}
+		return todo.Revision, nil
+	}
+}
+
 func listTodos(c echo.Context) error {
 	var (
 		s   = c.Get("service").(*Service)
@@ -63,7 +146,16 @@ func listTodos(c echo.Context) error {
 		all = c.QueryParam("all") == "true"
 	)
 
-	todos, err := s.db.Todo.ListTodos(sc.UserID, all)
+	// Lists keep the order users gave them unless asked otherwise.
+	sort := search.SortPosition
+	if c.QueryParam("sort") != "" {
+		var err error
+		if sort, err = search.ParseSort(c.QueryParam("sort")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	todos, err := s.db.Todo.ListTodos(sc.OrgID, sc.UserID, all, sort)
 	if err != nil {
 		return err
 	}
@@ -90,12 +182,84 @@ func updateTodo(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "empty body is not supported")
 	}
 
-	if err = s.db.Todo.UpdateTodo(sc.UserID, todoID, &req); err != nil {
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	if err = checkTodoRequest(s, org, &req, false); err != nil {
+		return err
+	}
+
+	revision, err := ifMatchRevision(c, currentRevision(s, sc, todoID))
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Todo.UpdateTodo(sc.OrgID, sc.UserID, todoID, revision, &req, sc.Actor()); err != nil {
+		return err
+	}
+
+	if req.Done {
+		publishTodo(s, sc, pkg.EventTodoCompleted, todoID)
+	} else {
+		publishTodo(s, sc, pkg.EventTodoUpdated, todoID)
+	}
+
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+	if err != nil {
 		return err
 	}
+	if todo != nil {
+		c.Response().Header().Set("ETag", todoETag(todo.Revision))
+	}
 	return c.JSON(http.StatusOK, nil)
 }
 
+// moveTodo places a todo between two others of a list, given by the before and after anchors.
+func moveTodo(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	todoID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var req pkg.MoveRequest
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	revision, err := ifMatchRevision(c, currentRevision(s, sc, todoID))
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Todo.MoveTodo(sc.OrgID, sc.UserID, todoID, revision, &req, sc.Actor()); err != nil {
+		return err
+	}
+
+	publishTodo(s, sc, pkg.EventTodoUpdated, todoID)
+
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+	if err != nil {
+		return err
+	}
+	if todo == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	}
+
+	c.Response().Header().Set("ETag", todoETag(todo.Revision))
+	return c.JSON(http.StatusOK, todo)
+}
+
 func deleteTodo(c echo.Context) error {
 	var (
 		s  = c.Get("service").(*Service)
@@ -107,8 +271,139 @@ func deleteTodo(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	if err = s.db.Todo.DeleteTodo(sc.UserID, todoID); err != nil {
+	revision, err := ifMatchRevision(c, currentRevision(s, sc, todoID))
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.Todo.DeleteTodo(sc.OrgID, sc.UserID, todoID, revision, sc.Actor()); err != nil {
+		return err
+	}
+
+	publishTodo(s, sc, pkg.EventTodoDeleted, todoID)
+	return c.JSON(http.StatusOK, nil)
+}
+
+func getTodoHistory(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	todoID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	history, err := s.db.Activity.ListTodoHistory(sc.OrgID, sc.UserID, todoID, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+func listActivity(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	activity, err := s.db.Activity.ListActivity(sc.OrgID, sc.UserID, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, activity)
+}
+
+func listTrash(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	todos, err := s.db.Todo.ListTrash(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, todos)
+}
+
+func restoreTodo(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	todoID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Todo.RestoreTodo(sc.OrgID, sc.UserID, todoID, sc.Actor()); err != nil {
+		return err
+	}
+
+	// To streams, a restored todo is a new one.
+	publishTodo(s, sc, pkg.EventTodoCreated, todoID)
+
+	todo, err := s.db.Todo.GetTodo(sc.OrgID, sc.UserID, todoID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, todo)
+}
+
+func purgeTodo(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	todoID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Todo.PurgeTodo(sc.OrgID, sc.UserID, todoID, sc.Actor()); err != nil {
 		return err
 	}
 	return c.JSON(http.StatusOK, nil)
 }
+
+func searchTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	q, err := search.Parse(c.QueryParam("q"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	sort, err := search.ParseSort(c.QueryParam("sort"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	todos, err := s.db.Todo.SearchTodos(sc.OrgID, sc.UserID, q, sort, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, todos)
+}
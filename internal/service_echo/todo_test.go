@@ -0,0 +1,398 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTodo is a stored todo with the organization and user it belongs to.
+type memoryTodo struct {
+	orgID, userID int64
+	pkg.TodoResponse
+}
+
+// memoryTodoStore keeps todos like the MySQL store does, including the unique tasks of live todos and
+// the rollback of failed transactions.
+type memoryTodoStore struct {
+	db.TodoDB
+	mu     sync.Mutex
+	todos  map[int64]*memoryTodo
+	nextID int64
+}
+
+func newMemoryTodoStore() *memoryTodoStore {
+	return &memoryTodoStore{todos: map[int64]*memoryTodo{}}
+}
+
+// add stores a todo as it is, for tests to start from.
+func (ms *memoryTodoStore) add(orgID, userID int64, t pkg.TodoResponse) int64 {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.nextID++
+	t.Id = ms.nextID
+	if t.Revision == 0 {
+		t.Revision = 1
+	}
+	ms.todos[t.Id] = &memoryTodo{orgID: orgID, userID: userID, TodoResponse: t}
+	return t.Id
+}
+
+// get returns a copy of the todo, live or trashed, for tests to inspect.
+func (ms *memoryTodoStore) get(todoID int64) *pkg.TodoResponse {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, ok := ms.todos[todoID]
+	if !ok {
+		return nil
+	}
+	c := t.TodoResponse
+	return &c
+}
+
+func (ms *memoryTodoStore) find(orgID, userID, todoID int64, trashed bool) (*memoryTodo, error) {
+	t, ok := ms.todos[todoID]
+	if !ok || t.orgID != orgID || t.userID != userID || (t.DeletedAt != nil) != trashed {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	}
+	return t, nil
+}
+
+func (ms *memoryTodoStore) checkTask(orgID, userID, todoID int64, task string) error {
+	for _, o := range ms.todos {
+		if o.orgID == orgID && o.userID == userID && o.Id != todoID && o.DeletedAt == nil && o.Task == task {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", task))
+		}
+	}
+	return nil
+}
+
+func checkMemoryRevision(t *memoryTodo, revision int64) error {
+	if revision != 0 && t.Revision != revision {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Sprintf("todo %d has been modified, its revision is %d", t.Id, t.Revision))
+	}
+	return nil
+}
+
+// memoryTodoTx runs mutations on the store, whose lock the caller holds.
+type memoryTodoTx struct {
+	ms *memoryTodoStore
+}
+
+func (tx memoryTodoTx) CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, _ *pkg.Actor) (int64, error) {
+	ms := tx.ms
+	if err := ms.checkTask(orgID, userID, 0, tr.Task); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	ms.nextID++
+	t := &memoryTodo{orgID: orgID, userID: userID, TodoResponse: pkg.TodoResponse{
+		Id:        ms.nextID,
+		Task:      tr.Task,
+		Category:  tr.Category,
+		Priority:  tr.Priority,
+		ProjectID: tr.ProjectID,
+		DueAt:     tr.DueAt,
+		Revision:  1,
+		CreatedAt: &now,
+	}}
+	if tr.Recurrence != nil {
+		t.Recurrence = *tr.Recurrence
+	}
+	ms.todos[t.Id] = t
+	return t.Id, nil
+}
+
+func (tx memoryTodoTx) UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, _ *pkg.Actor) error {
+	ms := tx.ms
+	t, err := ms.find(orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+	if err = checkMemoryRevision(t, revision); err != nil {
+		return err
+	}
+	if tr.Task != "" {
+		if err = ms.checkTask(orgID, userID, todoID, tr.Task); err != nil {
+			return err
+		}
+		t.Task = tr.Task
+	}
+	if tr.Category != "" {
+		t.Category = tr.Category
+	}
+	if tr.Priority != "" {
+		t.Priority = tr.Priority
+	}
+	if tr.ProjectID != nil {
+		t.ProjectID = tr.ProjectID
+	}
+	if tr.DueAt != nil {
+		t.DueAt = tr.DueAt
+	}
+	if tr.Recurrence != nil {
+		t.Recurrence = *tr.Recurrence
+	}
+	if tr.Done {
+		now := time.Now().UTC()
+		t.CompletedAt = &now
+	}
+	t.Revision++
+	return nil
+}
+
+func (tx memoryTodoTx) ReplaceTodo(orgID, userID, todoID int64, tr *pkg.TodoRequest, _ *pkg.Actor) error {
+	ms := tx.ms
+	t, err := ms.find(orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+	if err = ms.checkTask(orgID, userID, todoID, tr.Task); err != nil {
+		return err
+	}
+	t.Task, t.Category, t.Priority, t.ProjectID, t.DueAt, t.Recurrence = tr.Task, tr.Category, tr.Priority, tr.ProjectID, tr.DueAt, ""
+	if tr.Recurrence != nil {
+		t.Recurrence = *tr.Recurrence
+	}
+	if !tr.Done {
+		t.CompletedAt = nil
+	} else if t.CompletedAt == nil {
+		now := time.Now().UTC()
+		t.CompletedAt = &now
+	}
+	t.Revision++
+	return nil
+}
+
+func (tx memoryTodoTx) DeleteTodo(orgID, userID, todoID, revision int64, _ *pkg.Actor) error {
+	t, err := tx.ms.find(orgID, userID, todoID, false)
+	if err != nil {
+		return err
+	}
+	if err = checkMemoryRevision(t, revision); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	t.DeletedAt = &now
+	t.Revision++
+	return nil
+}
+
+// InTx runs fn on the store and puts every todo back as it was if fn fails.
+func (ms *memoryTodoStore) InTx(fn func(t db.TodoTx) error) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	saved, nextID := make(map[int64]memoryTodo, len(ms.todos)), ms.nextID
+	for id, t := range ms.todos {
+		saved[id] = *t
+	}
+
+	if err := fn(memoryTodoTx{ms: ms}); err != nil {
+		ms.todos, ms.nextID = make(map[int64]*memoryTodo, len(saved)), nextID
+		for id := range saved {
+			t := saved[id]
+			ms.todos[id] = &t
+		}
+		return err
+	}
+	return nil
+}
+
+func (ms *memoryTodoStore) CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, actor *pkg.Actor) (todoID int64, err error) {
+	err = ms.InTx(func(t db.TodoTx) error {
+		todoID, err = t.CreateTodo(orgID, userID, tr, actor)
+		return err
+	})
+	return todoID, err
+}
+
+func (ms *memoryTodoStore) UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, actor *pkg.Actor) error {
+	return ms.InTx(func(t db.TodoTx) error {
+		return t.UpdateTodo(orgID, userID, todoID, revision, tr, actor)
+	})
+}
+
+func (ms *memoryTodoStore) DeleteTodo(orgID, userID, todoID, revision int64, actor *pkg.Actor) error {
+	return ms.InTx(func(t db.TodoTx) error {
+		return t.DeleteTodo(orgID, userID, todoID, revision, actor)
+	})
+}
+
+func (ms *memoryTodoStore) GetTodo(orgID, userID, todoID int64) (*pkg.TodoResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, err := ms.find(orgID, userID, todoID, false)
+	if err != nil {
+		return nil, nil
+	}
+	c := t.TodoResponse
+	return &c, nil
+}
+
+// list returns copies of the todos of the user, in order of their ids.
+func (ms *memoryTodoStore) list(orgID, userID int64, keep func(t *memoryTodo) bool) []pkg.TodoResponse {
+	todos := make([]pkg.TodoResponse, 0)
+	for _, t := range ms.todos {
+		if t.orgID == orgID && t.userID == userID && keep(t) {
+			todos = append(todos, t.TodoResponse)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].Id < todos[j].Id })
+	return todos
+}
+
+func (ms *memoryTodoStore) ListTodos(orgID, userID int64, all bool, _ search.Sort) ([]pkg.TodoResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.list(orgID, userID, func(t *memoryTodo) bool {
+		return t.DeletedAt == nil && (all || t.CompletedAt == nil)
+	}), nil
+}
+
+func (ms *memoryTodoStore) ListTrash(orgID, userID int64) ([]pkg.TodoResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.list(orgID, userID, func(t *memoryTodo) bool { return t.DeletedAt != nil }), nil
+}
+
+func (ms *memoryTodoStore) RestoreTodo(orgID, userID, todoID int64, _ *pkg.Actor) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, err := ms.find(orgID, userID, todoID, true)
+	if err != nil {
+		return err
+	}
+	if ms.checkTask(orgID, userID, todoID, t.Task) != nil {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("a todo with the task %q already exists", t.Task))
+	}
+	t.DeletedAt = nil
+	t.Revision++
+	return nil
+}
+
+func (ms *memoryTodoStore) PurgeTodo(orgID, userID, todoID int64, _ *pkg.Actor) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := ms.find(orgID, userID, todoID, true); err != nil {
+		return err
+	}
+	delete(ms.todos, todoID)
+	return nil
+}
+
+// taskNames returns the tasks of todos, for short comparisons.
+func taskNames(todos []pkg.TodoResponse) string {
+	tasks := make([]string, 0, len(todos))
+	for _, t := range todos {
+		tasks = append(tasks, t.Task)
+	}
+	return strings.Join(tasks, ", ")
+}
+
+func Test_Trash(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+	)
+
+	list := func(target string) string {
+		var todos []pkg.TodoResponse
+		rec := ot.call("ann", 1, http.MethodGet, target, "")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &todos))
+		return taskNames(todos)
+	}
+
+	oldID := ot.todos.add(1, 1, pkg.TodoResponse{Task: "water plants", Priority: "low"})
+	ot.todos.add(1, 1, pkg.TodoResponse{Task: "pay rent", Priority: "high"})
+
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodDelete, fmt.Sprintf("/v1/todos/%d", oldID), "").Code)
+	assert.Equal("pay rent", list("/v1/todos"))
+	assert.Equal("water plants", list("/v1/trash"))
+
+	// The task of a trashed todo is free to be used again, which keeps the trashed one from coming back.
+	rec := ot.call("ann", 1, http.MethodPost, "/v1/todos", `{"task":"water plants","priority":"medium"}`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	// Creates respond with the todo.
+	var created pkg.TodoResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotZero(created.Id)
+	assert.Equal("water plants", created.Task)
+	assert.Equal("medium", created.Priority)
+	assert.Equal(int64(1), created.Revision)
+
+	restore := fmt.Sprintf("/v1/trash/%d/restore", oldID)
+	assert.Equal(http.StatusConflict, ot.call("ann", 1, http.MethodPost, restore, "").Code)
+	assert.Equal("water plants", list("/v1/trash"))
+	assert.Equal("pay rent, water plants", list("/v1/todos"))
+
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodDelete, fmt.Sprintf("/v1/todos/%d", created.Id), "").Code)
+
+	// Todos of other users cannot be restored or purged.
+	assert.Equal(http.StatusNotFound, ot.call("carl", 1, http.MethodPost, restore, "").Code)
+	assert.Equal(http.StatusNotFound, ot.call("carl", 1, http.MethodDelete, fmt.Sprintf("/v1/trash/%d", oldID), "").Code)
+	assert.Equal(http.StatusNotFound, ot.call("bob", 2, http.MethodPost, restore, "").Code)
+
+	rec = ot.call("ann", 1, http.MethodPost, restore, "")
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var restored pkg.TodoResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &restored))
+	assert.Equal(oldID, restored.Id)
+	assert.Equal("low", restored.Priority)
+	assert.Nil(restored.DeletedAt)
+
+	assert.Equal("water plants, pay rent", list("/v1/todos"))
+	assert.Equal("water plants", list("/v1/trash"))
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodPost, restore, "").Code)
+
+	// Only trashed todos can be purged, and purged ones are gone for good.
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodDelete, fmt.Sprintf("/v1/trash/%d", oldID), "").Code)
+	assert.Equal(http.StatusOK, ot.call("ann", 1, http.MethodDelete, fmt.Sprintf("/v1/trash/%d", created.Id), "").Code)
+	assert.Nil(ot.todos.get(created.Id))
+	assert.Equal("", list("/v1/trash"))
+	assert.Equal(http.StatusNotFound, ot.call("ann", 1, http.MethodPost, fmt.Sprintf("/v1/trash/%d/restore", created.Id), "").Code)
+}
+
+func Test_UpdateTodoRecurrence(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+	)
+
+	id := ot.todos.add(1, 1, pkg.TodoResponse{Task: "pay rent", Priority: "high", Recurrence: "FREQ=MONTHLY"})
+	target := fmt.Sprintf("/v1/todos/%d", id)
+
+	rec := ot.call("ann", 1, http.MethodPut, target, `{"recurrence":"FREQ=WEEKLY;BYDAY=XX"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Equal("FREQ=MONTHLY", ot.todos.get(id).Recurrence)
+
+	// Updates of other fields keep the recurrence, an empty one clears it.
+	rec = ot.call("ann", 1, http.MethodPut, target, `{"priority":"low"}`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal("FREQ=MONTHLY", ot.todos.get(id).Recurrence)
+
+	rec = ot.call("ann", 1, http.MethodPut, target, `{"recurrence":""}`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal("", ot.todos.get(id).Recurrence)
+}
@@ -0,0 +1,378 @@
+package service_echo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/ical"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/internal/transfer"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxImportSize bounds the size of imported files.
+	maxImportSize = 10 << 20
+
+	// importProgressRows is how often import jobs record their progress.
+	importProgressRows = 50
+)
+
+// exportTodos streams the caller's todos in the active organization in the format of the format query
+// parameter, JSON by default.
+func exportTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	name := c.QueryParam("format")
+	if name == "" {
+		name = transfer.JSON.Name
+	}
+
+	f, ok := transfer.Lookup(name)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown format %q, expected one of %s", name, strings.Join(transfer.Names(), ", ")))
+	}
+
+	projects, err := s.db.Project.ListProjects(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[int64]string, len(projects))
+	for _, p := range projects {
+		names[p.ID] = p.Name
+	}
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, f.ContentType)
+	h.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="todos.%s"`, f.Extension))
+	c.Response().WriteHeader(http.StatusOK)
+
+	enc := f.NewEncoder(c.Response())
+
+	err = s.db.Todo.ExportTodos(sc.OrgID, sc.UserID, func(t *pkg.TodoResponse) error {
+		var project string
+		if t.ProjectID != nil {
+			project = names[*t.ProjectID]
+		}
+		return enc.Encode(transfer.FromTodo(t, project))
+	})
+
+	// The status is sent already, so a failed export can only be cut short.
+	if err != nil {
+		log.Printf("could not export the todos of user %d: %v", sc.UserID, err)
+		return nil
+	}
+	return enc.Close()
+}
+
+// importer adds items to the caller's todos in the active organization, each on its own. Todos and
+// projects are looked up by lowercased name, which approximates the case-insensitive unique indexes;
+// the indexes still have the final say.
+type importer struct {
+	s          *Service
+	sc         *SecurityContext
+	opts       *pkg.ImportOptions
+	rules      transfer.Rules
+	categories []string
+	tasks      map[string]int64
+	projects   map[string]int64
+	report     *pkg.ImportReport
+}
+
+func newImporter(s *Service, sc *SecurityContext, org *pkg.Org, opts *pkg.ImportOptions) (*importer, error) {
+	im := &importer{
+		s:          s,
+		sc:         sc,
+		opts:       opts,
+		rules:      importRules(opts),
+		categories: org.Settings.CategoryList(),
+		tasks:      make(map[string]int64),
+		projects:   make(map[string]int64),
+		report:     &pkg.ImportReport{DryRun: opts.DryRun, Rows: make([]pkg.ImportRow, 0)},
+	}
+
+	todos, err := s.db.Todo.ListTodos(sc.OrgID, sc.UserID, true, search.DefaultSort)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range todos {
+		im.tasks[strings.ToLower(t.Task)] = t.Id
+	}
+
+	projects, err := s.db.Project.ListProjects(sc.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		im.projects[strings.ToLower(p.Name)] = p.ID
+	}
+	return im, nil
+}
+
+// importRules returns the rules of import options.
+func importRules(opts *pkg.ImportOptions) transfer.Rules {
+	return transfer.Rules{
+		Categories:      opts.CategoryMap,
+		Priorities:      opts.PriorityMap,
+		DefaultCategory: opts.DefaultCategory,
+		DefaultPriority: opts.DefaultPriority,
+	}
+}
+
+// run imports the items of a decoder. Rows the decoder can't read are reported as failed and rows it
+// leaves out as skipped. Progress, if set, is called with the number of rows done every so often, and
+// stops the import if it fails.
+func (im *importer) run(dec transfer.Decoder, progress func(n int) error) error {
+	for {
+		it, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+
+		var (
+			re *transfer.RowError
+			se *transfer.SkipError
+		)
+		switch {
+		case errors.As(err, &re):
+			im.report.Add(pkg.ImportRow{Row: re.Row, Status: pkg.ImportFailed, Error: re.Err.Error()})
+		case errors.As(err, &se):
+			im.report.Add(pkg.ImportRow{Row: se.Row, Task: se.Task, Status: pkg.ImportSkipped, Reason: se.Reason})
+		case err != nil:
+			return err
+		default:
+			im.report.Add(im.add(it))
+		}
+
+		if progress != nil && im.report.Total%importProgressRows == 0 {
+			if err = progress(im.report.Total); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// project returns the id of the project with the name, creating it if there is none. Dry runs only
+// note the projects they would create, with id zero.
+func (im *importer) project(name string) (*int64, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	key := strings.ToLower(name)
+	if id, ok := im.projects[key]; ok {
+		return &id, nil
+	}
+
+	var id int64
+	if !im.opts.DryRun {
+		var err error
+		if id, err = im.s.db.Project.CreateProject(im.sc.OrgID, im.sc.UserID, name); err != nil {
+			return nil, err
+		}
+	}
+
+	im.projects[key] = id
+	im.report.ProjectsCreated = append(im.report.ProjectsCreated, name)
+	return &id, nil
+}
+
+// rename returns the task with the lowest " (n)" suffix that is not taken.
+func (im *importer) rename(task string) string {
+	for n := 2; ; n++ {
+		t := fmt.Sprintf("%s (%d)", task, n)
+		if _, ok := im.tasks[strings.ToLower(t)]; !ok {
+			return t
+		}
+	}
+}
+
+// add imports an item and reports the outcome.
+func (im *importer) add(it *transfer.Item) pkg.ImportRow {
+	row := pkg.ImportRow{Row: it.Row, Task: strings.TrimSpace(it.Task), Notes: it.Notes}
+
+	fail := func(err error) pkg.ImportRow {
+		row.Status, row.ID = pkg.ImportFailed, 0
+		row.Error = batchResult(0, 0, err).Error
+		return row
+	}
+	invalid := func(err error) pkg.ImportRow {
+		return fail(echo.NewHTTPError(http.StatusBadRequest, err.Error()))
+	}
+
+	if err := im.rules.Apply(it, im.categories); err != nil {
+		return invalid(err)
+	}
+	row.Task = strings.TrimSpace(it.Task)
+
+	tr := &pkg.TodoRequest{Task: row.Task, Done: it.Done, Category: it.Category, Priority: it.Priority, DueAt: it.DueAt}
+	if err := tr.ValidateCategories(im.categories); err != nil {
+		return invalid(err)
+	}
+
+	if it.Recurrence != "" {
+		rule, err := ical.ParseRecurrence(it.Recurrence)
+		if err != nil {
+			return invalid(err)
+		}
+		tr.Recurrence = &rule
+	}
+
+	existing, duplicate := im.tasks[strings.ToLower(row.Task)]
+	if duplicate {
+		switch im.opts.Duplicates {
+		case pkg.ImportSkip:
+			row.Status, row.ID, row.Reason = pkg.ImportSkipped, existing, "duplicate task"
+			return row
+		case pkg.ImportRename:
+			tr.Task = im.rename(row.Task)
+			row.Task, duplicate = tr.Task, false
+		}
+	}
+
+	var err error
+	if tr.ProjectID, err = im.project(it.Project); err != nil {
+		return fail(err)
+	}
+
+	if duplicate {
+		row.Status, row.ID = pkg.ImportUpdated, existing
+	} else {
+		row.Status = pkg.ImportCreated
+	}
+
+	if im.opts.DryRun {
+		im.tasks[strings.ToLower(tr.Task)] = existing
+		return row
+	}
+
+	// Overwritten todos take every field of the row, so that fields it leaves empty are cleared.
+	if duplicate {
+		err = im.s.db.Todo.InTx(func(t db.TodoTx) error {
+			return t.ReplaceTodo(im.sc.OrgID, im.sc.UserID, existing, tr, im.sc.Actor())
+		})
+		if err != nil {
+			return fail(err)
+		}
+
+		event := pkg.EventTodoUpdated
+		if tr.Done {
+			event = pkg.EventTodoCompleted
+		}
+		publishTodo(im.s, im.sc, event, existing)
+		return row
+	}
+
+	// Done todos are created and completed in one transaction.
+	err = im.s.db.Todo.InTx(func(t db.TodoTx) error {
+		var err error
+		if row.ID, err = t.CreateTodo(im.sc.OrgID, im.sc.UserID, tr, im.sc.Actor()); err != nil || !tr.Done {
+			return err
+		}
+		return t.UpdateTodo(im.sc.OrgID, im.sc.UserID, row.ID, 0, &pkg.TodoRequest{Done: true}, im.sc.Actor())
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	im.tasks[strings.ToLower(tr.Task)] = row.ID
+	publishTodo(im.s, im.sc, pkg.EventTodoCreated, row.ID)
+	return row
+}
+
+// parseImportOptions reads the form fields of an import.
+func parseImportOptions(c echo.Context, categories []string) (*pkg.ImportOptions, error) {
+	opts := &pkg.ImportOptions{Duplicates: c.FormValue("duplicates")}
+
+	if v := c.FormValue("dry_run"); v != "" {
+		var err error
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid dry_run value: %s", v)
+		}
+	}
+
+	if opts.Duplicates == "" {
+		opts.Duplicates = pkg.ImportSkip
+	}
+	if !util.Contains(pkg.ImportDuplicateModes, opts.Duplicates) {
+		return nil, fmt.Errorf("unknown duplicates value: %s", opts.Duplicates)
+	}
+
+	var err error
+	if opts.CategoryMap, err = transfer.ParseMapping(c.FormValue("category_map")); err != nil {
+		return nil, err
+	}
+	if opts.PriorityMap, err = transfer.ParseMapping(c.FormValue("priority_map")); err != nil {
+		return nil, err
+	}
+
+	opts.DefaultCategory = strings.ToLower(c.FormValue("default_category"))
+	opts.DefaultPriority = strings.ToLower(c.FormValue("default_priority"))
+
+	rules := importRules(opts)
+	return opts, rules.Validate(categories)
+}
+
+// importTodos imports the todos of the multipart file field "file" in the format of the format field,
+// or else of the file's extension, and reports the outcome of every row.
+func importTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("inadequate input parameters. Required file: %v", err))
+	}
+
+	f, ok := transfer.Lookup(c.FormValue("format"))
+	if !ok && c.FormValue("format") == "" {
+		f, ok = transfer.ByExtension(fh.Filename)
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown format, expected one of %s", strings.Join(transfer.Names(), ", ")))
+	}
+
+	org, err := s.db.Org.GetOrg(sc.OrgID)
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseImportOptions(c, org.Settings.CategoryList())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	im, err := newImporter(s, sc, org, opts)
+	if err != nil {
+		return err
+	}
+
+	if err = im.run(f.NewDecoder(file), nil); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("could not read the %s file: %v", f.Name, err))
+	}
+	return c.JSON(http.StatusOK, im.report)
+}
@@ -0,0 +1,157 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/internal/transfer"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseImportOptions(t *testing.T) {
+	assert := asserts.New(t)
+
+	parse := func(form url.Values) (*pkg.ImportOptions, error) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/import", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		return parseImportOptions(echo.New().NewContext(req, httptest.NewRecorder()), pkg.DefaultCategories)
+	}
+
+	opts, err := parse(url.Values{})
+	assert.NoError(err)
+	assert.False(opts.DryRun)
+	assert.Equal(pkg.ImportSkip, opts.Duplicates)
+
+	opts, err = parse(url.Values{
+		"dry_run":          {"true"},
+		"duplicates":       {"rename"},
+		"category_map":     {"Job=work"},
+		"default_priority": {"Medium"},
+	})
+	assert.NoError(err)
+	assert.True(opts.DryRun)
+	assert.Equal(pkg.ImportRename, opts.Duplicates)
+	assert.Equal(map[string]string{"job": "work"}, opts.CategoryMap)
+	assert.Equal("medium", opts.DefaultPriority)
+
+	for _, form := range []url.Values{
+		{"dry_run": {"maybe"}},
+		{"duplicates": {"merge"}},
+		{"category_map": {"job=chores"}},
+		{"default_priority": {"urgent"}},
+	} {
+		_, err = parse(form)
+		assert.Error(err, form.Encode())
+	}
+}
+
+func Test_ImporterDryRun(t *testing.T) {
+	assert := asserts.New(t)
+
+	newDryRun := func(duplicates string) *importer {
+		return &importer{
+			opts:       &pkg.ImportOptions{DryRun: true, Duplicates: duplicates},
+			categories: pkg.DefaultCategories,
+			tasks:      map[string]int64{"buy milk": 1, "buy milk (2)": 2},
+			projects:   map[string]int64{"home": 3},
+			report:     &pkg.ImportReport{DryRun: true, Rows: make([]pkg.ImportRow, 0)},
+		}
+	}
+
+	input := "task,category,priority,project\n" +
+		"Buy milk,,,\n" +
+		"Paint fence,work,high,Home\n" +
+		"Call mom,,low,Family\n" +
+		"Plan trip,travel,,\n"
+
+	im := newDryRun(pkg.ImportSkip)
+	assert.NoError(im.run(transfer.CSV.NewDecoder(strings.NewReader(input)), nil))
+	assert.Equal(4, im.report.Total)
+	assert.Equal(2, im.report.Created)
+	assert.Equal(1, im.report.Skipped)
+	assert.Equal(1, im.report.Failed)
+	assert.Equal([]string{"Family"}, im.report.ProjectsCreated)
+	assert.Equal(pkg.ImportRow{Row: 2, Task: "Buy milk", Status: pkg.ImportSkipped, ID: 1, Reason: "duplicate task"}, im.report.Rows[0])
+	assert.Equal(pkg.ImportRow{Row: 5, Task: "Plan trip", Status: pkg.ImportFailed, Error: "unknown category value: travel"}, im.report.Rows[3])
+
+	im = newDryRun(pkg.ImportRename)
+	assert.NoError(im.run(transfer.CSV.NewDecoder(strings.NewReader("task\nBuy milk\nbuy MILK\n")), nil))
+	assert.Equal("Buy milk (3)", im.report.Rows[0].Task)
+	assert.Equal("buy MILK (4)", im.report.Rows[1].Task)
+
+	im = newDryRun(pkg.ImportOverwrite)
+	assert.NoError(im.run(transfer.CSV.NewDecoder(strings.NewReader("task\nBuy milk\n")), nil))
+	assert.Equal(pkg.ImportRow{Row: 2, Task: "Buy milk", Status: pkg.ImportUpdated, ID: 1}, im.report.Rows[0])
+}
+
+func Test_ImporterSource(t *testing.T) {
+	assert := asserts.New(t)
+
+	opts := &pkg.ImportOptions{DryRun: true, Duplicates: pkg.ImportSkip, PriorityMap: map[string]string{"p2": "high"}}
+	im := &importer{
+		opts:       opts,
+		rules:      transfer.Todoist.Rules(importRules(opts)),
+		categories: pkg.DefaultCategories,
+		tasks:      map[string]int64{},
+		projects:   map[string]int64{},
+		report:     &pkg.ImportReport{DryRun: true, Rows: make([]pkg.ImportRow, 0)},
+	}
+
+	dec, err := transfer.Todoist.NewDecoder(strings.NewReader(
+		"TYPE,CONTENT,PRIORITY,INDENT,DATE\n"+
+			"task,Fix sink @home @urgent,2,1,someday\n"+
+			"note,Call a plumber,,,\n",
+	), "House.csv")
+	assert.NoError(err)
+
+	var progress []int
+	assert.NoError(im.run(dec, func(n int) error {
+		progress = append(progress, n)
+		return nil
+	}))
+	assert.Empty(progress)
+
+	assert.Equal([]pkg.ImportRow{
+		{Row: 1, Task: "Fix sink #urgent", Status: pkg.ImportCreated, Notes: []string{`due date "someday" not understood`}},
+		{Row: 2, Task: "Call a plumber", Status: pkg.ImportSkipped, Reason: "note"},
+	}, im.report.Rows)
+	assert.Equal([]string{"House"}, im.report.ProjectsCreated)
+}
+
+func Test_ImporterOverwrite(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ot     = newOrgTest(t)
+		sc     = &SecurityContext{UserID: 1, OrgID: 1}
+	)
+
+	due, completed := time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	project := int64(1)
+	id := ot.todos.add(1, 1, pkg.TodoResponse{
+		Task: "Buy milk", Category: "home", Priority: "high", ProjectID: &project, DueAt: &due,
+		CompletedAt: &completed, Recurrence: "FREQ=WEEKLY",
+	})
+
+	org, err := ot.s.db.Org.GetOrg(1)
+	assert.NoError(err)
+
+	im, err := newImporter(ot.s, sc, org, &pkg.ImportOptions{Duplicates: pkg.ImportOverwrite})
+	assert.NoError(err)
+	assert.NoError(im.run(transfer.CSV.NewDecoder(strings.NewReader("task,category,priority\nbuy milk,work,low\n")), nil))
+	assert.Equal([]pkg.ImportRow{{Row: 2, Task: "buy milk", Status: pkg.ImportUpdated, ID: id}}, im.report.Rows)
+
+	// Overwriting replaces the todo, down to the fields the row leaves empty.
+	todo := ot.todos.get(id)
+	assert.Equal("buy milk", todo.Task)
+	assert.Equal("work", todo.Category)
+	assert.Equal("low", todo.Priority)
+	assert.Nil(todo.ProjectID)
+	assert.Nil(todo.DueAt)
+	assert.Nil(todo.CompletedAt)
+	assert.Empty(todo.Recurrence)
+}
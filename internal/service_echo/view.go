@@ -0,0 +1,222 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// builtInViews are the smart lists every user has. They are plain saved searches, evaluated like the
+// views users save themselves.
+var builtInViews = []pkg.View{
+	{Key: "today", Name: "Today", Query: "is:open due:<=today", Sort: string(search.SortDueAsc)},
+	{Key: "upcoming", Name: "Upcoming", Query: "is:open due:>today due:<=+7d", Sort: string(search.SortDueAsc)},
+	{Key: "high-priority", Name: "High priority", Query: "is:open priority:high", Sort: string(search.SortDueAsc)},
+	{Key: "recently-completed", Name: "Recently completed", Query: "is:done completed:>=-7d", Sort: string(search.SortCompletedDesc)},
+}
+
+func builtInView(key string) (pkg.View, bool) {
+	for _, v := range builtInViews {
+		if v.Key == key {
+			v.Pinned, v.BuiltIn = true, true
+			return v, true
+		}
+	}
+	return pkg.View{}, false
+}
+
+// getViewParam resolves the :id path parameter to a built-in view by key or to a saved view by id.
+func getViewParam(c echo.Context) (*pkg.View, error) {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	if v, ok := builtInView(c.Param("id")); ok {
+		return &v, nil
+	}
+
+	viewID, err := getID(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return s.db.View.GetView(sc.OrgID, sc.UserID, viewID)
+}
+
+// getSavedViewID returns the id of the saved view in the path. Built-in views can't be changed.
+func getSavedViewID(c echo.Context) (int64, error) {
+	if _, ok := builtInView(c.Param("id")); ok {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("built-in view can't be changed: %s", c.Param("id")))
+	}
+
+	viewID, err := getID(c)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return viewID, nil
+}
+
+// checkViewRequest validates the request and normalizes its query and sort, so that saved views
+// always hold a query that parses.
+func checkViewRequest(req *pkg.ViewRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	q, err := search.Parse(req.Query)
+	if err != nil {
+		return err
+	}
+
+	sort, err := search.ParseSort(req.Sort)
+	if err != nil {
+		return err
+	}
+
+	req.Query, req.Sort = q.String(), string(sort)
+	return nil
+}
+
+// listViews returns the built-in views followed by the user's saved views.
+func listViews(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	saved, err := s.db.View.ListViews(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+
+	views := make([]pkg.View, 0, len(builtInViews)+len(saved))
+
+	for _, v := range builtInViews {
+		v, _ = builtInView(v.Key)
+		views = append(views, v)
+	}
+	return c.JSON(http.StatusOK, append(views, saved...))
+}
+
+func getView(c echo.Context) error {
+	view, err := getViewParam(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+func createView(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.ViewRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := checkViewRequest(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	viewID, err := s.db.View.CreateView(sc.OrgID, sc.UserID, &req)
+	if err != nil {
+		return err
+	}
+
+	view, err := s.db.View.GetView(sc.OrgID, sc.UserID, viewID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, view)
+}
+
+func updateView(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	viewID, err := getSavedViewID(c)
+	if err != nil {
+		return err
+	}
+
+	var req pkg.ViewRequest
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = checkViewRequest(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err = s.db.View.GetView(sc.OrgID, sc.UserID, viewID); err != nil {
+		return err
+	}
+
+	if err = s.db.View.UpdateView(sc.OrgID, sc.UserID, viewID, &req); err != nil {
+		return err
+	}
+
+	view, err := s.db.View.GetView(sc.OrgID, sc.UserID, viewID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+func deleteView(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	viewID, err := getSavedViewID(c)
+	if err != nil {
+		return err
+	}
+
+	if err = s.db.View.DeleteView(sc.OrgID, sc.UserID, viewID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// listViewTodos evaluates the view and returns a page of the matching todos in the view's order.
+func listViewTodos(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	view, err := getViewParam(c)
+	if err != nil {
+		return err
+	}
+
+	q, err := search.Parse(view.Query)
+	if err != nil {
+		return err
+	}
+
+	sort, err := search.ParseSort(view.Sort)
+	if err != nil {
+		return err
+	}
+
+	todos, err := s.db.Todo.SearchTodos(sc.OrgID, sc.UserID, q, sort, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, todos)
+}
@@ -0,0 +1,42 @@
+package service_echo
+
+import (
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_BuiltInViews(t *testing.T) {
+	assert := asserts.New(t)
+
+	for _, v := range builtInViews {
+		req := pkg.ViewRequest{Name: v.Name, Query: v.Query, Sort: v.Sort}
+		if assert.NoError(checkViewRequest(&req), v.Key) {
+			assert.Equal(v.Query, req.Query, v.Key)
+		}
+
+		_, err := search.ParseSort(v.Sort)
+		assert.NoError(err, v.Key)
+	}
+
+	v, ok := builtInView("today")
+	assert.True(ok)
+	assert.True(v.BuiltIn)
+
+	_, ok = builtInView("1")
+	assert.False(ok)
+}
+
+func Test_CheckViewRequest(t *testing.T) {
+	assert := asserts.New(t)
+
+	req := pkg.ViewRequest{Name: "Errands", Query: "category:errands  PRIORITY:high"}
+	assert.NoError(checkViewRequest(&req))
+	assert.Equal("category:errands priority:high", req.Query)
+	assert.Equal(string(search.DefaultSort), req.Sort)
+
+	assert.Error(checkViewRequest(&pkg.ViewRequest{Query: "is:open"}))
+	assert.Error(checkViewRequest(&pkg.ViewRequest{Name: "Broken", Query: "due:<someday"}))
+	assert.Error(checkViewRequest(&pkg.ViewRequest{Name: "Sorted", Sort: "random"}))
+}
@@ -0,0 +1,213 @@
+package service_echo
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+func getDeliveryID(c echo.Context) (int64, error) {
+	idStr := c.Param("delivery_id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return id, fmt.Errorf("invalid delivery id given %s", idStr)
+	}
+	return id, nil
+}
+
+// getWebhookParam returns the webhook in the path if it belongs to the caller.
+func getWebhookParam(c echo.Context) (*pkg.Webhook, error) {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	webhookID, err := getID(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return s.db.Webhook.GetWebhook(sc.OrgID, sc.UserID, webhookID)
+}
+
+func listWebhooks(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	webhooks, err := s.db.Webhook.ListWebhooks(sc.OrgID, sc.UserID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+func getWebhook(c echo.Context) error {
+	w, err := getWebhookParam(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, w)
+}
+
+// createWebhook registers a webhook for the caller's todos in the active organization. The response
+// carries the signing secret, which is not shown again.
+func createWebhook(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	var req pkg.WebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return err
+	}
+	secret = "whsec_" + secret
+
+	webhookID, err := s.db.Webhook.CreateWebhook(sc.OrgID, sc.UserID, req.URL, secret, req.Events)
+	if err != nil {
+		return err
+	}
+
+	if req.Active != nil && !*req.Active {
+		if err = s.db.Webhook.UpdateWebhook(sc.OrgID, sc.UserID, webhookID, &req); err != nil {
+			return err
+		}
+	}
+
+	w, err := s.db.Webhook.GetWebhook(sc.OrgID, sc.UserID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	w.Secret = secret
+	return c.JSON(http.StatusCreated, w)
+}
+
+// updateWebhook replaces the url and events of a webhook. Setting active to true enables a webhook
+// that was disabled after repeated failures.
+func updateWebhook(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	w, err := getWebhookParam(c)
+	if err != nil {
+		return err
+	}
+
+	var req pkg.WebhookRequest
+	if err = c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = req.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Webhook.UpdateWebhook(sc.OrgID, sc.UserID, w.ID, &req); err != nil {
+		return err
+	}
+
+	w, err = s.db.Webhook.GetWebhook(sc.OrgID, sc.UserID, w.ID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, w)
+}
+
+func deleteWebhook(c echo.Context) error {
+	var (
+		s  = c.Get("service").(*Service)
+		sc = c.Get("security_context").(*SecurityContext)
+	)
+
+	webhookID, err := getID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err = s.db.Webhook.DeleteWebhook(sc.OrgID, sc.UserID, webhookID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+func listWebhookDeliveries(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	limit, offset, err := getPage(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	w, err := getWebhookParam(c)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := s.db.Webhook.ListDeliveries(w.ID, limit, offset)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// getWebhookDelivery returns a delivery with the response codes and errors of its attempts.
+func getWebhookDelivery(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	w, err := getWebhookParam(c)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := getDeliveryID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	d, err := s.db.Webhook.GetDelivery(w.ID, deliveryID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
+
+// redeliverWebhook queues the payload of a delivery again, whatever became of it.
+func redeliverWebhook(c echo.Context) error {
+	s := c.Get("service").(*Service)
+
+	w, err := getWebhookParam(c)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := getDeliveryID(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	newID, err := s.db.Webhook.Redeliver(w.ID, deliveryID)
+	if err != nil {
+		return err
+	}
+
+	d, err := s.db.Webhook.GetDelivery(w.ID, newID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, d)
+}
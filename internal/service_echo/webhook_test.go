@@ -0,0 +1,69 @@
+package service_echo
+
+import (
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// createdWebhooks keeps the urls of the webhooks it is asked to create.
+type createdWebhooks struct {
+	db.WebhookDB
+	urls []string
+}
+
+func (cw *createdWebhooks) CreateWebhook(_, _ int64, url, _ string, _ []string) (int64, error) {
+	cw.urls = append(cw.urls, url)
+	return int64(len(cw.urls)), nil
+}
+
+func (cw *createdWebhooks) GetWebhook(_, _, webhookID int64) (*pkg.Webhook, error) {
+	return &pkg.Webhook{ID: webhookID, URL: cw.urls[webhookID-1], Active: true}, nil
+}
+
+func Test_CreateWebhookAddress(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		store = &createdWebhooks{}
+		s     = &Service{conf: NewConfig(), db: &db.DB{Webhook: store}}
+		sc    = &SecurityContext{UserID: 1, OrgID: 2}
+	)
+
+	create := func(url string) int {
+		body, _ := json.Marshal(&pkg.WebhookRequest{URL: url})
+		return serveAs(s, sc, createWebhook, http.MethodPost, "/v1/webhooks", "/v1/webhooks", string(body)).Code
+	}
+
+	// Webhooks must not reach the network of the service.
+	for _, url := range []string{
+		"ftp://hooks.example.com/todo",
+		"http:///todo",
+		"http://localhost:8080/todo",
+		"http://api.LOCALHOST/todo",
+		"http://127.0.0.1/todo",
+		"http://10.1.2.3/todo",
+		"http://172.16.0.1/todo",
+		"http://192.168.1.1/todo",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0:3030/todo",
+		"http://[::1]/todo",
+		"http://[fd00::1]/todo",
+		"http://[fe80::1]/todo",
+		"http://[::ffff:127.0.0.1]/todo",
+	} {
+		assert.Equal(http.StatusBadRequest, create(url), url)
+	}
+	assert.Empty(store.urls)
+
+	for _, url := range []string{
+		"https://hooks.example.com/todo",
+		"http://93.184.216.34:8080/todo",
+		"https://[2606:4700::6810:84e5]/todo",
+	} {
+		assert.Equal(http.StatusCreated, create(url), url)
+	}
+}
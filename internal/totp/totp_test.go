@@ -0,0 +1,55 @@
+package totp
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, appendix B (SHA1).
+func Test_HOTPMatchesRFC6238(t *testing.T) {
+	assert := asserts.New(t)
+
+	key := []byte("12345678901234567890")
+
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for ts, want := range vectors {
+		assert.Equal(want, hotp(key, uint64(ts/Period), 8), "time %d", ts)
+	}
+}
+
+func Test_ValidateWithSkew(t *testing.T) {
+	assert := asserts.New(t)
+
+	secret, err := GenerateSecret()
+	assert.Nil(err)
+
+	now := time.Unix(1700000000, 0)
+	code, err := Code(secret, now.Add(-Period*time.Second))
+	assert.Nil(err)
+
+	step, ok := Validate(secret, code, now, 1)
+	assert.True(ok)
+	assert.Equal(Step(now)-1, step)
+
+	_, ok = Validate(secret, code, now, 0)
+	assert.False(ok)
+
+	_, ok = Validate(secret, "12345", now, 1)
+	assert.False(ok)
+}
+
+func Test_ProvisioningURI(t *testing.T) {
+	assert := asserts.New(t)
+
+	uri := ProvisioningURI("Todo", "bob@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal("otpauth://totp/Todo:bob@example.com?algorithm=SHA1&digits=6&issuer=Todo&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
@@ -0,0 +1,152 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvColumns = []string{"task", "done", "category", "priority", "project", "due_at", "created_at", "completed_at", "recurrence"}
+
+// CSV has a header row with the column names. Imports need the task column; the others are optional
+// and can be in any order.
+var CSV = register(&Format{
+	Name:        "csv",
+	ContentType: "text/csv; charset=utf-8",
+	Extension:   "csv",
+	NewEncoder:  func(w io.Writer) Encoder { return &csvEncoder{w: csv.NewWriter(w)} },
+	NewDecoder: func(r io.Reader) Decoder {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return &csvDecoder{r: cr}
+	},
+})
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) Encode(it *Item) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.w.Write([]string{
+		it.Task,
+		strconv.FormatBool(it.Done),
+		it.Category,
+		it.Priority,
+		it.Project,
+		csvTime(it.DueAt),
+		csvTime(it.CreatedAt),
+		csvTime(it.CompletedAt),
+		it.Recurrence,
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// parseBool reads the done column, which spreadsheets may fill in many ways.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "0", "no", "n":
+		return false, nil
+	case "true", "1", "yes", "y", "x":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid done value: %s", s)
+}
+
+func (d *csvDecoder) Decode() (*Item, error) {
+	if d.columns == nil {
+		header, err := d.r.Read()
+		if err == io.EOF {
+			return nil, fmt.Errorf("the CSV file has no header row")
+		} else if err != nil {
+			return nil, err
+		}
+
+		d.columns = make(map[string]int)
+		for i, name := range header {
+			d.columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))] = i
+		}
+		if _, ok := d.columns["task"]; !ok {
+			return nil, fmt.Errorf("the CSV file has no task column")
+		}
+	}
+
+	record, err := d.r.Read()
+	if err != nil {
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			return nil, &RowError{Row: pe.StartLine, Err: pe.Err}
+		}
+		return nil, err
+	}
+
+	row, _ := d.r.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	it := &Item{
+		Task:       field("task"),
+		Category:   field("category"),
+		Priority:   field("priority"),
+		Project:    field("project"),
+		Recurrence: field("recurrence"),
+		Row:        row,
+	}
+
+	if it.Done, err = parseBool(field("done")); err != nil {
+		return nil, &RowError{Row: row, Err: err}
+	}
+
+	times := []struct {
+		name string
+		t    **time.Time
+	}{{"due_at", &it.DueAt}, {"created_at", &it.CreatedAt}, {"completed_at", &it.CompletedAt}}
+
+	for _, c := range times {
+		if *c.t, err = parseTime(field(c.name)); err != nil {
+			return nil, &RowError{Row: row, Err: fmt.Errorf("%s: %w", c.name, err)}
+		}
+	}
+
+	it.Done = it.Done || it.CompletedAt != nil
+	return it, nil
+}
@@ -0,0 +1,64 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GoogleTasks reads Tasks.json of a Google Takeout export. Task lists become projects and subtasks todos
+// of their own. Google Tasks have no priorities or labels.
+var GoogleTasks = registerSource(&Source{
+	Name: "google_tasks",
+	NewDecoder: func(r io.Reader, _ string) (*ListDecoder, error) {
+		var export struct {
+			Items []struct {
+				Title string `json:"title"`
+				Items []struct {
+					ID        string     `json:"id"`
+					Title     string     `json:"title"`
+					Status    string     `json:"status"`
+					Due       *time.Time `json:"due"`
+					Completed *time.Time `json:"completed"`
+					Parent    string     `json:"parent"`
+					Deleted   bool       `json:"deleted"`
+				} `json:"items"`
+			} `json:"items"`
+		}
+
+		if err := json.NewDecoder(r).Decode(&export); err != nil {
+			return nil, fmt.Errorf("expected a Google Tasks export: %w", err)
+		}
+
+		d := &ListDecoder{}
+		for _, list := range export.Items {
+			titles := make(map[string]string, len(list.Items))
+			for _, t := range list.Items {
+				titles[t.ID] = strings.TrimSpace(t.Title)
+			}
+
+			for _, t := range list.Items {
+				title := titles[t.ID]
+				switch {
+				case t.Deleted:
+					d.skip(title, "deleted")
+					continue
+				case title == "":
+					d.skip(title, "no title")
+					continue
+				}
+
+				d.add(&Item{
+					Task:        subtask(titles[t.Parent], title),
+					Done:        t.Status == "completed" || t.Completed != nil,
+					Project:     strings.TrimSpace(list.Title),
+					DueAt:       t.Due,
+					CompletedAt: t.Completed,
+				})
+			}
+		}
+		return d, nil
+	},
+})
@@ -0,0 +1,92 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSON is an array of items.
+var JSON = register(&Format{
+	Name:        "json",
+	ContentType: "application/json; charset=utf-8",
+	Extension:   "json",
+	NewEncoder:  func(w io.Writer) Encoder { return &jsonEncoder{w: bufio.NewWriter(w)} },
+	NewDecoder:  func(r io.Reader) Decoder { return &jsonDecoder{d: json.NewDecoder(r)} },
+})
+
+type jsonEncoder struct {
+	w *bufio.Writer
+	n int
+}
+
+func (e *jsonEncoder) Encode(it *Item) error {
+	b, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if e.n == 0 {
+		sep = "[\n  "
+	}
+	e.n++
+
+	if _, err = e.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if e.n == 0 {
+		end = "[]\n"
+	}
+
+	if _, err := e.w.WriteString(end); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+type jsonDecoder struct {
+	d       *json.Decoder
+	row     int
+	started bool
+}
+
+func (d *jsonDecoder) Decode() (*Item, error) {
+	if !d.started {
+		tok, err := d.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("expected a JSON array of todos")
+		}
+		d.started = true
+	}
+
+	if !d.d.More() {
+		if _, err := d.d.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	d.row++
+
+	// Values of the wrong type are read completely, so the decoder can go on with the next item.
+	it := &Item{Row: d.row}
+	if err := d.d.Decode(it); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			return nil, &RowError{Row: d.row, Err: err}
+		}
+		return nil, err
+	}
+	return it, nil
+}
@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// maxLineSize bounds the lines the text decoders read.
+const maxLineSize = 1 << 20
+
+// Markdown is a checklist with a "## <project>" section per project after the todos without one. The
+// other fields follow the task in parentheses, as in
+//
+//   - [ ] Buy milk *(priority: high, category: home, due: 2026-01-09)*
+//
+// Imports take every checklist item; other lines are ignored, and a "# " heading ends the project.
+var Markdown = register(&Format{
+	Name:        "md",
+	ContentType: "text/markdown; charset=utf-8",
+	Extension:   "md",
+	NewEncoder:  func(w io.Writer) Encoder { return &markdownEncoder{w: bufio.NewWriter(w)} },
+	NewDecoder: func(r io.Reader) Decoder {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 4096), maxLineSize)
+		return &markdownDecoder{sc: sc}
+	},
+})
+
+type markdownEncoder struct {
+	w       *bufio.Writer
+	n       int
+	project string
+}
+
+func (e *markdownEncoder) Encode(it *Item) error {
+	var b strings.Builder
+
+	if it.Project != e.project {
+		if e.n > 0 {
+			b.WriteString("\n")
+		}
+
+		// Todos without a project after a project only come from unordered input.
+		if it.Project == "" {
+			b.WriteString("# No project\n\n")
+		} else {
+			b.WriteString("## " + it.Project + "\n\n")
+		}
+		e.project = it.Project
+	}
+	e.n++
+
+	check := " "
+	if it.Done {
+		check = "x"
+	}
+	b.WriteString("- [" + check + "] " + strings.ReplaceAll(it.Task, "\n", " "))
+
+	var meta []string
+	if it.Priority != "" {
+		meta = append(meta, "priority: "+it.Priority)
+	}
+	if it.Category != "" {
+		meta = append(meta, "category: "+it.Category)
+	}
+	if it.DueAt != nil {
+		meta = append(meta, "due: "+formatDate(*it.DueAt))
+	}
+	if it.CompletedAt != nil {
+		meta = append(meta, "completed: "+formatDate(*it.CompletedAt))
+	}
+	if it.Recurrence != "" {
+		meta = append(meta, "repeat: "+it.Recurrence)
+	}
+	if len(meta) > 0 {
+		b.WriteString(" *(" + strings.Join(meta, ", ") + ")*")
+	}
+	b.WriteString("\n")
+
+	_, err := e.w.WriteString(b.String())
+	return err
+}
+
+func (e *markdownEncoder) Close() error {
+	return e.w.Flush()
+}
+
+var (
+	checklistItem = regexp.MustCompile(`^\s*[-*+] \[([ xX])\]\s+(.*)$`)
+	itemMeta      = regexp.MustCompile(`^(.*?)\s*\*\(([^()]*)\)\*$`)
+)
+
+type markdownDecoder struct {
+	sc      *bufio.Scanner
+	line    int
+	project string
+}
+
+func (d *markdownDecoder) Decode() (*Item, error) {
+	for d.sc.Scan() {
+		d.line++
+		l := strings.TrimRight(d.sc.Text(), " \t\r")
+
+		switch {
+		case strings.HasPrefix(l, "## "):
+			d.project = strings.TrimSpace(strings.TrimLeft(l, "#"))
+			continue
+		case strings.HasPrefix(l, "# "):
+			d.project = ""
+			continue
+		}
+
+		m := checklistItem.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+
+		it := &Item{Task: m[2], Done: m[1] != " ", Project: d.project, Row: d.line}
+
+		if mm := itemMeta.FindStringSubmatch(m[2]); mm != nil {
+			it.Task = mm[1]
+			if err := it.setMeta(mm[2]); err != nil {
+				return nil, &RowError{Row: d.line, Err: err}
+			}
+		}
+		return it, nil
+	}
+
+	if err := d.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// setMeta reads the fields in the parentheses after a task.
+func (it *Item) setMeta(meta string) error {
+	for _, field := range strings.Split(meta, ",") {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return fmt.Errorf("invalid field %q, expected key: value", strings.TrimSpace(field))
+		}
+
+		var err error
+		switch value = strings.TrimSpace(value); strings.ToLower(strings.TrimSpace(key)) {
+		case "priority":
+			it.Priority = value
+		case "category":
+			it.Category = value
+		case "due":
+			it.DueAt, err = parseTime(value)
+		case "completed":
+			it.CompletedAt, err = parseTime(value)
+			it.Done = true
+		case "repeat":
+			it.Recurrence = value
+		default:
+			err = fmt.Errorf("unknown field %q", strings.TrimSpace(key))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// MicrosoftToDo reads the lists and tasks of Microsoft To Do as its Graph API returns them, either as
+// an array of lists or in a "value" or "lists" field. Lists become projects, except the default list,
+// whose tasks get none. Categories are labels and checklist items todos of their own. Most tasks have
+// normal importance, which is low.
+var MicrosoftToDo = registerSource(&Source{
+	Name:       "microsoft_todo",
+	Priorities: map[string]string{"high": "high", "normal": "low", "low": "low"},
+	NewDecoder: func(r io.Reader, _ string) (*ListDecoder, error) {
+		var raw json.RawMessage
+		if err := json.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		var (
+			lists []msList
+			err   error
+		)
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			err = json.Unmarshal(raw, &lists)
+		} else {
+			var export struct {
+				Value []msList `json:"value"`
+				Lists []msList `json:"lists"`
+			}
+			err = json.Unmarshal(raw, &export)
+			lists = append(export.Value, export.Lists...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("expected a Microsoft To Do export: %w", err)
+		}
+
+		d := &ListDecoder{}
+		for _, list := range lists {
+			project := strings.TrimSpace(list.DisplayName)
+			if list.WellknownListName == "defaultList" {
+				project = ""
+			}
+
+			for _, t := range list.Tasks {
+				title := strings.TrimSpace(t.Title)
+				if title == "" {
+					d.skip(title, "no title")
+					continue
+				}
+
+				it := &Item{
+					Task:        title,
+					Done:        t.Status == "completed",
+					Priority:    t.Importance,
+					Project:     project,
+					Labels:      t.Categories,
+					CreatedAt:   t.CreatedDateTime,
+					DueAt:       t.DueDateTime.date(),
+					CompletedAt: t.CompletedDateTime.time(),
+				}
+				if t.Recurrence != nil {
+					if it.Recurrence = t.Recurrence.rule(); it.Recurrence == "" {
+						it.Notes = append(it.Notes, fmt.Sprintf("recurrence %q not understood", t.Recurrence.Pattern.Type))
+					}
+				}
+				d.add(it)
+
+				for _, c := range t.ChecklistItems {
+					if name := strings.TrimSpace(c.DisplayName); name != "" {
+						d.add(&Item{Task: subtask(title, name), Done: c.IsChecked || it.Done, Priority: it.Priority, Project: project})
+					}
+				}
+			}
+		}
+		return d, nil
+	},
+})
+
+type msList struct {
+	DisplayName       string   `json:"displayName"`
+	WellknownListName string   `json:"wellknownListName"`
+	Tasks             []msTask `json:"tasks"`
+}
+
+type msTask struct {
+	Title             string            `json:"title"`
+	Status            string            `json:"status"`
+	Importance        string            `json:"importance"`
+	Categories        []string          `json:"categories"`
+	CreatedDateTime   *time.Time        `json:"createdDateTime"`
+	DueDateTime       *msDateTime       `json:"dueDateTime"`
+	CompletedDateTime *msDateTime       `json:"completedDateTime"`
+	Recurrence        *msRecurrence     `json:"recurrence"`
+	ChecklistItems    []msChecklistItem `json:"checklistItems"`
+}
+
+type msChecklistItem struct {
+	DisplayName string `json:"displayName"`
+	IsChecked   bool   `json:"isChecked"`
+}
+
+// msDateTime is a time without offset and the name of its zone.
+type msDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+func (dt *msDateTime) wall() (time.Time, bool) {
+	if dt == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02T15:04:05.9999999", dt.DateTime)
+	return t, err == nil
+}
+
+// time returns the time in its zone, or in UTC if the zone is unknown, as Windows zone names are.
+func (dt *msDateTime) time() *time.Time {
+	t, ok := dt.wall()
+	if !ok {
+		return nil
+	}
+	if loc, err := time.LoadLocation(dt.TimeZone); err == nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc).UTC()
+	}
+	return &t
+}
+
+// date returns due dates, which To Do sets to midnight in the user's zone, as the date at midnight UTC.
+func (dt *msDateTime) date() *time.Time {
+	t, ok := dt.wall()
+	if !ok {
+		return nil
+	}
+	if t.Hour() != 0 || t.Minute() != 0 {
+		return dt.time()
+	}
+	return &t
+}
+
+type msRecurrence struct {
+	Pattern struct {
+		Type       string   `json:"type"`
+		Interval   int      `json:"interval"`
+		DaysOfWeek []string `json:"daysOfWeek"`
+	} `json:"pattern"`
+}
+
+// rule returns the RRULE of a recurrence pattern, or nothing if the type is unknown.
+func (r *msRecurrence) rule() string {
+	freq := map[string]string{
+		"daily":           "DAILY",
+		"weekly":          "WEEKLY",
+		"absoluteMonthly": "MONTHLY",
+		"relativeMonthly": "MONTHLY",
+		"absoluteYearly":  "YEARLY",
+		"relativeYearly":  "YEARLY",
+	}[r.Pattern.Type]
+	if freq == "" {
+		return ""
+	}
+
+	rule := "FREQ=" + freq
+	if r.Pattern.Interval > 1 {
+		rule += fmt.Sprintf(";INTERVAL=%d", r.Pattern.Interval)
+	}
+
+	if freq == "WEEKLY" {
+		var days []string
+		for _, day := range r.Pattern.DaysOfWeek {
+			if d, ok := weekdays[strings.ToLower(day)]; ok {
+				days = append(days, d)
+			}
+		}
+		if len(days) > 0 {
+			rule += ";BYDAY=" + strings.Join(days, ",")
+		}
+	}
+	return rule
+}
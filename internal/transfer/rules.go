@@ -0,0 +1,122 @@
+package transfer
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"strings"
+)
+
+// Priorities are the priorities of todos.
+var Priorities = []string{"low", "medium", "high"}
+
+// Rules map the categories and priorities of imported items onto those of an organization. Keys match
+// case-insensitively. Empty values get the defaults, and so do values that are unknown after mapping if
+// there is a default; otherwise they are errors. Without defaults, empty categories get the first
+// category of the organization and empty priorities are low.
+type Rules struct {
+	Categories      map[string]string
+	Priorities      map[string]string
+	DefaultCategory string
+	DefaultPriority string
+}
+
+// ParseMapping reads a mapping of the form "from=to,from=to".
+func ParseMapping(s string) (map[string]string, error) {
+	m := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(from) == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected from=to", pair)
+		}
+		m[strings.ToLower(strings.TrimSpace(from))] = strings.ToLower(strings.TrimSpace(to))
+	}
+	return m, nil
+}
+
+// Validate checks the targets of the rules against the categories of the organization.
+func (r *Rules) Validate(categories []string) error {
+	for _, c := range append([]string{r.DefaultCategory}, values(r.Categories)...) {
+		if c != "" && !util.Contains(categories, c) {
+			return fmt.Errorf("unknown category value: %s", c)
+		}
+	}
+
+	for _, p := range append([]string{r.DefaultPriority}, values(r.Priorities)...) {
+		if p != "" && !util.Contains(Priorities, p) {
+			return fmt.Errorf("unknown priority value: %s", p)
+		}
+	}
+	return nil
+}
+
+func values(m map[string]string) []string {
+	var r []string
+	for _, v := range m {
+		r = append(r, v)
+	}
+	return r
+}
+
+// Apply maps the category and the priority of the item. Items without a category get the first label
+// that maps onto one, and the other labels are added to the task as hashtags.
+func (r *Rules) Apply(it *Item, categories []string) error {
+	var err error
+
+	labels := it.Labels
+	it.Labels = nil
+
+	for i, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if to, ok := r.Categories[l]; ok {
+			l = to
+		}
+		if it.Category == "" && util.Contains(categories, l) {
+			it.Category = labels[i]
+			continue
+		}
+		if tag := strings.Join(strings.Fields(labels[i]), "_"); tag != "" {
+			it.Task += " #" + tag
+		}
+	}
+
+	defaultCategory := r.DefaultCategory
+	if defaultCategory == "" && len(categories) > 0 {
+		defaultCategory = categories[0]
+	}
+
+	if it.Category, err = mapValue(it.Category, r.Categories, categories, defaultCategory, r.DefaultCategory != ""); err != nil {
+		return fmt.Errorf("unknown category value: %s", it.Category)
+	}
+
+	defaultPriority := r.DefaultPriority
+	if defaultPriority == "" {
+		defaultPriority = "low"
+	}
+
+	if it.Priority, err = mapValue(it.Priority, r.Priorities, Priorities, defaultPriority, r.DefaultPriority != ""); err != nil {
+		return fmt.Errorf("unknown priority value: %s", it.Priority)
+	}
+	return nil
+}
+
+func mapValue(v string, mapping map[string]string, known []string, def string, fallback bool) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if to, ok := mapping[v]; ok {
+		v = to
+	}
+
+	switch {
+	case v == "":
+		return def, nil
+	case util.Contains(known, v):
+		return v, nil
+	case fallback:
+		return def, nil
+	}
+	return v, fmt.Errorf("unknown value: %s", v)
+}
@@ -0,0 +1,112 @@
+package transfer
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Source is the export format of another todo app. Sources are only imported. Their decoders read the
+// whole file up front, so they know how many items there are.
+type Source struct {
+	Name string
+
+	// Priorities map the priorities of the app onto low, medium and high. Rules given with an import
+	// take precedence.
+	Priorities map[string]string
+
+	// NewDecoder reads an export. The file name tells what some exports leave out, such as the project
+	// of a Todoist CSV export.
+	NewDecoder func(r io.Reader, filename string) (*ListDecoder, error)
+}
+
+var sources = map[string]*Source{}
+
+func registerSource(s *Source) *Source {
+	sources[s.Name] = s
+	return s
+}
+
+// LookupSource returns the source with the name.
+func LookupSource(name string) (*Source, bool) {
+	s, ok := sources[strings.ToLower(name)]
+	return s, ok
+}
+
+// SourceNames returns the names of the sources in order.
+func SourceNames() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rules returns the rules with the priorities of the source added to them.
+func (s *Source) Rules(r Rules) Rules {
+	priorities := make(map[string]string, len(s.Priorities)+len(r.Priorities))
+	for k, v := range s.Priorities {
+		priorities[k] = v
+	}
+	for k, v := range r.Priorities {
+		priorities[k] = v
+	}
+	r.Priorities = priorities
+	return r
+}
+
+// ListDecoder returns the items and skipped rows of a document read in full.
+type ListDecoder struct {
+	rows []listRow
+	next int
+}
+
+type listRow struct {
+	item *Item
+	err  error
+}
+
+func (d *ListDecoder) add(it *Item) {
+	it.Row = len(d.rows) + 1
+	d.rows = append(d.rows, listRow{item: it})
+}
+
+func (d *ListDecoder) skip(task, reason string) {
+	d.rows = append(d.rows, listRow{err: &SkipError{Row: len(d.rows) + 1, Task: task, Reason: reason}})
+}
+
+func (d *ListDecoder) fail(err error) {
+	d.rows = append(d.rows, listRow{err: &RowError{Row: len(d.rows) + 1, Err: err}})
+}
+
+// Len returns the number of rows, including the skipped ones.
+func (d *ListDecoder) Len() int {
+	return len(d.rows)
+}
+
+func (d *ListDecoder) Decode() (*Item, error) {
+	if d.next == len(d.rows) {
+		return nil, io.EOF
+	}
+	r := d.rows[d.next]
+	d.next++
+	return r.item, r.err
+}
+
+// subtaskSep joins the task of a subtask to the task of its parent, since todos have no subtasks.
+const subtaskSep = " / "
+
+// subtask returns the task of a subtask.
+func subtask(parent, task string) string {
+	if parent == "" {
+		return task
+	}
+	return parent + subtaskSep + task
+}
+
+// weekdays are the RRULE days by English name.
+var weekdays = map[string]string{
+	"monday": "MO", "tuesday": "TU", "wednesday": "WE", "thursday": "TH", "friday": "FR", "saturday": "SA", "sunday": "SU",
+	"mon": "MO", "tue": "TU", "wed": "WE", "thu": "TH", "fri": "FR", "sat": "SA", "sun": "SU",
+}
@@ -0,0 +1,223 @@
+package transfer
+
+import (
+	"errors"
+	asserts "github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeSource reads an export into items and skipped rows.
+func decodeSource(t *testing.T, s *Source, doc, filename string) ([]*Item, []*SkipError) {
+	d, err := s.NewDecoder(strings.NewReader(doc), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		items []*Item
+		skips []*SkipError
+	)
+
+	for {
+		it, err := d.Decode()
+		if err == io.EOF {
+			return items, skips
+		}
+
+		var se *SkipError
+		if errors.As(err, &se) {
+			skips = append(skips, se)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, it)
+	}
+}
+
+func Test_Sources(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal([]string{"google_tasks", "microsoft_todo", "todoist"}, SourceNames())
+
+	s, ok := LookupSource("Todoist")
+	assert.True(ok)
+	assert.Equal(Todoist, s)
+
+	_, ok = LookupSource("trello")
+	assert.False(ok)
+
+	r := Todoist.Rules(Rules{Priorities: map[string]string{"p3": "medium"}})
+	assert.Equal(map[string]string{"p1": "high", "p2": "medium", "p3": "medium", "p4": "low"}, r.Priorities)
+	assert.Equal("low", Todoist.Priorities["p3"])
+}
+
+func Test_TodoistRecurrence(t *testing.T) {
+	assert := asserts.New(t)
+
+	for text, want := range map[string]string{
+		"every day":             "FREQ=DAILY",
+		"Every 2 weeks":         "FREQ=WEEKLY;INTERVAL=2",
+		"every other month":     "FREQ=MONTHLY;INTERVAL=2",
+		"ev year":               "FREQ=YEARLY",
+		"daily":                 "FREQ=DAILY",
+		"every weekday at 9am":  "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+		"every mon, fri":        "FREQ=WEEKLY;BYDAY=MO,FR",
+		"every tuesday and sat": "FREQ=WEEKLY;BYDAY=TU,SA",
+	} {
+		rule, ok := todoistRecurrence(text)
+		assert.True(ok, text)
+		assert.Equal(want, rule, text)
+	}
+
+	for _, text := range []string{"every 3rd friday", "every last day", "every other monday"} {
+		rule, ok := todoistRecurrence(text)
+		assert.False(ok, text)
+		assert.Equal(text, rule, text)
+	}
+
+	rule, ok := todoistRecurrence("tomorrow")
+	assert.False(ok)
+	assert.Empty(rule)
+}
+
+func Test_DecodeTodoistCSV(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := "\uFEFFTYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Buy milk @shop @Home,,1,1,Ann,,2026-11-02,en,UTC\n" +
+		"task,Whole milk,,4,2,Ann,,,en,UTC\n" +
+		"note,Ask for a discount,,,,,,,,\n" +
+		",,,,,,,,,\n" +
+		"task,Water plants,,3,1,Ann,,every mon,en,UTC\n" +
+		"task,Call mom,,4,3,Ann,,someday,en,UTC\n"
+
+	items, skips := decodeSource(t, Todoist, doc, "uploads/Groceries.csv")
+
+	assert.Equal([]*Item{
+		{Task: "Buy milk", Priority: "p1", Project: "Groceries", Labels: []string{"shop", "Home"}, DueAt: date(2026, 11, 2), Row: 2},
+		{Task: "Buy milk / Whole milk", Priority: "p4", Project: "Groceries", Row: 3},
+		{Task: "Water plants", Priority: "p3", Project: "Groceries", Recurrence: "FREQ=WEEKLY;BYDAY=MO", Row: 5},
+		{Task: "Water plants / Call mom", Priority: "p4", Project: "Groceries", Notes: []string{`due date "someday" not understood`}, Row: 6},
+	}, items)
+
+	assert.Equal([]*SkipError{
+		{Row: 1, Task: "Errands", Reason: "section"},
+		{Row: 4, Task: "Ask for a discount", Reason: "note"},
+	}, skips)
+
+	_, err := Todoist.NewDecoder(strings.NewReader("task,done\nBuy milk,false\n"), "todos.csv")
+	assert.Error(err)
+}
+
+func Test_DecodeTodoistJSON(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := `{
+	  "projects": [{"id": "1", "name": "Inbox", "inbox_project": true}, {"id": "2", "name": "Home"}],
+	  "labels": [{"id": 7, "name": "chores"}],
+	  "items": [
+	    {"id": "10", "content": "Paint fence", "project_id": "2", "priority": 4, "labels": ["work", 7],
+	     "due": {"date": "2026-11-02", "string": "Nov 2", "is_recurring": false}},
+	    {"id": "11", "content": "Buy paint", "project_id": "2", "parent_id": "10", "priority": 1, "checked": true},
+	    {"id": "12", "content": "Stretch", "project_id": "1", "priority": 2,
+	     "due": {"date": "2026-11-03T07:00:00Z", "string": "every day at 7am", "is_recurring": true}},
+	    {"id": "13", "content": "Old idea", "project_id": "1", "is_deleted": true}
+	  ]
+	}`
+
+	items, skips := decodeSource(t, Todoist, doc, "todoist.json")
+
+	assert.Equal([]*Item{
+		{Task: "Paint fence", Priority: "p1", Project: "Home", Labels: []string{"work", "chores"}, DueAt: date(2026, 11, 2), Row: 1},
+		{Task: "Paint fence / Buy paint", Done: true, Priority: "p4", Project: "Home", Row: 2},
+		{Task: "Stretch", Priority: "p3", Recurrence: "FREQ=DAILY", DueAt: func() *time.Time {
+			d := time.Date(2026, 11, 3, 7, 0, 0, 0, time.UTC)
+			return &d
+		}(), Row: 3},
+	}, items)
+	assert.Equal([]*SkipError{{Row: 4, Task: "Old idea", Reason: "deleted"}}, skips)
+
+	items, _ = decodeSource(t, Todoist, `[{"id": 1, "content": "Read", "is_completed": true}]`, "")
+	assert.Equal([]*Item{{Task: "Read", Done: true, Row: 1}}, items)
+}
+
+func Test_DecodeGoogleTasks(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := `{"kind": "tasks#taskLists", "items": [
+	  {"kind": "tasks#taskList", "title": "My Tasks", "items": [
+	    {"id": "a", "title": "Plan trip", "status": "needsAction", "due": "2026-12-01T00:00:00.000Z"},
+	    {"id": "b", "title": "Book hotel", "status": "completed", "parent": "a", "completed": "2026-10-01T10:00:00.000Z"},
+	    {"id": "c", "title": "Gone", "status": "needsAction", "deleted": true},
+	    {"id": "d", "title": " ", "status": "needsAction"}
+	  ]}
+	]}`
+
+	items, skips := decodeSource(t, GoogleTasks, doc, "Tasks.json")
+
+	completed := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal([]*Item{
+		{Task: "Plan trip", Project: "My Tasks", DueAt: date(2026, 12, 1), Row: 1},
+		{Task: "Plan trip / Book hotel", Done: true, Project: "My Tasks", CompletedAt: &completed, Row: 2},
+	}, items)
+	assert.Equal([]*SkipError{{Row: 3, Task: "Gone", Reason: "deleted"}, {Row: 4, Reason: "no title"}}, skips)
+}
+
+func Test_DecodeMicrosoftToDo(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := `{"value": [
+	  {"displayName": "Tasks", "wellknownListName": "defaultList", "tasks": [
+	    {"title": "Pay rent", "status": "notStarted", "importance": "high", "categories": ["Home"],
+	     "dueDateTime": {"dateTime": "2026-11-01T00:00:00.0000000", "timeZone": "Europe/Berlin"},
+	     "recurrence": {"pattern": {"type": "absoluteMonthly", "interval": 1}}}
+	  ]},
+	  {"displayName": "Trip", "wellknownListName": "none", "tasks": [
+	    {"title": "Pack", "status": "completed", "importance": "normal",
+	     "completedDateTime": {"dateTime": "2026-10-02T08:00:00.0000000", "timeZone": "UTC"},
+	     "checklistItems": [{"displayName": "Socks", "isChecked": false}]},
+	    {"title": "Gym", "status": "notStarted", "importance": "low",
+	     "recurrence": {"pattern": {"type": "weekly", "interval": 2, "daysOfWeek": ["monday", "thursday"]}}},
+	    {"title": "", "status": "notStarted"}
+	  ]}
+	]}`
+
+	items, skips := decodeSource(t, MicrosoftToDo, doc, "todo.json")
+
+	completed := time.Date(2026, 10, 2, 8, 0, 0, 0, time.UTC)
+	assert.Equal([]*Item{
+		{Task: "Pay rent", Priority: "high", Labels: []string{"Home"}, DueAt: date(2026, 11, 1), Recurrence: "FREQ=MONTHLY", Row: 1},
+		{Task: "Pack", Done: true, Priority: "normal", Project: "Trip", CompletedAt: &completed, Row: 2},
+		{Task: "Pack / Socks", Done: true, Priority: "normal", Project: "Trip", Row: 3},
+		{Task: "Gym", Priority: "low", Project: "Trip", Recurrence: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", Row: 4},
+	}, items)
+	assert.Equal([]*SkipError{{Row: 5, Reason: "no title"}}, skips)
+
+	items, _ = decodeSource(t, MicrosoftToDo, `[{"displayName": "Work", "tasks": [{"title": "Report"}]}]`, "")
+	assert.Equal([]*Item{{Task: "Report", Project: "Work", Row: 1}}, items)
+}
+
+func Test_RulesLabels(t *testing.T) {
+	assert := asserts.New(t)
+
+	categories := []string{"work", "home"}
+	r := Rules{Categories: map[string]string{"office": "work"}}
+
+	it := &Item{Task: "Fix sink", Labels: []string{"urgent", "Home", "needs parts"}}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal(&Item{Task: "Fix sink #urgent #needs_parts", Category: "home", Priority: "low"}, it)
+
+	it = &Item{Task: "Report", Labels: []string{"Office", "home"}}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal(&Item{Task: "Report #home", Category: "work", Priority: "low"}, it)
+
+	it = &Item{Task: "Report", Category: "home", Labels: []string{"work"}}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal(&Item{Task: "Report #work", Category: "home", Priority: "low"}, it)
+}
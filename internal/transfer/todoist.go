@@ -0,0 +1,365 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todoist reads the CSV export of a Todoist project and the JSON of its API. Priorities are p1 (the
+// highest) to p4, as in the app. Labels are @words in CSV tasks. Subtasks are todos of their own.
+var Todoist = registerSource(&Source{
+	Name:       "todoist",
+	Priorities: map[string]string{"p1": "high", "p2": "medium", "p3": "low", "p4": "low"},
+	NewDecoder: func(r io.Reader, filename string) (*ListDecoder, error) {
+		br := bufio.NewReader(r)
+		if b, err := br.Peek(1); err == nil && (b[0] == '{' || b[0] == '[') {
+			return decodeTodoistJSON(br)
+		}
+
+		var project string
+		if filename != "" {
+			project = strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+		}
+		return decodeTodoistCSV(br, project)
+	},
+})
+
+// todoistLabel is a label in a CSV task.
+var todoistLabel = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// todoistDateLayouts are the layouts of the dates in Todoist CSV exports, after those of parseTime.
+var todoistDateLayouts = []string{"Jan 2 2006", "Jan 2, 2006", "2 Jan 2006", "January 2 2006", "January 2, 2006", "2 January 2006"}
+
+// todoistDue reads a due date or a recurring due date in the words of Todoist, such as "every monday".
+func todoistDue(it *Item, s string) {
+	if s = strings.TrimSpace(s); s == "" {
+		return
+	}
+
+	if rule, ok := todoistRecurrence(s); ok {
+		it.Recurrence = rule
+		return
+	} else if rule != "" {
+		it.Notes = append(it.Notes, fmt.Sprintf("recurrence %q not understood", s))
+		return
+	}
+
+	if t, err := parseTime(s); err == nil {
+		it.DueAt = t
+		return
+	}
+	for _, layout := range todoistDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			it.DueAt = &t
+			return
+		}
+	}
+	it.Notes = append(it.Notes, fmt.Sprintf("due date %q not understood", s))
+}
+
+// todoistRecurrence turns a recurring date such as "every 2 weeks" or "every mon, fri at 9am" into an
+// RRULE. It returns ok false with the text if the text is recurring but not understood, and without it
+// if the text is not recurring.
+func todoistRecurrence(s string) (string, bool) {
+	text := strings.ToLower(s)
+
+	switch text {
+	case "daily", "weekly", "monthly", "yearly":
+		return "FREQ=" + strings.ToUpper(text), true
+	}
+
+	for _, prefix := range []string{"every ", "ev "} {
+		if strings.HasPrefix(text, prefix) {
+			text = strings.TrimPrefix(text, prefix)
+			break
+		}
+	}
+	if text == strings.ToLower(s) {
+		return "", false
+	}
+
+	for _, sep := range []string{" at ", " starting ", " from ", " until ", " for "} {
+		text, _, _ = strings.Cut(text, sep)
+	}
+	text = strings.TrimSpace(text)
+
+	interval := 1
+	if strings.HasPrefix(text, "other ") {
+		interval, text = 2, strings.TrimPrefix(text, "other ")
+	} else if n, rest, ok := strings.Cut(text, " "); ok {
+		if i, err := strconv.Atoi(n); err == nil && i > 0 {
+			interval, text = i, rest
+		}
+	}
+
+	freq := ""
+	switch strings.TrimSuffix(text, "s") {
+	case "day":
+		freq = "DAILY"
+	case "week":
+		freq = "WEEKLY"
+	case "month":
+		freq = "MONTHLY"
+	case "year":
+		freq = "YEARLY"
+	case "weekday", "workday":
+		if interval > 1 {
+			return s, false
+		}
+		return "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", true
+	}
+
+	if freq != "" {
+		if interval > 1 {
+			return fmt.Sprintf("FREQ=%s;INTERVAL=%d", freq, interval), true
+		}
+		return "FREQ=" + freq, true
+	}
+
+	var days []string
+	for _, f := range strings.FieldsFunc(strings.ReplaceAll(text, " and ", ","), func(r rune) bool { return r == ',' || r == ' ' }) {
+		d, ok := weekdays[f]
+		if !ok {
+			return s, false
+		}
+		days = append(days, d)
+	}
+	if len(days) == 0 || interval > 1 {
+		return s, false
+	}
+	return "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ","), true
+}
+
+// todoistTask takes the labels out of a CSV task.
+func todoistTask(content string) (string, []string) {
+	var labels []string
+	for _, m := range todoistLabel.FindAllStringSubmatch(content, -1) {
+		labels = append(labels, m[2])
+	}
+
+	task := todoistLabel.ReplaceAllString(content, "$1")
+	task = strings.TrimPrefix(strings.Join(strings.Fields(task), " "), "* ")
+	return task, labels
+}
+
+// decodeTodoistCSV reads the CSV export of a project, which has the TYPE, CONTENT, PRIORITY, INDENT and
+// DATE columns among others. Its rows are tasks, sections and notes; INDENT nests tasks.
+func decodeTodoistCSV(r io.Reader, project string) (*ListDecoder, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the CSV file has no header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))] = i
+	}
+	for _, name := range []string{"TYPE", "CONTENT"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV file has no %s column, expected a Todoist export", name)
+		}
+	}
+
+	var (
+		d       = &ListDecoder{}
+		parents []string
+	)
+
+	for _, record := range records[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		switch strings.ToLower(field("TYPE")) {
+		case "":
+			continue
+		case "task":
+		case "section":
+			d.skip(field("CONTENT"), "section")
+			continue
+		default:
+			d.skip(field("CONTENT"), field("TYPE"))
+			continue
+		}
+
+		task, labels := todoistTask(field("CONTENT"))
+		it := &Item{Project: project, Labels: labels}
+
+		indent, err := strconv.Atoi(field("INDENT"))
+		if err != nil || indent < 1 {
+			indent = 1
+		}
+		if indent > len(parents)+1 {
+			indent = len(parents) + 1
+		}
+		parents = append(parents[:indent-1], task)
+		it.Task = strings.Join(parents, subtaskSep)
+
+		if p := field("PRIORITY"); p != "" {
+			it.Priority = "p" + p
+		}
+		todoistDue(it, field("DATE"))
+		d.add(it)
+	}
+	return d, nil
+}
+
+// todoistID is an id of the Todoist API, which are strings in newer versions and numbers in older ones.
+type todoistID string
+
+func (id *todoistID) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	*id = todoistID(strings.Trim(string(b), `"`))
+	return nil
+}
+
+type todoistItem struct {
+	ID          todoistID   `json:"id"`
+	Content     string      `json:"content"`
+	ProjectID   todoistID   `json:"project_id"`
+	ParentID    todoistID   `json:"parent_id"`
+	Priority    int         `json:"priority"`
+	Labels      []todoistID `json:"labels"`
+	Checked     bool        `json:"checked"`
+	IsCompleted bool        `json:"is_completed"`
+	IsDeleted   bool        `json:"is_deleted"`
+	CompletedAt *time.Time  `json:"completed_at"`
+	AddedAt     *time.Time  `json:"added_at"`
+	Due         *struct {
+		Date        string `json:"date"`
+		Datetime    string `json:"datetime"`
+		String      string `json:"string"`
+		IsRecurring bool   `json:"is_recurring"`
+	} `json:"due"`
+}
+
+type todoistExport struct {
+	Projects []struct {
+		ID           todoistID `json:"id"`
+		Name         string    `json:"name"`
+		InboxProject bool      `json:"inbox_project"`
+		IsInbox      bool      `json:"is_inbox_project"`
+	} `json:"projects"`
+	Labels []struct {
+		ID   todoistID `json:"id"`
+		Name string    `json:"name"`
+	} `json:"labels"`
+	Items []todoistItem `json:"items"`
+	Tasks []todoistItem `json:"tasks"`
+}
+
+// decodeTodoistJSON reads the projects, labels and items of the sync API, or an array of tasks of the
+// REST API. API priorities are 4 for p1 down to 1 for p4.
+func decodeTodoistJSON(r io.Reader) (*ListDecoder, error) {
+	var (
+		export todoistExport
+		raw    json.RawMessage
+	)
+
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		err = json.Unmarshal(raw, &export.Tasks)
+	} else {
+		err = json.Unmarshal(raw, &export)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expected a Todoist export: %w", err)
+	}
+
+	projects := make(map[todoistID]string)
+	for _, p := range export.Projects {
+		if !p.InboxProject && !p.IsInbox {
+			projects[p.ID] = p.Name
+		}
+	}
+
+	labels := make(map[todoistID]string)
+	for _, l := range export.Labels {
+		labels[l.ID] = l.Name
+	}
+
+	items := append(export.Items, export.Tasks...)
+	byID := make(map[todoistID]*todoistItem, len(items))
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+
+	// task follows parents up to a depth that only cycles reach.
+	var task func(t *todoistItem, depth int) string
+	task = func(t *todoistItem, depth int) string {
+		p, ok := byID[t.ParentID]
+		if !ok || t.ParentID == "" || depth > 10 {
+			return t.Content
+		}
+		return subtask(task(p, depth+1), t.Content)
+	}
+
+	d := &ListDecoder{}
+	for i := range items {
+		t := &items[i]
+		if t.IsDeleted {
+			d.skip(t.Content, "deleted")
+			continue
+		}
+
+		it := &Item{
+			Task:        task(t, 0),
+			Done:        t.Checked || t.IsCompleted || t.CompletedAt != nil,
+			Project:     projects[t.ProjectID],
+			CreatedAt:   t.AddedAt,
+			CompletedAt: t.CompletedAt,
+		}
+
+		for _, l := range t.Labels {
+			if name, ok := labels[l]; ok {
+				it.Labels = append(it.Labels, name)
+			} else {
+				it.Labels = append(it.Labels, string(l))
+			}
+		}
+
+		if t.Priority >= 1 && t.Priority <= 4 {
+			it.Priority = fmt.Sprintf("p%d", 5-t.Priority)
+		}
+
+		if t.Due != nil {
+			if t.Due.IsRecurring {
+				todoistDue(it, t.Due.String)
+			}
+			if it.DueAt == nil {
+				date := t.Due.Datetime
+				if date == "" {
+					date = t.Due.Date
+				}
+				todoistDue(it, date)
+			}
+		}
+		d.add(it)
+	}
+	return d, nil
+}
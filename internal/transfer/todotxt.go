@@ -0,0 +1,179 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TodoTxt is the todo.txt format (https://github.com/todotxt/todo.txt). Priorities are (A) for high,
+// (B) for medium and (C) for low, and kept as pri: on completed todos. The project is +project with
+// the spaces replaced by underscores, the category @category, and due: and rrule: hold the due date and
+// the recurrence. Imports take (C) to (Z) as low.
+var TodoTxt = register(&Format{
+	Name:        "todotxt",
+	ContentType: "text/plain; charset=utf-8",
+	Extension:   "txt",
+	NewEncoder:  func(w io.Writer) Encoder { return &todoTxtEncoder{w: bufio.NewWriter(w)} },
+	NewDecoder: func(r io.Reader) Decoder {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 4096), maxLineSize)
+		return &todoTxtDecoder{sc: sc}
+	},
+})
+
+var (
+	todoTxtPriorities = map[string]string{"high": "A", "medium": "B", "low": "C"}
+	todoTxtPriority   = regexp.MustCompile(`^\(([A-Z])\)$`)
+	todoTxtDate       = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+const todoTxtDateLayout = "2006-01-02"
+
+type todoTxtEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *todoTxtEncoder) Encode(it *Item) error {
+	var (
+		fields []string
+		pri    = todoTxtPriorities[it.Priority]
+	)
+
+	switch {
+	case it.Done:
+		fields = append(fields, "x")
+		if it.CompletedAt != nil {
+			fields = append(fields, it.CompletedAt.UTC().Format(todoTxtDateLayout))
+		}
+	case pri != "":
+		fields = append(fields, "("+pri+")")
+	}
+
+	// The creation date can only follow a completion date.
+	if it.CreatedAt != nil && (!it.Done || it.CompletedAt != nil) {
+		fields = append(fields, it.CreatedAt.UTC().Format(todoTxtDateLayout))
+	}
+
+	fields = append(fields, strings.Fields(it.Task)...)
+
+	if it.Project != "" {
+		fields = append(fields, "+"+strings.Join(strings.Fields(it.Project), "_"))
+	}
+	if it.Category != "" {
+		fields = append(fields, "@"+it.Category)
+	}
+	if it.DueAt != nil {
+		fields = append(fields, "due:"+it.DueAt.UTC().Format(todoTxtDateLayout))
+	}
+	if it.Recurrence != "" {
+		fields = append(fields, "rrule:"+it.Recurrence)
+	}
+	if it.Done && pri != "" {
+		fields = append(fields, "pri:"+pri)
+	}
+
+	_, err := e.w.WriteString(strings.Join(fields, " ") + "\n")
+	return err
+}
+
+func (e *todoTxtEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type todoTxtDecoder struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func todoTxtPriorityName(letter string) string {
+	switch letter {
+	case "A":
+		return "high"
+	case "B":
+		return "medium"
+	}
+	return "low"
+}
+
+func (d *todoTxtDecoder) Decode() (*Item, error) {
+	for d.sc.Scan() {
+		d.line++
+
+		fields := strings.Fields(d.sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		it, err := parseTodoTxt(fields)
+		if err != nil {
+			return nil, &RowError{Row: d.line, Err: err}
+		}
+		it.Row = d.line
+		return it, nil
+	}
+
+	if err := d.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func parseTodoTxt(fields []string) (*Item, error) {
+	var (
+		it   = &Item{}
+		date = func() (*time.Time, error) {
+			if len(fields) == 0 || !todoTxtDate.MatchString(fields[0]) {
+				return nil, nil
+			}
+			t, err := time.Parse(todoTxtDateLayout, fields[0])
+			fields = fields[1:]
+			return &t, err
+		}
+		err error
+	)
+
+	if fields[0] == "x" {
+		it.Done, fields = true, fields[1:]
+		if it.CompletedAt, err = date(); err != nil {
+			return nil, err
+		}
+	} else if m := todoTxtPriority.FindStringSubmatch(fields[0]); m != nil {
+		it.Priority, fields = todoTxtPriorityName(m[1]), fields[1:]
+	}
+
+	if it.CreatedAt, err = date(); err != nil {
+		return nil, err
+	}
+
+	var task []string
+	for _, f := range fields {
+		key, value, _ := strings.Cut(f, ":")
+
+		switch {
+		case len(f) > 1 && f[0] == '+' && it.Project == "":
+			it.Project = strings.ReplaceAll(f[1:], "_", " ")
+		case len(f) > 1 && f[0] == '@' && it.Category == "":
+			it.Category = f[1:]
+		case key == "due" && value != "":
+			if it.DueAt, err = parseTime(value); err != nil {
+				return nil, err
+			}
+		case key == "rrule" && value != "":
+			it.Recurrence = value
+		case key == "pri" && len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z':
+			it.Priority = todoTxtPriorityName(value)
+		default:
+			task = append(task, f)
+		}
+	}
+
+	if len(task) == 0 {
+		return nil, fmt.Errorf("missing task")
+	}
+	it.Task = strings.Join(task, " ")
+	return it, nil
+}
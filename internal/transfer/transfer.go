@@ -0,0 +1,161 @@
+// Package transfer reads and writes todos in the file formats of exports and imports: JSON, CSV,
+// Markdown checklists and todo.txt. It also reads the exports of other todo apps.
+package transfer
+
+import (
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Item is a todo as it is exported and imported. Projects are referred to by name.
+type Item struct {
+	Task        string     `json:"task"`
+	Done        bool       `json:"done"`
+	Category    string     `json:"category,omitempty"`
+	Priority    string     `json:"priority,omitempty"`
+	Project     string     `json:"project,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+
+	// Labels are tags of the item in the tool it comes from. Rules turn them into the category and
+	// hashtags of the task.
+	Labels []string `json:"labels,omitempty"`
+
+	// Notes tell what a decoder had to leave out of the item, such as a due date it didn't understand.
+	Notes []string `json:"-"`
+
+	// Row is where a decoder found the item: the line in text formats and the position in the array in
+	// JSON.
+	Row int `json:"-"`
+}
+
+// FromTodo returns the item of a todo in the project with the given name.
+func FromTodo(t *pkg.TodoResponse, project string) *Item {
+	return &Item{
+		Task:        t.Task,
+		Done:        t.CompletedAt != nil,
+		Category:    t.Category,
+		Priority:    t.Priority,
+		Project:     project,
+		DueAt:       t.DueAt,
+		CreatedAt:   t.CreatedAt,
+		CompletedAt: t.CompletedAt,
+		Recurrence:  t.Recurrence,
+	}
+}
+
+// Encoder writes items one at a time, so that exports are never held in memory as a whole. Close
+// writes the end of the document and flushes it.
+type Encoder interface {
+	Encode(it *Item) error
+	Close() error
+}
+
+// Decoder reads items and returns io.EOF after the last one. Rows it can't read are reported as
+// *RowError and rows it leaves out as *SkipError, after which it continues with the next row. Other
+// errors end the document.
+type Decoder interface {
+	Decode() (*Item, error)
+}
+
+// RowError is an error in one row of an imported document.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// SkipError is an item a decoder left out on purpose, such as a deleted task or a comment.
+type SkipError struct {
+	Row    int
+	Task   string
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("row %d skipped: %s", e.Row, e.Reason)
+}
+
+// Format is a file format with its codec.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	NewEncoder  func(w io.Writer) Encoder
+	NewDecoder  func(r io.Reader) Decoder
+}
+
+var formats = map[string]*Format{}
+
+func register(f *Format) *Format {
+	formats[f.Name] = f
+	return f
+}
+
+// Lookup returns the format with the name.
+func Lookup(name string) (*Format, bool) {
+	f, ok := formats[strings.ToLower(name)]
+	return f, ok
+}
+
+// ByExtension returns the format of a file name's extension.
+func ByExtension(filename string) (*Format, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	for _, f := range formats {
+		if f.Extension == ext {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of the formats in order.
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dateLayouts are the layouts of dates and times in text formats, after RFC 3339.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime reads a date or a time. Times without a zone are UTC.
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date: %s", s)
+}
+
+// formatDate writes a time as a date if it is midnight UTC and as RFC 3339 otherwise.
+func formatDate(t time.Time) string {
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
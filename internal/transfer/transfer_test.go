@@ -0,0 +1,223 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	asserts "github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) *time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+// decodeAll reads a document into items and row errors.
+func decodeAll(t *testing.T, d Decoder) ([]*Item, []*RowError) {
+	var (
+		items []*Item
+		rows  []*RowError
+	)
+
+	for {
+		it, err := d.Decode()
+		if err == io.EOF {
+			return items, rows
+		}
+
+		var re *RowError
+		if errors.As(err, &re) {
+			rows = append(rows, re)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, it)
+	}
+}
+
+func Test_RoundTrip(t *testing.T) {
+	assert := asserts.New(t)
+
+	items := []*Item{
+		{Task: "Buy milk", Category: "home", Priority: "high", DueAt: date(2026, 1, 9), CreatedAt: date(2026, 1, 2)},
+		{Task: "Ship it", Done: true, Category: "work", Priority: "medium", Project: "Release 2", CreatedAt: date(2026, 1, 2), CompletedAt: date(2026, 1, 5)},
+		{Task: "Stand-up, daily", Category: "work", Priority: "low", Project: "Release 2", Recurrence: "FREQ=DAILY", CreatedAt: date(2026, 1, 3)},
+	}
+
+	for _, name := range Names() {
+		f, _ := Lookup(name)
+
+		var buf bytes.Buffer
+		enc := f.NewEncoder(&buf)
+		for _, it := range items {
+			assert.NoError(enc.Encode(it), name)
+		}
+		assert.NoError(enc.Close(), name)
+
+		got, rows := decodeAll(t, f.NewDecoder(&buf))
+		assert.Empty(rows, name)
+		if !assert.Len(got, len(items), name) {
+			continue
+		}
+
+		for i := range items {
+			assert.Equal(items[i].Task, got[i].Task, name)
+			assert.Equal(items[i].Done, got[i].Done, name)
+			assert.Equal(items[i].Category, got[i].Category, name)
+			assert.Equal(items[i].Priority, got[i].Priority, name)
+			assert.Equal(items[i].Project, got[i].Project, name)
+			assert.Equal(items[i].DueAt, got[i].DueAt, name)
+			assert.Equal(items[i].Recurrence, got[i].Recurrence, name)
+			assert.NotZero(got[i].Row, name)
+		}
+	}
+}
+
+func Test_EmptyExport(t *testing.T) {
+	assert := asserts.New(t)
+
+	for _, name := range Names() {
+		f, _ := Lookup(name)
+
+		var buf bytes.Buffer
+		assert.NoError(f.NewEncoder(&buf).Close(), name)
+
+		got, rows := decodeAll(t, f.NewDecoder(&buf))
+		assert.Empty(got, name)
+		assert.Empty(rows, name)
+	}
+}
+
+func Test_Formats(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal([]string{"csv", "json", "md", "todotxt"}, Names())
+
+	f, ok := ByExtension("backup.TXT")
+	assert.True(ok)
+	assert.Equal(TodoTxt, f)
+
+	_, ok = ByExtension("backup.xlsx")
+	assert.False(ok)
+
+	f, ok = Lookup("CSV")
+	assert.True(ok)
+	assert.Equal(CSV, f)
+}
+
+func Test_DecodeCSV(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := "\uFEFFPriority,Task,Done,Due_At\n" +
+		"high,Buy milk,yes,2026-01-09\n" +
+		"low,Bad date,,someday\n" +
+		"low,Bad done,maybe,\n" +
+		"\"unterminated,x\n"
+
+	items, rows := decodeAll(t, CSV.NewDecoder(strings.NewReader(doc)))
+	if assert.Len(items, 1) {
+		assert.Equal(&Item{Task: "Buy milk", Done: true, Priority: "high", DueAt: date(2026, 1, 9), Row: 2}, items[0])
+	}
+	if assert.Len(rows, 3) {
+		assert.Equal(3, rows[0].Row)
+		assert.Contains(rows[0].Error(), "due_at: invalid date: someday")
+		assert.Equal(4, rows[1].Row)
+	}
+
+	_, err := CSV.NewDecoder(strings.NewReader("name,done\nx,y\n")).Decode()
+	assert.EqualError(err, "the CSV file has no task column")
+}
+
+func Test_DecodeJSON(t *testing.T) {
+	assert := asserts.New(t)
+
+	items, rows := decodeAll(t, JSON.NewDecoder(strings.NewReader(`[{"task": "a"}, {"task": 5}, {"task": "c", "done": true}]`)))
+	assert.Len(items, 2)
+	assert.Equal(3, items[1].Row)
+	if assert.Len(rows, 1) {
+		assert.Equal(2, rows[0].Row)
+	}
+
+	_, err := JSON.NewDecoder(strings.NewReader(`{"task": "a"}`)).Decode()
+	assert.Error(err)
+}
+
+func Test_DecodeMarkdown(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := "# Plans\n\nSome prose.\n\n- [ ] Inbox item\n## Garden\n* [X] Mow *(priority: high, due: 2026-01-09)*\n" +
+		"- plain list item\n- [ ] Bad *(when: later)*\n# Other\n- [ ] Last\n"
+
+	items, rows := decodeAll(t, Markdown.NewDecoder(strings.NewReader(doc)))
+	assert.Equal([]*Item{
+		{Task: "Inbox item", Row: 5},
+		{Task: "Mow", Done: true, Priority: "high", Project: "Garden", DueAt: date(2026, 1, 9), Row: 7},
+		{Task: "Last", Row: 11},
+	}, items)
+	if assert.Len(rows, 1) {
+		assert.Equal(9, rows[0].Row)
+	}
+}
+
+func Test_DecodeTodoTxt(t *testing.T) {
+	assert := asserts.New(t)
+
+	doc := "(A) 2026-01-02 Call Mom +Family_Stuff @home due:2026-01-09 http://example.com\n" +
+		"\n" +
+		"x 2026-01-05 2026-01-01 Pay rent pri:B\n" +
+		"(D) Someday\n" +
+		"(A) +Empty @home\n"
+
+	items, rows := decodeAll(t, TodoTxt.NewDecoder(strings.NewReader(doc)))
+	assert.Equal([]*Item{
+		{Task: "Call Mom http://example.com", Priority: "high", Project: "Family Stuff", Category: "home", DueAt: date(2026, 1, 9), CreatedAt: date(2026, 1, 2), Row: 1},
+		{Task: "Pay rent", Done: true, Priority: "medium", CompletedAt: date(2026, 1, 5), CreatedAt: date(2026, 1, 1), Row: 3},
+		{Task: "Someday", Priority: "low", Row: 4},
+	}, items)
+	if assert.Len(rows, 1) {
+		assert.Equal(5, rows[0].Row)
+	}
+}
+
+func Test_Rules(t *testing.T) {
+	assert := asserts.New(t)
+
+	categories := []string{"work", "home"}
+
+	m, err := ParseMapping(" Errands = home, p1=high,")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"errands": "home", "p1": "high"}, m)
+
+	_, err = ParseMapping("nothing")
+	assert.Error(err)
+
+	r := &Rules{Categories: map[string]string{"errands": "home"}, Priorities: map[string]string{"urgent": "high"}}
+	assert.NoError(r.Validate(categories))
+
+	it := &Item{Category: "Errands", Priority: "URGENT"}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal("home", it.Category)
+	assert.Equal("high", it.Priority)
+
+	it = &Item{}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal("work", it.Category)
+	assert.Equal("low", it.Priority)
+
+	assert.EqualError(r.Apply(&Item{Category: "garden"}, categories), "unknown category value: garden")
+	assert.EqualError(r.Apply(&Item{Priority: "p9"}, categories), "unknown priority value: p9")
+
+	r = &Rules{DefaultCategory: "home", DefaultPriority: "medium"}
+	it = &Item{Category: "garden", Priority: "p9"}
+	assert.NoError(r.Apply(it, categories))
+	assert.Equal("home", it.Category)
+	assert.Equal("medium", it.Priority)
+
+	assert.Error((&Rules{DefaultCategory: "garden"}).Validate(categories))
+	assert.Error((&Rules{Priorities: map[string]string{"a": "urgent"}}).Validate(categories))
+}
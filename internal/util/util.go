@@ -1,5 +1,7 @@
 package util
 
+import "net"
+
 func Contains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -8,3 +10,10 @@ func Contains(s []string, e string) bool {
 	}
 	return false
 }
+
+// PublicIP reports whether ip is a globally routable unicast address, as opposed to the loopback,
+// private, link-local, unspecified and multicast ones.
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
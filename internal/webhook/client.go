@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/internal/util"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrAddress is returned for deliveries to addresses that are not public.
+var ErrAddress = errors.New("webhook: address is not public")
+
+// NewClient returns a client for deliveries that only connects to public addresses, so that webhooks
+// cannot reach into the network of the service. Addresses are checked once host names are resolved,
+// which covers names that resolve to private addresses too. Redirects are not followed, their
+// responses count as failed attempts.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicOnly}
+
+	// A proxy would be the only address dialed, so none is used.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicOnly is a net.Dialer Control function that refuses connections to addresses that are not public.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !util.PublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrAddress, host)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_PublicOnly(t *testing.T) {
+	assert := asserts.New(t)
+
+	for _, address := range []string{
+		"127.0.0.1:80",
+		"10.0.0.1:443",
+		"172.31.255.255:80",
+		"192.168.0.10:80",
+		"169.254.169.254:80",
+		"0.0.0.0:80",
+		"224.0.0.1:80",
+		"[::1]:443",
+		"[::]:80",
+		"[fc00::1]:80",
+		"[fe80::1%25eth0]:80",
+		"[::ffff:10.0.0.1]:80",
+	} {
+		assert.True(errors.Is(publicOnly("tcp", address, nil), ErrAddress), address)
+	}
+
+	for _, address := range []string{"93.184.216.34:443", "[2606:4700::6810:84e5]:443"} {
+		assert.NoError(publicOnly("tcp", address, nil), address)
+	}
+}
+
+func Test_ClientRefusesPrivateAddresses(t *testing.T) {
+	assert := asserts.New(t)
+
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{active: true, deliveries: []*memoryDelivery{{
+		job:    Job{DeliveryID: 1, WebhookID: 1, URL: receiver.URL, Secret: "s", Event: pkg.EventTodoCreated, Payload: []byte(`{}`)},
+		status: pkg.WebhookPending,
+	}}}
+
+	d := &Dispatcher{Store: store, Client: NewClient(time.Second), MaxAttempts: 3, BatchSize: 10}
+
+	n, err := d.Dispatch(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.False(called)
+
+	if a := store.deliveries[0].log; assert.Len(a, 1) {
+		assert.Contains(a[0].Error, ErrAddress.Error())
+		assert.Zero(a[0].StatusCode)
+	}
+}
+
+func Test_ClientDoesNotFollowRedirects(t *testing.T) {
+	assert := asserts.New(t)
+
+	req := httptest.NewRequest(http.MethodPost, "https://hooks.example.com/todo", nil)
+	assert.Equal(http.ErrUseLastResponse, NewClient(time.Second).CheckRedirect(req, []*http.Request{req}))
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Job is a delivery that is due, with what it takes to send it.
+type Job struct {
+	DeliveryID int64
+	WebhookID  int64
+	URL        string
+	Secret     string
+	Event      string
+	Payload    []byte
+	Attempts   int
+}
+
+// Store is the persistent queue of deliveries.
+type Store interface {
+	// ClaimDeliveries returns up to limit pending deliveries of active webhooks that are due, and
+	// hides them from other claims for the lease, so that several instances can dispatch at once.
+	ClaimDeliveries(now time.Time, limit int, lease time.Duration) ([]Job, error)
+
+	// RecordAttempt logs the attempt and moves the delivery to status, to be tried again at next if it
+	// is still pending. A failed attempt counts against the webhook, which is disabled after
+	// disableAfter failures in a row. A successful one clears its count.
+	RecordAttempt(job *Job, a *pkg.WebhookAttempt, status string, next time.Time, disableAfter int) error
+}
+
+// Dispatcher sends due deliveries and schedules retries of failed ones.
+type Dispatcher struct {
+	Store  Store
+	Client *http.Client
+
+	// MaxAttempts is the number of attempts after which a delivery is dead.
+	MaxAttempts int
+
+	// DisableAfter is the number of failed attempts in a row after which a webhook is disabled.
+	DisableAfter int
+
+	// BatchSize is the number of deliveries claimed at once.
+	BatchSize int
+}
+
+const claimLease = 5 * time.Minute
+
+// Dispatch sends the deliveries that are due and returns how many were attempted.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	jobs, err := d.Store.ClaimDeliveries(time.Now(), d.BatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		a := d.send(ctx, job)
+
+		var (
+			status = pkg.WebhookSucceeded
+			next   time.Time
+		)
+
+		if a.Error != "" {
+			status, next = pkg.WebhookPending, time.Now().Add(Backoff(job.Attempts+1))
+			if job.Attempts+1 >= d.MaxAttempts {
+				status = pkg.WebhookDead
+			}
+		}
+
+		if err = d.Store.RecordAttempt(job, a, status, next, d.DisableAfter); err != nil {
+			return i, err
+		}
+	}
+	return len(jobs), nil
+}
+
+// send posts the payload once. Any response other than 2xx is a failure.
+func (d *Dispatcher) send(ctx context.Context, job *Job) *pkg.WebhookAttempt {
+	var (
+		start = time.Now()
+		a     = &pkg.WebhookAttempt{}
+	)
+
+	defer func() {
+		a.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Todo-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, job.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(job.DeliveryID, 10))
+	req.Header.Set(HeaderSignature, Sign(job.Secret, start, job.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	// Drain a bit of the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	a.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		a.Error = fmt.Sprintf("unexpected status %s", res.Status)
+	}
+	return a
+}
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"github.com/harsha-aqfer/todo/pkg"
+	asserts "github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type memoryDelivery struct {
+	job    Job
+	status string
+	next   time.Time
+	log    []pkg.WebhookAttempt
+}
+
+// memoryStore keeps the deliveries of a single webhook.
+type memoryStore struct {
+	deliveries []*memoryDelivery
+	active     bool
+	failures   int
+}
+
+func (ms *memoryStore) ClaimDeliveries(now time.Time, limit int, lease time.Duration) ([]Job, error) {
+	var jobs []Job
+	for _, d := range ms.deliveries {
+		if ms.active && d.status == pkg.WebhookPending && !d.next.After(now) && len(jobs) < limit {
+			d.next = now.Add(lease)
+			jobs = append(jobs, d.job)
+		}
+	}
+	return jobs, nil
+}
+
+func (ms *memoryStore) RecordAttempt(job *Job, a *pkg.WebhookAttempt, status string, next time.Time, disableAfter int) error {
+	for _, d := range ms.deliveries {
+		if d.job.DeliveryID == job.DeliveryID {
+			d.job.Attempts++
+			d.status, d.next = status, next
+			d.log = append(d.log, *a)
+		}
+	}
+
+	if a.Error == "" {
+		ms.failures = 0
+	} else if ms.failures++; disableAfter > 0 && ms.failures >= disableAfter {
+		ms.active = false
+	}
+	return nil
+}
+
+// due makes every pending delivery due, as if its backoff had passed.
+func (ms *memoryStore) due() {
+	for _, d := range ms.deliveries {
+		d.next = time.Time{}
+	}
+}
+
+func Test_Dispatcher(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		fail     = 1
+		received []string
+	)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if err := Verify("whsec_1", r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		received = append(received, r.Header.Get(HeaderEvent)+" "+r.Header.Get(HeaderDelivery)+" "+string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{active: true}
+	for i, event := range []string{pkg.EventTodoCreated, pkg.EventTodoCompleted} {
+		store.deliveries = append(store.deliveries, &memoryDelivery{
+			job: Job{
+				DeliveryID: int64(i + 1),
+				WebhookID:  1,
+				URL:        receiver.URL,
+				Secret:     "whsec_1",
+				Event:      event,
+				Payload:    []byte(`{"n":` + strconv.Itoa(i) + `}`),
+			},
+			status: pkg.WebhookPending,
+		})
+	}
+
+	d := &Dispatcher{Store: store, Client: receiver.Client(), MaxAttempts: 3, DisableAfter: 5, BatchSize: 10}
+
+	// The first delivery fails once and is retried after its backoff.
+	n, err := d.Dispatch(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	first := store.deliveries[0]
+	assert.Equal(pkg.WebhookPending, first.status)
+	assert.Equal(http.StatusInternalServerError, first.log[0].StatusCode)
+	assert.WithinDuration(time.Now().Add(30*time.Second), first.next, 5*time.Second)
+
+	n, err = d.Dispatch(context.Background())
+	assert.NoError(err)
+	assert.Zero(n)
+
+	store.due()
+
+	n, err = d.Dispatch(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, n)
+
+	assert.Equal(pkg.WebhookSucceeded, first.status)
+	assert.Equal(pkg.WebhookSucceeded, store.deliveries[1].status)
+	assert.Equal([]string{`todo.completed 2 {"n":1}`, `todo.created 1 {"n":0}`}, received)
+	assert.Zero(store.failures)
+}
+
+func Test_DispatcherGivesUp(t *testing.T) {
+	assert := asserts.New(t)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{active: true}
+	for i := 1; i <= 2; i++ {
+		store.deliveries = append(store.deliveries, &memoryDelivery{
+			job:    Job{DeliveryID: int64(i), WebhookID: 1, URL: receiver.URL, Secret: "whsec_1", Payload: []byte(`{}`)},
+			status: pkg.WebhookPending,
+		})
+	}
+
+	d := &Dispatcher{Store: store, Client: receiver.Client(), MaxAttempts: 2, DisableAfter: 3, BatchSize: 10}
+
+	for i := 0; i < 2; i++ {
+		_, err := d.Dispatch(context.Background())
+		assert.NoError(err)
+		store.due()
+	}
+
+	// Both deliveries failed twice, which makes them dead, and the failures in a row disabled the webhook.
+	for _, delivery := range store.deliveries {
+		assert.Equal(pkg.WebhookDead, delivery.status)
+		if assert.Len(delivery.log, 2) {
+			assert.Equal(http.StatusGone, delivery.log[1].StatusCode)
+		}
+	}
+	assert.False(store.active)
+
+	// Deliveries of disabled webhooks wait until it is enabled again.
+	store.deliveries = append(store.deliveries, &memoryDelivery{
+		job:    Job{DeliveryID: 3, WebhookID: 1, URL: receiver.URL, Secret: "whsec_1", Payload: []byte(`{}`)},
+		status: pkg.WebhookPending,
+	})
+
+	n, err := d.Dispatch(context.Background())
+	assert.NoError(err)
+	assert.Zero(n)
+}
@@ -0,0 +1,99 @@
+// Package webhook signs and delivers webhook payloads.
+//
+// Every delivery is a POST of a JSON payload with the headers:
+//
+//	Todo-Event:      the event type, e.g. todo.created
+//	Todo-Delivery:   the id of the delivery, the same across retries
+//	Todo-Signature:  t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed with the secret>
+//
+// Receivers check the signature with Verify and reject old timestamps to prevent replays.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderEvent     = "Todo-Event"
+	HeaderDelivery  = "Todo-Delivery"
+	HeaderSignature = "Todo-Signature"
+)
+
+var (
+	ErrSignature = errors.New("webhook: signature mismatch")
+	ErrTimestamp = errors.New("webhook: timestamp outside the tolerance")
+)
+
+func mac(secret string, t int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(h, "%d.", t)
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns the Todo-Signature header of a body sent at time t.
+func Sign(secret string, t time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), mac(secret, t.Unix(), body))
+}
+
+// Verify checks a Todo-Signature header against the body, and that it was made within tolerance of now.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var (
+		t    int64
+		sigs []string
+	)
+
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			var err error
+			if t, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return ErrSignature
+			}
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+
+	if t == 0 || len(sigs) == 0 {
+		return ErrSignature
+	}
+
+	if d := now.Sub(time.Unix(t, 0)); d > tolerance || d < -tolerance {
+		return ErrTimestamp
+	}
+
+	expected := mac(secret, t, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
+
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = 12 * time.Hour
+)
+
+// Backoff returns the delay before the next attempt of a delivery that failed attempts times: 30s,
+// doubling with every failure up to 12h.
+func Backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts && d < backoffMax; i++ {
+		d *= 2
+	}
+	if d > backoffMax {
+		d = backoffMax
+	}
+	return d
+}
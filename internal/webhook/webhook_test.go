@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	asserts "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SignVerify(t *testing.T) {
+	assert := asserts.New(t)
+
+	var (
+		now  = time.Unix(1760000000, 0)
+		body = []byte(`{"type":"todo.created"}`)
+		sig  = Sign("whsec_1", now, body)
+	)
+
+	assert.Regexp(`^t=1760000000,v1=[0-9a-f]{64}$`, sig)
+	assert.NoError(Verify("whsec_1", sig, body, 5*time.Minute, now.Add(time.Minute)))
+
+	assert.Equal(ErrSignature, Verify("whsec_2", sig, body, 5*time.Minute, now))
+	assert.Equal(ErrSignature, Verify("whsec_1", sig, []byte(`{}`), 5*time.Minute, now))
+	assert.Equal(ErrTimestamp, Verify("whsec_1", sig, body, 5*time.Minute, now.Add(10*time.Minute)))
+	assert.Equal(ErrSignature, Verify("whsec_1", "v1=abc", body, 5*time.Minute, now))
+
+	// Receivers accept any of several signatures, which allows rotating secrets.
+	assert.NoError(Verify("whsec_1", sig+",v1=0000", body, 5*time.Minute, now))
+}
+
+func Test_Backoff(t *testing.T) {
+	assert := asserts.New(t)
+
+	assert.Equal(30*time.Second, Backoff(1))
+	assert.Equal(time.Minute, Backoff(2))
+	assert.Equal(4*time.Minute, Backoff(4))
+	assert.Equal(12*time.Hour, Backoff(20))
+	assert.Equal(12*time.Hour, Backoff(1000))
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/harsha-aqfer/todo/pkg"
+	"net/http"
+)
+
+// SignUp creates an account. The user has to sign in afterwards.
+func (c *Client) SignUp(ctx context.Context, user *pkg.User) error {
+	return c.do(ctx, &call{method: http.MethodPost, path: "/v1/sign_up", body: user, public: true})
+}
+
+// SignIn signs the client in. For users with two-factor authentication it returns a
+// *MFARequiredError, and SignInMFA completes the sign-in.
+func (c *Client) SignIn(ctx context.Context, email, password string) error {
+	// The response is either a token or a challenge.
+	var raw json.RawMessage
+	if err := c.do(ctx, &call{
+		method: http.MethodPost,
+		path:   "/v1/sign_in",
+		body:   &pkg.User{Email: email, Password: password},
+		out:    &raw,
+		public: true,
+	}); err != nil {
+		return err
+	}
+
+	var mfa pkg.MFAChallenge
+	if err := json.Unmarshal(raw, &mfa); err != nil {
+		return err
+	}
+	if mfa.MFARequired {
+		return &MFARequiredError{Challenge: mfa}
+	}
+
+	var t pkg.Token
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return err
+	}
+	c.setToken(&t)
+	return nil
+}
+
+// SignInMFA completes a sign-in with the token of the challenge and a code of the user's
+// authenticator app, or a recovery code.
+func (c *Client) SignInMFA(ctx context.Context, mfaToken, code string) error {
+	var t pkg.Token
+	if err := c.do(ctx, &call{
+		method: http.MethodPost,
+		path:   "/v1/sign_in/mfa",
+		body:   &pkg.MFASignIn{MFAToken: mfaToken, Code: code},
+		out:    &t,
+		public: true,
+	}); err != nil {
+		return err
+	}
+	c.setToken(&t)
+	return nil
+}
+
+// SignOut ends the session of the client's token and forgets the token.
+func (c *Client) SignOut(ctx context.Context) error {
+	if err := c.do(ctx, &call{method: http.MethodPost, path: "/v1/sign_out"}); err != nil {
+		return err
+	}
+	c.SetToken(nil)
+	return nil
+}
@@ -0,0 +1,412 @@
+// Package client is a Go client of the todo API.
+//
+//	c := client.New("https://todo.example.com")
+//	if err := c.SignIn(ctx, "ann@example.com", "secret"); err != nil {
+//		return err
+//	}
+//	todo, err := c.CreateTodo(ctx, &pkg.TodoRequest{Task: "Buy milk"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshEarly is how long before its expiry a token is refreshed.
+const refreshEarly = 30 * time.Second
+
+// Client calls a todo server on behalf of a user. It keeps the user's token, refreshes it before it
+// expires or when the server rejects it, and retries idempotent calls that fail for reasons that may be
+// temporary. A Client is safe for concurrent use.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times an idempotent call is retried after a network error, a 429 or a
+	// 5xx response.
+	MaxRetries int
+
+	// RetryWait is the wait before the first retry. It doubles with every further one, up to
+	// MaxRetryWait. A server that asks to wait longer than MaxRetryWait is not retried.
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+
+	// OnToken, if set, is called with every token the client gets, so that it can be stored.
+	OnToken func(t *pkg.Token)
+
+	mu        sync.Mutex
+	token     *pkg.Token
+	expiresAt time.Time
+
+	// refreshing is the refresh in flight, if any.
+	refreshing *refreshFlight
+}
+
+// refreshFlight is a refresh of the token that other calls can wait for. Err is set before done is
+// closed.
+type refreshFlight struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a client of the server at baseURL, such as "https://todo.example.com".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   3,
+		RetryWait:    250 * time.Millisecond,
+		MaxRetryWait: 10 * time.Second,
+	}
+}
+
+// Token returns the current token, or nil if the client is not signed in.
+func (c *Client) Token() *pkg.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == nil {
+		return nil
+	}
+	t := *c.token
+	return &t
+}
+
+// SetToken signs the client in with a token it got earlier. Its expiry is unknown, so it is only
+// refreshed once the server rejects it.
+func (c *Client) SetToken(t *pkg.Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token, c.expiresAt = t, time.Time{}
+}
+
+// setToken stores a token the server just issued.
+func (c *Client) setToken(t *pkg.Token) {
+	c.mu.Lock()
+	c.token, c.expiresAt = t, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	c.mu.Unlock()
+
+	if c.OnToken != nil {
+		c.OnToken(t)
+	}
+}
+
+// accessToken returns the token to send, refreshed first if it is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	var (
+		token   string
+		refresh bool
+	)
+	if c.token != nil {
+		token = c.token.JWTToken
+		refresh = c.token.RefreshToken != "" && !c.expiresAt.IsZero() && time.Until(c.expiresAt) < refreshEarly
+	}
+	c.mu.Unlock()
+
+	if !refresh {
+		return token, nil
+	}
+	if err := c.refresh(ctx, token); err != nil {
+		return "", err
+	}
+	return c.Token().JWTToken, nil
+}
+
+// refresh exchanges the refresh token for a new token, unless the token is no longer stale because
+// another call refreshed it meanwhile. Calls that need a refresh while one is in flight wait for its
+// outcome instead of starting their own, since a refresh token works once and the server revokes the
+// session when one is used again.
+func (c *Client) refresh(ctx context.Context, stale string) error {
+	c.mu.Lock()
+
+	if c.token == nil || c.token.RefreshToken == "" {
+		c.mu.Unlock()
+		return ErrUnauthorized
+	}
+	if c.token.JWTToken != stale {
+		c.mu.Unlock()
+		return nil
+	}
+	if f := c.refreshing; f != nil {
+		c.mu.Unlock()
+
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f := &refreshFlight{done: make(chan struct{})}
+	refreshToken := c.token.RefreshToken
+	c.refreshing = f
+	c.mu.Unlock()
+
+	// A refresh is not retried, since the server may have used up the refresh token even if the
+	// response got lost.
+	var t pkg.Token
+	f.err = c.send(ctx, &call{
+		method: http.MethodPost,
+		path:   "/v1/token/refresh",
+		body:   &pkg.RefreshRequest{RefreshToken: refreshToken},
+		out:    &t,
+	}, "")
+
+	// The token stays as it is if the client was signed out or given another token meanwhile.
+	c.mu.Lock()
+	c.refreshing = nil
+	stored := f.err == nil && c.token != nil && c.token.RefreshToken == refreshToken
+	if stored {
+		c.token, c.expiresAt = &t, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	}
+	c.mu.Unlock()
+	close(f.done)
+
+	if stored && c.OnToken != nil {
+		c.OnToken(&t)
+	}
+	return f.err
+}
+
+// RequestOption sets a header of a call.
+type RequestOption func(h http.Header)
+
+// IfMatch makes an update or delete fail with ErrPreconditionFailed unless the todo is still at the
+// given revision.
+func IfMatch(revision int64) RequestOption {
+	return func(h http.Header) {
+		h.Set("If-Match", fmt.Sprintf(`"%d"`, revision))
+	}
+}
+
+// IdempotencyKey sets the key under which the server remembers the response of a create, so that
+// retries with the same key don't repeat it. Creates get a random key unless given one.
+func IdempotencyKey(key string) RequestOption {
+	return func(h http.Header) {
+		h.Set("Idempotency-Key", key)
+	}
+}
+
+// call is a request to the API and where its response goes.
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	out    interface{}
+	header http.Header
+
+	// public calls are made without a token.
+	public bool
+}
+
+func newCall(method, path string, opts []RequestOption) *call {
+	cl := &call{method: method, path: path, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(cl.header)
+	}
+	return cl
+}
+
+// idempotent reports whether the call can be repeated without effects beyond those of the first.
+func (cl *call) idempotent() bool {
+	switch cl.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return cl.header.Get("Idempotency-Key") != ""
+}
+
+// withIdempotencyKey gives the call a random idempotency key unless it has one.
+func (cl *call) withIdempotencyKey() (*call, error) {
+	if cl.header.Get("Idempotency-Key") != "" {
+		return cl, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	cl.header.Set("Idempotency-Key", hex.EncodeToString(b))
+	return cl, nil
+}
+
+// do makes a call, refreshing the token once if the server rejects it and retrying idempotent calls.
+func (c *Client) do(ctx context.Context, cl *call) error {
+	var (
+		refreshed bool
+		retries   int
+	)
+
+	for {
+		var token string
+		if !cl.public {
+			var err error
+			if token, err = c.accessToken(ctx); err != nil {
+				return err
+			}
+		}
+
+		err := c.send(ctx, cl, token)
+		if err == nil {
+			return nil
+		}
+
+		var e *Error
+		if errors.As(err, &e) && e.StatusCode == http.StatusUnauthorized && !cl.public && !refreshed {
+			refreshed = true
+			if rerr := c.refresh(ctx, token); rerr != nil {
+				if errors.Is(rerr, ErrUnauthorized) {
+					return err
+				}
+				return rerr
+			}
+			continue
+		}
+
+		if !cl.idempotent() || retries >= c.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		wait := backoff(c.RetryWait, c.MaxRetryWait, retries)
+		if e != nil && e.RetryAfter > wait {
+			if e.RetryAfter > c.MaxRetryWait {
+				return err
+			}
+			wait = e.RetryAfter
+		}
+		retries++
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// send makes a call once.
+func (c *Client) send(ctx context.Context, cl *call, token string) error {
+	u := c.BaseURL + cl.path
+	if len(cl.query) > 0 {
+		u += "?" + cl.query.Encode()
+	}
+
+	var body io.Reader
+	if cl.body != nil {
+		b, err := json.Marshal(cl.body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, cl.method, u, body)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range cl.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if cl.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// The context's error tells more than the transport's wrapping of it.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newError(res)
+	}
+
+	if cl.out == nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	if err = json.NewDecoder(res.Body).Decode(cl.out); err != nil {
+		return fmt.Errorf("could not decode the response of %s %s: %w", cl.method, cl.path, err)
+	}
+	return nil
+}
+
+// retryable reports whether a failed call may succeed if it is repeated.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		var ue *url.Error
+		return errors.As(err, &ue)
+	}
+
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before the retry after the given number of retries.
+func backoff(base, max time.Duration, retries int) time.Duration {
+	d := base
+	for i := 0; i < retries && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// retryAfter returns the wait a response asks for in its Retry-After header, in seconds or as a date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,681 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/harsha-aqfer/todo/internal/db"
+	"github.com/harsha-aqfer/todo/internal/search"
+	"github.com/harsha-aqfer/todo/internal/service_echo"
+	"github.com/harsha-aqfer/todo/pkg"
+	"github.com/harsha-aqfer/todo/pkg/client"
+	"github.com/labstack/echo/v4"
+	asserts "github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The fakes below keep in memory what the auth and todo routes need of the stores.
+
+type memUsers struct {
+	db.UserDB
+	mu    sync.Mutex
+	users []*pkg.User
+}
+
+func (mu *memUsers) CreateUser(u *pkg.User, _ string) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	for _, o := range mu.users {
+		if o.Email == u.Email {
+			return echo.NewHTTPError(http.StatusConflict, "email already registered")
+		}
+	}
+	c := *u
+	c.ID, c.Role = int64(len(mu.users)+1), pkg.RoleUser
+	mu.users = append(mu.users, &c)
+	return nil
+}
+
+func (mu *memUsers) GetUser(email string) (*pkg.User, error) {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	for _, u := range mu.users {
+		if u.Email == email {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", db.ErrUserNotFound, email)
+}
+
+type memSessions struct {
+	db.SessionDB
+	mu       sync.Mutex
+	sessions map[string]*db.Session
+	refresh  map[string]string
+	used     map[string]string
+	users    *memUsers
+}
+
+func (ms *memSessions) CreateSession(userID, orgID int64, refreshHash string, expiresAt time.Time) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id := fmt.Sprintf("s%d", len(ms.sessions)+1)
+	ms.sessions[id] = &db.Session{ID: id, UserID: userID, Email: ms.users.users[userID-1].Email, OrgID: orgID, ExpiresAt: expiresAt}
+	ms.refresh[refreshHash] = id
+	return id, nil
+}
+
+func (ms *memSessions) GetSession(sessionID string) (*db.Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[sessionID]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "session expired or revoked")
+	}
+	return s, nil
+}
+
+func (ms *memSessions) RefreshSession(refreshHash, newRefreshHash string, _ time.Time) (*db.Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id, ok := ms.refresh[refreshHash]
+	if _, live := ms.sessions[id]; !ok || !live {
+		if id, ok = ms.used[refreshHash]; ok {
+			delete(ms.sessions, id)
+			return nil, echo.NewHTTPError(http.StatusUnauthorized, "refresh token was used already, the session is revoked")
+		}
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired refresh token")
+	}
+	delete(ms.refresh, refreshHash)
+	ms.refresh[newRefreshHash], ms.used[refreshHash] = id, id
+	return ms.sessions[id], nil
+}
+
+func (ms *memSessions) RevokeSession(sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, sessionID)
+	return nil
+}
+
+type memOrgs struct {
+	db.OrgDB
+	mu     sync.Mutex
+	owners map[int64]int64
+}
+
+func (mo *memOrgs) GetDefaultOrgID(userID int64) (int64, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for orgID, owner := range mo.owners {
+		if owner == userID {
+			return orgID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mo *memOrgs) CreateOrg(_ string, _ *pkg.OrgSettings, ownerID int64) (int64, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	orgID := int64(len(mo.owners) + 1)
+	mo.owners[orgID] = ownerID
+	return orgID, nil
+}
+
+func (mo *memOrgs) GetOrg(orgID int64) (*pkg.Org, error) {
+	return &pkg.Org{ID: orgID}, nil
+}
+
+func (mo *memOrgs) GetMemberRole(orgID, userID int64) (string, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	if mo.owners[orgID] == userID {
+		return pkg.OrgRoleOwner, nil
+	}
+	return "", nil
+}
+
+type memMFA struct {
+	db.MFADB
+}
+
+func (memMFA) GetMFA(int64) (*db.MFA, error) {
+	return nil, nil
+}
+
+type memAuthEvents struct{}
+
+func (memAuthEvents) RecordEvent(string, string, string) error {
+	return nil
+}
+
+type memIdempotency struct {
+	db.IdempotencyDB
+	mu       sync.Mutex
+	requests map[string]*db.IdempotentRequest
+}
+
+func (mi *memIdempotency) ReserveKey(_, _ int64, key, fingerprint string, _ time.Time) (*db.IdempotentRequest, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if r, ok := mi.requests[key]; ok {
+		return r, nil
+	}
+	mi.requests[key] = &db.IdempotentRequest{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (mi *memIdempotency) SaveResponse(_, _ int64, key string, status int, contentType string, body []byte) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	r := mi.requests[key]
+	r.Status, r.ContentType, r.Body = status, contentType, body
+	return nil
+}
+
+func (mi *memIdempotency) ReleaseKey(_, _ int64, key string) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	delete(mi.requests, key)
+	return nil
+}
+
+// memTodo is a todo of a user in an organization.
+type memTodo struct {
+	orgID, userID int64
+	pkg.TodoResponse
+}
+
+type memTodos struct {
+	db.TodoDB
+	mu    sync.Mutex
+	todos []*memTodo
+}
+
+// find returns the live todo if it belongs to the user in the organization.
+func (mt *memTodos) find(orgID, userID, todoID int64) *memTodo {
+	for _, t := range mt.todos {
+		if t.orgID == orgID && t.userID == userID && t.Id == todoID && t.DeletedAt == nil {
+			return t
+		}
+	}
+	return nil
+}
+
+func (mt *memTodos) CreateTodo(orgID, userID int64, tr *pkg.TodoRequest, _ *pkg.Actor) (int64, error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	now := time.Now()
+	t := &memTodo{orgID: orgID, userID: userID, TodoResponse: pkg.TodoResponse{
+		Id: int64(len(mt.todos) + 1), Task: tr.Task, Category: tr.Category, Priority: tr.Priority, Revision: 1, CreatedAt: &now,
+	}}
+	mt.todos = append(mt.todos, t)
+	return t.Id, nil
+}
+
+func (mt *memTodos) GetTodo(orgID, userID, todoID int64) (*pkg.TodoResponse, error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if t := mt.find(orgID, userID, todoID); t != nil {
+		c := t.TodoResponse
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (mt *memTodos) UpdateTodo(orgID, userID, todoID, revision int64, tr *pkg.TodoRequest, _ *pkg.Actor) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	t := mt.find(orgID, userID, todoID)
+	if t == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	}
+	if revision != 0 && revision != t.Revision {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, fmt.Sprintf("todo %d has been modified, its revision is %d", todoID, t.Revision))
+	}
+	if tr.Task != "" {
+		t.Task = tr.Task
+	}
+	if tr.Done {
+		now := time.Now()
+		t.CompletedAt = &now
+	}
+	t.Revision++
+	return nil
+}
+
+func (mt *memTodos) DeleteTodo(orgID, userID, todoID, _ int64, _ *pkg.Actor) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	t := mt.find(orgID, userID, todoID)
+	if t == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	}
+	now := time.Now()
+	t.DeletedAt = &now
+	return nil
+}
+
+// MoveTodo keeps the todos in the order they were created.
+func (mt *memTodos) MoveTodo(orgID, userID, todoID, _ int64, _ *pkg.MoveRequest, _ *pkg.Actor) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if mt.find(orgID, userID, todoID) == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such todo: %d", todoID))
+	}
+	return nil
+}
+
+func (mt *memTodos) ListTodos(orgID, userID int64, all bool, _ search.Sort) ([]pkg.TodoResponse, error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	todos := make([]pkg.TodoResponse, 0)
+	for _, t := range mt.todos {
+		if t.orgID == orgID && t.userID == userID && t.DeletedAt == nil && (all || t.CompletedAt == nil) {
+			todos = append(todos, t.TodoResponse)
+		}
+	}
+	return todos, nil
+}
+
+func (mt *memTodos) SearchTodos(orgID, userID int64, _ *search.Query, sort search.Sort, limit, offset int) ([]pkg.TodoResponse, error) {
+	todos, err := mt.ListTodos(orgID, userID, true, sort)
+	if err != nil || offset >= len(todos) {
+		return []pkg.TodoResponse{}, err
+	}
+	todos = todos[offset:]
+	if len(todos) > limit {
+		todos = todos[:limit]
+	}
+	return todos, nil
+}
+
+type server struct {
+	*httptest.Server
+	todos *memTodos
+
+	// fail, if set, replaces the response of a request that it returns a status for.
+	fail func(r *http.Request) int
+}
+
+// newServer runs the echo service on in-memory stores. A request fail returns a status for is
+// handled by the service, as if the response got lost, and answered with that status instead.
+func newServer(t *testing.T) *server {
+	users := &memUsers{}
+
+	store := &db.DB{
+		User:        users,
+		Session:     &memSessions{sessions: map[string]*db.Session{}, refresh: map[string]string{}, used: map[string]string{}, users: users},
+		Attempt:     db.NewMemoryAttemptStore(),
+		AuthEvent:   memAuthEvents{},
+		MFA:         memMFA{},
+		Org:         &memOrgs{owners: map[int64]int64{}},
+		Todo:        &memTodos{},
+		Idempotency: &memIdempotency{requests: map[string]*db.IdempotentRequest{}},
+	}
+
+	conf := service_echo.NewConfig()
+	conf.SigningKey = "test"
+	conf.EventPublisher = "memory"
+
+	s, err := service_echo.NewServiceWithDB(conf, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &server{todos: store.Todo.(*memTodos)}
+	h := s.Handler()
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.fail != nil {
+			if status := srv.fail(r); status != 0 {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(status)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// signedIn returns a client of a new user of the server.
+func signedIn(t *testing.T, srv *server) *client.Client {
+	ctx := context.Background()
+
+	c := client.New(srv.URL)
+	c.RetryWait = time.Millisecond
+
+	if err := c.SignUp(ctx, &pkg.User{Email: "ann@example.com", Username: "ann", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SignIn(ctx, "ann@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func Test_Todos(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		c      = signedIn(t, newServer(t))
+	)
+
+	todo, err := c.CreateTodo(ctx, &pkg.TodoRequest{Task: "Buy milk", Priority: "high"})
+	assert.NoError(err)
+	assert.Equal("Buy milk", todo.Task)
+	assert.Equal("work", todo.Category)
+
+	got, err := c.GetTodo(ctx, todo.Id)
+	assert.NoError(err)
+	assert.Equal(todo.Task, got.Task)
+
+	assert.NoError(c.UpdateTodo(ctx, todo.Id, &pkg.TodoRequest{Task: "Buy oat milk"}, client.IfMatch(todo.Revision)))
+
+	err = c.UpdateTodo(ctx, todo.Id, &pkg.TodoRequest{Task: "Buy soy milk"}, client.IfMatch(todo.Revision))
+	assert.True(errors.Is(err, client.ErrPreconditionFailed))
+	assert.Equal("todo: 412 todo 1 has been modified, its revision is 2", err.Error())
+
+	assert.NoError(c.CompleteTodo(ctx, todo.Id))
+
+	todos, err := c.ListTodos(ctx, nil)
+	assert.NoError(err)
+	assert.Empty(todos)
+
+	todos, err = c.ListTodos(ctx, &client.ListOptions{All: true})
+	assert.NoError(err)
+	assert.Len(todos, 1)
+	assert.Equal("Buy oat milk", todos[0].Task)
+
+	assert.NoError(c.DeleteTodo(ctx, todo.Id))
+
+	_, err = c.GetTodo(ctx, todo.Id)
+	assert.True(errors.Is(err, client.ErrNotFound))
+
+	err = c.DeleteTodo(ctx, todo.Id)
+	var e *client.Error
+	assert.True(errors.As(err, &e))
+	assert.Equal(http.StatusNotFound, e.StatusCode)
+	assert.Equal("no such todo: 1", e.Message)
+}
+
+func Test_TodosOfOtherUsers(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		srv    = newServer(t)
+		ann    = signedIn(t, srv)
+		bob    = client.New(srv.URL)
+	)
+
+	assert.NoError(bob.SignUp(ctx, &pkg.User{Email: "bob@example.com", Username: "bob", Password: "secret"}))
+	assert.NoError(bob.SignIn(ctx, "bob@example.com", "secret"))
+
+	todo, err := ann.CreateTodo(ctx, &pkg.TodoRequest{Task: "Buy milk", Priority: "high"})
+	assert.NoError(err)
+
+	_, err = bob.GetTodo(ctx, todo.Id)
+	assert.True(errors.Is(err, client.ErrNotFound))
+	assert.True(errors.Is(bob.UpdateTodo(ctx, todo.Id, &pkg.TodoRequest{Task: "Buy beer"}), client.ErrNotFound))
+	assert.True(errors.Is(bob.DeleteTodo(ctx, todo.Id), client.ErrNotFound))
+
+	todos, err := bob.ListTodos(ctx, &client.ListOptions{All: true})
+	assert.NoError(err)
+	assert.Empty(todos)
+
+	got, err := ann.GetTodo(ctx, todo.Id)
+	assert.NoError(err)
+	assert.Equal("Buy milk", got.Task)
+}
+
+func Test_SignIn(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		srv    = newServer(t)
+		c      = client.New(srv.URL)
+	)
+
+	_, err := c.ListTodos(ctx, nil)
+	assert.True(errors.Is(err, client.ErrUnauthorized))
+
+	assert.NoError(c.SignUp(ctx, &pkg.User{Email: "ann@example.com", Username: "ann", Password: "secret"}))
+
+	err = c.SignUp(ctx, &pkg.User{Email: "bob@example.com"})
+	assert.True(errors.Is(err, client.ErrBadRequest))
+
+	err = c.SignIn(ctx, "ann@example.com", "wrong")
+	assert.True(errors.Is(err, client.ErrUnauthorized))
+	assert.Equal("todo: 401 invalid email or password", err.Error())
+	assert.Nil(c.Token())
+
+	assert.NoError(c.SignIn(ctx, "ann@example.com", "secret"))
+	assert.NotEmpty(c.Token().RefreshToken)
+
+	assert.NoError(c.SignOut(ctx))
+	assert.Nil(c.Token())
+}
+
+func Test_TokenRefresh(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		c      = signedIn(t, newServer(t))
+		stored []*pkg.Token
+	)
+
+	c.OnToken = func(t *pkg.Token) {
+		stored = append(stored, t)
+	}
+
+	// An expired token is refreshed, and the call made again.
+	old := c.Token()
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &service_echo.Claims{
+		Email:          "ann@example.com",
+		OrgID:          1,
+		StandardClaims: jwt.StandardClaims{Id: "s1", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetToken(&pkg.Token{JWTToken: expired, RefreshToken: old.RefreshToken})
+
+	_, err = c.ListTodos(ctx, nil)
+	assert.NoError(err)
+	assert.Len(stored, 1)
+	assert.Equal(stored[0], c.Token())
+	assert.NotEqual(old.RefreshToken, c.Token().RefreshToken)
+
+	// Refresh tokens work once, and one used again revokes the session, since it may have been stolen.
+	current := c.Token()
+	c.SetToken(&pkg.Token{JWTToken: expired, RefreshToken: old.RefreshToken})
+
+	_, err = c.ListTodos(ctx, nil)
+	assert.True(errors.Is(err, client.ErrUnauthorized))
+	assert.Len(stored, 1)
+
+	c.SetToken(current)
+	_, err = c.ListTodos(ctx, nil)
+	assert.True(errors.Is(err, client.ErrUnauthorized))
+}
+
+func Test_ConcurrentTokenRefresh(t *testing.T) {
+	var (
+		assert    = asserts.New(t)
+		ctx       = context.Background()
+		srv       = newServer(t)
+		c         = signedIn(t, srv)
+		refreshes int32
+		started   = make(chan struct{})
+		release   = make(chan struct{})
+	)
+
+	// The refresh is held up until the client has shown that it is not locked meanwhile.
+	srv.fail = func(r *http.Request) int {
+		if r.URL.Path == "/v1/token/refresh" && atomic.AddInt32(&refreshes, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return 0
+	}
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &service_echo.Claims{
+		Email:          "ann@example.com",
+		OrgID:          1,
+		StandardClaims: jwt.StandardClaims{Id: "s1", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken(&pkg.Token{JWTToken: expired, RefreshToken: c.Token().RefreshToken})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.ListTodos(ctx, nil)
+		}(i)
+	}
+
+	<-started
+	token := make(chan *pkg.Token)
+	go func() { token <- c.Token() }()
+	select {
+	case tk := <-token:
+		assert.Equal(expired, tk.JWTToken)
+	case <-time.After(time.Second):
+		t.Error("the client is locked while it refreshes the token")
+	}
+	close(release)
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(err)
+	}
+	assert.Equal(int32(1), atomic.LoadInt32(&refreshes))
+	assert.NotEqual(expired, c.Token().JWTToken)
+}
+
+func Test_Retries(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		srv    = newServer(t)
+		c      = signedIn(t, srv)
+		calls  int32
+	)
+
+	// The first create succeeds, but its response is lost. The retry gets the stored response.
+	srv.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/todos" && atomic.AddInt32(&calls, 1) == 1 {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+
+	todo, err := c.CreateTodo(ctx, &pkg.TodoRequest{Task: "Buy milk", Priority: "low"})
+	assert.NoError(err)
+	assert.Equal(int64(1), todo.Id)
+	assert.Equal(int32(2), calls)
+	assert.Len(srv.todos.todos, 1)
+
+	// Moves are not idempotent and not retried.
+	calls = 0
+	srv.fail = func(r *http.Request) int {
+		atomic.AddInt32(&calls, 1)
+		return http.StatusServiceUnavailable
+	}
+
+	_, err = c.MoveTodo(ctx, todo.Id, &pkg.MoveRequest{After: &todo.Id})
+	assert.True(errors.Is(err, &client.Error{StatusCode: http.StatusServiceUnavailable}))
+	assert.Equal(int32(1), calls)
+
+	// Reads are retried up to MaxRetries times.
+	calls = 0
+	_, err = c.ListTodos(ctx, nil)
+	assert.Error(err)
+	assert.Equal(int32(4), calls)
+
+	// Waiting for a retry ends with the context.
+	c.RetryWait, c.MaxRetryWait = time.Hour, time.Hour
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.ListTodos(ctx, nil)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Less(time.Since(start), time.Second)
+}
+
+func Test_Iterator(t *testing.T) {
+	var (
+		assert = asserts.New(t)
+		ctx    = context.Background()
+		srv    = newServer(t)
+		c      = signedIn(t, srv)
+		pages  int32
+	)
+
+	for i := 1; i <= 5; i++ {
+		_, err := c.CreateTodo(ctx, &pkg.TodoRequest{Task: fmt.Sprintf("Todo %d", i), Priority: "low"})
+		assert.NoError(err)
+	}
+
+	srv.fail = func(r *http.Request) int {
+		if r.URL.Path == "/v1/todos/search" {
+			atomic.AddInt32(&pages, 1)
+		}
+		return 0
+	}
+
+	it := c.SearchTodos(ctx, "", "")
+	it.PageSize = 2
+
+	var tasks []string
+	for it.Next() {
+		tasks = append(tasks, it.Value().Task)
+	}
+	assert.NoError(it.Err())
+	assert.Equal([]string{"Todo 1", "Todo 2", "Todo 3", "Todo 4", "Todo 5"}, tasks)
+	assert.Equal(int32(3), pages)
+
+	it = c.SearchTodos(ctx, "", "shuffled")
+	assert.False(it.Next())
+	assert.True(errors.Is(it.Err(), client.ErrBadRequest))
+
+	todos, err := c.SearchTodos(ctx, "", "").All()
+	assert.NoError(err)
+	assert.Len(todos, 5)
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is a response of the server other than 2xx. It matches the Err values of its status with
+// errors.Is:
+//
+//	if errors.Is(err, client.ErrNotFound) {
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// RetryAfter is how long the server asked to wait before trying again, if it did.
+	RetryAfter time.Duration
+}
+
+var (
+	ErrBadRequest         = &Error{StatusCode: http.StatusBadRequest}
+	ErrUnauthorized       = &Error{StatusCode: http.StatusUnauthorized}
+	ErrForbidden          = &Error{StatusCode: http.StatusForbidden}
+	ErrNotFound           = &Error{StatusCode: http.StatusNotFound}
+	ErrConflict           = &Error{StatusCode: http.StatusConflict}
+	ErrPreconditionFailed = &Error{StatusCode: http.StatusPreconditionFailed}
+	ErrTooManyRequests    = &Error{StatusCode: http.StatusTooManyRequests}
+)
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("todo: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("todo: %d %s", e.StatusCode, e.Message)
+}
+
+// Is matches the Err values, which have no message, by status.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.StatusCode == e.StatusCode
+}
+
+// newError reads the error the server responded with, which the API sends as {"message": "..."}.
+func newError(res *http.Response) *Error {
+	e := &Error{StatusCode: res.StatusCode, RetryAfter: retryAfter(res.Header)}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+
+	var msg pkg.MsgResp
+	if json.Unmarshal(body, &msg) == nil && msg.Message != "" {
+		e.Message = msg.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	if e.Message == "" {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+	return e
+}
+
+// MFARequiredError is returned by SignIn for users with two-factor authentication. The sign-in is
+// completed with SignInMFA, a code and the challenge's MFAToken.
+type MFARequiredError struct {
+	Challenge pkg.MFAChallenge
+}
+
+func (e *MFARequiredError) Error() string {
+	return "todo: two-factor authentication code required"
+}
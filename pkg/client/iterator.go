@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DefaultPageSize is the number of items an Iterator fetches at once. The server caps pages at 500.
+const DefaultPageSize = 100
+
+// Iterator walks a list the server returns in pages, fetching the next page when the current one is
+// used up:
+//
+//	it := c.SearchTodos(ctx, "is:open", "")
+//	for it.Next() {
+//		fmt.Println(it.Value().Task)
+//	}
+//	if err := it.Err(); err != nil {
+//
+// Pages are fetched by offset, so items added or removed while iterating can shift the rest of the list.
+type Iterator[T any] struct {
+	// PageSize is the number of items fetched at once. It can be changed before the first Next.
+	PageSize int
+
+	fetch  func(limit, offset int) ([]T, error)
+	page   []T
+	i      int
+	offset int
+	done   bool
+	err    error
+}
+
+// list returns an iterator over the pages of a GET of path.
+func list[T any](ctx context.Context, c *Client, path string, query url.Values) *Iterator[T] {
+	return &Iterator[T]{
+		PageSize: DefaultPageSize,
+		i:        -1,
+		fetch: func(limit, offset int) ([]T, error) {
+			q := url.Values{}
+			for k, v := range query {
+				q[k] = v
+			}
+			q.Set("limit", strconv.Itoa(limit))
+			q.Set("offset", strconv.Itoa(offset))
+
+			var page []T
+			if err := c.do(ctx, &call{method: http.MethodGet, path: path, query: q, out: &page}); err != nil {
+				return nil, err
+			}
+			return page, nil
+		},
+	}
+}
+
+// Next advances to the next item and reports whether there is one. It returns false at the end of
+// the list or on an error, which Err returns.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.i+1 < len(it.page) {
+		it.i++
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	page, err := it.fetch(it.PageSize, it.offset)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page, it.i = page, 0
+	it.offset += len(page)
+
+	// A short page is the last one.
+	if len(page) < it.PageSize {
+		it.done = true
+	}
+	return len(page) > 0
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.page[it.i]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All reads the rest of the list.
+func (it *Iterator[T]) All() ([]T, error) {
+	var items []T
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.Err()
+}
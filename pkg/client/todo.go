@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/harsha-aqfer/todo/pkg"
+	"net/http"
+	"net/url"
+)
+
+// ListOptions select the todos ListTodos returns.
+type ListOptions struct {
+	// All includes the todos that are done.
+	All bool
+
+	// Sort is a sort order of the search API, such as "due_asc". Lists are in the users' order by
+	// default.
+	Sort string
+}
+
+func todoPath(todoID int64) string {
+	return fmt.Sprintf("/v1/todos/%d", todoID)
+}
+
+// ListTodos returns the todos of the active organization that are not done, or all with opts.All.
+func (c *Client) ListTodos(ctx context.Context, opts *ListOptions) ([]pkg.TodoResponse, error) {
+	q := url.Values{}
+	if opts != nil {
+		if opts.All {
+			q.Set("all", "true")
+		}
+		if opts.Sort != "" {
+			q.Set("sort", opts.Sort)
+		}
+	}
+
+	var todos []pkg.TodoResponse
+	if err := c.do(ctx, &call{method: http.MethodGet, path: "/v1/todos", query: q, out: &todos}); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// SearchTodos iterates over the todos matching a query of the search syntax, such as
+// "priority:high is:open". An empty sort sorts by creation, newest first.
+func (c *Client) SearchTodos(ctx context.Context, query, sort string) *Iterator[pkg.TodoResponse] {
+	q := url.Values{"q": {query}}
+	if sort != "" {
+		q.Set("sort", sort)
+	}
+	return list[pkg.TodoResponse](ctx, c, "/v1/todos/search", q)
+}
+
+// GetTodo returns a todo, or ErrNotFound.
+func (c *Client) GetTodo(ctx context.Context, todoID int64) (*pkg.TodoResponse, error) {
+	var todo *pkg.TodoResponse
+	if err := c.do(ctx, &call{method: http.MethodGet, path: todoPath(todoID), out: &todo}); err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, &Error{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("no such todo: %d", todoID)}
+	}
+	return todo, nil
+}
+
+// CreateTodo creates a todo and returns it. It is sent with an idempotency key, random unless given
+// with IdempotencyKey, so that it can be retried.
+func (c *Client) CreateTodo(ctx context.Context, req *pkg.TodoRequest, opts ...RequestOption) (*pkg.TodoResponse, error) {
+	cl, err := newCall(http.MethodPost, "/v1/todos", opts).withIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var todo pkg.TodoResponse
+	cl.body, cl.out = req, &todo
+
+	if err = c.do(ctx, cl); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// UpdateTodo changes the fields set in req. With IfMatch it fails with ErrPreconditionFailed if the
+// todo changed meanwhile.
+func (c *Client) UpdateTodo(ctx context.Context, todoID int64, req *pkg.TodoRequest, opts ...RequestOption) error {
+	cl := newCall(http.MethodPut, todoPath(todoID), opts)
+	cl.body = req
+	return c.do(ctx, cl)
+}
+
+// CompleteTodo marks a todo done.
+func (c *Client) CompleteTodo(ctx context.Context, todoID int64, opts ...RequestOption) error {
+	return c.UpdateTodo(ctx, todoID, &pkg.TodoRequest{Done: true}, opts...)
+}
+
+// DeleteTodo moves a todo to the trash.
+func (c *Client) DeleteTodo(ctx context.Context, todoID int64, opts ...RequestOption) error {
+	return c.do(ctx, newCall(http.MethodDelete, todoPath(todoID), opts))
+}
+
+// MoveTodo places a todo after or before others and returns it. Moves are not retried.
+func (c *Client) MoveTodo(ctx context.Context, todoID int64, req *pkg.MoveRequest, opts ...RequestOption) (*pkg.TodoResponse, error) {
+	var todo pkg.TodoResponse
+
+	cl := newCall(http.MethodPost, todoPath(todoID)+"/move", opts)
+	cl.body, cl.out = req, &todo
+
+	if err := c.do(ctx, cl); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// TodoHistory iterates over the changes of a todo, newest first.
+func (c *Client) TodoHistory(ctx context.Context, todoID int64) *Iterator[pkg.TodoActivity] {
+	return list[pkg.TodoActivity](ctx, c, todoPath(todoID)+"/history", nil)
+}
+
+// Activity iterates over the changes of all todos of the user, newest first.
+func (c *Client) Activity(ctx context.Context) *Iterator[pkg.TodoActivity] {
+	return list[pkg.TodoActivity](ctx, c, "/v1/activity", nil)
+}
+
+// BatchTodos applies several operations at once. Each has its own result unless req.Atomic is set.
+func (c *Client) BatchTodos(ctx context.Context, req *pkg.BatchRequest, opts ...RequestOption) (*pkg.BatchResponse, error) {
+	cl, err := newCall(http.MethodPost, "/v1/todos:batch", opts).withIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var res pkg.BatchResponse
+	cl.body, cl.out = req, &res
+
+	if err = c.do(ctx, cl); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// BulkTodos deletes or completes every todo matching a filter.
+func (c *Client) BulkTodos(ctx context.Context, req *pkg.BulkRequest, opts ...RequestOption) (*pkg.BulkResponse, error) {
+	cl, err := newCall(http.MethodPost, "/v1/todos:bulk", opts).withIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var res pkg.BulkResponse
+	cl.body, cl.out = req, &res
+
+	if err = c.do(ctx, cl); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListTrash returns the deleted todos that can still be restored.
+func (c *Client) ListTrash(ctx context.Context) ([]pkg.TodoResponse, error) {
+	var todos []pkg.TodoResponse
+	if err := c.do(ctx, &call{method: http.MethodGet, path: "/v1/trash", out: &todos}); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// RestoreTodo takes a todo out of the trash and returns it.
+func (c *Client) RestoreTodo(ctx context.Context, todoID int64, opts ...RequestOption) (*pkg.TodoResponse, error) {
+	cl, err := newCall(http.MethodPost, fmt.Sprintf("/v1/trash/%d/restore", todoID), opts).withIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var todo pkg.TodoResponse
+	cl.out = &todo
+
+	if err = c.do(ctx, cl); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// PurgeTodo deletes a todo in the trash for good.
+func (c *Client) PurgeTodo(ctx context.Context, todoID int64) error {
+	return c.do(ctx, &call{method: http.MethodDelete, path: fmt.Sprintf("/v1/trash/%d", todoID)})
+}
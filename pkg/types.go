@@ -1,17 +1,26 @@
 package pkg
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/harsha-aqfer/todo/internal/util"
+	"net"
+	"net/url"
 	"strings"
 	"time"
 )
 
 type TodoRequest struct {
-	Task     string `json:"task"`
-	Done     bool   `json:"done,omitempty"`
-	Category string `json:"category,omitempty"`
-	Priority string `json:"priority,omitempty"`
+	Task      string     `json:"task"`
+	Done      bool       `json:"done,omitempty"`
+	Category  string     `json:"category,omitempty"`
+	Priority  string     `json:"priority,omitempty"`
+	ProjectID *int64     `json:"project_id,omitempty"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+
+	// Recurrence is an iCalendar RRULE value such as "FREQ=WEEKLY;BYDAY=MO". It is kept for calendar
+	// clients and not evaluated. Updates leave it alone when it is nil and clear it when it is empty.
+	Recurrence *string `json:"recurrence,omitempty"`
 }
 
 type TodoResponse struct {
@@ -19,18 +28,263 @@ type TodoResponse struct {
 	Task        string     `json:"task"`
 	Category    string     `json:"category"`
 	Priority    string     `json:"priority"`
+	ProjectID   *int64     `json:"project_id,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Position    string     `json:"position"`
+	Revision    int64      `json:"revision"`
 	CreatedAt   *time.Time `json:"created_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	ClientUID   string     `json:"client_uid,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+}
+
+// Actor identifies who performs a change: a user, possibly through an OAuth client.
+type Actor struct {
+	UserID   int64
+	ClientID string
+}
+
+const (
+	ActivityCreate  = "create"
+	ActivityUpdate  = "update"
+	ActivityDelete  = "delete"
+	ActivityRestore = "restore"
+	ActivityPurge   = "purge"
+)
+
+// FieldChange is the old and new value of a field. From is nil for created todos and To for deleted ones.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type TodoActivity struct {
+	ID         int64                  `json:"id"`
+	TodoID     int64                  `json:"todo_id"`
+	ActorID    int64                  `json:"actor_id"`
+	ActorEmail string                 `json:"actor_email,omitempty"`
+	ClientID   string                 `json:"client_id,omitempty"`
+	Action     string                 `json:"action"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  *time.Time             `json:"created_at"`
+}
+
+const (
+	BatchCreate   = "create"
+	BatchUpdate   = "update"
+	BatchDelete   = "delete"
+	BatchComplete = "complete"
+
+	MaxBatchOperations = 100
+)
+
+// BatchOperation is a single operation of a batch request. Revision makes an update or delete
+// conditional like an If-Match header.
+type BatchOperation struct {
+	Op       string       `json:"op"`
+	ID       int64        `json:"id,omitempty"`
+	Revision int64        `json:"revision,omitempty"`
+	Todo     *TodoRequest `json:"todo,omitempty"`
+}
+
+func (bo *BatchOperation) Validate() error {
+	switch bo.Op {
+	case BatchCreate:
+		if bo.Todo == nil {
+			return fmt.Errorf("inadequate input parameters. Required todo")
+		}
+	case BatchUpdate:
+		if bo.ID == 0 || bo.Todo == nil || bo.Todo.IsZero() {
+			return fmt.Errorf("inadequate input parameters. Required id, todo")
+		}
+	case BatchDelete, BatchComplete:
+		if bo.ID == 0 {
+			return fmt.Errorf("inadequate input parameters. Required id")
+		}
+	default:
+		return fmt.Errorf("unknown op value: %s", bo.Op)
+	}
+	return nil
+}
+
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
 }
 
+func (br BatchRequest) Validate() error {
+	if len(br.Operations) == 0 {
+		return fmt.Errorf("inadequate input parameters. Required operations")
+	}
+	if len(br.Operations) > MaxBatchOperations {
+		return fmt.Errorf("too many operations, at most %d are allowed", MaxBatchOperations)
+	}
+	return nil
+}
+
+// BatchResult is the outcome of one operation, in the order of the request.
+type BatchResult struct {
+	ID     int64  `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+const (
+	BulkDelete   = "delete"
+	BulkComplete = "complete"
+)
+
+// TodoFilter selects todos for bulk actions. Unset fields match every todo.
+type TodoFilter struct {
+	Done      *bool  `json:"done,omitempty"`
+	Category  string `json:"category,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+	ProjectID *int64 `json:"project_id,omitempty"`
+}
+
+type BulkRequest struct {
+	Action string     `json:"action"`
+	Filter TodoFilter `json:"filter"`
+}
+
+func (br *BulkRequest) Validate() error {
+	if br.Action != BulkDelete && br.Action != BulkComplete {
+		return fmt.Errorf("unknown action value: %s", br.Action)
+	}
+
+	f := &br.Filter
+	if f.Done == nil && f.Category == "" && f.Priority == "" && f.ProjectID == nil {
+		return fmt.Errorf("inadequate input parameters. Required at least one filter")
+	}
+	f.Category = strings.ToLower(f.Category)
+	f.Priority = strings.ToLower(f.Priority)
+	return nil
+}
+
+type BulkResponse struct {
+	Affected int     `json:"affected"`
+	IDs      []int64 `json:"ids"`
+}
+
+// Ways of importing todos whose task is taken already.
+const (
+	ImportSkip      = "skip"
+	ImportRename    = "rename"
+	ImportOverwrite = "overwrite"
+)
+
+var ImportDuplicateModes = []string{ImportSkip, ImportRename, ImportOverwrite}
+
+// Outcomes of imported rows.
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// ImportRow is the outcome of a row of an imported file. Task is the task the todo got, which differs
+// from the file's when it was renamed.
+type ImportRow struct {
+	Row    int    `json:"row"`
+	Task   string `json:"task,omitempty"`
+	Status string `json:"status"`
+	ID     int64  `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Reason tells why a row was skipped and Notes what was left out of an imported row.
+	Reason string   `json:"reason,omitempty"`
+	Notes  []string `json:"notes,omitempty"`
+}
+
+// ImportReport sums up an import. In a dry run nothing is written and the rows tell what would happen.
+type ImportReport struct {
+	DryRun          bool        `json:"dry_run"`
+	Total           int         `json:"total"`
+	Created         int         `json:"created"`
+	Updated         int         `json:"updated"`
+	Skipped         int         `json:"skipped"`
+	Failed          int         `json:"failed"`
+	ProjectsCreated []string    `json:"projects_created,omitempty"`
+	Rows            []ImportRow `json:"rows"`
+}
+
+// Add counts a row and appends it.
+func (ir *ImportReport) Add(row ImportRow) {
+	ir.Total++
+	switch row.Status {
+	case ImportCreated:
+		ir.Created++
+	case ImportUpdated:
+		ir.Updated++
+	case ImportSkipped:
+		ir.Skipped++
+	case ImportFailed:
+		ir.Failed++
+	}
+	ir.Rows = append(ir.Rows, row)
+}
+
+// ImportOptions are the settings of an import. The maps rename categories and priorities of the file,
+// and the defaults replace empty or unknown ones.
+type ImportOptions struct {
+	DryRun          bool              `json:"dry_run"`
+	Duplicates      string            `json:"duplicates"`
+	CategoryMap     map[string]string `json:"category_map,omitempty"`
+	PriorityMap     map[string]string `json:"priority_map,omitempty"`
+	DefaultCategory string            `json:"default_category,omitempty"`
+	DefaultPriority string            `json:"default_priority,omitempty"`
+}
+
+// States of import jobs.
+const (
+	ImportJobQueued  = "queued"
+	ImportJobRunning = "running"
+	ImportJobDone    = "done"
+	ImportJobFailed  = "failed"
+)
+
+// ImportJob is an import from another todo app that runs in the background. Processed counts the rows
+// imported so far out of Total. Jobs that are done have a report; failed jobs an error.
+type ImportJob struct {
+	ID         int64         `json:"id"`
+	Source     string        `json:"source"`
+	Filename   string        `json:"filename"`
+	Options    ImportOptions `json:"options"`
+	Status     string        `json:"status"`
+	Processed  int           `json:"processed"`
+	Total      int           `json:"total"`
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// DefaultCategories are the todo categories of organizations that do not configure their own.
+var DefaultCategories = []string{"work", "home"}
+
 func (tr *TodoRequest) IsZero() bool {
 	return tr.Task == "" &&
 		tr.Priority == "" &&
 		tr.Category == "" &&
-		tr.Done == false
+		tr.Done == false &&
+		tr.ProjectID == nil &&
+		tr.DueAt == nil &&
+		tr.Recurrence == nil
 }
 
 func (tr *TodoRequest) Validate() error {
+	return tr.ValidateCategories(DefaultCategories)
+}
+
+// ValidateCategories validates the request against the categories allowed in an organization.
+func (tr *TodoRequest) ValidateCategories(categories []string) error {
 	if tr.Task == "" {
 		return fmt.Errorf("inadequate input parameters. Required field: task")
 	}
@@ -38,8 +292,6 @@ func (tr *TodoRequest) Validate() error {
 	category := tr.Category
 	tr.Category = strings.ToLower(tr.Category)
 
-	categories := []string{"work", "home"}
-
 	if !util.Contains(categories, tr.Category) {
 		return fmt.Errorf("unknown category value: %s", category)
 	}
@@ -55,12 +307,27 @@ func (tr *TodoRequest) Validate() error {
 	return nil
 }
 
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
 type User struct {
-	Email     string     `json:"email"`
-	Username  string     `json:"username"`
-	Password  string     `json:"password"`
-	CreatedAt *time.Time `json:"created_at"`
-	UpdatedAt *time.Time `json:"updated_at"`
+	ID          int64      `json:"id,omitempty"`
+	Email       string     `json:"email"`
+	Username    string     `json:"username"`
+	Password    string     `json:"password,omitempty"`
+	Role        string     `json:"role,omitempty"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+
+	// Invitation is an optional organization invitation token accepted on sign-up.
+	Invitation string `json:"invitation,omitempty"`
 }
 
 func (u User) Validate() error {
@@ -72,6 +339,728 @@ func (u User) Validate() error {
 	return nil
 }
 
+type ProfileUpdate struct {
+	Username string `json:"username"`
+}
+
+func (pu ProfileUpdate) Validate() error {
+	if pu.Username == "" {
+		return fmt.Errorf("inadequate input parameters. Required username")
+	}
+	return nil
+}
+
+// PasswordChange sets a new password. Users provisioned through single sign-on have no current password
+// and leave it empty, confirming the change with a fresh sign-in instead.
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (pc PasswordChange) Validate() error {
+	if pc.NewPassword == "" {
+		return fmt.Errorf("inadequate input parameters. Required new_password")
+	}
+	if pc.CurrentPassword == pc.NewPassword {
+		return fmt.Errorf("new password must differ from the current password")
+	}
+	return nil
+}
+
+type EmailChange struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (ec EmailChange) Validate() error {
+	if ec.Email == "" {
+		return fmt.Errorf("inadequate input parameters. Required email")
+	}
+	return nil
+}
+
+type EmailVerification struct {
+	Token string `json:"token"`
+}
+
+type AccountDeletion struct {
+	Password string `json:"password"`
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFADisable struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (md MFADisable) Validate() error {
+	if md.Code == "" {
+		return fmt.Errorf("inadequate input parameters. Required code")
+	}
+	return nil
+}
+
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type MFASignIn struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (ms MFASignIn) Validate() error {
+	if ms.MFAToken == "" || ms.Code == "" {
+		return fmt.Errorf("inadequate input parameters. Required mfa_token, code")
+	}
+	return nil
+}
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public,omitempty"`
+}
+
+func (cr OAuthClientRequest) Validate() error {
+	if cr.Name == "" || len(cr.RedirectURIs) == 0 {
+		return fmt.Errorf("inadequate input parameters. Required name, redirect_uris")
+	}
+
+	for _, u := range cr.RedirectURIs {
+		if _, err := ParseRedirectURI(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRedirectURI parses an OAuth redirect uri. It has to be an absolute https uri without fragment;
+// plain http is only accepted for loopback hosts, as native apps use them.
+func ParseRedirectURI(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil || s == "" || strings.ContainsAny(s, "\r\n#") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid redirect uri: %q", s)
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("invalid redirect uri: %q, http is only allowed for loopback hosts", s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid redirect uri: %q, expected an https uri", s)
+	}
+	return u, nil
+}
+
+type OAuthClientResponse struct {
+	ClientID     string     `json:"client_id"`
+	ClientSecret string     `json:"client_secret,omitempty"`
+	Name         string     `json:"name"`
+	RedirectURIs []string   `json:"redirect_uris"`
+	Public       bool       `json:"public"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type" json:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id" json:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope" json:"scope"`
+	State               string `query:"state" form:"state" json:"state"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method" json:"code_challenge_method"`
+	Approve             bool   `form:"approve" json:"approve"`
+}
+
+// OAuthConsent describes an authorization request so that the user can approve or deny it.
+type OAuthConsent struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+type OAuthRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// OAuthIntrospection is the RFC 7662 token introspection response.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+}
+
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type AuthorizedApp struct {
+	ClientID     string     `json:"client_id"`
+	Name         string     `json:"name"`
+	Scopes       []string   `json:"scopes"`
+	AuthorizedAt *time.Time `json:"authorized_at"`
+}
+
+const (
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+	OrgRoleOwner  = "owner"
+)
+
+var OrgRoles = []string{OrgRoleMember, OrgRoleAdmin, OrgRoleOwner}
+
+type OrgSettings struct {
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+	Categories          []string `json:"categories"`
+}
+
+func (os *OrgSettings) Validate() error {
+	for i, d := range os.AllowedEmailDomains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d == "" || strings.Contains(d, "@") {
+			return fmt.Errorf("invalid email domain: %q", os.AllowedEmailDomains[i])
+		}
+		os.AllowedEmailDomains[i] = d
+	}
+
+	for i, c := range os.Categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || len(c) > 64 {
+			return fmt.Errorf("invalid category: %q", os.Categories[i])
+		}
+		os.Categories[i] = c
+	}
+	return nil
+}
+
+// CategoryList returns the categories todos in the organization can use. The first one is the default.
+func (os *OrgSettings) CategoryList() []string {
+	if len(os.Categories) == 0 {
+		return DefaultCategories
+	}
+	return os.Categories
+}
+
+// AllowsEmail reports whether an address may join the organization.
+func (os *OrgSettings) AllowsEmail(email string) bool {
+	if len(os.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	i := strings.LastIndex(email, "@")
+	return i >= 0 && util.Contains(os.AllowedEmailDomains, strings.ToLower(email[i+1:]))
+}
+
+type Org struct {
+	ID        int64       `json:"id"`
+	Name      string      `json:"name"`
+	Role      string      `json:"role,omitempty"`
+	Settings  OrgSettings `json:"settings"`
+	CreatedAt *time.Time  `json:"created_at"`
+}
+
+type OrgRequest struct {
+	Name     string       `json:"name"`
+	Settings *OrgSettings `json:"settings,omitempty"`
+}
+
+func (or OrgRequest) Validate() error {
+	if or.Name == "" {
+		return fmt.Errorf("inadequate input parameters. Required name")
+	}
+	if or.Settings != nil {
+		return or.Settings.Validate()
+	}
+	return nil
+}
+
+type OrgMember struct {
+	UserID   int64      `json:"user_id"`
+	Email    string     `json:"email"`
+	Username string     `json:"username"`
+	Role     string     `json:"role"`
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+type OrgMemberRole struct {
+	Role string `json:"role"`
+}
+
+func (mr OrgMemberRole) Validate() error {
+	if !util.Contains(OrgRoles, mr.Role) {
+		return fmt.Errorf("unknown role value: %s", mr.Role)
+	}
+	return nil
+}
+
+type InvitationRequest struct {
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+func (ir *InvitationRequest) Validate() error {
+	if ir.Role == "" {
+		ir.Role = OrgRoleMember
+	}
+	if ir.Role == OrgRoleOwner || !util.Contains(OrgRoles, ir.Role) {
+		return fmt.Errorf("unknown role value: %s", ir.Role)
+	}
+	return nil
+}
+
+type InvitationResponse struct {
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InvitationAccept struct {
+	Token string `json:"token"`
+}
+
+type Project struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	CreatedBy int64      `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type ProjectRequest struct {
+	Name string `json:"name"`
+}
+
+func (pr ProjectRequest) Validate() error {
+	if pr.Name == "" {
+		return fmt.Errorf("inadequate input parameters. Required name")
+	}
+	return nil
+}
+
+// View is a saved search. Built-in views are addressed by their key instead of an id and can't be changed.
+type View struct {
+	ID        int64      `json:"id,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Name      string     `json:"name"`
+	Query     string     `json:"query"`
+	Sort      string     `json:"sort"`
+	Pinned    bool       `json:"pinned"`
+	BuiltIn   bool       `json:"built_in"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type ViewRequest struct {
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Sort   string `json:"sort"`
+	Pinned bool   `json:"pinned"`
+}
+
+func (vr ViewRequest) Validate() error {
+	if vr.Name == "" {
+		return fmt.Errorf("inadequate input parameters. Required name")
+	}
+	return nil
+}
+
+// MoveRequest places a todo right after the todo After and right before the todo Before. At least one
+// of them is required, and both have to be next to each other if both are given.
+type MoveRequest struct {
+	After  *int64 `json:"after,omitempty"`
+	Before *int64 `json:"before,omitempty"`
+}
+
+func (mr MoveRequest) Validate() error {
+	if mr.After == nil && mr.Before == nil {
+		return fmt.Errorf("inadequate input parameters. Required after or before")
+	}
+	return nil
+}
+
+// Types of todo events.
+const (
+	EventTodoCreated = "todo.created"
+	EventTodoUpdated = "todo.updated"
+	EventTodoDeleted = "todo.deleted"
+
+	// EventTodoCompleted is an update that marks a todo done.
+	EventTodoCompleted = "todo.completed"
+
+	// EventReset tells a resuming client that the events it missed are gone and that it has to reload
+	// its todos.
+	EventReset = "reset"
+
+	// EventHeartbeat keeps idle WebSocket streams alive. Server-Sent Events streams use comments instead.
+	EventHeartbeat = "heartbeat"
+)
+
+// TodoEvent is a change of a todo, pushed to the event streams of its owner. Todo is the todo after
+// the change, and missing for deletions.
+type TodoEvent struct {
+	ID     string        `json:"id"`
+	Type   string        `json:"type"`
+	TodoID int64         `json:"todo_id,omitempty"`
+	Todo   *TodoResponse `json:"todo,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+// WebhookEvents are the events webhooks can subscribe to.
+var WebhookEvents = []string{EventTodoCreated, EventTodoUpdated, EventTodoCompleted, EventTodoDeleted}
+
+// Statuses of webhook deliveries.
+const (
+	WebhookPending   = "pending"
+	WebhookSucceeded = "succeeded"
+	WebhookDead      = "dead"
+)
+
+// Webhook is a subscription to todo events. Secret, the key of the payload signatures, is only
+// returned when the webhook is created. An empty Events list subscribes to every event.
+type Webhook struct {
+	ID           int64      `json:"id"`
+	URL          string     `json:"url"`
+	Events       []string   `json:"events"`
+	Active       bool       `json:"active"`
+	FailureCount int        `json:"failure_count"`
+	Secret       string     `json:"secret,omitempty"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+func (wr WebhookRequest) Validate() error {
+	if wr.URL == "" {
+		return fmt.Errorf("inadequate input parameters. Required url")
+	}
+
+	u, err := url.Parse(wr.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid url: %s", wr.URL)
+	}
+
+	// Deliveries only go to public addresses. Host names are checked again when they are resolved for
+	// a delivery.
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); (ip != nil && !util.PublicIP(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("invalid url: %s, webhooks can only be sent to public addresses", wr.URL)
+	}
+
+	for _, e := range wr.Events {
+		if !util.Contains(WebhookEvents, e) {
+			return fmt.Errorf("unknown event: %s", e)
+		}
+	}
+	return nil
+}
+
+// WebhookDelivery is a payload queued for a webhook. Attempts lists the attempts to send it, and is
+// only filled in when a single delivery is requested.
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int64            `json:"webhook_id"`
+	Event          string           `json:"event"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	AttemptCount   int              `json:"attempt_count"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"`
+	CreatedAt      *time.Time       `json:"created_at"`
+	Attempts       []WebhookAttempt `json:"attempts,omitempty"`
+}
+
+// WebhookAttempt is one attempt to send a delivery. StatusCode is zero if no response was received.
+type WebhookAttempt struct {
+	StatusCode int        `json:"status_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	DurationMS int64      `json:"duration_ms"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+}
+
+const (
+	SyncUpsert = "upsert"
+	SyncDelete = "delete"
+
+	MaxSyncMutations = 100
+	MaxClientUIDLen  = 64
+)
+
+// SyncChange is a change of a todo since a sync token: its current state for upserts, or a tombstone
+// with only the id for deletions.
+type SyncChange struct {
+	Op        string        `json:"op"`
+	ID        int64         `json:"id"`
+	ClientUID string        `json:"client_uid,omitempty"`
+	Todo      *TodoResponse `json:"todo,omitempty"`
+}
+
+// SyncResponse is a page of changes. Token is passed as since to get the next page, or the changes
+// made later. HasMore tells that the next page can be fetched right away.
+type SyncResponse struct {
+	Changes []SyncChange `json:"changes"`
+	Token   string       `json:"token"`
+	HasMore bool         `json:"has_more"`
+}
+
+// SyncMutation is a change a client made offline. It addresses the todo by its id or by the id the
+// client generated when it created the todo. Fields holds only the changed fields of an upsert; null
+// clears project_id and due_at, and an empty string clears recurrence. Base is the sync token the
+// client had when it made the change, and is needed to detect conflicts.
+type SyncMutation struct {
+	Op        string                     `json:"op"`
+	ID        int64                      `json:"id,omitempty"`
+	ClientUID string                     `json:"client_uid,omitempty"`
+	Base      string                     `json:"base,omitempty"`
+	Fields    map[string]json.RawMessage `json:"fields,omitempty"`
+}
+
+func (sm *SyncMutation) Validate() error {
+	if sm.Op != SyncUpsert && sm.Op != SyncDelete {
+		return fmt.Errorf("unknown op value: %s", sm.Op)
+	}
+	if sm.ID == 0 && sm.ClientUID == "" {
+		return fmt.Errorf("inadequate input parameters. Required id or client_uid")
+	}
+	if len(sm.ClientUID) > MaxClientUIDLen {
+		return fmt.Errorf("client_uid is longer than %d characters", MaxClientUIDLen)
+	}
+	if sm.Op == SyncUpsert && len(sm.Fields) == 0 {
+		return fmt.Errorf("inadequate input parameters. Required fields")
+	}
+	_, err := sm.Values()
+	return err
+}
+
+// Values decodes the fields into the form the activity log uses: project_id is an int64 and due_at an
+// RFC 3339 string in UTC, or nil when cleared.
+func (sm *SyncMutation) Values() (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(sm.Fields))
+
+	for field, raw := range sm.Fields {
+		var err error
+
+		switch field {
+		case "task":
+			var v string
+			if err = json.Unmarshal(raw, &v); err == nil && v == "" {
+				err = fmt.Errorf("empty task")
+			}
+			values[field] = v
+		case "done":
+			var v bool
+			err = json.Unmarshal(raw, &v)
+			values[field] = v
+		case "category":
+			var v string
+			err = json.Unmarshal(raw, &v)
+			values[field] = strings.ToLower(v)
+		case "priority":
+			var v string
+			if err = json.Unmarshal(raw, &v); err == nil && !util.Contains([]string{"low", "medium", "high"}, strings.ToLower(v)) {
+				err = fmt.Errorf("unknown priority value: %s", v)
+			}
+			values[field] = strings.ToLower(v)
+		case "project_id":
+			var v *int64
+			if err = json.Unmarshal(raw, &v); err == nil && v != nil && *v <= 0 {
+				err = fmt.Errorf("invalid project id given %d", *v)
+			}
+			values[field] = nil
+			if v != nil {
+				values[field] = *v
+			}
+		case "recurrence":
+			var v string
+			err = json.Unmarshal(raw, &v)
+			values[field] = nil
+			if v != "" {
+				values[field] = v
+			}
+		case "due_at":
+			var v *time.Time
+			err = json.Unmarshal(raw, &v)
+			values[field] = nil
+			if v != nil {
+				values[field] = v.UTC().Truncate(time.Second).Format(time.RFC3339)
+			}
+		default:
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", field, err)
+		}
+	}
+	return values, nil
+}
+
+type SyncRequest struct {
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+func (sr SyncRequest) Validate() error {
+	if len(sr.Mutations) == 0 {
+		return fmt.Errorf("inadequate input parameters. Required mutations")
+	}
+	if len(sr.Mutations) > MaxSyncMutations {
+		return fmt.Errorf("too many mutations, at most %d are allowed", MaxSyncMutations)
+	}
+	return nil
+}
+
+// Winners of sync conflicts.
+const (
+	SyncClientWins = "client"
+	SyncServerWins = "server"
+)
+
+// SyncConflict is a field that was changed both by the client and on the server since the client's base.
+// Server is the server's value and Client the client's, which is nil for deletions.
+type SyncConflict struct {
+	Field  string      `json:"field"`
+	Server interface{} `json:"server"`
+	Client interface{} `json:"client"`
+	Winner string      `json:"winner"`
+}
+
+// SyncResult is the outcome of one mutation, in the order of the request.
+type SyncResult struct {
+	ID        int64          `json:"id,omitempty"`
+	ClientUID string         `json:"client_uid,omitempty"`
+	Status    int            `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+}
+
+type SyncPushResponse struct {
+	Results []SyncResult `json:"results"`
+}
+
+// Feed is a calendar feed of the caller's todos. URL holds the secret token and is only returned when the
+// feed is created or rotated.
+type Feed struct {
+	URL        string     `json:"url,omitempty"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+const MaxPersonalTokenDays = 366
+
+// PersonalToken is a token that apps which can't sign in, such as CalDAV clients, use as password. The
+// token itself is only returned when it is created.
+type PersonalToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// PersonalTokenRequest creates a token. Tokens without ExpiresInDays don't expire.
+type PersonalTokenRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty"`
+}
+
+func (pr PersonalTokenRequest) Validate() error {
+	if pr.Name == "" {
+		return fmt.Errorf("inadequate input parameters. Required name")
+	}
+	if len(pr.Name) > 64 {
+		return fmt.Errorf("name is longer than 64 characters")
+	}
+	if pr.ExpiresInDays < 0 || pr.ExpiresInDays > MaxPersonalTokenDays {
+		return fmt.Errorf("expires_in_days must be between 0 and %d", MaxPersonalTokenDays)
+	}
+	return nil
+}
+
+type RoleChange struct {
+	Role string `json:"role"`
+}
+
+func (rc RoleChange) Validate() error {
+	if !util.Contains(Roles, rc.Role) {
+		return fmt.Errorf("unknown role value: %s", rc.Role)
+	}
+	return nil
+}
+
+type TodoCounts struct {
+	Total      int            `json:"total"`
+	Open       int            `json:"open"`
+	Done       int            `json:"done"`
+	ByCategory map[string]int `json:"by_category"`
+	ByPriority map[string]int `json:"by_priority"`
+}
+
+type AdminAction struct {
+	ID           int64      `json:"id"`
+	ActorID      int64      `json:"actor_id"`
+	ActorEmail   string     `json:"actor_email"`
+	Action       string     `json:"action"`
+	TargetUserID *int64     `json:"target_user_id,omitempty"`
+	Detail       string     `json:"detail,omitempty"`
+	Outcome      string     `json:"outcome"`
+	IP           string     `json:"ip"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// Outcomes of admin actions. Denied actions were refused for lack of a role, failed ones by an error.
+const (
+	AdminSucceeded = "succeeded"
+	AdminDenied    = "denied"
+	AdminFailed    = "failed"
+)
+
+type UnlockRequest struct {
+	Email string `json:"email,omitempty"`
+	IP    string `json:"ip,omitempty"`
+}
+
+func (ur UnlockRequest) Validate() error {
+	if ur.Email == "" && ur.IP == "" {
+		return fmt.Errorf("inadequate input parameters. Required email or ip")
+	}
+	return nil
+}
+
 type MsgResp struct {
 	Message string `json:"message"`
 }
@@ -84,4 +1073,19 @@ type Token struct {
 	Type      string `json:"type"`
 	ExpiresIn int    `json:"expires_in"`
 	JWTToken  string `json:"jwt_token"`
+
+	// RefreshToken is exchanged for a new token at /v1/token/refresh before or after this one expires.
+	// It works once; the response holds the next one.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (rr RefreshRequest) Validate() error {
+	if rr.RefreshToken == "" {
+		return fmt.Errorf("inadequate input parameters. Required refresh_token")
+	}
+	return nil
 }
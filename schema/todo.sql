@@ -25,8 +25,57 @@ CREATE TABLE IF NOT EXISTS `mydb`.`user` (
   `email` VARCHAR(255) NOT NULL,
   `user_name` VARCHAR(255) NOT NULL,
   `password` VARCHAR(255) NOT NULL,
+  `role` ENUM('user', 'support', 'admin') NOT NULL DEFAULT 'user',
+  `pending_email` VARCHAR(255) NULL,
+  `email_token` CHAR(64) NULL,
+  `email_token_expires_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  `delete_after` TIMESTAMP NULL,
+  `disabled_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_email` (`email` ASC),
+  UNIQUE INDEX `uq_email_token` (`email_token` ASC),
+  INDEX `idx_delete_after` (`delete_after` ASC))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`session`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`session` (
+  `id` CHAR(36) NOT NULL,
+  `user_id` INT NOT NULL,
+  `org_id` INT NOT NULL DEFAULT 0,
+  `refresh_hash` CHAR(64) NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` TIMESTAMP NOT NULL,
+  `revoked_at` TIMESTAMP NULL,
   PRIMARY KEY (`id`),
-  UNIQUE INDEX `uq_email` (`email` ASC))
+  UNIQUE INDEX `uq_refresh_hash` (`refresh_hash` ASC),
+  INDEX `fk_session_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_session_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`used_refresh_token`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`used_refresh_token` (
+  `refresh_hash` CHAR(64) NOT NULL,
+  `session_id` CHAR(36) NOT NULL,
+  `used_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`refresh_hash`),
+  INDEX `fk_used_refresh_token_session_id_idx` (`session_id` ASC),
+  CONSTRAINT `fk_used_refresh_token_session_id`
+    FOREIGN KEY (`session_id`)
+    REFERENCES `mydb`.`session` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
 ENGINE = InnoDB;
 
 
@@ -35,24 +84,586 @@ ENGINE = InnoDB;
 -- -----------------------------------------------------
 CREATE TABLE IF NOT EXISTS `mydb`.`todo` (
   `id` INT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
   `user_id` INT NOT NULL,
+  `project_id` INT NULL,
   `task` VARCHAR(255) NOT NULL,
+  `due_at` TIMESTAMP NULL,
   `done` TINYINT NOT NULL DEFAULT 0,
-  `category` ENUM('work', 'home') NOT NULL DEFAULT 'work',
+  `category` VARCHAR(64) NOT NULL DEFAULT 'work',
   `priority` ENUM('low', 'medium', 'high') NOT NULL DEFAULT 'low',
   `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `completed_at` TIMESTAMP NULL,
+  `revision` INT NOT NULL DEFAULT 1,
+  `deleted_at` TIMESTAMP NULL,
+  `position` VARCHAR(255) CHARACTER SET 'ascii' COLLATE 'ascii_bin' NOT NULL DEFAULT '',
+  `live` TINYINT GENERATED ALWAYS AS (IF(`deleted_at` IS NULL, 1, NULL)) VIRTUAL,
+  `client_uid` VARCHAR(64) NULL,
+  `recurrence` VARCHAR(255) NOT NULL DEFAULT '',
   PRIMARY KEY (`id`),
   INDEX `fk_user_id_idx` (`user_id` ASC),
-  UNIQUE INDEX `uq_user_id_task` (`user_id` ASC, `task` ASC),
+  INDEX `fk_todo_project_id_idx` (`project_id` ASC),
+  INDEX `idx_deleted_at` (`deleted_at` ASC),
+  INDEX `idx_due_at` (`due_at` ASC),
+  INDEX `idx_list_position` (`org_id` ASC, `user_id` ASC, `project_id` ASC, `position` ASC),
+  FULLTEXT INDEX `ft_task` (`task`),
+  UNIQUE INDEX `uq_org_id_user_id_task` (`org_id` ASC, `user_id` ASC, `task` ASC, `live` ASC),
+  UNIQUE INDEX `uq_org_id_user_id_client_uid` (`org_id` ASC, `user_id` ASC, `client_uid` ASC),
   CONSTRAINT `fk_user_id`
     FOREIGN KEY (`user_id`)
     REFERENCES `mydb`.`user` (`id`)
     ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_todo_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_todo_project_id`
+    FOREIGN KEY (`project_id`)
+    REFERENCES `mydb`.`project` (`id`)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`login_attempt`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`login_attempt` (
+  `attempt_key` VARCHAR(300) NOT NULL,
+  `failures` INT NOT NULL DEFAULT 0,
+  `last_failure_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `blocked_until` TIMESTAMP NULL,
+  PRIMARY KEY (`attempt_key`))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`auth_event`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`auth_event` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `event` VARCHAR(32) NOT NULL,
+  `subject` VARCHAR(300) NOT NULL,
+  `ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_subject` (`subject` ASC))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`mfa`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`mfa` (
+  `user_id` INT NOT NULL,
+  `secret` VARCHAR(255) NOT NULL,
+  `enabled` TINYINT NOT NULL DEFAULT 0,
+  `last_step` BIGINT NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `enabled_at` TIMESTAMP NULL,
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `fk_mfa_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`mfa_recovery_code`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`mfa_recovery_code` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `code_hash` CHAR(64) NOT NULL,
+  `used_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_user_id_code_hash` (`user_id` ASC, `code_hash` ASC),
+  CONSTRAINT `fk_mfa_recovery_code_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`user_identity`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`user_identity` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `provider` VARCHAR(64) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `email` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_provider_subject` (`provider` ASC, `subject` ASC),
+  INDEX `fk_user_identity_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_user_identity_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`oidc_state`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`oidc_state` (
+  `state` VARCHAR(64) NOT NULL,
+  `provider` VARCHAR(64) NOT NULL,
+  `nonce` VARCHAR(64) NOT NULL,
+  `verifier` VARCHAR(128) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`state`))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`oauth_client`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`oauth_client` (
+  `id` CHAR(36) NOT NULL,
+  `secret_hash` CHAR(64) NOT NULL DEFAULT '',
+  `name` VARCHAR(255) NOT NULL,
+  `redirect_uris` TEXT NOT NULL,
+  `owner_id` INT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_oauth_client_owner_id_idx` (`owner_id` ASC),
+  CONSTRAINT `fk_oauth_client_owner_id`
+    FOREIGN KEY (`owner_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`oauth_code`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`oauth_code` (
+  `code_hash` CHAR(64) NOT NULL,
+  `client_id` CHAR(36) NOT NULL,
+  `user_id` INT NOT NULL,
+  `org_id` INT NOT NULL,
+  `redirect_uri` VARCHAR(1024) NOT NULL,
+  `scope` VARCHAR(255) NOT NULL,
+  `challenge` VARCHAR(128) NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`code_hash`),
+  CONSTRAINT `fk_oauth_code_client_id`
+    FOREIGN KEY (`client_id`)
+    REFERENCES `mydb`.`oauth_client` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_oauth_code_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`oauth_grant`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`oauth_grant` (
+  `user_id` INT NOT NULL,
+  `client_id` CHAR(36) NOT NULL,
+  `scope` VARCHAR(255) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`user_id`, `client_id`),
+  CONSTRAINT `fk_oauth_grant_client_id`
+    FOREIGN KEY (`client_id`)
+    REFERENCES `mydb`.`oauth_client` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_oauth_grant_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`oauth_token`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`oauth_token` (
+  `id` CHAR(36) NOT NULL,
+  `client_id` CHAR(36) NOT NULL,
+  `user_id` INT NOT NULL,
+  `org_id` INT NOT NULL,
+  `scope` VARCHAR(255) NOT NULL,
+  `issued_at` TIMESTAMP NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `revoked_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_id_client_id` (`user_id` ASC, `client_id` ASC),
+  CONSTRAINT `fk_oauth_token_client_id`
+    FOREIGN KEY (`client_id`)
+    REFERENCES `mydb`.`oauth_client` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_oauth_token_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`admin_audit`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`admin_audit` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `actor_id` INT NOT NULL,
+  `actor_email` VARCHAR(255) NOT NULL,
+  `action` VARCHAR(64) NOT NULL,
+  `target_user_id` INT NULL,
+  `detail` VARCHAR(1024) NOT NULL DEFAULT '',
+  `outcome` VARCHAR(16) NOT NULL DEFAULT 'succeeded',
+  `ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_target_user_id` (`target_user_id` ASC))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`organization`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`organization` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(255) NOT NULL,
+  `settings` TEXT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`org_member`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`org_member` (
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `role` ENUM('member', 'admin', 'owner') NOT NULL DEFAULT 'member',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`org_id`, `user_id`),
+  INDEX `fk_org_member_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_org_member_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_org_member_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`org_invitation`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`org_invitation` (
+  `token_hash` CHAR(64) NOT NULL,
+  `org_id` INT NOT NULL,
+  `email` VARCHAR(255) NOT NULL DEFAULT '',
+  `role` ENUM('member', 'admin') NOT NULL DEFAULT 'member',
+  `invited_by` INT NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`token_hash`),
+  INDEX `fk_org_invitation_org_id_idx` (`org_id` ASC),
+  CONSTRAINT `fk_org_invitation_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_org_invitation_invited_by`
+    FOREIGN KEY (`invited_by`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`project`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`project` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
+  `name` VARCHAR(255) NOT NULL,
+  `created_by` INT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_org_id_name` (`org_id` ASC, `name` ASC),
+  CONSTRAINT `fk_project_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`todo_activity`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`todo_activity` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `todo_id` INT NOT NULL,
+  `actor_id` INT NOT NULL,
+  `client_id` VARCHAR(36) NOT NULL DEFAULT '',
+  `action` ENUM('create', 'update', 'delete', 'restore', 'purge') NOT NULL,
+  `changes` TEXT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_org_id_user_id` (`org_id` ASC, `user_id` ASC, `id` ASC),
+  INDEX `idx_todo_id` (`todo_id` ASC, `id` ASC),
+  CONSTRAINT `fk_todo_activity_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_todo_activity_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`idempotency_key`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`idempotency_key` (
+  `user_id` INT NOT NULL,
+  `org_id` INT NOT NULL DEFAULT 0,
+  `idempotency_key` VARCHAR(255) NOT NULL,
+  `fingerprint` CHAR(64) NOT NULL,
+  `status` INT NOT NULL DEFAULT 0,
+  `content_type` VARCHAR(255) NOT NULL DEFAULT '',
+  `body` MEDIUMBLOB NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`user_id`, `org_id`, `idempotency_key`),
+  INDEX `idx_expires_at` (`expires_at` ASC),
+  CONSTRAINT `fk_idempotency_key_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`view`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`view` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `name` VARCHAR(255) NOT NULL,
+  `query` VARCHAR(512) NOT NULL DEFAULT '',
+  `sort` VARCHAR(64) NOT NULL DEFAULT 'created_desc',
+  `pinned` TINYINT(1) NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_org_id_user_id_name` (`org_id` ASC, `user_id` ASC, `name` ASC),
+  INDEX `fk_view_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_view_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_view_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`webhook`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`webhook` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `secret` VARCHAR(255) NOT NULL,
+  `events` VARCHAR(255) NOT NULL DEFAULT '',
+  `active` TINYINT(1) NOT NULL DEFAULT 1,
+  `failure_count` INT NOT NULL DEFAULT 0,
+  `disabled_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_org_id_user_id` (`org_id` ASC, `user_id` ASC),
+  CONSTRAINT `fk_webhook_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_webhook_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+
+-- -----------------------------------------------------
+-- Table `mydb`.`webhook_delivery`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`webhook_delivery` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `webhook_id` INT NOT NULL,
+  `event` VARCHAR(64) NOT NULL,
+  `payload` MEDIUMBLOB NOT NULL,
+  `status` ENUM('pending', 'succeeded', 'dead') NOT NULL DEFAULT 'pending',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `last_status_code` INT NOT NULL DEFAULT 0,
+  `last_error` VARCHAR(1024) NOT NULL DEFAULT '',
+  `next_attempt_at` TIMESTAMP NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_webhook_delivery_webhook_id_idx` (`webhook_id` ASC),
+  INDEX `idx_status_next_attempt_at` (`status` ASC, `next_attempt_at` ASC),
+  CONSTRAINT `fk_webhook_delivery_webhook_id`
+    FOREIGN KEY (`webhook_id`)
+    REFERENCES `mydb`.`webhook` (`id`)
+    ON DELETE CASCADE
     ON UPDATE NO ACTION)
 ENGINE = InnoDB;
 
 
+-- -----------------------------------------------------
+-- Table `mydb`.`webhook_attempt`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`webhook_attempt` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `delivery_id` INT NOT NULL,
+  `status_code` INT NOT NULL DEFAULT 0,
+  `error` VARCHAR(1024) NOT NULL DEFAULT '',
+  `duration_ms` INT NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `fk_webhook_attempt_delivery_id_idx` (`delivery_id` ASC),
+  CONSTRAINT `fk_webhook_attempt_delivery_id`
+    FOREIGN KEY (`delivery_id`)
+    REFERENCES `mydb`.`webhook_delivery` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`outbox_event`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`outbox_event` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `event_type` VARCHAR(64) NOT NULL,
+  `aggregate_type` VARCHAR(32) NOT NULL,
+  `aggregate_id` INT NOT NULL,
+  `payload` TEXT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `published_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  INDEX `outbox_event_published_at_idx` (`published_at` ASC, `id` ASC))
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`calendar_feed`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`calendar_feed` (
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_used_at` TIMESTAMP NULL,
+  PRIMARY KEY (`org_id`, `user_id`),
+  UNIQUE INDEX `uq_token_hash` (`token_hash` ASC),
+  INDEX `fk_calendar_feed_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_calendar_feed_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_calendar_feed_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`personal_token`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`personal_token` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `user_id` INT NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_used_at` TIMESTAMP NULL,
+  `expires_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uq_token_hash` (`token_hash` ASC),
+  INDEX `fk_personal_token_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_personal_token_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
+-- -----------------------------------------------------
+-- Table `mydb`.`import_job`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `mydb`.`import_job` (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `org_id` INT NOT NULL,
+  `user_id` INT NOT NULL,
+  `source` VARCHAR(32) NOT NULL,
+  `filename` VARCHAR(255) NOT NULL DEFAULT '',
+  `options` TEXT NOT NULL,
+  `data` MEDIUMBLOB NOT NULL,
+  `status` ENUM('queued', 'running', 'done', 'failed') NOT NULL DEFAULT 'queued',
+  `processed` INT NOT NULL DEFAULT 0,
+  `total` INT NOT NULL DEFAULT 0,
+  `claims` INT NOT NULL DEFAULT 0,
+  `report` MEDIUMTEXT NULL,
+  `error` VARCHAR(1024) NOT NULL DEFAULT '',
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `started_at` TIMESTAMP NULL,
+  `heartbeat_at` TIMESTAMP NULL,
+  `finished_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_org_id_user_id` (`org_id` ASC, `user_id` ASC),
+  INDEX `idx_status` (`status` ASC, `id` ASC),
+  INDEX `idx_finished_at` (`finished_at` ASC),
+  INDEX `fk_import_job_user_id_idx` (`user_id` ASC),
+  CONSTRAINT `fk_import_job_org_id`
+    FOREIGN KEY (`org_id`)
+    REFERENCES `mydb`.`organization` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_import_job_user_id`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `mydb`.`user` (`id`)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION)
+ENGINE = InnoDB;
+
 SET SQL_MODE=@OLD_SQL_MODE;
 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;